@@ -56,6 +56,12 @@ include $(dir)/Rules.mk
 dir := pin/internal/pb
 include $(dir)/Rules.mk
 
+dir := pubsub/pb
+include $(dir)/Rules.mk
+
+dir := blocks/bloom/pb
+include $(dir)/Rules.mk
+
 # -------------------- #
 #   universal rules    #
 # -------------------- #
@@ -15,6 +15,8 @@ import (
 // block Cids. This provides block access-time improvements, allowing
 // to short-cut many searches without query-ing the underlying datastore.
 type arccache struct {
+	counters cacheCounters
+
 	arc        *lru.ARCCache
 	blockstore Blockstore
 
@@ -54,6 +56,7 @@ func (b *arccache) DeleteBlock(k *cid.Cid) error {
 // if ok == true then has respons to question: is it contained
 func (b *arccache) hasCached(k *cid.Cid) (has bool, ok bool) {
 	b.total.Inc()
+	b.counters.request()
 	if k == nil {
 		log.Error("nil cid in arccache")
 		// Return cache invalid so the call to blockstore happens
@@ -64,6 +67,7 @@ func (b *arccache) hasCached(k *cid.Cid) (has bool, ok bool) {
 	h, ok := b.arc.Get(k.KeyString())
 	if ok {
 		b.hits.Inc()
+		b.counters.hit()
 		return h.(bool), true
 	}
 	return false, false
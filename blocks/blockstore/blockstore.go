@@ -99,10 +99,25 @@ func NewBlockstore(d ds.Batching) Blockstore {
 	}
 }
 
+// NewCompressedBlockstore returns a Blockstore like NewBlockstore, which
+// compresses the blocks it writes with the registered codec of the given
+// name. All blockstores read compressed blocks.
+func NewCompressedBlockstore(d ds.Batching, codec string) (Blockstore, error) {
+	c, err := CodecByName(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	bs := NewBlockstore(d).(*blockstore)
+	bs.codec = c
+	return bs, nil
+}
+
 type blockstore struct {
 	datastore ds.Batching
 
 	rehash bool
+	codec  *Codec
 }
 
 func (bs *blockstore) HashOnRead(enabled bool) {
@@ -126,6 +141,10 @@ func (bs *blockstore) Get(k *cid.Cid) (blocks.Block, error) {
 	if !ok {
 		return nil, ErrValueTypeMismatch
 	}
+	bdata, err = decompressBlock(bdata)
+	if err != nil {
+		return nil, err
+	}
 
 	if bs.rehash {
 		rbcid, err := k.Prefix().Sum(bdata)
@@ -150,7 +169,12 @@ func (bs *blockstore) Put(block blocks.Block) error {
 	if err == nil && exists {
 		return nil // already stored.
 	}
-	return bs.datastore.Put(k, block.RawData())
+
+	data, err := bs.storedData(block)
+	if err != nil {
+		return err
+	}
+	return bs.datastore.Put(k, data)
 }
 
 func (bs *blockstore) PutMany(blocks []blocks.Block) error {
@@ -165,7 +189,11 @@ func (bs *blockstore) PutMany(blocks []blocks.Block) error {
 			continue
 		}
 
-		err = t.Put(k, b.RawData())
+		data, err := bs.storedData(b)
+		if err != nil {
+			return err
+		}
+		err = t.Put(k, data)
 		if err != nil {
 			return err
 		}
@@ -173,6 +201,11 @@ func (bs *blockstore) PutMany(blocks []blocks.Block) error {
 	return t.Commit()
 }
 
+// storedData returns the data of b as written to the datastore.
+func (bs *blockstore) storedData(b blocks.Block) ([]byte, error) {
+	return compressBlock(bs.codec, b.RawData())
+}
+
 func (bs *blockstore) Has(k *cid.Cid) (bool, error) {
 	return bs.datastore.Has(dshelp.CidToDsKey(k))
 }
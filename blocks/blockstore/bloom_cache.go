@@ -1,33 +1,83 @@
 package blockstore
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	pb "github.com/scroot/go-ipfs/blocks/bloom/pb"
 	"gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
 
 	"gx/ipfs/QmRg1gKTHzc3CZXSKzem8aR4E3TubFhbgXwfVuWnSK5CC5/go-metrics-interface"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
 	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
 	bloom "gx/ipfs/QmeiMCBkYHxkDkDfnDadzz4YxY5ruL5Pj499essE4vRsGM/bbloom"
 )
 
+// BloomFilterKey is the key under which the bloom filter of a blockstore is
+// saved when it is closed.
+var BloomFilterKey = ds.NewKey("/local/blockstore/bloom")
+
+// bloomBitsPerBlock is the number of bits per block of the bloom filters
+// sized from the number of blocks, giving a false positive rate of about 1%
+// with 7 hash functions. Twice as many bits are allocated, for the
+// blockstore to grow.
+const bloomBitsPerBlock = 10
+
+// minBloomSize is the size in bits of the smallest bloom filter sized from
+// the number of blocks.
+const minBloomSize = 4 << 20
+
+type bloomOpts struct {
+	// size is the size of the filter in bits, it is sized from the number
+	// of blocks when 0.
+	size      int
+	hashCount int
+
+	// store is where the filter is saved, when set.
+	store ds.Datastore
+}
+
 // bloomCached returns a Blockstore that caches Has requests using a Bloom
 // filter. bloomSize is size of bloom filter in bytes. hashCount specifies the
 // number of hashing functions in the bloom filter (usually known as k).
 func bloomCached(ctx context.Context, bs Blockstore, bloomSize, hashCount int) (*bloomcache, error) {
-	bl, err := bloom.New(float64(bloomSize), float64(hashCount))
-	if err != nil {
-		return nil, err
+	return newBloomCache(ctx, bs, bloomOpts{size: bloomSize, hashCount: hashCount})
+}
+
+// newBloomCache returns a bloomcache which loads its filter from
+// opts.store, unless it is missing or doesn't match the options, in which
+// case it is rebuilt.
+func newBloomCache(ctx context.Context, bs Blockstore, opts bloomOpts) (*bloomcache, error) {
+	if opts.size < 0 {
+		return nil, errors.New("bloom filter size can't be negative")
 	}
-	bc := &bloomcache{blockstore: bs, bloom: bl}
+	bc := &bloomcache{blockstore: bs, opts: opts}
 	bc.hits = metrics.NewCtx(ctx, "bloom.hits_total",
 		"Number of cache hits in bloom cache").Counter()
 	bc.total = metrics.NewCtx(ctx, "bloom_total",
 		"Total number of requests to bloom cache").Counter()
 
 	bc.Invalidate()
-	go bc.Rebuild(ctx)
+	if !bc.load() {
+		if opts.size > 0 {
+			bl, err := bloom.New(float64(opts.size), float64(opts.hashCount))
+			if err != nil {
+				return nil, err
+			}
+			bc.bloom = bl
+			bc.size = uint64(opts.size)
+		}
+		go bc.Rebuild(ctx)
+	}
 	if metrics.Active() {
 		go func() {
 			fill := metrics.NewCtx(ctx, "bloom_fill_ratio",
@@ -50,8 +100,27 @@ func bloomCached(ctx context.Context, bs Blockstore, bloomSize, hashCount int) (
 }
 
 type bloomcache struct {
+	counters cacheCounters
+
 	bloom  *bloom.Bloom
 	active int32
+	opts   bloomOpts
+
+	// size is the size of bloom in bits, and loaded the number of
+	// elements it had when it was loaded
+	size   uint64
+	loaded uint64
+
+	// lk protects bloom and pending, the keys added before a filter sized
+	// from the number of blocks is allocated, until the filter is active
+	lk      sync.Mutex
+	pending [][]byte
+
+	// closeLk is held by the writes and by Close, once closed the writes
+	// delete the saved filter
+	closeLk    sync.RWMutex
+	closed     bool
+	deleteOnce sync.Once
 
 	// This chan is only used for testing to wait for bloom to enable
 	rebuildChan chan struct{}
@@ -75,6 +144,16 @@ func (b *bloomcache) Rebuild(ctx context.Context) {
 	evt := log.EventBegin(ctx, "bloomcache.Rebuild")
 	defer evt.Done()
 
+	b.lk.Lock()
+	sized := b.bloom != nil
+	b.lk.Unlock()
+	if !sized {
+		if err := b.allocate(ctx); err != nil {
+			log.Errorf("failed to size the bloom filter: %v", err)
+			return
+		}
+	}
+
 	ch, err := b.blockstore.AllKeysChan(ctx)
 	if err != nil {
 		log.Errorf("AllKeysChan failed in bloomcache rebuild with: %v", err)
@@ -98,6 +177,195 @@ func (b *bloomcache) Rebuild(ctx context.Context) {
 	atomic.StoreInt32(&b.active, 1)
 }
 
+// allocate sizes the filter from the number of blocks.
+func (b *bloomcache) allocate(ctx context.Context) error {
+	ch, err := b.blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+	var count uint64
+	for range ch {
+		count++
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	size := uint64(minBloomSize)
+	if s := 2 * bloomBitsPerBlock * count; s > size {
+		size = s
+	}
+	bl, err := bloom.New(float64(size), float64(b.opts.hashCount))
+	if err != nil {
+		return err
+	}
+
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	for _, k := range b.pending {
+		bl.AddTS(k)
+	}
+	b.pending = nil
+	b.bloom = bl
+	b.size = size
+	return nil
+}
+
+// add adds a key to the filter, or to the pending keys before it is
+// allocated.
+func (b *bloomcache) add(k *cid.Cid) {
+	if b.BloomActive() {
+		b.bloom.AddTS(k.Bytes())
+		return
+	}
+
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if b.bloom != nil {
+		b.bloom.AddTS(k.Bytes())
+	} else {
+		b.pending = append(b.pending, k.Bytes())
+	}
+}
+
+// load loads the saved filter, and deletes it so that it isn't used once
+// the blockstore changed without it. It returns whether the filter was
+// loaded.
+func (b *bloomcache) load() bool {
+	if b.opts.store == nil {
+		return false
+	}
+
+	v, err := b.opts.store.Get(BloomFilterKey)
+	if err == ds.ErrNotFound {
+		return false
+	}
+	if err != nil {
+		log.Errorf("failed to read the saved bloom filter: %v", err)
+		return false
+	}
+	if err := b.opts.store.Delete(BloomFilterKey); err != nil {
+		log.Errorf("failed to delete the saved bloom filter: %v", err)
+		return false
+	}
+
+	data, ok := v.([]byte)
+	if !ok {
+		log.Warning("rebuilding the bloom filter: the saved filter is not a byte slice")
+		return false
+	}
+	pf, bl, err := b.unpack(data)
+	if err != nil {
+		log.Warningf("rebuilding the bloom filter: %v", err)
+		return false
+	}
+
+	b.bloom = bl
+	b.size = pf.GetSize()
+	b.loaded = pf.GetElements()
+	close(b.rebuildChan)
+	atomic.StoreInt32(&b.active, 1)
+	return true
+}
+
+// unpack validates the saved filter against the options of the cache.
+func (b *bloomcache) unpack(data []byte) (*pb.PackedFilter, *bloom.Bloom, error) {
+	pf := new(pb.PackedFilter)
+	if err := proto.Unmarshal(data, pf); err != nil {
+		return nil, nil, err
+	}
+
+	if h := pf.GetHashes(); len(h) != 1 || h[0] != pb.PackedFilter_BBLOOM {
+		return nil, nil, fmt.Errorf("unknown hash functions %v", h)
+	}
+	if pf.GetHashCount() != uint64(b.opts.hashCount) {
+		return nil, nil, fmt.Errorf("the filter has %d hash functions instead of %d", pf.GetHashCount(), b.opts.hashCount)
+	}
+	if b.opts.size > 0 && pf.GetSize() != uint64(b.opts.size) {
+		return nil, nil, fmt.Errorf("the filter has %d bits instead of %d", pf.GetSize(), b.opts.size)
+	}
+	if b.opts.size == 0 && pf.GetElements()*bloomBitsPerBlock > pf.GetSize() {
+		return nil, nil, fmt.Errorf("the filter is too small for %d blocks", pf.GetElements())
+	}
+	if sum := sha256.Sum256(pf.GetData()); !bytes.Equal(sum[:], pf.GetChecksum()) {
+		return nil, nil, errors.New("the filter is corrupted")
+	}
+
+	data = pf.GetData()
+	if pf.GetCompressed() {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return nil, nil, err
+		}
+	}
+	bl, err := bloom.JSONUnmarshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pf, bl, nil
+}
+
+func (b *bloomcache) pack() ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b.bloom.JSONMarshalTS()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	return proto.Marshal(&pb.PackedFilter{
+		Compressed: proto.Bool(true),
+		Data:       buf.Bytes(),
+		Hashes:     []pb.PackedFilter_HashType{pb.PackedFilter_BBLOOM},
+		Size:       proto.Uint64(b.size),
+		HashCount:  proto.Uint64(uint64(b.opts.hashCount)),
+		Elements:   proto.Uint64(b.loaded + b.bloom.ElementsAdded()),
+		Checksum:   sum[:],
+	})
+}
+
+// Close saves the filter, once it is complete, for the next bloomcache on
+// the same blockstore not to rebuild it. The writes which follow delete it.
+func (b *bloomcache) Close() error {
+	b.closeLk.Lock()
+	defer b.closeLk.Unlock()
+
+	if b.closed || b.opts.store == nil || !b.BloomActive() {
+		return nil
+	}
+	b.closed = true
+
+	data, err := b.pack()
+	if err != nil {
+		return err
+	}
+	return b.opts.store.Put(BloomFilterKey, data)
+}
+
+// writing must be called before writing to the blockstore, and the
+// returned function once done.
+func (b *bloomcache) writing() func() {
+	b.closeLk.RLock()
+	if b.closed {
+		b.deleteOnce.Do(func() {
+			deleteSavedBloom(b.opts.store)
+		})
+	}
+	return b.closeLk.RUnlock
+}
+
+func deleteSavedBloom(d ds.Datastore) {
+	if err := d.Delete(BloomFilterKey); err != nil && err != ds.ErrNotFound {
+		log.Errorf("failed to delete the saved bloom filter: %v", err)
+	}
+}
+
 func (b *bloomcache) DeleteBlock(k *cid.Cid) error {
 	if has, ok := b.hasCached(k); ok && !has {
 		return ErrNotFound
@@ -110,6 +378,7 @@ func (b *bloomcache) DeleteBlock(k *cid.Cid) error {
 // if ok == true then has respons to question: is it contained
 func (b *bloomcache) hasCached(k *cid.Cid) (has bool, ok bool) {
 	b.total.Inc()
+	b.counters.request()
 	if k == nil {
 		log.Error("nil cid in bloom cache")
 		// Return cache invalid so call to blockstore
@@ -120,6 +389,7 @@ func (b *bloomcache) hasCached(k *cid.Cid) (has bool, ok bool) {
 		blr := b.bloom.HasTS(k.Bytes())
 		if !blr { // not contained in bloom is only conclusive answer bloom gives
 			b.hits.Inc()
+			b.counters.hit()
 			return false, true
 		}
 	}
@@ -131,7 +401,11 @@ func (b *bloomcache) Has(k *cid.Cid) (bool, error) {
 		return has, nil
 	}
 
-	return b.blockstore.Has(k)
+	has, err := b.blockstore.Has(k)
+	if err == nil && !has {
+		b.falsePositive()
+	}
+	return has, err
 }
 
 func (b *bloomcache) Get(k *cid.Cid) (blocks.Block, error) {
@@ -139,14 +413,28 @@ func (b *bloomcache) Get(k *cid.Cid) (blocks.Block, error) {
 		return nil, ErrNotFound
 	}
 
-	return b.blockstore.Get(k)
+	bl, err := b.blockstore.Get(k)
+	if err == ErrNotFound {
+		b.falsePositive()
+	}
+	return bl, err
+}
+
+// falsePositive counts a block the bloom filter didn't rule out which
+// wasn't in the blockstore.
+func (b *bloomcache) falsePositive() {
+	if b.BloomActive() {
+		b.counters.falsePositive()
+	}
 }
 
 func (b *bloomcache) Put(bl blocks.Block) error {
+	defer b.writing()()
+
 	// See comment in PutMany
 	err := b.blockstore.Put(bl)
 	if err == nil {
-		b.bloom.AddTS(bl.Cid().Bytes())
+		b.add(bl.Cid())
 	}
 	return err
 }
@@ -156,12 +444,14 @@ func (b *bloomcache) PutMany(bs []blocks.Block) error {
 	// to reduce number of puts we need conclusive information if block is contained
 	// this means that PutMany can't be improved with bloom cache so we just
 	// just do a passthrough.
+	defer b.writing()()
+
 	err := b.blockstore.PutMany(bs)
 	if err != nil {
 		return err
 	}
 	for _, bl := range bs {
-		b.bloom.AddTS(bl.Cid().Bytes())
+		b.add(bl.Cid())
 	}
 	return nil
 }
@@ -185,3 +475,28 @@ func (b *bloomcache) PinLock() Unlocker {
 func (b *bloomcache) GCRequested() bool {
 	return b.blockstore.(GCBlockstore).GCRequested()
 }
+
+// bloomInvalidator deletes the saved bloom filter of a blockstore used
+// without it before the first write, as the filter would miss the blocks.
+type bloomInvalidator struct {
+	Blockstore
+
+	store ds.Datastore
+	once  sync.Once
+}
+
+func (b *bloomInvalidator) invalidate() {
+	b.once.Do(func() {
+		deleteSavedBloom(b.store)
+	})
+}
+
+func (b *bloomInvalidator) Put(bl blocks.Block) error {
+	b.invalidate()
+	return b.Blockstore.Put(bl)
+}
+
+func (b *bloomInvalidator) PutMany(bs []blocks.Block) error {
+	b.invalidate()
+	return b.Blockstore.PutMany(bs)
+}
@@ -132,6 +132,206 @@ func TestHasIsBloomCached(t *testing.T) {
 	}
 }
 
+func waitBloom(t *testing.T, b *bloomcache) {
+	select {
+	case <-b.rebuildChan:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the bloom filter")
+	}
+}
+
+func testBloomStore(t *testing.T, n int) (ds.Datastore, Blockstore, []blocks.Block) {
+	d := syncds.MutexWrap(ds.NewMapDatastore())
+	bs := NewBlockstore(d)
+	var bl []blocks.Block
+	for i := 0; i < n; i++ {
+		b := blocks.NewBlock([]byte(fmt.Sprintf("data: %d", i)))
+		if err := bs.Put(b); err != nil {
+			t.Fatal(err)
+		}
+		bl = append(bl, b)
+	}
+	return d, bs, bl
+}
+
+func TestBloomFilterSaved(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, bs, bl := testBloomStore(t, 100)
+	opts := bloomOpts{size: 1 << 16, hashCount: 7, store: d}
+	bc, err := newBloomCache(ctx, bs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitBloom(t, bc)
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := d.Has(BloomFilterKey); !has {
+		t.Fatal("the bloom filter wasn't saved")
+	}
+
+	bc, err = newBloomCache(ctx, bs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bc.BloomActive() {
+		t.Fatal("expected the saved bloom filter to be loaded")
+	}
+	if has, _ := d.Has(BloomFilterKey); has {
+		t.Fatal("the saved bloom filter wasn't deleted once loaded")
+	}
+	for _, b := range bl {
+		if !bc.bloom.HasTS(b.Cid().Bytes()) {
+			t.Fatalf("the loaded bloom filter misses %s", b.Cid())
+		}
+	}
+	if _, ok := bc.hasCached(blocks.NewBlock([]byte("missing")).Cid()); !ok {
+		t.Fatal("expected the loaded bloom filter to rule a missing block out")
+	}
+
+	// the elements of the loaded filter are counted when saving it again
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	pf, _, err := bc.unpack(getBytes(t, d, BloomFilterKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pf.GetElements() != uint64(len(bl)) {
+		t.Fatalf("expected %d elements, got %d", len(bl), pf.GetElements())
+	}
+}
+
+func getBytes(t *testing.T, d ds.Datastore, k ds.Key) []byte {
+	v, err := d.Get(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.([]byte)
+}
+
+func TestBloomFilterSavedInvalid(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, bs, _ := testBloomStore(t, 10)
+	save := func() []byte {
+		bc, err := newBloomCache(ctx, bs, bloomOpts{size: 1 << 16, hashCount: 7, store: d})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitBloom(t, bc)
+		if err := bc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return getBytes(t, d, BloomFilterKey)
+	}
+
+	data := save()
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	for i, c := range []struct {
+		data []byte
+		opts bloomOpts
+	}{
+		{data, bloomOpts{size: 1 << 17, hashCount: 7}},
+		{data, bloomOpts{size: 1 << 16, hashCount: 5}},
+		{corrupted, bloomOpts{size: 1 << 16, hashCount: 7}},
+		{[]byte("not a filter"), bloomOpts{size: 1 << 16, hashCount: 7}},
+	} {
+		if err := d.Put(BloomFilterKey, c.data); err != nil {
+			t.Fatal(err)
+		}
+		c.opts.store = d
+		bc, err := newBloomCache(ctx, bs, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// rebuilt instead
+		waitBloom(t, bc)
+		if bc.size != uint64(c.opts.size) {
+			t.Fatalf("%d: expected a filter of %d bits, got %d", i, c.opts.size, bc.size)
+		}
+		if has, _ := d.Has(BloomFilterKey); has {
+			t.Fatalf("%d: the invalid bloom filter wasn't deleted", i)
+		}
+	}
+}
+
+func TestBloomFilterInvalidatedByWrites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d, bs, _ := testBloomStore(t, 10)
+	bc, err := newBloomCache(ctx, bs, bloomOpts{size: 1 << 16, hashCount: 7, store: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitBloom(t, bc)
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Put(blocks.NewBlock([]byte("after close"))); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := d.Has(BloomFilterKey); has {
+		t.Fatal("the saved bloom filter wasn't deleted by a write")
+	}
+
+	// nor used by a blockstore without bloom filter
+	if err := d.Put(BloomFilterKey, []byte("saved")); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultCacheOpts()
+	opts.HasBloomFilterSize = 0
+	opts.BloomFilterStore = d
+	cbs, err := CachedBlockstore(ctx, bs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := d.Has(BloomFilterKey); !has {
+		t.Fatal("the saved bloom filter was deleted before any write")
+	}
+	if err := cbs.PutMany([]blocks.Block{blocks.NewBlock([]byte("without filter"))}); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := d.Has(BloomFilterKey); has {
+		t.Fatal("the saved bloom filter wasn't deleted by a write")
+	}
+}
+
+func TestBloomFilterAutoSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, bs, bl := testBloomStore(t, 1000)
+	opts := DefaultCacheOpts()
+	opts.HasARCCacheSize = 0
+	opts.HasBloomFilterAutoSize = true
+	cbs, err := CachedBlockstore(ctx, bs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := cbs.(*bloomcache)
+
+	// written while the filter is sized
+	added := blocks.NewBlock([]byte("added"))
+	if err := bc.Put(added); err != nil {
+		t.Fatal(err)
+	}
+	waitBloom(t, bc)
+	if bc.size != minBloomSize {
+		t.Fatalf("expected a filter of %d bits, got %d", minBloomSize, bc.size)
+	}
+	for _, b := range append(bl, added) {
+		if has, err := bc.Has(b.Cid()); err != nil || !has {
+			t.Fatalf("block %s reported missing", b.Cid())
+		}
+	}
+}
+
 type callbackDatastore struct {
 	sync.Mutex
 	f  func()
@@ -5,6 +5,7 @@ import (
 
 	context "context"
 	"gx/ipfs/QmRg1gKTHzc3CZXSKzem8aR4E3TubFhbgXwfVuWnSK5CC5/go-metrics-interface"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
 )
 
 // CacheOpts wraps options for CachedBlockStore().
@@ -13,6 +14,15 @@ type CacheOpts struct {
 	HasBloomFilterSize   int // 1 byte
 	HasBloomFilterHashes int // No size, 7 is usually best, consult bloom papers
 	HasARCCacheSize      int // 32 bytes
+
+	// HasBloomFilterAutoSize sizes the bloom filter from the number of
+	// blocks instead of HasBloomFilterSize, at 20 bits per block.
+	HasBloomFilterAutoSize bool
+
+	// BloomFilterStore is where the bloom filter is saved on Close, and
+	// loaded from instead of being rebuilt. The writes of a blockstore
+	// without bloom filter delete it.
+	BloomFilterStore ds.Datastore
 }
 
 // DefaultCacheOpts returns a CacheOpts initialized with default values.
@@ -37,7 +47,8 @@ func CachedBlockstore(
 		return nil, errors.New("all options for cache need to be greater than zero")
 	}
 
-	if opts.HasBloomFilterSize != 0 && opts.HasBloomFilterHashes == 0 {
+	bloomEnabled := opts.HasBloomFilterSize != 0 || opts.HasBloomFilterAutoSize
+	if bloomEnabled && opts.HasBloomFilterHashes == 0 {
 		return nil, errors.New("bloom filter hash count can't be 0 when there is size set")
 	}
 
@@ -46,9 +57,19 @@ func CachedBlockstore(
 	if opts.HasARCCacheSize > 0 {
 		cbs, err = newARCCachedBS(ctx, cbs, opts.HasARCCacheSize)
 	}
-	if opts.HasBloomFilterSize != 0 {
-		// *8 because of bytes to bits conversion
-		cbs, err = bloomCached(ctx, cbs, opts.HasBloomFilterSize*8, opts.HasBloomFilterHashes)
+	if bloomEnabled {
+		bopts := bloomOpts{
+			// *8 because of bytes to bits conversion
+			size:      opts.HasBloomFilterSize * 8,
+			hashCount: opts.HasBloomFilterHashes,
+			store:     opts.BloomFilterStore,
+		}
+		if opts.HasBloomFilterAutoSize {
+			bopts.size = 0
+		}
+		cbs, err = newBloomCache(ctx, cbs, bopts)
+	} else if opts.BloomFilterStore != nil {
+		cbs = &bloomInvalidator{Blockstore: cbs, store: opts.BloomFilterStore}
 	}
 
 	return cbs, err
@@ -0,0 +1,244 @@
+package blockstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsns "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/namespace"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+// Codec compresses the blocks written to a blockstore. The CIDs of the
+// blocks are always computed over their uncompressed data.
+type Codec struct {
+	// ID identifies the codec in the stored blocks, it mustn't change once
+	// blocks were written with it.
+	ID byte
+
+	// Name is the name of the codec in the config.
+	Name string
+
+	Compress   func(data []byte) ([]byte, error)
+	Decompress func(data []byte, size int) ([]byte, error)
+}
+
+// compressedMagic starts the stored blocks written by a compressing
+// blockstore, followed by the ID of the codec, the uncompressed size of the
+// block as a uvarint and the compressed data.
+//
+// Blocks which aren't compressed are stored as is, unless they start with
+// compressedMagic, in which case they are stored with the codec noCodecID.
+// Any blockstore reads both, so the compression of a repo can change at any
+// time. Only the blocks starting with a valid header, stored as is before
+// blockstores knew about compression, are misread.
+var compressedMagic = []byte{0x00, 'c', 'z'}
+
+const noCodecID byte = 0
+
+var (
+	codecsLk sync.RWMutex
+	codecs   = make(map[string]*Codec)
+	codecIDs = make(map[byte]*Codec)
+)
+
+// RegisterCodec makes a codec available to compressing blockstores. It is
+// meant to be called from init functions, and panics if the name or ID of
+// the codec is taken.
+func RegisterCodec(c *Codec) {
+	codecsLk.Lock()
+	defer codecsLk.Unlock()
+
+	if c.ID == noCodecID {
+		panic(fmt.Sprintf("codec %s uses the reserved id %d", c.Name, noCodecID))
+	}
+	if _, ok := codecs[c.Name]; ok {
+		panic(fmt.Sprintf("codec %s registered twice", c.Name))
+	}
+	if _, ok := codecIDs[c.ID]; ok {
+		panic(fmt.Sprintf("codec id %d registered twice", c.ID))
+	}
+	codecs[c.Name] = c
+	codecIDs[c.ID] = c
+}
+
+// CodecByName returns the registered codec with the given name.
+func CodecByName(name string) (*Codec, error) {
+	codecsLk.RLock()
+	defer codecsLk.RUnlock()
+
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown block compression %q", name)
+	}
+	return c, nil
+}
+
+func codecByID(id byte) *Codec {
+	codecsLk.RLock()
+	defer codecsLk.RUnlock()
+	return codecIDs[id]
+}
+
+func init() {
+	RegisterCodec(&Codec{
+		ID:         1,
+		Name:       "gzip",
+		Compress:   gzipCompress,
+		Decompress: gzipDecompress,
+	})
+}
+
+func gzipCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipDecompress(data []byte, size int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, size)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, err
+	}
+	// the stream must end with the block, reading its end checks the
+	// checksum of the data
+	n, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, fmt.Errorf("gzip stream longer than the block")
+	}
+	return out, r.Close()
+}
+
+// maxCompressedBlockSize is the size above which blocks aren't compressed,
+// bounding the memory decompressing a corrupted block can take.
+const maxCompressedBlockSize = 64 << 20
+
+// compressBlock returns the data of a block as stored with codec, which is
+// nil when the blockstore doesn't compress.
+func compressBlock(c *Codec, data []byte) ([]byte, error) {
+	id, z := noCodecID, data
+	if c != nil && len(data) <= maxCompressedBlockSize {
+		cz, err := c.Compress(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressedMagic)+1+binary.MaxVarintLen64+len(cz) < len(data) {
+			id, z = c.ID, cz
+		}
+	}
+	if id == noCodecID && !bytes.HasPrefix(data, compressedMagic) {
+		return data, nil
+	}
+
+	hdr := make([]byte, len(compressedMagic)+1+binary.MaxVarintLen64, len(compressedMagic)+1+binary.MaxVarintLen64+len(z))
+	copy(hdr, compressedMagic)
+	hdr[len(compressedMagic)] = id
+	n := len(compressedMagic) + 1
+	n += binary.PutUvarint(hdr[n:], uint64(len(data)))
+
+	return append(hdr[:n], z...), nil
+}
+
+// parseStoredBlock parses the header of the stored block v, returning the
+// codec, the uncompressed size and the data of the block. ok is false for
+// blocks stored as is.
+func parseStoredBlock(v []byte) (c *Codec, size uint64, data []byte, ok bool) {
+	if !bytes.HasPrefix(v, compressedMagic) || len(v) == len(compressedMagic) {
+		return nil, 0, nil, false
+	}
+
+	id := v[len(compressedMagic)]
+	size, n := binary.Uvarint(v[len(compressedMagic)+1:])
+	if n <= 0 {
+		return nil, 0, nil, false
+	}
+	data = v[len(compressedMagic)+1+n:]
+
+	if id == noCodecID {
+		return nil, size, data, uint64(len(data)) == size
+	}
+	c = codecByID(id)
+	return c, size, data, c != nil && size <= maxCompressedBlockSize
+}
+
+// decompressBlock returns the data of the stored block v. Stored blocks
+// whose header doesn't decode are returned as is, the ones whose data
+// doesn't decompress are corrupt and fail with ErrHashMismatch.
+func decompressBlock(v []byte) ([]byte, error) {
+	c, size, data, ok := parseStoredBlock(v)
+	if !ok {
+		return v, nil
+	}
+	if c == nil {
+		return data, nil
+	}
+
+	out, err := c.Decompress(data, int(size))
+	if err != nil {
+		log.Warningf("failed to decompress a %s block: %s", c.Name, err)
+		return nil, ErrHashMismatch
+	}
+	return out, nil
+}
+
+// storedBlockSize returns the uncompressed size of the stored block v,
+// without decompressing it.
+func storedBlockSize(v []byte) uint64 {
+	if _, size, _, ok := parseStoredBlock(v); ok {
+		return size
+	}
+	return uint64(len(v))
+}
+
+// BlockSizes returns the total size of the blocks a blockstore built on d
+// holds, as read from it and as stored in d, which is smaller when they are
+// compressed.
+func BlockSizes(ctx context.Context, d ds.Datastore) (logical, physical uint64, err error) {
+	res, err := dsns.Wrap(d, BlockPrefix).Query(dsq.Query{})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer res.Close()
+
+	for {
+		e, ok := res.NextSync()
+		if !ok {
+			return logical, physical, nil
+		}
+		if e.Error != nil {
+			return 0, 0, e.Error
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+
+		v, ok := e.Value.([]byte)
+		if !ok {
+			return 0, 0, ErrValueTypeMismatch
+		}
+		logical += storedBlockSize(v)
+		physical += uint64(len(v))
+	}
+}
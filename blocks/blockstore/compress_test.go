@@ -0,0 +1,102 @@
+package blockstore
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	dshelp "github.com/scroot/go-ipfs/thirdparty/ds-help"
+	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	ds_sync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+func storedValue(t *testing.T, d ds.Datastore, b blocks.Block) []byte {
+	v, err := d.Get(BlockPrefix.Child(dshelp.CidToDsKey(b.Cid())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.([]byte)
+}
+
+func TestCompressedBlockstore(t *testing.T) {
+	d := ds_sync.MutexWrap(ds.NewMapDatastore())
+	bs, err := NewCompressedBlockstore(d, "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs.HashOnRead(true)
+
+	text := blocks.NewBlock([]byte(strings.Repeat("some text compressing well ", 100)))
+	random := blocks.NewBlock([]byte("short"))
+	magic := blocks.NewBlock(append(append([]byte{}, compressedMagic...), 0, 1, 'a'))
+	if err := bs.PutMany([]blocks.Block{text, random}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewBlockstore(d).Put(magic); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := storedValue(t, d, text); len(v) >= len(text.RawData()) {
+		t.Fatalf("expected the block to be compressed, stored %d bytes out of %d", len(v), len(text.RawData()))
+	}
+	if v := storedValue(t, d, random); !bytes.Equal(v, random.RawData()) {
+		t.Fatal("expected the block which doesn't compress to be stored as is")
+	}
+
+	// every blockstore reads the blocks, whatever their compression
+	for _, r := range []Blockstore{bs, NewBlockstore(d)} {
+		for _, b := range []blocks.Block{text, random, magic} {
+			out, err := r.Get(b.Cid())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.RawData(), b.RawData()) {
+				t.Fatalf("block %s read as %q", b.Cid(), out.RawData())
+			}
+		}
+	}
+
+	logical, physical, err := BlockSizes(context.Background(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := uint64(len(text.RawData()) + len(random.RawData()) + len(magic.RawData()))
+	if logical != size {
+		t.Fatalf("expected a logical size of %d, got %d", size, logical)
+	}
+	if physical >= logical {
+		t.Fatalf("expected the physical size to be smaller than %d, got %d", logical, physical)
+	}
+}
+
+func TestCorruptedCompressedBlock(t *testing.T) {
+	bl := blocks.NewBlock([]byte(strings.Repeat("a", 1000)))
+	v, err := compressBlock(codecs["gzip"], bl.RawData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v[len(v)-1] ^= 0xff
+
+	d := ds_sync.MutexWrap(ds.NewMapDatastore())
+	if err := d.Put(BlockPrefix.Child(dshelp.CidToDsKey(bl.Cid())), v); err != nil {
+		t.Fatal(err)
+	}
+	// blocks which don't decompress are corrupt, whether they are hashed
+	// on read or not
+	for _, rehash := range []bool{true, false} {
+		bs := NewBlockstore(d)
+		bs.HashOnRead(rehash)
+		if _, err := bs.Get(bl.Cid()); err != ErrHashMismatch {
+			t.Fatalf("expected '%v' got '%v'", ErrHashMismatch, err)
+		}
+	}
+}
+
+func TestUnknownCodec(t *testing.T) {
+	if _, err := NewCompressedBlockstore(ds_sync.MutexWrap(ds.NewMapDatastore()), "lz4"); err == nil {
+		t.Fatal("expected an error using an unknown codec")
+	}
+}
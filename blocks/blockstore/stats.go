@@ -0,0 +1,295 @@
+package blockstore
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
+
+	mh "gx/ipfs/QmVGtdTZdTFaLsaj2RwdVG8jcjNNcp1DE914DKZ2kHmXHw/go-multihash"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// BlockSizeBuckets are the upper bounds, in bytes, of the buckets of the
+// block size histograms.
+var BlockSizeBuckets = []uint64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// SizeHistogram counts the sizes of blocks.
+type SizeHistogram struct {
+	// Counts has the number of blocks in each of BlockSizeBuckets, larger
+	// than the previous bound, and last the number of blocks larger than
+	// all of them.
+	Counts []uint64
+	Sum    uint64
+}
+
+func newSizeHistogram() SizeHistogram {
+	return SizeHistogram{Counts: make([]uint64, len(BlockSizeBuckets)+1)}
+}
+
+func (h *SizeHistogram) observe(size int) {
+	i := 0
+	for i < len(BlockSizeBuckets) && uint64(size) > BlockSizeBuckets[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Sum += uint64(size)
+}
+
+func (h SizeHistogram) copy() SizeHistogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// OpCounts counts the operations on blocks.
+type OpCounts struct {
+	Gets    uint64
+	Puts    uint64
+	Deletes uint64
+}
+
+// CacheStats are the requests answered by a cache of a blockstore.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+
+	// FalsePositives counts the requests the bloom filter couldn't answer
+	// for blocks which weren't in the blockstore.
+	FalsePositives uint64 `json:",omitempty"`
+}
+
+// HitRate returns the ratio of the requests answered by the cache.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// FalsePositiveRate returns the ratio of the requests for blocks which
+// weren't in the blockstore the bloom filter couldn't answer.
+func (s CacheStats) FalsePositiveRate() float64 {
+	if s.Hits+s.FalsePositives == 0 {
+		return 0
+	}
+	return float64(s.FalsePositives) / float64(s.Hits+s.FalsePositives)
+}
+
+// BlockstoreStats are the statistics gathered by a StatsBlockstore since it
+// was created.
+type BlockstoreStats struct {
+	// Codecs and Hashes count the operations by the codec of the CIDs and
+	// the type of their multihash.
+	Codecs map[string]OpCounts
+	Hashes map[string]OpCounts
+
+	// GetSizes and PutSizes count the sizes of the blocks read and written.
+	GetSizes SizeHistogram
+	PutSizes SizeHistogram
+
+	// ARCCache and BloomCache are the stats of the caches of the
+	// blockstore, when it has them.
+	ARCCache   *CacheStats `json:",omitempty"`
+	BloomCache *CacheStats `json:",omitempty"`
+}
+
+// codecNames maps the CID codecs to their names.
+var codecNames = make(map[uint64]string)
+
+func init() {
+	for name, c := range cid.Codecs {
+		if name != "v0" {
+			codecNames[c] = name
+		}
+	}
+}
+
+func codecName(c uint64) string {
+	if name, ok := codecNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", c)
+}
+
+func hashName(h uint64) string {
+	if name, ok := mh.Codes[h]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", h)
+}
+
+// PrefixNames returns the names of the codec and multihash type of c, under
+// which the stats count it.
+func PrefixNames(c *cid.Cid) (codec, hash string) {
+	p := c.Prefix()
+	return codecName(p.Codec), hashName(p.MhType)
+}
+
+// StatsBlockstore wraps a blockstore, counting the operations on its blocks
+// and gathering the stats of the caches it is built on.
+type StatsBlockstore struct {
+	Blockstore
+
+	lk       sync.Mutex
+	codecs   map[uint64]*OpCounts
+	hashes   map[uint64]*OpCounts
+	getSizes SizeHistogram
+	putSizes SizeHistogram
+}
+
+// NewStatsBlockstore returns a StatsBlockstore wrapping bs.
+func NewStatsBlockstore(bs Blockstore) *StatsBlockstore {
+	return &StatsBlockstore{
+		Blockstore: bs,
+		codecs:     make(map[uint64]*OpCounts),
+		hashes:     make(map[uint64]*OpCounts),
+		getSizes:   newSizeHistogram(),
+		putSizes:   newSizeHistogram(),
+	}
+}
+
+// count calls f on the counts of the codec and multihash type of k. The
+// lock must be held.
+func (s *StatsBlockstore) count(k *cid.Cid, f func(*OpCounts)) {
+	p := k.Prefix()
+	for _, c := range []struct {
+		m    map[uint64]*OpCounts
+		code uint64
+	}{{s.codecs, p.Codec}, {s.hashes, p.MhType}} {
+		counts, ok := c.m[c.code]
+		if !ok {
+			counts = new(OpCounts)
+			c.m[c.code] = counts
+		}
+		f(counts)
+	}
+}
+
+func (s *StatsBlockstore) Get(k *cid.Cid) (blocks.Block, error) {
+	b, err := s.Blockstore.Get(k)
+	if k == nil {
+		return b, err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.count(k, func(c *OpCounts) { c.Gets++ })
+	if err == nil {
+		s.getSizes.observe(len(b.RawData()))
+	}
+	return b, err
+}
+
+func (s *StatsBlockstore) Put(b blocks.Block) error {
+	if err := s.Blockstore.Put(b); err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.countPut(b)
+	return nil
+}
+
+func (s *StatsBlockstore) PutMany(bs []blocks.Block) error {
+	if err := s.Blockstore.PutMany(bs); err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for _, b := range bs {
+		s.countPut(b)
+	}
+	return nil
+}
+
+func (s *StatsBlockstore) countPut(b blocks.Block) {
+	s.count(b.Cid(), func(c *OpCounts) { c.Puts++ })
+	s.putSizes.observe(len(b.RawData()))
+}
+
+func (s *StatsBlockstore) DeleteBlock(k *cid.Cid) error {
+	if err := s.Blockstore.DeleteBlock(k); err != nil {
+		return err
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.count(k, func(c *OpCounts) { c.Deletes++ })
+	return nil
+}
+
+// Close closes the wrapped blockstore, when it can be closed.
+func (s *StatsBlockstore) Close() error {
+	if c, ok := s.Blockstore.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Stats returns the stats gathered so far.
+func (s *StatsBlockstore) Stats() *BlockstoreStats {
+	s.lk.Lock()
+	st := &BlockstoreStats{
+		Codecs:   make(map[string]OpCounts),
+		Hashes:   make(map[string]OpCounts),
+		GetSizes: s.getSizes.copy(),
+		PutSizes: s.putSizes.copy(),
+	}
+	for c, counts := range s.codecs {
+		st.Codecs[codecName(c)] = *counts
+	}
+	for h, counts := range s.hashes {
+		st.Hashes[hashName(h)] = *counts
+	}
+	s.lk.Unlock()
+
+	for bs := s.Blockstore; bs != nil; {
+		switch c := bs.(type) {
+		case *arccache:
+			st.ARCCache = c.counters.stats()
+			bs = c.blockstore
+		case *bloomcache:
+			st.BloomCache = c.counters.stats()
+			bs = c.blockstore
+		case *bloomInvalidator:
+			bs = c.Blockstore
+		default:
+			bs = nil
+		}
+	}
+	return st
+}
+
+// cacheCounters counts the requests of a cache for its stats, as its
+// metrics can't be read. It must come first in the structs holding it, for
+// the alignment of the atomic counters.
+type cacheCounters struct {
+	hits           uint64
+	total          uint64
+	falsePositives uint64
+}
+
+func (c *cacheCounters) hit() {
+	atomic.AddUint64(&c.hits, 1)
+}
+
+func (c *cacheCounters) request() {
+	atomic.AddUint64(&c.total, 1)
+}
+
+func (c *cacheCounters) falsePositive() {
+	atomic.AddUint64(&c.falsePositives, 1)
+}
+
+func (c *cacheCounters) stats() *CacheStats {
+	hits, total := atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.total)
+	return &CacheStats{
+		Hits:           hits,
+		Misses:         total - hits,
+		FalsePositives: atomic.LoadUint64(&c.falsePositives),
+	}
+}
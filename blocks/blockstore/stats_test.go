@@ -0,0 +1,100 @@
+package blockstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
+
+	mh "gx/ipfs/QmVGtdTZdTFaLsaj2RwdVG8jcjNNcp1DE914DKZ2kHmXHw/go-multihash"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	syncds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+func TestStatsBlockstore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	cbs, err := CachedBlockstore(ctx, NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore())), DefaultCacheOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-cbs.(*bloomcache).rebuildChan:
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for the bloom filter")
+	}
+	bs := NewStatsBlockstore(cbs)
+
+	pb := blocks.NewBlock([]byte("a protobuf block"))
+	data := []byte(strings.Repeat("a", 2000))
+	c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA2_256, MhLength: -1}.Sum(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := blocks.NewBlock([]byte("missing"))
+
+	if err := bs.PutMany([]blocks.Block{pb, raw}); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []*cid.Cid{pb.Cid(), raw.Cid(), raw.Cid()} {
+		if _, err := bs.Get(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := bs.Get(missing.Cid()); err != ErrNotFound {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	if err := bs.DeleteBlock(pb.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	st := bs.Stats()
+	if counts := st.Codecs["protobuf"]; counts != (OpCounts{Gets: 2, Puts: 1, Deletes: 1}) {
+		t.Fatalf("unexpected protobuf counts %+v", counts)
+	}
+	if counts := st.Codecs["raw"]; counts != (OpCounts{Gets: 2, Puts: 1}) {
+		t.Fatalf("unexpected raw counts %+v", counts)
+	}
+	if counts := st.Hashes["sha2-256"]; counts != (OpCounts{Gets: 4, Puts: 2, Deletes: 1}) {
+		t.Fatalf("unexpected sha2-256 counts %+v", counts)
+	}
+
+	if st.PutSizes.Counts[0] != 1 || st.PutSizes.Counts[1] != 1 {
+		t.Fatalf("unexpected put sizes %v", st.PutSizes.Counts)
+	}
+	if st.GetSizes.Sum != uint64(len(pb.RawData())+2*len(data)) {
+		t.Fatalf("unexpected size of the blocks read %d", st.GetSizes.Sum)
+	}
+
+	if st.ARCCache == nil || st.BloomCache == nil {
+		t.Fatal("expected the stats of the caches")
+	}
+	if st.ARCCache.Hits == 0 || st.ARCCache.Hits+st.ARCCache.Misses < 4 {
+		t.Fatalf("unexpected ARC cache stats %+v", st.ARCCache)
+	}
+	// the bloom filter rules the missing block out
+	if st.BloomCache.Hits == 0 {
+		t.Fatalf("unexpected bloom cache stats %+v", st.BloomCache)
+	}
+}
+
+func TestCacheStatsRates(t *testing.T) {
+	s := CacheStats{Hits: 3, Misses: 1, FalsePositives: 1}
+	if s.HitRate() != 0.75 {
+		t.Fatalf("expected a hit rate of 0.75, got %f", s.HitRate())
+	}
+	if s.FalsePositiveRate() != 0.25 {
+		t.Fatalf("expected a false positive rate of 0.25, got %f", s.FalsePositiveRate())
+	}
+	if (CacheStats{}).HitRate() != 0 {
+		t.Fatal("expected a null hit rate without requests")
+	}
+}
@@ -0,0 +1,549 @@
+package blockstore
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	dshelp "github.com/scroot/go-ipfs/thirdparty/ds-help"
+
+	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
+
+	"gx/ipfs/QmRg1gKTHzc3CZXSKzem8aR4E3TubFhbgXwfVuWnSK5CC5/go-metrics-interface"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// TierSizesKey is the prefix of the keys under which the sizes of the blocks
+// in the hot tier are recorded.
+var TierSizesKey = ds.NewKey("/local/blockstore/tiered")
+
+// TierOpts wraps options for TieredBlockstore().
+type TierOpts struct {
+	// HotSize is the size in bytes of the blocks above which the least
+	// recently used ones are demoted to the cold tier.
+	HotSize uint64
+
+	// MaxAge is the time after which the blocks which weren't used are
+	// demoted, whatever the size of the hot tier. They aren't when 0.
+	MaxAge time.Duration
+
+	// DemoteInterval is how often the hot tier is checked for blocks to
+	// demote, besides when it grows above HotSize.
+	DemoteInterval time.Duration
+
+	// SizeIndex is where the sizes of the blocks in the hot tier are
+	// recorded, so that they aren't read again to learn their size when
+	// the blockstore is created.
+	SizeIndex ds.Datastore
+}
+
+// DefaultTierOpts returns a TierOpts initialized with default values.
+func DefaultTierOpts() TierOpts {
+	return TierOpts{
+		HotSize:        10 << 30,
+		DemoteInterval: time.Minute,
+	}
+}
+
+// TieredBlockstore returns a blockstore keeping the new and recently read
+// blocks in hot, while the blocks which are the least recently used or
+// weren't used for opts.MaxAge are demoted to cold. Reading a block from
+// cold promotes it back to hot. The blocks are demoted in the background,
+// until ctx is done.
+//
+// The use of the blocks is only tracked in memory: when the blockstore is
+// created, the blocks in hot count as just used. They are tracked in the
+// background, while the blocks used meanwhile can already be demoted.
+func TieredBlockstore(ctx context.Context, hot, cold Blockstore, opts TierOpts) (Blockstore, error) {
+	if opts.HotSize == 0 {
+		return nil, errors.New("the size of the hot tier must be greater than zero")
+	}
+	if opts.MaxAge < 0 || opts.DemoteInterval <= 0 {
+		return nil, errors.New("the durations of the tiers must be greater than zero")
+	}
+
+	ctx = metrics.CtxSubScope(ctx, "bs.tiered")
+	t := &tiered{
+		hot:      hot,
+		cold:     cold,
+		opts:     opts,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		demoteCh: make(chan struct{}, 1),
+		loadChan: make(chan struct{}),
+	}
+	t.promoted = metrics.NewCtx(ctx, "promoted_total",
+		"Number of blocks promoted to the hot tier").Counter()
+	t.demoted = metrics.NewCtx(ctx, "demoted_total",
+		"Number of blocks demoted to the cold tier").Counter()
+
+	go t.run(ctx)
+	return t, nil
+}
+
+// maxDemoteBackoff bounds the delay after which demoting a block which
+// failed to be is tried again.
+const maxDemoteBackoff = time.Hour
+
+type tierEntry struct {
+	c    *cid.Cid
+	size uint64
+	used time.Time
+
+	// retry is when demoting the block is tried again, after failures
+	// attempts in a row failed
+	retry    time.Time
+	failures uint
+}
+
+type tiered struct {
+	hot  Blockstore
+	cold Blockstore
+	opts TierOpts
+
+	// moveLk is held while moving blocks between the tiers and deleting
+	// them, so that a deleted block isn't moved back
+	moveLk sync.Mutex
+
+	// lk protects the use of the blocks in hot, the most recently used
+	// first
+	lk      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	size    uint64
+
+	demoteCh chan struct{}
+	// This chan is only used for testing to wait for the hot tier to be
+	// loaded
+	loadChan chan struct{}
+
+	promoted metrics.Counter
+	demoted  metrics.Counter
+}
+
+func (t *tiered) run(ctx context.Context) {
+	go func() {
+		t.load(ctx)
+		close(t.loadChan)
+	}()
+
+	tick := time.NewTicker(t.opts.DemoteInterval)
+	defer tick.Stop()
+	for {
+		t.demoteBlocks(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		case <-t.demoteCh:
+		}
+	}
+}
+
+// load tracks the blocks which are already in hot. Their sizes are read
+// from the size index, only the blocks missing from it, written while the
+// blockstore wasn't tiered, are read.
+func (t *tiered) load(ctx context.Context) {
+	evt := log.EventBegin(ctx, "tiered.Load")
+	defer evt.Done()
+
+	sizes := t.loadSizes()
+	ch, err := t.hot.AllKeysChan(ctx)
+	if err != nil {
+		log.Errorf("AllKeysChan failed loading the hot tier: %v", err)
+		return
+	}
+	for c := range ch {
+		k := sizeKey(c)
+		size, ok := sizes[k]
+		if ok {
+			delete(sizes, k)
+		} else {
+			b, err := t.hot.Get(c)
+			if err != nil {
+				continue
+			}
+			size = uint64(len(b.RawData()))
+			t.recordSize(c, size)
+		}
+
+		t.lk.Lock()
+		if _, ok := t.entries[c.KeyString()]; !ok {
+			t.entries[c.KeyString()] = t.lru.PushBack(&tierEntry{c: c, size: size, used: time.Now()})
+			t.size += size
+		}
+		over := t.size > t.opts.HotSize
+		t.lk.Unlock()
+		if over {
+			t.signalDemotion()
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	// the sizes left are the ones of blocks deleted while the blockstore
+	// wasn't tiered
+	for k := range sizes {
+		if err := t.opts.SizeIndex.Delete(k); err != nil && err != ds.ErrNotFound {
+			log.Errorf("failed to delete the size %s: %s", k, err)
+		}
+	}
+}
+
+// loadSizes returns the sizes recorded in the size index, by key.
+func (t *tiered) loadSizes() map[ds.Key]uint64 {
+	sizes := make(map[ds.Key]uint64)
+	if t.opts.SizeIndex == nil {
+		return sizes
+	}
+
+	res, err := t.opts.SizeIndex.Query(dsq.Query{Prefix: TierSizesKey.String()})
+	if err != nil {
+		log.Errorf("failed to query the sizes of the hot tier: %v", err)
+		return sizes
+	}
+	defer res.Close()
+
+	for e := range res.Next() {
+		if e.Error != nil {
+			log.Errorf("failed to read the sizes of the hot tier: %v", e.Error)
+			break
+		}
+		v, ok := e.Value.([]byte)
+		if !ok {
+			continue
+		}
+		if size, n := binary.Uvarint(v); n > 0 {
+			sizes[ds.NewKey(e.Key)] = size
+		}
+	}
+	return sizes
+}
+
+func sizeKey(c *cid.Cid) ds.Key {
+	return TierSizesKey.Child(dshelp.CidToDsKey(c))
+}
+
+// recordSize records the size of a block added to hot in the size index.
+func (t *tiered) recordSize(c *cid.Cid, size uint64) {
+	if t.opts.SizeIndex == nil {
+		return
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, size)
+	if err := t.opts.SizeIndex.Put(sizeKey(c), buf[:n]); err != nil {
+		log.Errorf("failed to record the size of block %s: %s", c, err)
+	}
+}
+
+// dropSize deletes the size of a block which left hot from the size index.
+func (t *tiered) dropSize(c *cid.Cid) {
+	if t.opts.SizeIndex == nil {
+		return
+	}
+	if err := t.opts.SizeIndex.Delete(sizeKey(c)); err != nil && err != ds.ErrNotFound {
+		log.Errorf("failed to delete the size of block %s: %s", c, err)
+	}
+}
+
+func (t *tiered) signalDemotion() {
+	select {
+	case t.demoteCh <- struct{}{}:
+	default:
+	}
+}
+
+// touch records the use of a block in hot.
+func (t *tiered) touch(c *cid.Cid, size int) {
+	t.lk.Lock()
+	if el, ok := t.entries[c.KeyString()]; ok {
+		el.Value.(*tierEntry).used = time.Now()
+		t.lru.MoveToFront(el)
+		t.lk.Unlock()
+		return
+	}
+
+	t.entries[c.KeyString()] = t.lru.PushFront(&tierEntry{c: c, size: uint64(size), used: time.Now()})
+	t.size += uint64(size)
+	over := t.size > t.opts.HotSize
+	t.lk.Unlock()
+
+	t.recordSize(c, uint64(size))
+	if over {
+		t.signalDemotion()
+	}
+}
+
+func (t *tiered) forget(c *cid.Cid) {
+	t.lk.Lock()
+	if el, ok := t.entries[c.KeyString()]; ok {
+		t.remove(el)
+	}
+	t.lk.Unlock()
+
+	t.dropSize(c)
+}
+
+func (t *tiered) remove(el *list.Element) {
+	e := t.lru.Remove(el).(*tierEntry)
+	delete(t.entries, e.c.KeyString())
+	t.size -= e.size
+}
+
+// nextDemotion returns the next block to demote, if any.
+func (t *tiered) nextDemotion(now time.Time) *tierEntry {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	// the blocks which failed to be demoted are skipped until they are
+	// tried again
+	for el := t.lru.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*tierEntry)
+		if t.size <= t.opts.HotSize && (t.opts.MaxAge == 0 || now.Sub(e.used) < t.opts.MaxAge) {
+			return nil
+		}
+		if now.Before(e.retry) {
+			continue
+		}
+		t.remove(el)
+		return e
+	}
+	return nil
+}
+
+// demoteBlocks demotes the blocks until the hot tier is within its limits.
+func (t *tiered) demoteBlocks(ctx context.Context) {
+	for ctx.Err() == nil {
+		e := t.nextDemotion(time.Now())
+		if e == nil {
+			return
+		}
+
+		if err := t.demote(e.c); err != nil {
+			log.Errorf("failed to demote block %s: %s", e.c, err)
+			t.backOff(e, time.Now())
+			continue
+		}
+		t.dropSize(e.c)
+	}
+}
+
+// backOff puts back the entry of a block which failed to be demoted, to be
+// tried again after a delay doubling with every failure, while the other
+// blocks are demoted.
+func (t *tiered) backOff(e *tierEntry, now time.Time) {
+	delay := t.opts.DemoteInterval
+	for i := uint(0); i < e.failures && delay < maxDemoteBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxDemoteBackoff {
+		delay = maxDemoteBackoff
+	}
+	e.failures++
+	e.retry = now.Add(delay)
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	// it was used meanwhile
+	if _, ok := t.entries[e.c.KeyString()]; ok {
+		return
+	}
+	t.entries[e.c.KeyString()] = t.lru.PushBack(e)
+	t.size += e.size
+}
+
+// demote moves a block from hot to cold. It is written to cold before
+// being deleted from hot, so that it is always in one of them.
+func (t *tiered) demote(c *cid.Cid) error {
+	t.moveLk.Lock()
+	defer t.moveLk.Unlock()
+
+	b, err := t.hot.Get(c)
+	if err == ErrNotFound {
+		// deleted meanwhile
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := t.cold.Put(b); err != nil {
+		return err
+	}
+	if err := t.hot.DeleteBlock(c); err != nil && !isNotFound(err) {
+		return err
+	}
+	t.demoted.Inc()
+	return nil
+}
+
+// promote moves a block read from cold to hot.
+func (t *tiered) promote(b blocks.Block) error {
+	t.moveLk.Lock()
+	defer t.moveLk.Unlock()
+
+	has, err := t.cold.Has(b.Cid())
+	if err != nil || !has {
+		// deleted meanwhile
+		return err
+	}
+	if err := t.hot.Put(b); err != nil {
+		return err
+	}
+	t.touch(b.Cid(), len(b.RawData()))
+	if err := t.cold.DeleteBlock(b.Cid()); err != nil && !isNotFound(err) {
+		return err
+	}
+	t.promoted.Inc()
+	return nil
+}
+
+func isNotFound(err error) bool {
+	return err == ErrNotFound || err == ds.ErrNotFound
+}
+
+func (t *tiered) DeleteBlock(k *cid.Cid) error {
+	t.moveLk.Lock()
+	defer t.moveLk.Unlock()
+
+	t.forget(k)
+	herr := t.hot.DeleteBlock(k)
+	cerr := t.cold.DeleteBlock(k)
+	switch {
+	case herr != nil && !isNotFound(herr):
+		return herr
+	case cerr != nil && !isNotFound(cerr):
+		return cerr
+	case herr != nil && cerr != nil:
+		return ErrNotFound
+	default:
+		return nil
+	}
+}
+
+func (t *tiered) Has(k *cid.Cid) (bool, error) {
+	has, err := t.hot.Has(k)
+	if err != nil || has {
+		return has, err
+	}
+	has, err = t.cold.Has(k)
+	if err != nil || has {
+		return has, err
+	}
+	// it may have been promoted while looking for it
+	return t.hot.Has(k)
+}
+
+func (t *tiered) Get(k *cid.Cid) (blocks.Block, error) {
+	b, err := t.hot.Get(k)
+	if err == nil {
+		t.touch(k, len(b.RawData()))
+		return b, nil
+	}
+	if err != ErrNotFound {
+		return nil, err
+	}
+
+	b, err = t.cold.Get(k)
+	if err == ErrNotFound {
+		// it may have been promoted while looking for it
+		return t.hot.Get(k)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := t.promote(b); err != nil {
+		log.Errorf("failed to promote block %s: %s", k, err)
+	}
+	return b, nil
+}
+
+func (t *tiered) Put(b blocks.Block) error {
+	if has, err := t.cold.Has(b.Cid()); err == nil && has {
+		return nil
+	}
+	if err := t.hot.Put(b); err != nil {
+		return err
+	}
+	t.touch(b.Cid(), len(b.RawData()))
+	return nil
+}
+
+func (t *tiered) PutMany(bs []blocks.Block) error {
+	var good []blocks.Block
+	for _, b := range bs {
+		if has, err := t.cold.Has(b.Cid()); err == nil && has {
+			continue
+		}
+		good = append(good, b)
+	}
+	if len(good) == 0 {
+		return nil
+	}
+
+	if err := t.hot.PutMany(good); err != nil {
+		return err
+	}
+	for _, b := range good {
+		t.touch(b.Cid(), len(b.RawData()))
+	}
+	return nil
+}
+
+func (t *tiered) HashOnRead(enabled bool) {
+	t.hot.HashOnRead(enabled)
+	t.cold.HashOnRead(enabled)
+}
+
+// AllKeysChan lists the blocks in hot, then the ones in cold. A block
+// promoted during the listing may be missed.
+func (t *tiered) AllKeysChan(ctx context.Context) (<-chan *cid.Cid, error) {
+	hotCh, err := t.hot.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan *cid.Cid, dsq.KeysOnlyBufSize)
+	go func() {
+		defer close(output)
+
+		// the hot tier is small, its keys are kept to skip the blocks
+		// demoted during the listing
+		seen := make(map[string]struct{})
+		for c := range hotCh {
+			seen[c.KeyString()] = struct{}{}
+			select {
+			case output <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		coldCh, err := t.cold.AllKeysChan(ctx)
+		if err != nil {
+			log.Errorf("AllKeysChan failed listing the cold tier: %v", err)
+			return
+		}
+		for c := range coldCh {
+			if _, ok := seen[c.KeyString()]; ok {
+				continue
+			}
+			select {
+			case output <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return output, nil
+}
@@ -0,0 +1,335 @@
+package blockstore
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	syncds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// testTiered returns a tiered blockstore which only demotes blocks when
+// the tests call demoteBlocks.
+func testTiered(t *testing.T, hot, cold Blockstore, opts TierOpts) *tiered {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	opts.DemoteInterval = time.Hour
+	bs, err := TieredBlockstore(ctx, hot, cold, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbs := bs.(*tiered)
+	select {
+	case <-tbs.loadChan:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the hot tier to be loaded")
+	}
+	return tbs
+}
+
+func expectTier(t *testing.T, bs Blockstore, tier string, in bool, bl ...blocks.Block) {
+	for _, b := range bl {
+		has, err := bs.Has(b.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != in {
+			t.Fatalf("expected block %s to be in the %s tier: %t", b.RawData(), tier, in)
+		}
+	}
+}
+
+func TestTieredBlockstore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hot := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	cold := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	bs := testTiered(t, hot, cold, TierOpts{HotSize: 20})
+
+	var bl []blocks.Block
+	for i := 0; i < 3; i++ {
+		bl = append(bl, blocks.NewBlock([]byte(fmt.Sprintf("block %03d", i))))
+	}
+	if err := bs.PutMany(bl[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(bl[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the least recently used block is demoted
+	bs.demoteBlocks(ctx)
+	expectTier(t, hot, "hot", true, bl[1:]...)
+	expectTier(t, cold, "cold", true, bl[0])
+	expectTier(t, bs, "tiered", true, bl...)
+
+	// and promoted back when read
+	out, err := bs.Get(bl[0].Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out.RawData()) != string(bl[0].RawData()) {
+		t.Fatalf("read %q", out.RawData())
+	}
+	expectTier(t, cold, "cold", false, bl[0])
+	bs.demoteBlocks(ctx)
+	expectTier(t, hot, "hot", true, bl[0], bl[2])
+	expectTier(t, cold, "cold", true, bl[1])
+
+	ch, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool)
+	for c := range ch {
+		if keys[c.KeyString()] {
+			t.Fatalf("block %s listed twice", c)
+		}
+		keys[c.KeyString()] = true
+	}
+	if len(keys) != len(bl) {
+		t.Fatalf("expected %d blocks, listed %d", len(bl), len(keys))
+	}
+
+	for _, b := range bl {
+		if err := bs.DeleteBlock(b.Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectTier(t, bs, "tiered", false, bl...)
+	if err := bs.DeleteBlock(bl[0].Cid()); err != ErrNotFound {
+		t.Fatalf("expected %v deleting a missing block, got %v", ErrNotFound, err)
+	}
+}
+
+func TestTieredMaxAge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hot := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	cold := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	old := blocks.NewBlock([]byte("old"))
+	if err := hot.Put(old); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blocks already in the hot tier are loaded
+	bs := testTiered(t, hot, cold, TierOpts{HotSize: 1 << 20, MaxAge: 50 * time.Millisecond})
+	time.Sleep(100 * time.Millisecond)
+	recent := blocks.NewBlock([]byte("recent"))
+	if err := bs.Put(recent); err != nil {
+		t.Fatal(err)
+	}
+
+	bs.demoteBlocks(ctx)
+	expectTier(t, cold, "cold", true, old)
+	expectTier(t, hot, "hot", true, recent)
+}
+
+// countingBlockstore counts the blocks read from it.
+type countingBlockstore struct {
+	Blockstore
+	gets int32
+}
+
+func (bs *countingBlockstore) Get(c *cid.Cid) (blocks.Block, error) {
+	atomic.AddInt32(&bs.gets, 1)
+	return bs.Blockstore.Get(c)
+}
+
+// failingBlockstore fails to store one block.
+type failingBlockstore struct {
+	Blockstore
+	fail *cid.Cid
+}
+
+func (bs *failingBlockstore) Put(b blocks.Block) error {
+	if b.Cid().Equals(bs.fail) {
+		return fmt.Errorf("can't store %s", b.Cid())
+	}
+	return bs.Blockstore.Put(b)
+}
+
+func TestTieredDemoteFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var bl []blocks.Block
+	for i := 0; i < 3; i++ {
+		bl = append(bl, blocks.NewBlock([]byte(fmt.Sprintf("block %03d", i))))
+	}
+
+	hot := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	cold := &failingBlockstore{
+		Blockstore: NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore())),
+		fail:       bl[0].Cid(),
+	}
+	bs := testTiered(t, hot, cold, TierOpts{HotSize: 5})
+	if err := bs.PutMany(bl); err != nil {
+		t.Fatal(err)
+	}
+
+	// the block which can't be demoted doesn't hold off the others
+	bs.demoteBlocks(ctx)
+	expectTier(t, hot, "hot", true, bl[0])
+	expectTier(t, cold, "cold", true, bl[1:]...)
+
+	// and is only tried again once its delay has passed
+	e := bs.nextDemotion(time.Now())
+	if e != nil {
+		t.Fatalf("expected block %s to be skipped", e.c)
+	}
+	e = bs.nextDemotion(time.Now().Add(2 * time.Hour))
+	if e == nil || !e.c.Equals(bl[0].Cid()) {
+		t.Fatal("expected the block which failed to be tried again")
+	}
+}
+
+func TestTieredSizeIndex(t *testing.T) {
+	index := syncds.MutexWrap(ds.NewMapDatastore())
+	hot := &countingBlockstore{Blockstore: NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))}
+	cold := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	opts := TierOpts{HotSize: 1 << 20, SizeIndex: index}
+	bs := testTiered(t, hot, cold, opts)
+
+	a := blocks.NewBlock([]byte("aaaa"))
+	b := blocks.NewBlock([]byte("bbbbbb"))
+	if err := bs.PutMany([]blocks.Block{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(a.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	for k, in := range map[*cid.Cid]bool{a.Cid(): false, b.Cid(): true} {
+		if has, err := index.Has(sizeKey(k)); err != nil || has != in {
+			t.Fatalf("expected the size of %s to be indexed: %t, %v", k, in, err)
+		}
+	}
+
+	// a block written while the blockstore wasn't tiered is read, and the
+	// size of a block deleted meanwhile is dropped
+	c := blocks.NewBlock([]byte("cc"))
+	if err := hot.Put(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Put(sizeKey(a.Cid()), []byte{4}); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&hot.gets, 0)
+	bs = testTiered(t, hot, cold, opts)
+	if gets := atomic.LoadInt32(&hot.gets); gets != 1 {
+		t.Fatalf("expected only the block missing from the index to be read, read %d", gets)
+	}
+	if bs.size != 8 {
+		t.Fatalf("expected a hot tier of 8 bytes, got %d", bs.size)
+	}
+	for k, in := range map[*cid.Cid]bool{a.Cid(): false, b.Cid(): true, c.Cid(): true} {
+		if has, err := index.Has(sizeKey(k)); err != nil || has != in {
+			t.Fatalf("expected the size of %s to be indexed: %t, %v", k, in, err)
+		}
+	}
+}
+
+// slowBlockstore lists its blocks once released.
+type slowBlockstore struct {
+	Blockstore
+	release chan struct{}
+}
+
+func (bs *slowBlockstore) AllKeysChan(ctx context.Context) (<-chan *cid.Cid, error) {
+	<-bs.release
+	return bs.Blockstore.AllKeysChan(ctx)
+}
+
+func TestTieredDemotesWhileLoading(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hot := &slowBlockstore{
+		Blockstore: NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore())),
+		release:    make(chan struct{}),
+	}
+	cold := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	bs, err := TieredBlockstore(ctx, hot, cold, TierOpts{HotSize: 1, DemoteInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(hot.release)
+
+	b := blocks.NewBlock([]byte("demoted"))
+	if err := bs.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if has, err := cold.Has(b.Cid()); err != nil {
+			t.Fatal(err)
+		} else if has {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the block wasn't demoted while loading the hot tier")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTieredComposesWithCaches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hot := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	cold := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	tbs := testTiered(t, hot, cold, TierOpts{HotSize: 1})
+	cbs, err := CachedBlockstore(ctx, tbs, DefaultCacheOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := blocks.NewBlock([]byte("cached"))
+	if err := cbs.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	tbs.demoteBlocks(ctx)
+	expectTier(t, cold, "cold", true, b)
+
+	// the caches still find the block once it moved
+	for _, f := range []func(*cid.Cid) error{
+		func(c *cid.Cid) error {
+			has, err := cbs.Has(c)
+			if err == nil && !has {
+				err = ErrNotFound
+			}
+			return err
+		},
+		func(c *cid.Cid) error {
+			_, err := cbs.Get(c)
+			return err
+		},
+	} {
+		if err := f(b.Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTieredOpts(t *testing.T) {
+	bs := NewBlockstore(syncds.MutexWrap(ds.NewMapDatastore()))
+	for _, opts := range []TierOpts{
+		{},
+		{HotSize: 1},
+		{HotSize: 1, MaxAge: -1, DemoteInterval: time.Second},
+	} {
+		if _, err := TieredBlockstore(context.Background(), bs, bs, opts); err == nil {
+			t.Fatalf("expected an error with %+v", opts)
+		}
+	}
+}
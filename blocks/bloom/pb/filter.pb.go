@@ -0,0 +1,129 @@
+// Code generated by protoc-gen-gogo.
+// source: filter.proto
+// DO NOT EDIT!
+
+/*
+Package pb is a generated protocol buffer package.
+
+It is generated from these files:
+	filter.proto
+
+It has these top-level messages:
+	PackedFilter
+*/
+package pb
+
+import proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type PackedFilter_HashType int32
+
+const (
+	// the hash functions of bbloom filters
+	PackedFilter_BBLOOM PackedFilter_HashType = 1
+)
+
+var PackedFilter_HashType_name = map[int32]string{
+	1: "BBLOOM",
+}
+var PackedFilter_HashType_value = map[string]int32{
+	"BBLOOM": 1,
+}
+
+func (x PackedFilter_HashType) Enum() *PackedFilter_HashType {
+	p := new(PackedFilter_HashType)
+	*p = x
+	return p
+}
+func (x PackedFilter_HashType) String() string {
+	return proto.EnumName(PackedFilter_HashType_name, int32(x))
+}
+func (x *PackedFilter_HashType) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(PackedFilter_HashType_value, data, "PackedFilter_HashType")
+	if err != nil {
+		return err
+	}
+	*x = PackedFilter_HashType(value)
+	return nil
+}
+
+// PackedFilter is a bloom filter saved to disk.
+type PackedFilter struct {
+	// data is compressed with gzip
+	Compressed *bool                   `protobuf:"varint,1,opt,name=compressed" json:"compressed,omitempty"`
+	Data       []byte                  `protobuf:"bytes,2,opt,name=data" json:"data,omitempty"`
+	Hashes     []PackedFilter_HashType `protobuf:"varint,3,rep,name=hashes,enum=ipfs.bloom.PackedFilter_HashType" json:"hashes,omitempty"`
+	// size of the filter in bits
+	Size *uint64 `protobuf:"varint,4,opt,name=size" json:"size,omitempty"`
+	// number of hash functions
+	HashCount *uint64 `protobuf:"varint,5,opt,name=hashCount" json:"hashCount,omitempty"`
+	// number of elements added to the filter
+	Elements *uint64 `protobuf:"varint,6,opt,name=elements" json:"elements,omitempty"`
+	// sha256 of the data
+	Checksum         []byte `protobuf:"bytes,7,opt,name=checksum" json:"checksum,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *PackedFilter) Reset()         { *m = PackedFilter{} }
+func (m *PackedFilter) String() string { return proto.CompactTextString(m) }
+func (*PackedFilter) ProtoMessage()    {}
+
+func (m *PackedFilter) GetCompressed() bool {
+	if m != nil && m.Compressed != nil {
+		return *m.Compressed
+	}
+	return false
+}
+
+func (m *PackedFilter) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *PackedFilter) GetHashes() []PackedFilter_HashType {
+	if m != nil {
+		return m.Hashes
+	}
+	return nil
+}
+
+func (m *PackedFilter) GetSize() uint64 {
+	if m != nil && m.Size != nil {
+		return *m.Size
+	}
+	return 0
+}
+
+func (m *PackedFilter) GetHashCount() uint64 {
+	if m != nil && m.HashCount != nil {
+		return *m.HashCount
+	}
+	return 0
+}
+
+func (m *PackedFilter) GetElements() uint64 {
+	if m != nil && m.Elements != nil {
+		return *m.Elements
+	}
+	return 0
+}
+
+func (m *PackedFilter) GetChecksum() []byte {
+	if m != nil {
+		return m.Checksum
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*PackedFilter)(nil), "ipfs.bloom.PackedFilter")
+	proto.RegisterEnum("ipfs.bloom.PackedFilter_HashType", PackedFilter_HashType_name, PackedFilter_HashType_value)
+}
@@ -251,17 +251,16 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 
 		if !domigrate {
 			fmt.Println("Not running migrations of fs-repo now.")
-			fmt.Println("Please get fs-repo-migrations from https://dist.ipfs.io")
+			fmt.Println("Please run 'ipfs repo migrate' to migrate it.")
 			res.SetError(fmt.Errorf("fs-repo requires migration"), cmds.ErrNormal)
 			return
 		}
 
-		err = migrate.RunMigration(fsrepo.RepoVersion)
+		err = fsrepo.Migrate(ctx.ConfigRoot, fsrepo.RepoVersion, migrate.Options{Log: os.Stdout})
 		if err != nil {
 			fmt.Println("The migrations of fs-repo failed:")
 			fmt.Printf("  %s\n", err)
 			fmt.Println("If you think this is a bug, please file an issue and include this whole log output.")
-			fmt.Println("  https://github.com/ipfs/fs-repo-migrations")
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
@@ -100,5 +100,8 @@ var cmdDetailsMap = map[*cmds.Command]cmdDetails{
 	commands.LogCmd:                       {cannotRunOnClient: true},
 	commands.ActiveReqsCmd:                {cannotRunOnClient: true},
 	commands.RepoFsckCmd:                  {cannotRunOnDaemon: true},
+	commands.RepoMigrateCmd:               {cannotRunOnDaemon: true, doesNotUseRepo: true},
+	commands.RepoImportCmd:                {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true, doesNotUseRepo: true},
+	commands.RepoReencryptCmd:             {cannotRunOnDaemon: true, doesNotUseRepo: true},
 	commands.ConfigCmd.Subcommand("edit"): {cannotRunOnDaemon: true, doesNotUseRepo: true},
 }
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/scroot/go-ipfs/thirdparty/assert"
+	ignore "github.com/scroot/go-ipfs/thirdparty/ignore"
 )
 
 func TestIsHidden(t *testing.T) {
@@ -11,3 +15,25 @@ func TestIsHidden(t *testing.T) {
 	assert.False(IsHidden("."), t, ". for current dir should not be considered hidden")
 	assert.False(IsHidden("bar/baz"), t, "normal dirs should not be hidden")
 }
+
+func TestIsIgnored(t *testing.T) {
+	root, err := ioutil.TempDir("", "ipfswatch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(filepath.Join(root, ignore.IgnoreFile), []byte("build/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := ignore.New(ignore.SplitPatterns("*.swp,*.tmp"), ignore.SplitPatterns("keep.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(IsIgnored(rules, root, filepath.Join(root, "a.swp"), false), t, "excluded files should be ignored")
+	assert.True(IsIgnored(rules, root, filepath.Join(root, "build", "out"), false), t, "files of ignored dirs should be ignored")
+	assert.False(IsIgnored(rules, root, filepath.Join(root, "keep.tmp"), false), t, "included files should not be ignored")
+	assert.False(IsIgnored(rules, root, filepath.Join(root, "a.txt"), false), t, "other files should not be ignored")
+}
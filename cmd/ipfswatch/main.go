@@ -15,6 +15,7 @@ import (
 	coreunix "github.com/scroot/go-ipfs/core/coreunix"
 	config "github.com/scroot/go-ipfs/repo/config"
 	fsrepo "github.com/scroot/go-ipfs/repo/fsrepo"
+	ignore "github.com/scroot/go-ipfs/thirdparty/ignore"
 
 	homedir "github.com/scroot/go-ipfs/Godeps/_workspace/src/github.com/mitchellh/go-homedir"
 
@@ -26,6 +27,8 @@ import (
 var http = flag.Bool("http", false, "expose IPFS HTTP API")
 var repoPath = flag.String("repo", os.Getenv("IPFS_PATH"), "IPFS_PATH to use")
 var watchPath = flag.String("path", ".", "the path to watch")
+var exclude = flag.String("exclude", "", "comma separated patterns of the paths not to add")
+var include = flag.String("include", "", "comma separated patterns of the paths to add even when excluded")
 
 func main() {
 	flag.Parse()
@@ -45,12 +48,17 @@ func main() {
 		}
 	}
 
-	if err := run(ipfsPath, *watchPath); err != nil {
+	rules, err := ignore.New(ignore.SplitPatterns(*exclude), ignore.SplitPatterns(*include))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := run(ipfsPath, *watchPath, rules); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func run(ipfsPath, watchPath string) error {
+func run(ipfsPath, watchPath string, rules *ignore.Matcher) error {
 
 	proc := process.WithParent(process.Background())
 	log.Printf("running IPFSWatch on '%s' using repo at '%s'...", watchPath, ipfsPath)
@@ -65,7 +73,7 @@ func run(ipfsPath, watchPath string) error {
 	}
 	defer watcher.Close()
 
-	if err := addTree(watcher, watchPath); err != nil {
+	if err := addTree(watcher, watchPath, rules); err != nil {
 		return err
 	}
 
@@ -112,6 +120,10 @@ func run(ipfsPath, watchPath string) error {
 			if err != nil {
 				continue
 			}
+			if e.Op != fsnotify.Remove && IsIgnored(rules, watchPath, e.Name, isDir) {
+				log.Printf("ignoring %s", e.Name)
+				continue
+			}
 			switch e.Op {
 			case fsnotify.Remove:
 				if isDir {
@@ -125,7 +137,7 @@ func run(ipfsPath, watchPath string) error {
 				switch e.Op {
 				case fsnotify.Create:
 					if isDir {
-						addTree(watcher, e.Name)
+						addTree(watcher, e.Name, rules)
 					}
 				}
 				proc.Go(func(p process.Process) {
@@ -147,7 +159,7 @@ func run(ipfsPath, watchPath string) error {
 	}
 }
 
-func addTree(w *fsnotify.Watcher, root string) error {
+func addTree(w *fsnotify.Watcher, root string, rules *ignore.Matcher) error {
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		isDir, err := IsDirectory(path)
 		if err != nil {
@@ -155,7 +167,7 @@ func addTree(w *fsnotify.Watcher, root string) error {
 			return nil
 		}
 		switch {
-		case isDir && IsHidden(path):
+		case isDir && (IsHidden(path) || IsIgnored(rules, *watchPath, path, true)):
 			log.Println(path)
 			return filepath.SkipDir
 		case isDir:
@@ -187,6 +199,17 @@ func IsHidden(path string) bool {
 	return false
 }
 
+// IsIgnored returns whether path, in the watched tree at root, is excluded
+// by the patterns given on the command line or the .ipfsignore files.
+func IsIgnored(rules *ignore.Matcher, root, path string, isDir bool) bool {
+	ignored, err := rules.IgnoredPath(root, path, isDir)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return ignored
+}
+
 func cmdCtx(node *core.IpfsNode, repoPath string) commands.Context {
 	return commands.Context{
 		Online:     true,
@@ -0,0 +1,96 @@
+package files
+
+import (
+	"fmt"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers carrying the unix attributes of a file in multipart requests.
+const (
+	modeHeader  = "mode"
+	mtimeHeader = "mtime"
+	sizeHeader  = "size"
+)
+
+// SetAttrHeaders records the unix mode bits, modification time and, for
+// regular files, the size of stat in the headers of a multipart part.
+func SetAttrHeaders(header textproto.MIMEHeader, stat os.FileInfo) {
+	m := stat.Mode()
+	mode := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	header.Set(modeHeader, strconv.FormatUint(uint64(mode), 8))
+
+	mt := stat.ModTime()
+	header.Set(mtimeHeader, fmt.Sprintf("%d.%09d", mt.Unix(), mt.Nanosecond()))
+
+	if m.IsRegular() {
+		header.Set(sizeHeader, strconv.FormatInt(stat.Size(), 10))
+	}
+}
+
+// statFromHeaders returns the attributes found in the headers of a part, or
+// nil when it has none. Only the mode, time, type and, for regular files,
+// the size of the returned FileInfo are meaningful.
+func statFromHeaders(name string, header textproto.MIMEHeader, typ os.FileMode) os.FileInfo {
+	ms, ts := header.Get(modeHeader), header.Get(mtimeHeader)
+	if ms == "" && ts == "" {
+		return nil
+	}
+
+	fi := &headerFileInfo{name: name, mode: typ}
+
+	if m, err := strconv.ParseUint(ms, 8, 32); err == nil {
+		fi.mode |= os.FileMode(m & 0777)
+		if m&04000 != 0 {
+			fi.mode |= os.ModeSetuid
+		}
+		if m&02000 != 0 {
+			fi.mode |= os.ModeSetgid
+		}
+		if m&01000 != 0 {
+			fi.mode |= os.ModeSticky
+		}
+	}
+
+	if parts := strings.SplitN(ts, ".", 2); len(parts) == 2 {
+		sec, err1 := strconv.ParseInt(parts[0], 10, 64)
+		nsec, err2 := strconv.ParseInt(parts[1], 10, 64)
+		if err1 == nil && err2 == nil {
+			fi.mtime = time.Unix(sec, nsec)
+		}
+	}
+
+	if size, err := strconv.ParseInt(header.Get(sizeHeader), 10, 64); err == nil {
+		fi.size = size
+	}
+
+	return fi
+}
+
+// headerFileInfo is the os.FileInfo of a file received in a multipart
+// request. Its size is 0 when the sender didn't give it.
+type headerFileInfo struct {
+	name  string
+	mode  os.FileMode
+	mtime time.Time
+	size  int64
+}
+
+func (fi *headerFileInfo) Name() string       { return fi.name }
+func (fi *headerFileInfo) Size() int64        { return fi.size }
+func (fi *headerFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *headerFileInfo) ModTime() time.Time { return fi.mtime }
+func (fi *headerFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *headerFileInfo) Sys() interface{}   { return nil }
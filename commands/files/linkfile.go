@@ -45,6 +45,10 @@ func (f *Symlink) FullPath() string {
 	return f.path
 }
 
+func (f *Symlink) Stat() os.FileInfo {
+	return f.stat
+}
+
 func (f *Symlink) Read(b []byte) (int, error) {
 	return f.reader.Read(b)
 }
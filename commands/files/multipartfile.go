@@ -6,6 +6,7 @@ import (
 	"mime"
 	"mime/multipart"
 	"net/url"
+	"os"
 )
 
 const (
@@ -26,6 +27,8 @@ type MultipartFile struct {
 	Part      *multipart.Part
 	Reader    *multipart.Reader
 	Mediatype string
+
+	stat os.FileInfo
 }
 
 func NewFileFromPart(part *multipart.Part) (File, error) {
@@ -44,6 +47,7 @@ func NewFileFromPart(part *multipart.Part) (File, error) {
 		return &Symlink{
 			Target: string(out),
 			name:   f.FileName(),
+			stat:   statFromHeaders(f.FileName(), part.Header, os.ModeSymlink),
 		}, nil
 	case applicationFile:
 		return &ReaderFile{
@@ -51,6 +55,7 @@ func NewFileFromPart(part *multipart.Part) (File, error) {
 			filename: f.FileName(),
 			abspath:  part.Header.Get("abspath"),
 			fullpath: f.FullPath(),
+			stat:     statFromHeaders(f.FileName(), part.Header, 0),
 		}, nil
 	}
 
@@ -60,6 +65,10 @@ func NewFileFromPart(part *multipart.Part) (File, error) {
 		return nil, err
 	}
 
+	if f.IsDirectory() {
+		f.stat = statFromHeaders(f.FileName(), part.Header, os.ModeDir)
+	}
+
 	return f, nil
 }
 
@@ -100,6 +109,11 @@ func (f *MultipartFile) FullPath() string {
 	return f.FileName()
 }
 
+// Stat returns the attributes of the file sent along with it, if any.
+func (f *MultipartFile) Stat() os.FileInfo {
+	return f.stat
+}
+
 func (f *MultipartFile) Read(p []byte) (int, error) {
 	if f.IsDirectory() {
 		return 0, ErrNotReader
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+
+	"github.com/scroot/go-ipfs/thirdparty/ignore"
 )
 
 // serialFile implements File, and reads from a path on the OS filesystem.
@@ -38,6 +40,15 @@ func NewSerialFile(name, path string, hidden bool, stat os.FileInfo) (File, erro
 		if err != nil {
 			return nil, err
 		}
+
+		// the ignore file comes first, as it applies to the other entries
+		for i, fi := range contents {
+			if fi.Name() == ignore.IgnoreFile {
+				copy(contents[1:i+1], contents[:i])
+				contents[0] = fi
+				break
+			}
+		}
 		return &serialFile{name, path, contents, stat, nil, hidden}, nil
 	case mode&os.ModeSymlink != 0:
 		target, err := os.Readlink(path)
@@ -71,7 +82,9 @@ func (f *serialFile) NextFile() (File, error) {
 	stat := f.files[0]
 	f.files = f.files[1:]
 
-	for !f.handleHiddenFiles && strings.HasPrefix(stat.Name(), ".") {
+	// ignore files are sent along even when skipping hidden files, for
+	// the receiver to apply them
+	for !f.handleHiddenFiles && strings.HasPrefix(stat.Name(), ".") && stat.Name() != ignore.IgnoreFile {
 		if len(f.files) == 0 {
 			return nil, io.EOF
 		}
@@ -22,9 +22,11 @@ import (
 
 	ci "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
 	retry "gx/ipfs/QmPP91WFAb8LCs8EMzGvDPPvg1kacbqRkoxgTTnUsZckGe/retry-datastore"
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	metrics "gx/ipfs/QmRg1gKTHzc3CZXSKzem8aR4E3TubFhbgXwfVuWnSK5CC5/go-metrics-interface"
 	goprocessctx "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess/context"
 	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsns "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/namespace"
 	dsync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
 	pstore "gx/ipfs/QmXZSd1qR5BxZkPyuwfT5jpqQFScZccoZvDneXsKzCNHWX/go-libp2p-peerstore"
 	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
@@ -169,26 +171,65 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		TempErrFunc: isTooManyFDError,
 	}
 
-	bs := bstore.NewBlockstore(rds)
-
-	opts := bstore.DefaultCacheOpts()
 	conf, err := n.Repo.Config()
 	if err != nil {
 		return err
 	}
 
+	bs, err := newBlockstore(rds, conf.Datastore.BlockCompression)
+	if err != nil {
+		return err
+	}
+	if tc := conf.Datastore.Tiering; tc != nil {
+		topts, err := tierOpts(tc)
+		if err != nil {
+			return err
+		}
+		topts.SizeIndex = rds
+		cold, err := newBlockstore(dsns.Wrap(rds, ds.NewKey(tc.ColdPrefix)), conf.Datastore.BlockCompression)
+		if err != nil {
+			return err
+		}
+		bs, err = bstore.TieredBlockstore(ctx, bs, cold, topts)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts := bstore.DefaultCacheOpts()
+
 	// TEMP: setting global sharding switch here
 	uio.UseHAMTSharding = conf.Experimental.ShardingEnabled
+	if conf.Experimental.ShardingThreshold > 0 {
+		uio.ShardSplitThreshold = conf.Experimental.ShardingThreshold
+	}
+	if conf.Experimental.PrefetchWindow > 0 {
+		uio.PrefetchWindow = conf.Experimental.PrefetchWindow
+	}
 
 	opts.HasBloomFilterSize = conf.Datastore.BloomFilterSize
+	if opts.HasBloomFilterSize == -1 {
+		opts.HasBloomFilterSize = 0
+		opts.HasBloomFilterAutoSize = true
+	}
 	if !cfg.Permament {
 		opts.HasBloomFilterSize = 0
+		opts.HasBloomFilterAutoSize = false
+	}
+	if conf.Experimental.FilestoreEnabled {
+		// the filestore writes to the blockstore without the bloom filter
+		if err := rds.Delete(bstore.BloomFilterKey); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	} else {
+		opts.BloomFilterStore = rds
 	}
 
 	cbs, err := bstore.CachedBlockstore(ctx, bs, opts)
 	if err != nil {
 		return err
 	}
+	cbs = bstore.NewStatsBlockstore(cbs)
 
 	n.BaseBlocks = cbs
 	n.GCLocker = bstore.NewGCLocker()
@@ -233,3 +274,35 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 
 	return n.loadFilesRoot()
 }
+
+// newBlockstore returns a blockstore on d, compressing the blocks with the
+// given codec unless it is empty.
+func newBlockstore(d ds.Batching, codec string) (bstore.Blockstore, error) {
+	if codec == "" {
+		return bstore.NewBlockstore(d), nil
+	}
+	return bstore.NewCompressedBlockstore(d, codec)
+}
+
+func tierOpts(tc *cfg.Tiering) (bstore.TierOpts, error) {
+	opts := bstore.DefaultTierOpts()
+	if ds.NewKey(tc.ColdPrefix).String() == "/" {
+		return opts, errors.New("Datastore.Tiering.ColdPrefix must be set")
+	}
+
+	if tc.HotSize != "" {
+		size, err := humanize.ParseBytes(tc.HotSize)
+		if err != nil {
+			return opts, err
+		}
+		opts.HotSize = size
+	}
+	if tc.MaxAge != "" {
+		age, err := time.ParseDuration(tc.MaxAge)
+		if err != nil {
+			return opts, err
+		}
+		opts.MaxAge = age
+	}
+	return opts, nil
+}
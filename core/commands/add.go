@@ -16,6 +16,7 @@ import (
 	dag "github.com/scroot/go-ipfs/merkledag"
 	dagtest "github.com/scroot/go-ipfs/merkledag/test"
 	mfs "github.com/scroot/go-ipfs/mfs"
+	ignore "github.com/scroot/go-ipfs/thirdparty/ignore"
 	ft "github.com/scroot/go-ipfs/unixfs"
 
 	mh "gx/ipfs/QmVGtdTZdTFaLsaj2RwdVG8jcjNNcp1DE914DKZ2kHmXHw/go-multihash"
@@ -27,21 +28,28 @@ import (
 var ErrDepthLimitExceeded = fmt.Errorf("depth limit exceeded")
 
 const (
-	quietOptionName       = "quiet"
-	quieterOptionName     = "quieter"
-	silentOptionName      = "silent"
-	progressOptionName    = "progress"
-	trickleOptionName     = "trickle"
-	wrapOptionName        = "wrap-with-directory"
-	hiddenOptionName      = "hidden"
-	onlyHashOptionName    = "only-hash"
-	chunkerOptionName     = "chunker"
-	pinOptionName         = "pin"
-	rawLeavesOptionName   = "raw-leaves"
-	noCopyOptionName      = "nocopy"
-	fstoreCacheOptionName = "fscache"
-	cidVersionOptionName  = "cid-version"
-	hashOptionName        = "hash"
+	quietOptionName         = "quiet"
+	quieterOptionName       = "quieter"
+	silentOptionName        = "silent"
+	progressOptionName      = "progress"
+	trickleOptionName       = "trickle"
+	wrapOptionName          = "wrap-with-directory"
+	hiddenOptionName        = "hidden"
+	onlyHashOptionName      = "only-hash"
+	chunkerOptionName       = "chunker"
+	pinOptionName           = "pin"
+	rawLeavesOptionName     = "raw-leaves"
+	noCopyOptionName        = "nocopy"
+	fstoreCacheOptionName   = "fscache"
+	cidVersionOptionName    = "cid-version"
+	hashOptionName          = "hash"
+	preserveModeOptionName  = "preserve-mode"
+	preserveMtimeOptionName = "preserve-mtime"
+	incrementalOptionName   = "incremental"
+	excludeOptionName       = "exclude"
+	includeOptionName       = "include"
+	verboseOptionName       = "verbose"
+	workersOptionName       = "workers"
 )
 
 const adderOutChanSize = 8
@@ -71,6 +79,45 @@ its filename. For example:
 You can now refer to the added file in a gateway, like so:
 
   /ipfs/QmaG4FuMqEBnQNn3C8XJ5bpW8kLs7zq2ZXgHptJHbKDDVx/example.jpg
+
+The chunker option, '-s', specifies how files are split into blocks:
+'size-[bytes]' makes fixed size blocks, while 'rabin', 'buzhash' and
+'fastcdc' find block boundaries from the content, so that data shifted
+within a file still deduplicates. The content-defined chunkers take an
+average size, as in 'buzhash-[avg]', or bounds, as in
+'fastcdc-[min]-[avg]-[max]'. Buzhash and FastCDC are much faster than
+Rabin. 'tar' starts a new block at every member header and body of a
+tar stream, and 'lines-[max]' ends blocks on line boundaries, which
+suits logs and other text files. The default is 'size-262144'.
+
+The '--preserve-mode' and '--preserve-mtime' options record the
+permissions and the modification time of the added files and
+directories, so that 'ipfs get' can restore them. Both are off by
+default, as they change the resulting hashes. Directories large enough
+to be sharded don't keep their attributes.
+
+Files are chunked and hashed by as many goroutines as there are CPUs.
+Use '--workers' to change their number, for instance to 1 to leave the
+other cores to the rest of the system.
+
+The '--incremental' option keeps a journal of the files added, with
+their size and modification time, in the repo. Files which didn't change
+since they were last added with the same options aren't read and hashed
+again, so re-running an interrupted 'ipfs add -r --incremental' resumes
+where it stopped, and later runs only hash the modified files. The
+resulting hashes are the same as without the option. Files whose blocks
+aren't all in the repo anymore are added again, and 'ipfs repo gc' prunes
+the journal of the files whose blocks it collected.
+
+When adding directories, the paths matching the '--exclude' patterns
+are skipped. Patterns are comma separated and follow the rules of
+gitignore files: '*.log' matches log files at any depth, '/build' only
+at the top of the added directory, 'tmp/' only directories, and '**'
+any number of directories. The patterns listed in the .ipfsignore files
+of the added directories apply to these directories and their content.
+'--include' patterns re-include the paths they match, and take
+precedence over all the others. Use '--verbose' to list the skipped
+paths.
 `,
 	},
 
@@ -94,6 +141,14 @@ You can now refer to the added file in a gateway, like so:
 		cmds.BoolOption(fstoreCacheOptionName, "Check the filestore for pre-existing blocks. (experimental)"),
 		cmds.IntOption(cidVersionOptionName, "Cid version. Non-zero value will change default of 'raw-leaves' to true. (experimental)").Default(0),
 		cmds.StringOption(hashOptionName, "Hash function to use. Will set Cid version to 1 if used. (experimental)").Default("sha2-256"),
+		cmds.BoolOption(preserveModeOptionName, "Record the unix permissions of the added files."),
+		cmds.BoolOption(preserveMtimeOptionName, "Record the modification time of the added files."),
+		cmds.BoolOption(incrementalOptionName, "Skip the files unchanged since they were last added."),
+		cmds.StringOption(excludeOptionName, "Comma separated patterns of the paths to skip when adding directories."),
+		cmds.StringOption(includeOptionName, "Comma separated patterns of the paths to add even when excluded."),
+		cmds.BoolOption(verboseOptionName, "v", "Write the paths skipped by the ignore rules."),
+		cmds.IntOption(workersOptionName, "Number of goroutines hashing the file chunks. Defaults to the number of CPUs."),
+		namespaceOption,
 	},
 	PreRun: func(req cmds.Request) error {
 		quiet, _, _ := req.Option(quietOptionName).Bool()
@@ -137,7 +192,7 @@ You can now refer to the added file in a gateway, like so:
 		return nil
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -169,6 +224,24 @@ You can now refer to the added file in a gateway, like so:
 		fscache, _, _ := req.Option(fstoreCacheOptionName).Bool()
 		cidVer, _, _ := req.Option(cidVersionOptionName).Int()
 		hashFunStr, hfset, _ := req.Option(hashOptionName).String()
+		preserveMode, _, _ := req.Option(preserveModeOptionName).Bool()
+		preserveMtime, _, _ := req.Option(preserveMtimeOptionName).Bool()
+		incremental, _, _ := req.Option(incrementalOptionName).Bool()
+		exclude, _, _ := req.Option(excludeOptionName).String()
+		include, _, _ := req.Option(includeOptionName).String()
+		verbose, _, _ := req.Option(verboseOptionName).Bool()
+		workers, wset, _ := req.Option(workersOptionName).Int()
+
+		if wset && workers < 1 {
+			res.SetError(fmt.Errorf("%s must be at least 1", workersOptionName), cmds.ErrClient)
+			return
+		}
+
+		rules, err := ignore.New(ignore.SplitPatterns(exclude), ignore.SplitPatterns(include))
+		if err != nil {
+			res.SetError(err, cmds.ErrClient)
+			return
+		}
 
 		if nocopy && !cfg.Experimental.FilestoreEnabled {
 			res.SetError(errors.New("filestore is not enabled, see https://git.io/vy4XN"),
@@ -255,6 +328,22 @@ You can now refer to the added file in a gateway, like so:
 		fileAdder.RawLeaves = rawblks
 		fileAdder.NoCopy = nocopy
 		fileAdder.Prefix = &prefix
+		fileAdder.PreserveMode = preserveMode
+		fileAdder.PreserveMtime = preserveMtime
+		fileAdder.Ignore = rules
+		fileAdder.ReportIgnored = verbose
+		if wset {
+			fileAdder.Workers = workers
+		}
+
+		// hashes computed with --only-hash aren't stored, don't record them
+		if incremental && !hash {
+			fileAdder.Journal = n.Repo.Datastore()
+			if n.Namespace != nil {
+				// the files added in other namespaces aren't referenced in this one
+				fileAdder.Journal = n.Namespace.Datastore()
+			}
+		}
 
 		if hash {
 			md := dagtest.Mock()
@@ -354,7 +443,12 @@ You can now refer to the added file in a gateway, like so:
 					break LOOP
 				}
 				output := out.(*coreunix.AddedObject)
-				if len(output.Hash) > 0 {
+				if output.Ignored {
+					if progress {
+						fmt.Fprintf(res.Stderr(), "\033[2K\r")
+					}
+					fmt.Fprintf(res.Stderr(), "excluded %s\n", output.Name)
+				} else if len(output.Hash) > 0 {
 					lastHash = output.Hash
 					if quieter {
 						continue
@@ -59,6 +59,9 @@ on raw IPFS blocks. It outputs the following to stdout:
 	Arguments: []cmds.Argument{
 		cmds.StringArg("key", true, false, "The base58 multihash of an existing block to stat.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		namespaceOption,
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		b, err := getBlockForKey(req, req.Arguments()[0])
 		if err != nil {
@@ -92,6 +95,9 @@ It outputs to stdout, and <key> is a base58 encoded multihash.
 	Arguments: []cmds.Argument{
 		cmds.StringArg("key", true, false, "The base58 multihash of an existing block to get.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		namespaceOption,
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		b, err := getBlockForKey(req, req.Arguments()[0])
 		if err != nil {
@@ -119,9 +125,10 @@ It reads from stdin, and <key> is a base58 encoded multihash.
 		cmds.StringOption("format", "f", "cid format for blocks to be created with.").Default("v0"),
 		cmds.StringOption("mhtype", "multihash hash function").Default("sha2-256"),
 		cmds.IntOption("mhlen", "multihash hash length").Default(-1),
+		namespaceOption,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -212,7 +219,7 @@ func getBlockForKey(req cmds.Request, skey string) (blocks.Block, error) {
 		return nil, fmt.Errorf("zero length cid invalid")
 	}
 
-	n, err := req.InvocContext().GetNode()
+	n, err := getNamespacedNode(req)
 	if err != nil {
 		return nil, err
 	}
@@ -245,9 +252,10 @@ It takes a list of base58 encoded multihashs to remove.
 	Options: []cmds.Option{
 		cmds.BoolOption("force", "f", "Ignore nonexistent blocks.").Default(false),
 		cmds.BoolOption("quiet", "q", "Write minimal output.").Default(false),
+		namespaceOption,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -21,8 +21,11 @@ var CatCmd = &cmds.Command{
 	Arguments: []cmds.Argument{
 		cmds.StringArg("ipfs-path", true, true, "The path to the IPFS object(s) to be outputted.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		namespaceOption,
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		node, err := req.InvocContext().GetNode()
+		node, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -50,10 +50,27 @@ The resolver can recursively resolve:
 		cmds.BoolOption("recursive", "r", "Resolve until the result is not a DNS link.").Default(false),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		txt, err := namesys.NewTXTResolver(cfg.DNS.Servers, cfg.DNS.Resolvers)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
 
 		recursive, _, _ := req.Option("recursive").Bool()
 		name := req.Arguments()[0]
-		resolver := namesys.NewDNSResolver()
+		resolver := namesys.NewDNSResolverWithLookup(txt, 0)
 
 		depth := 1
 		if recursive {
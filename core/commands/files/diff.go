@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	cmds "github.com/scroot/go-ipfs/commands"
+	diff "github.com/scroot/go-ipfs/unixfs/diff"
+
+	u "gx/ipfs/QmWbjfz3u6HkAdPh34dgPchGbQjob6LXLhAeCGii2TX69n/go-ipfs-util"
+)
+
+// FilesDiffChange is a path added, removed or modified between two trees.
+type FilesDiffChange struct {
+	Type       string
+	Path       string
+	Before     string `json:",omitempty"`
+	After      string `json:",omitempty"`
+	BeforeSize uint64 `json:",omitempty"`
+	AfterSize  uint64 `json:",omitempty"`
+	Err        string `json:",omitempty"`
+}
+
+var FilesDiffCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Display the files changed between two directories.",
+		ShortDescription: `
+Compare two unixfs trees, from the files API or from /ipfs/ paths, and list
+the paths added, removed and modified, with their hashes and the cumulative
+sizes of their DAGs:
+
+    $ ipfs files diff /ipfs/QmOld /data
+    ~ QmNgd5cz2jNftnAHBhcRUGdtiaMzb5Rhjqd4etondHHST8 14 QmRfFVsjSXkhFxrfWnLpMae2M4GBVsry6VAuYYcji5MiZb 18 "bar"
+    + QmcmRptkSPWhptCttgHg27QNDmnV33wAJyUkCnAvqD3eCD 1090 "baz/new"
+    - QmegHcnrPgMwC7tBiMxChD54fgQMBUecNw9nE9UUU4x1bz 22 "giraffe"
+
+Subtrees with the same hash on both sides are skipped without being fetched,
+and sharded directories are compared shard by shard. Added and removed
+directories are listed once, without their content. Changes are written as
+they are found.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("a", true, false, "Path to diff against."),
+		cmds.StringArg("b", true, false, "Path to diff."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		ctx := req.Context()
+
+		var paths [2]string
+		for i, p := range req.Arguments() {
+			paths[i], err = checkPath(p)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		a, err := getNodeFromPath(ctx, n, paths[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		b, err := getNodeFromPath(ctx, n, paths[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		out := make(chan interface{})
+		res.SetOutput((<-chan interface{})(out))
+
+		go func() {
+			defer close(out)
+
+			err := diff.Diff(ctx, n.DAG, a, b, func(c *diff.Change) error {
+				o := &FilesDiffChange{
+					Type:       c.Type.String(),
+					Path:       c.Path,
+					BeforeSize: c.BeforeSize,
+					AfterSize:  c.AfterSize,
+				}
+				if c.Before != nil {
+					o.Before = c.Before.String()
+				}
+				if c.After != nil {
+					o.After = c.After.String()
+				}
+
+				select {
+				case out <- o:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil {
+				select {
+				case out <- &FilesDiffChange{Err: err.Error()}:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	},
+	Type: FilesDiffChange{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			outChan, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			marshal := func(v interface{}) (io.Reader, error) {
+				c, ok := v.(*FilesDiffChange)
+				if !ok {
+					return nil, u.ErrCast()
+				}
+
+				if c.Err != "" {
+					return nil, errors.New(c.Err)
+				}
+
+				var line string
+				switch c.Type {
+				case "added":
+					line = fmt.Sprintf("+ %s %d %q\n", c.After, c.AfterSize, c.Path)
+				case "removed":
+					line = fmt.Sprintf("- %s %d %q\n", c.Before, c.BeforeSize, c.Path)
+				default:
+					line = fmt.Sprintf("~ %s %d %s %d %q\n", c.Before, c.BeforeSize, c.After, c.AfterSize, c.Path)
+				}
+				return strings.NewReader(line), nil
+			}
+
+			return &cmds.ChannelMarshaler{
+				Channel:   outChan,
+				Marshaler: marshal,
+				Res:       res,
+			}, nil
+		},
+	},
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	gopath "path"
 	"strings"
+	"time"
 
 	cmds "github.com/scroot/go-ipfs/commands"
 	core "github.com/scroot/go-ipfs/core"
@@ -45,15 +46,18 @@ operations.
 		cmds.BoolOption("f", "flush", "Flush target and ancestors after write.").Default(true),
 	},
 	Subcommands: map[string]*cmds.Command{
-		"read":  FilesReadCmd,
-		"write": FilesWriteCmd,
-		"mv":    FilesMvCmd,
-		"cp":    FilesCpCmd,
-		"ls":    FilesLsCmd,
-		"mkdir": FilesMkdirCmd,
-		"stat":  FilesStatCmd,
-		"rm":    FilesRmCmd,
-		"flush": FilesFlushCmd,
+		"read":     FilesReadCmd,
+		"write":    FilesWriteCmd,
+		"mv":       FilesMvCmd,
+		"cp":       FilesCpCmd,
+		"diff":     FilesDiffCmd,
+		"ls":       FilesLsCmd,
+		"mkdir":    FilesMkdirCmd,
+		"symlink":  FilesSymlinkCmd,
+		"stat":     FilesStatCmd,
+		"rm":       FilesRmCmd,
+		"flush":    FilesFlushCmd,
+		"snapshot": FilesSnapshotCmd,
 	},
 }
 
@@ -69,7 +73,7 @@ var FilesStatCmd = &cmds.Command{
 	},
 	Options: []cmds.Option{
 		cmds.StringOption("format", "Print statistics in given format. Allowed tokens: "+
-			"<hash> <size> <cumulsize> <type> <childs>. Conflicts with other format options.").Default(
+			"<hash> <size> <cumulsize> <type> <childs> <mode> <mtime> <target>. Conflicts with other format options.").Default(
 			`<hash>
 Size: <size>
 CumulativeSize: <cumulsize>
@@ -123,6 +127,9 @@ Type: <type>`),
 			s = strings.Replace(s, "<cumulsize>", fmt.Sprintf("%d", out.CumulativeSize), -1)
 			s = strings.Replace(s, "<childs>", fmt.Sprintf("%d", out.Blocks), -1)
 			s = strings.Replace(s, "<type>", out.Type, -1)
+			s = strings.Replace(s, "<mode>", out.Mode, -1)
+			s = strings.Replace(s, "<mtime>", out.Mtime, -1)
+			s = strings.Replace(s, "<target>", out.Target, -1)
 
 			fmt.Fprintln(buf, s)
 			return buf, nil
@@ -183,17 +190,32 @@ func statNode(ds dag.DAGService, fsn mfs.FSNode) (*Object, error) {
 		ndtype = "directory"
 	case mfs.TFile:
 		ndtype = "file"
+	case mfs.TSymlink:
+		ndtype = "symlink"
 	default:
 		return nil, fmt.Errorf("Unrecognized node type: %s", fsn.Type())
 	}
 
-	return &Object{
+	o := &Object{
 		Hash:           c.String(),
 		Blocks:         len(nd.Links()),
 		Size:           d.GetFilesize(),
 		CumulativeSize: cumulsize,
 		Type:           ndtype,
-	}, nil
+	}
+	if fi, ok := fsn.(*mfs.File); ok && fsn.Type() == mfs.TSymlink {
+		o.Target, err = fi.Readlink()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if mode, ok := ft.Mode(d); ok {
+		o.Mode = fmt.Sprintf("%04o", ft.ModeFromOS(mode))
+	}
+	if mtime, ok := ft.ModTime(d); ok {
+		o.Mtime = mtime.UTC().Format(time.RFC3339Nano)
+	}
+	return o, nil
 }
 
 var FilesCpCmd = &cmds.Command{
@@ -282,6 +304,9 @@ type Object struct {
 	CumulativeSize uint64
 	Blocks         int
 	Type           string
+	Mode           string `json:",omitempty"`
+	Mtime          string `json:",omitempty"`
+	Target         string `json:",omitempty"`
 }
 
 type FilesLsOutput struct {
@@ -725,6 +750,59 @@ Examples:
 	},
 }
 
+var FilesSymlinkCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Make a symbolic link.",
+		ShortDescription: `
+Create a symbolic link at <path> pointing to <target>. The target is stored
+as is: it may be relative to the directory of the link, and it does not
+need to exist.
+
+NOTE: The link path must be absolute.
+
+Examples:
+
+    $ ipfs files symlink ../data/file /test/link
+    $ ipfs files stat --format="<type> <target>" /test/link
+    symlink ../data/file
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("target", true, false, "Target of the link."),
+		cmds.StringArg("path", true, false, "Path of the link to make."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		target := req.Arguments()[0]
+		path, err := checkPath(req.Arguments()[1])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		err = mfs.Symlink(n.FilesRoot, target, path)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		flush, _, _ := req.Option("flush").Bool()
+		if flush {
+			err = mfs.FlushPath(n.FilesRoot, path)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+	},
+}
+
 var FilesFlushCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Flush a given path's data to disk.",
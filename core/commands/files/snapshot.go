@@ -0,0 +1,264 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	cmds "github.com/scroot/go-ipfs/commands"
+	objectcmd "github.com/scroot/go-ipfs/core/commands/object"
+	corerepo "github.com/scroot/go-ipfs/core/corerepo"
+	dagutils "github.com/scroot/go-ipfs/merkledag/utils"
+
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
+)
+
+type FilesSnapshotList struct {
+	Snapshots []*corerepo.Snapshot
+}
+
+var FilesSnapshotCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Record and restore versions of the files API root.",
+		ShortDescription: `
+Snapshots record the root of the files API at a point in time, and pin it so
+that it isn't garbage collected. A snapshot can be referred to by its id or
+by its label.
+
+    $ ipfs files snapshot create before-cleanup
+    1
+    $ ipfs files rm -r /data/tmp
+    $ ipfs files snapshot diff before-cleanup
+    - QmNgd5cz2jNftnAHBhcRUGdtiaMzb5Rhjqd4etondHHST8 "data/tmp"
+    $ ipfs files snapshot restore before-cleanup /data
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"create":  filesSnapshotCreateCmd,
+		"ls":      filesSnapshotLsCmd,
+		"rm":      filesSnapshotRmCmd,
+		"restore": filesSnapshotRestoreCmd,
+		"diff":    filesSnapshotDiffCmd,
+	},
+}
+
+var filesSnapshotCreateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Snapshot the current root of the files API.",
+		ShortDescription: `
+Flush the files API, pin its root and record it as a new snapshot. The id of
+the snapshot is printed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("label", false, false, "Label of the snapshot."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var label string
+		if len(req.Arguments()) > 0 {
+			label = req.Arguments()[0]
+		}
+
+		s, err := corerepo.CreateSnapshot(req.Context(), nd, label)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(s)
+	},
+	Type: corerepo.Snapshot{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			s := res.Output().(*corerepo.Snapshot)
+			return bytes.NewBufferString(fmt.Sprintf("%d\n", s.ID)), nil
+		},
+	},
+}
+
+var filesSnapshotLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the snapshots of the files API.",
+		ShortDescription: `
+List the snapshots of the files API, oldest first, with their id, root,
+creation time and label.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		snaps, err := corerepo.ListSnapshots(nd)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&FilesSnapshotList{snaps})
+	},
+	Type: FilesSnapshotList{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list := res.Output().(*FilesSnapshotList)
+			buf := new(bytes.Buffer)
+			for _, s := range list.Snapshots {
+				fmt.Fprintf(buf, "%d\t%s\t%s\t%s\n", s.ID, s.Root, s.Time.Format(time.RFC3339), s.Label)
+			}
+			return buf, nil
+		},
+	},
+}
+
+var filesSnapshotRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove a snapshot.",
+		ShortDescription: `
+Forget a snapshot. Its root is unpinned, unless another snapshot shares it, so
+that it can be garbage collected.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("snapshot", true, false, "Id or label of the snapshot."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		_, err = corerepo.RemoveSnapshot(req.Context(), nd, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var filesSnapshotRestoreCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Roll the files API back to a snapshot.",
+		ShortDescription: `
+Replace a path of the files API with its content in a snapshot. When no path
+is given, all of '/' is restored. Paths that didn't exist when the snapshot
+was taken can't be restored.
+
+    $ ipfs files snapshot restore before-cleanup
+    $ ipfs files snapshot restore 3 /data/tmp
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("snapshot", true, false, "Id or label of the snapshot."),
+		cmds.StringArg("path", false, false, "Path to restore. Default: '/'."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		s, err := corerepo.GetSnapshot(nd, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		path := "/"
+		if len(req.Arguments()) > 1 {
+			path, err = checkPath(req.Arguments()[1])
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		err = corerepo.RestoreSnapshot(req.Context(), nd, s, path)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var filesSnapshotDiffCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Display the differences between two snapshots.",
+		ShortDescription: `
+Show the changes between two snapshots, in the format of 'ipfs object diff'.
+When the second snapshot is omitted, the first one is compared with the
+current root of the files API.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("snapshot_a", true, false, "Snapshot to diff against."),
+		cmds.StringArg("snapshot_b", false, false, "Snapshot to diff. Default: the current root."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("verbose", "v", "Print extra information."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		nd, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		ctx := req.Context()
+
+		sa, err := corerepo.GetSnapshot(nd, req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		a, err := corerepo.SnapshotNode(ctx, nd, sa, "/")
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var b node.Node
+		if len(req.Arguments()) > 1 {
+			sb, err := corerepo.GetSnapshot(nd, req.Arguments()[1])
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
+			b, err = corerepo.SnapshotNode(ctx, nd, sb, "/")
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		} else {
+			b, err = corerepo.FilesRootNode(nd)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		changes, err := dagutils.Diff(ctx, nd.DAG, a, b)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&objectcmd.Changes{Changes: changes})
+	},
+	Type: objectcmd.Changes{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: objectcmd.ChangesTextMarshaler,
+	},
+}
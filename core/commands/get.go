@@ -34,6 +34,14 @@ To output a TAR archive instead of unpacked files, use '--archive' or '-a'.
 
 To compress the output with GZIP compression, use '--compress' or '-C'. You
 may also specify the level of compression by specifying '-l=<1-9>'.
+
+The mode and modification time recorded in the unixfs nodes, if any, are
+applied to the unpacked files. The others keep the defaults, or their own
+when overwritten.
+
+The setuid, setgid and sticky bits recorded in the unixfs nodes are dropped
+when unpacking the files, as anyone may have published them. Use
+'--special-bits' to keep them.
 `,
 	},
 
@@ -45,6 +53,8 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		cmds.BoolOption("archive", "a", "Output a TAR archive.").Default(false),
 		cmds.BoolOption("compress", "C", "Compress the output with GZIP compression.").Default(false),
 		cmds.IntOption("compression-level", "l", "The level of compression (1-9).").Default(-1),
+		cmds.BoolOption("special-bits", "Keep the setuid, setgid and sticky bits of the files.").Default(false),
+		namespaceOption,
 	},
 	PreRun: func(req cmds.Request) error {
 		_, err := getCompressOptions(req)
@@ -62,7 +72,7 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 			return
 		}
 
-		node, err := req.InvocContext().GetNode()
+		node, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -119,12 +129,14 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		}
 
 		archive, _, _ := req.Option("archive").Bool()
+		specialBits, _, _ := req.Option("special-bits").Bool()
 
 		gw := getWriter{
 			Out:         os.Stdout,
 			Err:         os.Stderr,
 			Archive:     archive,
 			Compression: cmplvl,
+			SpecialBits: specialBits,
 			Size:        int64(res.Length()),
 		}
 
@@ -177,6 +189,7 @@ type getWriter struct {
 
 	Archive     bool
 	Compression int
+	SpecialBits bool
 	Size        int64
 }
 
@@ -225,7 +238,7 @@ func (gw *getWriter) writeExtracted(r io.Reader, fpath string) error {
 	defer bar.Finish()
 	defer bar.Set64(gw.Size)
 
-	extractor := &tar.Extractor{fpath, bar.Add64}
+	extractor := &tar.Extractor{Path: fpath, Progress: bar.Add64, SpecialBits: gw.SpecialBits}
 	return extractor.Extract(r)
 }
 
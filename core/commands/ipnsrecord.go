@@ -0,0 +1,273 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	cmds "github.com/scroot/go-ipfs/commands"
+	namesys "github.com/scroot/go-ipfs/namesys"
+	pb "github.com/scroot/go-ipfs/namesys/pb"
+	path "github.com/scroot/go-ipfs/path"
+
+	ci "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+	routing "gx/ipfs/QmP1wMAqk6aZYRZirbaAwmrNeqFRgQrwBt3orUtvSa1UYD/go-libp2p-routing"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
+)
+
+var IpnsRecordCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create and import signed IPNS records.",
+		ShortDescription: `
+'ipfs name record' allows signing IPNS records on one machine and
+publishing them from another one. This way the private key of a name never
+has to be present on a node connected to the network.
+
+Create a record on an offline machine:
+
+  > ipfs name record create --key=mykey /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy > record.bin
+
+Then put it into the routing system from an online one:
+
+  > ipfs name record put QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n record.bin
+  Published to QmbCMUZw6JFeZ7Wp9jkzbye3Fzp2GGcPgC3nmeUjfVF87n: /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"create": ipnsRecordCreateCmd,
+		"put":    ipnsRecordPutCmd,
+	},
+}
+
+var ipnsRecordCreateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create a signed IPNS record without publishing it.",
+		ShortDescription: `
+'ipfs name record create' signs an IPNS record pointing to <ipfs-path> and
+writes the marshalled record to stdout. The routing system is never
+contacted, so this command can be run on a machine without network access.
+
+Unless --sequence is given, the sequence number of the new record is one more
+than the highest of the one of the last record found in the local datastore
+for that key and the ones of the records created before by this command.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, false, "ipfs path the record will point to.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("lifetime", "t",
+			`Time duration that the record will be valid for. <<default>>
+    This accepts durations such as "300s", "1.5h" or "2h45m". Valid time units are
+    "ns", "us" (or "µs"), "ms", "s", "m", "h".`).Default("24h"),
+		cmds.StringOption("ttl", "Time duration this record should be cached for (caution: experimental)."),
+		cmds.StringOption("key", "k", "Name of the key to be used or a valid PeerID, as listed by 'ipfs key list -l'. Default: <<default>>.").Default("self"),
+		cmds.UintOption("sequence", "s", "Sequence number of the record."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		pth, err := path.ParsePath(req.Arguments()[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		validtime, _, _ := req.Option("lifetime").String()
+		d, err := time.ParseDuration(validtime)
+		if err != nil {
+			res.SetError(fmt.Errorf("error parsing lifetime option: %s", err), cmds.ErrNormal)
+			return
+		}
+
+		kname, _, _ := req.Option("key").String()
+		k, err := keylookup(n, kname)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		seq, found, err := req.Option("sequence").Uint()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		id, err := peer.IDFromPrivateKey(k)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		seqnum := uint64(seq)
+		if !found {
+			seqnum, err = namesys.NextSequence(n.Repo.Datastore(), id)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		entry, err := namesys.CreateRoutingEntryData(k, pth, seqnum, time.Now().Add(d))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if ttl, found, _ := req.Option("ttl").String(); found {
+			d, err := time.ParseDuration(ttl)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+
+			entry.Ttl = proto.Uint64(uint64(d.Nanoseconds()))
+		}
+
+		data, err := proto.Marshal(entry)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if err := namesys.SetIssuedSequence(n.Repo.Datastore(), id, seqnum); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(bytes.NewReader(data))
+	},
+}
+
+var ipnsRecordPutCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Publish a signed IPNS record to the routing system.",
+		ShortDescription: `
+'ipfs name record put' reads a record created by 'ipfs name record create'
+and pushes it to the routing system under <name>. The signature, EOL and
+sequence number of the record are validated first; a record older than the
+one currently published is rejected.
+
+The public key of <name> must be known to this node, either because it is
+in the local keystore or peerstore, or because it can be found through the
+routing system.
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The IPNS name (PeerID) the record is published under."),
+		cmds.FileArg("record", true, false, "File containing the marshalled IPNS record.").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if !n.OnlineMode() {
+			err := n.SetupOfflineRouting()
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
+		if n.Mounts.Ipns != nil && n.Mounts.Ipns.IsActive() {
+			res.SetError(errors.New("cannot manually publish while IPNS is mounted"), cmds.ErrNormal)
+			return
+		}
+
+		name := strings.TrimPrefix(req.Arguments()[0], "/ipns/")
+		id, err := peer.IDB58Decode(name)
+		if err != nil {
+			res.SetError(fmt.Errorf("invalid IPNS name %q: %s", name, err), cmds.ErrNormal)
+			return
+		}
+
+		file, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		err = file.Close()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		entry := new(pb.IpnsEntry)
+		err = proto.Unmarshal(data, entry)
+		if err != nil {
+			res.SetError(fmt.Errorf("invalid IPNS record: %s", err), cmds.ErrNormal)
+			return
+		}
+
+		pubk, err := recordPubKey(req, id)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		err = namesys.PutRoutingEntry(req.Context(), n.Routing, pubk, entry)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&IpnsEntry{
+			Name:  id.Pretty(),
+			Value: string(entry.GetValue()),
+		})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			v := res.Output().(*IpnsEntry)
+			s := fmt.Sprintf("Published to %s: %s\n", v.Name, v.Value)
+			return strings.NewReader(s), nil
+		},
+	},
+	Type: IpnsEntry{},
+}
+
+// recordPubKey finds the public key for the given IPNS name, looking at the
+// local keystore and peerstore first and falling back to the routing system.
+func recordPubKey(req cmds.Request, id peer.ID) (ci.PubKey, error) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		return nil, err
+	}
+
+	if sk, err := keylookup(n, id.Pretty()); err == nil {
+		return sk.GetPublic(), nil
+	}
+
+	if pk := n.Peerstore.PubKey(id); pk != nil {
+		return pk, nil
+	}
+
+	pk, err := routing.GetPublicKey(n.Routing, req.Context(), []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("could not find public key for %s: %s", id.Pretty(), err)
+	}
+
+	return pk, nil
+}
@@ -11,6 +11,8 @@ import (
 	"text/tabwriter"
 
 	cmds "github.com/scroot/go-ipfs/commands"
+	repo "github.com/scroot/go-ipfs/repo"
+	fsrepo "github.com/scroot/go-ipfs/repo/fsrepo"
 
 	ci "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
 	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
@@ -245,6 +247,13 @@ var keyRenameCmd = &cmds.Command{
 			return
 		}
 
+		for _, k := range []string{name, newName} {
+			if err := checkDatastoreKey(n.Repo, k); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+
 		oldKey, err := ks.Get(name)
 		if err != nil {
 			res.SetError(fmt.Errorf("no key named %s was found", name), cmds.ErrNormal)
@@ -342,6 +351,10 @@ var keyRmCmd = &cmds.Command{
 				res.SetError(fmt.Errorf("cannot remove key with name 'self'"), cmds.ErrNormal)
 				return
 			}
+			if err := checkDatastoreKey(n.Repo, name); err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
 
 			removed, err := n.Repo.Keystore().Get(name)
 			if err != nil {
@@ -376,6 +389,25 @@ var keyRmCmd = &cmds.Command{
 	Type: KeyOutputList{},
 }
 
+// checkDatastoreKey fails when the datastore of r is encrypted with the key
+// name, which then can't be removed, renamed or overwritten.
+func checkDatastoreKey(r repo.Repo, name string) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	keys, err := fsrepo.DatastoreKeys(cfg)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if k == name {
+			return fmt.Errorf("key %s encrypts the datastore, it can't be removed, renamed or overwritten", name)
+		}
+	}
+	return nil
+}
+
 func keyOutputListMarshaler(res cmds.Response) (io.Reader, error) {
 	withId, _, _ := res.Request().Option("l").Bool()
 
@@ -58,5 +58,6 @@ Resolve the value of a dnslink:
 	Subcommands: map[string]*cmds.Command{
 		"publish": PublishCmd,
 		"resolve": IpnsCmd,
+		"record":  IpnsRecordCmd,
 	},
 }
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	cmds "github.com/scroot/go-ipfs/commands"
+	core "github.com/scroot/go-ipfs/core"
+
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
+)
+
+// namespaceOption is taken by the commands which can work in a namespace
+// instead of the default one.
+var namespaceOption = cmds.StringOption("namespace", "Work in the given namespace, see 'ipfs namespace'.")
+
+// getNamespacedNode returns the node of the request, working in the
+// namespace given with --namespace, if any.
+func getNamespacedNode(req cmds.Request) (*core.IpfsNode, error) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		return nil, err
+	}
+
+	name, _, err := req.Option("namespace").String()
+	if err != nil || name == "" {
+		return n, err
+	}
+	return n.WithNamespace(name)
+}
+
+var NamespaceCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Interact with the namespaces of the node.",
+		ShortDescription: `
+Namespaces have their own pins, quota and garbage collection, while sharing
+the blockstore and the network of the node. They are configured in
+'Namespaces', and selected with the --namespace option of the 'add', 'cat',
+'get', 'pin', 'block', 'repo gc' and 'repo stat' commands.
+
+The blocks are stored once, whatever the number of namespaces referencing
+them, and accounted to each of these namespaces.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls": namespaceLsCmd,
+	},
+}
+
+// NamespaceOutput is the usage of a namespace.
+type NamespaceOutput struct {
+	Name       string
+	Usage      uint64 // size in bytes of the blocks it references
+	StorageMax uint64 // quota in bytes, 0 when unlimited
+}
+
+type NamespaceList struct {
+	Namespaces []NamespaceOutput
+}
+
+var namespaceLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the namespaces of the node and their usage.",
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("human", "Output sizes in a human readable format.").Default(false),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		var names []string
+		for name := range cfg.Namespaces {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		list := &NamespaceList{Namespaces: []NamespaceOutput{}}
+		for _, name := range names {
+			nn, err := n.WithNamespace(name)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			list.Namespaces = append(list.Namespaces, NamespaceOutput{
+				Name:       name,
+				Usage:      nn.Namespace.Usage(),
+				StorageMax: nn.Namespace.Quota(),
+			})
+		}
+		res.SetOutput(list)
+	},
+	Type: NamespaceList{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*NamespaceList)
+			if !ok {
+				return nil, errors.New("failed to cast NamespaceList")
+			}
+			human, _, err := res.Request().Option("human").Bool()
+			if err != nil {
+				return nil, err
+			}
+
+			size := func(s uint64) string {
+				if human {
+					return humanize.Bytes(s)
+				}
+				return fmt.Sprint(s)
+			}
+			buf := new(bytes.Buffer)
+			w := tabwriter.NewWriter(buf, 1, 2, 1, ' ', 0)
+			for _, ns := range list.Namespaces {
+				max := "unlimited"
+				if ns.StorageMax != 0 {
+					max = size(ns.StorageMax)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t\n", ns.Name, size(ns.Usage), max)
+			}
+			w.Flush()
+			return buf, nil
+		},
+	},
+}
@@ -95,32 +95,36 @@ Example:
 	},
 	Type: Changes{},
 	Marshalers: cmds.MarshalerMap{
-		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			verbose, _, _ := res.Request().Option("v").Bool()
-			changes := res.Output().(*Changes)
-			buf := new(bytes.Buffer)
-			for _, change := range changes.Changes {
-				if verbose {
-					switch change.Type {
-					case dagutils.Add:
-						fmt.Fprintf(buf, "Added new link %q pointing to %s.\n", change.Path, change.After)
-					case dagutils.Mod:
-						fmt.Fprintf(buf, "Changed %q from %s to %s.\n", change.Path, change.Before, change.After)
-					case dagutils.Remove:
-						fmt.Fprintf(buf, "Removed link %q (was %s).\n", change.Path, change.Before)
-					}
-				} else {
-					switch change.Type {
-					case dagutils.Add:
-						fmt.Fprintf(buf, "+ %s %q\n", change.After, change.Path)
-					case dagutils.Mod:
-						fmt.Fprintf(buf, "~ %s %s %q\n", change.Before, change.After, change.Path)
-					case dagutils.Remove:
-						fmt.Fprintf(buf, "- %s %q\n", change.Before, change.Path)
-					}
-				}
-			}
-			return buf, nil
-		},
+		cmds.Text: ChangesTextMarshaler,
 	},
 }
+
+// ChangesTextMarshaler prints the Changes output of a command, in more
+// detail when its "v" option is set.
+var ChangesTextMarshaler = func(res cmds.Response) (io.Reader, error) {
+	verbose, _, _ := res.Request().Option("v").Bool()
+	changes := res.Output().(*Changes)
+	buf := new(bytes.Buffer)
+	for _, change := range changes.Changes {
+		if verbose {
+			switch change.Type {
+			case dagutils.Add:
+				fmt.Fprintf(buf, "Added new link %q pointing to %s.\n", change.Path, change.After)
+			case dagutils.Mod:
+				fmt.Fprintf(buf, "Changed %q from %s to %s.\n", change.Path, change.Before, change.After)
+			case dagutils.Remove:
+				fmt.Fprintf(buf, "Removed link %q (was %s).\n", change.Path, change.Before)
+			}
+		} else {
+			switch change.Type {
+			case dagutils.Add:
+				fmt.Fprintf(buf, "+ %s %q\n", change.After, change.Path)
+			case dagutils.Mod:
+				fmt.Fprintf(buf, "~ %s %s %q\n", change.Before, change.After, change.Path)
+			case dagutils.Remove:
+				fmt.Fprintf(buf, "- %s %q\n", change.Before, change.Path)
+			}
+		}
+	}
+	return buf, nil
+}
@@ -54,10 +54,11 @@ var addPinCmd = &cmds.Command{
 	Options: []cmds.Option{
 		cmds.BoolOption("recursive", "r", "Recursively pin the object linked to by the specified object(s).").Default(true),
 		cmds.BoolOption("progress", "Show progress"),
+		namespaceOption,
 	},
 	Type: AddPinOutput{},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -184,10 +185,11 @@ collected if needed. (By default, recursively. Use -r=false for direct pins.)
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("recursive", "r", "Recursively unpin the object linked to by the specified object(s).").Default(true),
+		namespaceOption,
 	},
 	Type: PinOutput{},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -274,9 +276,10 @@ Example:
 	Options: []cmds.Option{
 		cmds.StringOption("type", "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\".").Default("all"),
 		cmds.BoolOption("quiet", "q", "Write just hashes of objects.").Default(false),
+		namespaceOption,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -351,10 +354,11 @@ new pin and removing the old one.
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("unpin", "Remove the old pin.").Default(true),
+		namespaceOption,
 	},
 	Type: PinOutput{},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -424,9 +428,10 @@ var verifyPinCmd = &cmds.Command{
 	Options: []cmds.Option{
 		cmds.BoolOption("verbose", "Also write the hashes of non-broken pins."),
 		cmds.BoolOption("quiet", "q", "Write just hashes of broken pins."),
+		namespaceOption,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -12,9 +13,10 @@ import (
 
 	cmds "github.com/scroot/go-ipfs/commands"
 	core "github.com/scroot/go-ipfs/core"
+	pubsub "github.com/scroot/go-ipfs/pubsub"
 	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
 
-	floodsub "gx/ipfs/QmUpeULWfmtsgCnfuRN3BHsfhHvBxNphoYh4La4CMxGt2Z/floodsub"
+	ci "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
 	u "gx/ipfs/QmWbjfz3u6HkAdPh34dgPchGbQjob6LXLhAeCGii2TX69n/go-ipfs-util"
 	pstore "gx/ipfs/QmXZSd1qR5BxZkPyuwfT5jpqQFScZccoZvDneXsKzCNHWX/go-libp2p-peerstore"
 	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
@@ -34,10 +36,11 @@ To use, the daemon must be run with '--enable-pubsub-experiment'.
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"pub":   PubsubPubCmd,
-		"sub":   PubsubSubCmd,
-		"ls":    PubsubLsCmd,
-		"peers": PubsubPeersCmd,
+		"pub":     PubsubPubCmd,
+		"sub":     PubsubSubCmd,
+		"ls":      PubsubLsCmd,
+		"peers":   PubsubPeersCmd,
+		"persist": PubsubPersistCmd,
 	},
 }
 
@@ -60,6 +63,24 @@ to be used in a production environment.
 
 To use, the daemon must be run with '--enable-pubsub-experiment'.
 
+Messages published with 'ipfs pubsub pub --sign' carry the signature of
+their sender. The "signatureValid" field tells whether the signature checks
+out, in which case the "from" field of the message is the signing peer. Use
+--verify to only receive messages with a valid signature. Signed messages
+received again, as replayed by other peers, are dropped.
+
+Messages published with 'ipfs pubsub pub --key=<name>' are encrypted with
+a key derived from the named key of the keystore. Pass the same --key to
+decrypt them; encrypted messages which can't be decrypted are dropped, as are
+the messages which aren't encrypted. The "encrypted" field is set on the
+decrypted messages.
+
+With --since, messages received by a persistent subscription on the topic
+(see 'ipfs pubsub persist') are replayed before new ones are output. Each of
+them carries an "index" field: reconnecting with --since=<last index + 1>
+resumes the stream without missing messages. --since also accepts a RFC3339
+time, such as "2017-06-01T10:00:00Z".
+
 This command outputs data in the following encodings:
   * "json"
 (Specified by the "--encoding" or "--enc" flag)
@@ -70,6 +91,9 @@ This command outputs data in the following encodings:
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("discover", "try to discover other peers subscribed to the same topic"),
+		cmds.BoolOption("verify", "Only output messages with a valid sender signature.").Default(false),
+		cmds.StringOption("key", "k", "Name of the keystore key used to decrypt messages."),
+		cmds.StringOption("since", "Replay the stored messages from a message index or a time."),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
@@ -90,6 +114,25 @@ This command outputs data in the following encodings:
 		}
 
 		topic := req.Arguments()[0]
+		verify, _, _ := req.Option("verify").Bool()
+
+		topicKey, err := pubsubTopicKey(req, n)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if sincestr, found, _ := req.Option("since").String(); found {
+			since, err := pubsub.ParseSince(sincestr)
+			if err != nil {
+				res.SetError(err, cmds.ErrClient)
+				return
+			}
+
+			replayPubsub(req, res, n, topic, since, topicKey, verify)
+			return
+		}
+
 		sub, err := n.Floodsub.Subscribe(topic)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
@@ -103,7 +146,9 @@ This command outputs data in the following encodings:
 			defer sub.Cancel()
 			defer close(out)
 
-			out <- floodsub.Message{}
+			out <- PubsubMessage{}
+
+			seen := pubsub.NewSeenMessages(seenPubsubMessages)
 
 			for {
 				msg, err := sub.Next(req.Context())
@@ -114,7 +159,23 @@ This command outputs data in the following encodings:
 					return
 				}
 
-				out <- msg
+				m, err := openPubsubMessage(topic, &pubsub.StoredMessage{
+					From:     msg.GetFrom(),
+					Data:     msg.GetData(),
+					Seqno:    msg.GetSeqno(),
+					TopicIDs: msg.GetTopicIDs(),
+				}, topicKey, seen)
+				if err != nil {
+					log.Infof("pubsub: dropping message on %s: %s", topic, err)
+					continue
+				}
+
+				if verify && !m.SignatureValid {
+					log.Infof("pubsub: dropping message on %s without a valid signature", topic)
+					continue
+				}
+
+				out <- m
 			}
 		}()
 
@@ -133,21 +194,140 @@ This command outputs data in the following encodings:
 		}
 	},
 	Marshalers: cmds.MarshalerMap{
-		cmds.Text: getPsMsgMarshaler(func(m *floodsub.Message) (io.Reader, error) {
+		cmds.Text: getPsMsgMarshaler(func(m *PubsubMessage) (io.Reader, error) {
 			return bytes.NewReader(m.Data), nil
 		}),
-		"ndpayload": getPsMsgMarshaler(func(m *floodsub.Message) (io.Reader, error) {
+		"ndpayload": getPsMsgMarshaler(func(m *PubsubMessage) (io.Reader, error) {
 			m.Data = append(m.Data, '\n')
 			return bytes.NewReader(m.Data), nil
 		}),
-		"lenpayload": getPsMsgMarshaler(func(m *floodsub.Message) (io.Reader, error) {
+		"lenpayload": getPsMsgMarshaler(func(m *PubsubMessage) (io.Reader, error) {
 			buf := make([]byte, 8)
 
 			n := binary.PutUvarint(buf, uint64(len(m.Data)))
 			return io.MultiReader(bytes.NewReader(buf[:n]), bytes.NewReader(m.Data)), nil
 		}),
 	},
-	Type: floodsub.Message{},
+	Type: PubsubMessage{},
+}
+
+// PubsubMessage is a message received on a topic, as output by
+// 'ipfs pubsub sub'. The first four fields match the ones of floodsub
+// messages.
+type PubsubMessage struct {
+	From     []byte   `json:"from,omitempty"`
+	Data     []byte   `json:"data,omitempty"`
+	Seqno    []byte   `json:"seqno,omitempty"`
+	TopicIDs []string `json:"topicIDs,omitempty"`
+
+	// Signed is true when the sender signed the message. When the signature
+	// is valid, From is the signing peer.
+	Signed         bool `json:"signed,omitempty"`
+	SignatureValid bool `json:"signatureValid,omitempty"`
+
+	// Encrypted is true when the message was encrypted with the topic key.
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// Index is set on messages replayed from a persistent subscription.
+	Index *uint64 `json:"index,omitempty"`
+}
+
+// seenPubsubMessages is the number of signed messages a subscription
+// remembers to drop the ones replayed.
+const seenPubsubMessages = 4096
+
+var errPubsubReplayed = errors.New("message was already received")
+
+// openPubsubMessage unwraps a received message, checking its signature and
+// decrypting it with topicKey if needed. Signed messages already in seen are
+// rejected.
+func openPubsubMessage(topic string, msg *pubsub.StoredMessage, topicKey []byte, seen *pubsub.SeenMessages) (*PubsubMessage, error) {
+	m, err := pubsub.Open(topic, msg.Data, topicKey)
+	if err != nil {
+		return nil, err
+	}
+	if seen.Seen(m) {
+		return nil, errPubsubReplayed
+	}
+
+	out := &PubsubMessage{
+		From:      msg.From,
+		Data:      m.Data,
+		Seqno:     msg.Seqno,
+		TopicIDs:  msg.TopicIDs,
+		Signed:    m.Signed,
+		Encrypted: m.Encrypted,
+	}
+
+	if m.Valid {
+		out.From = []byte(m.Signer)
+		out.SignatureValid = true
+	}
+
+	return out, nil
+}
+
+// replayPubsub outputs the messages stored by a persistent subscription on
+// topic, followed by the new ones.
+func replayPubsub(req cmds.Request, res cmds.Response, n *core.IpfsNode, topic string, since pubsub.Since, topicKey []byte, verify bool) {
+	if n.PubsubHistory == nil {
+		res.SetError(fmt.Errorf("persistent subscriptions not available"), cmds.ErrNormal)
+		return
+	}
+
+	msgs, err := n.PubsubHistory.Replay(req.Context(), topic, since)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	out := make(chan interface{})
+	res.SetOutput((<-chan interface{})(out))
+
+	go func() {
+		defer close(out)
+
+		out <- PubsubMessage{}
+
+		seen := pubsub.NewSeenMessages(seenPubsubMessages)
+		for sm := range msgs {
+			m, err := openPubsubMessage(topic, sm, topicKey, seen)
+			if err != nil {
+				log.Infof("pubsub: dropping message %d on %s: %s", sm.Index, topic, err)
+				continue
+			}
+
+			if verify && !m.SignatureValid {
+				log.Infof("pubsub: dropping message %d on %s without a valid signature", sm.Index, topic)
+				continue
+			}
+
+			idx := sm.Index
+			m.Index = &idx
+
+			select {
+			case out <- m:
+			case <-req.Context().Done():
+				return
+			}
+		}
+	}()
+}
+
+// pubsubTopicKey returns the topic key derived from the keystore key given
+// with the --key option, or nil if the option wasn't set.
+func pubsubTopicKey(req cmds.Request, n *core.IpfsNode) ([]byte, error) {
+	kname, found, _ := req.Option("key").String()
+	if !found {
+		return nil, nil
+	}
+
+	sk, err := n.GetKey(kname)
+	if err != nil {
+		return nil, fmt.Errorf("pubsub topic key %q: %s", kname, err)
+	}
+
+	return pubsub.TopicKey(sk)
 }
 
 func connectToPubSubPeers(ctx context.Context, n *core.IpfsNode, cid *cid.Cid) {
@@ -174,7 +354,7 @@ func connectToPubSubPeers(ctx context.Context, n *core.IpfsNode, cid *cid.Cid) {
 	wg.Wait()
 }
 
-func getPsMsgMarshaler(f func(m *floodsub.Message) (io.Reader, error)) func(cmds.Response) (io.Reader, error) {
+func getPsMsgMarshaler(f func(m *PubsubMessage) (io.Reader, error)) func(cmds.Response) (io.Reader, error) {
 	return func(res cmds.Response) (io.Reader, error) {
 		outChan, ok := res.Output().(<-chan interface{})
 		if !ok {
@@ -182,11 +362,11 @@ func getPsMsgMarshaler(f func(m *floodsub.Message) (io.Reader, error)) func(cmds
 		}
 
 		marshal := func(v interface{}) (io.Reader, error) {
-			obj, ok := v.(*floodsub.Message)
+			obj, ok := v.(*PubsubMessage)
 			if !ok {
 				return nil, u.ErrCast()
 			}
-			if obj.Message == nil {
+			if obj.Data == nil {
 				return strings.NewReader(""), nil
 			}
 
@@ -211,12 +391,21 @@ This is an experimental feature. It is not intended in its current state
 to be used in a production environment.
 
 To use, the daemon must be run with '--enable-pubsub-experiment'.
+
+With --sign, messages are signed with the key of this node, so that
+subscribers can authenticate the sender. With --key, the payload is
+encrypted with a key derived from the named key of the keystore; only the
+peers holding the same key can read it.
 `,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("topic", true, false, "Topic to publish to."),
 		cmds.StringArg("data", true, true, "Payload of message to publish.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption("sign", "Sign messages with the key of this node.").Default(false),
+		cmds.StringOption("key", "k", "Name of the keystore key used to encrypt messages."),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
 		if err != nil {
@@ -237,8 +426,34 @@ To use, the daemon must be run with '--enable-pubsub-experiment'.
 
 		topic := req.Arguments()[0]
 
+		topicKey, err := pubsubTopicKey(req, n)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		sign, _, _ := req.Option("sign").Bool()
+		if sign && n.PrivateKey == nil {
+			res.SetError(fmt.Errorf("cannot sign messages: private key not loaded"), cmds.ErrNormal)
+			return
+		}
+
 		for _, data := range req.Arguments()[1:] {
-			if err := n.Floodsub.Publish(topic, []byte(data)); err != nil {
+			msg := []byte(data)
+			if sign || topicKey != nil {
+				var sk ci.PrivKey
+				if sign {
+					sk = n.PrivateKey
+				}
+
+				msg, err = pubsub.Seal(topic, msg, sk, topicKey)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+			}
+
+			if err := n.Floodsub.Publish(topic, msg); err != nil {
 				res.SetError(err, cmds.ErrNormal)
 				return
 			}
@@ -335,3 +550,146 @@ To use, the daemon must be run with '--enable-pubsub-experiment'.
 		cmds.Text: stringListMarshaler,
 	},
 }
+
+var PubsubPersistCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage persistent subscriptions.",
+		ShortDescription: `
+Persistent subscriptions are run by the daemon, and store the messages they
+receive in the repo, whether or not a client is listening. The stored
+messages can be replayed with 'ipfs pubsub sub --since'.
+
+Persistent subscriptions survive daemon restarts.
+
+This is an experimental feature. It is not intended in its current state
+to be used in a production environment.
+
+To use, the daemon must be run with '--enable-pubsub-experiment'.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": pubsubPersistAddCmd,
+		"rm":  pubsubPersistRmCmd,
+		"ls":  pubsubPersistLsCmd,
+	},
+}
+
+var pubsubPersistAddCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add a persistent subscription.",
+		ShortDescription: `
+'ipfs pubsub persist add' creates a persistent subscription called <name>
+on <topic>. The messages it keeps are bounded by --max-messages and
+--max-age; when neither is given, the last 1000 messages are kept.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the persistent subscription."),
+		cmds.StringArg("topic", true, false, "Topic to subscribe to."),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption("max-messages", "Number of messages to keep."),
+		cmds.StringOption("max-age", "Time duration messages are kept for, such as \"24h\"."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := pubsubHistory(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		s := pubsub.Subscription{
+			Name:  req.Arguments()[0],
+			Topic: req.Arguments()[1],
+		}
+
+		s.MaxMessages, _, _ = req.Option("max-messages").Int()
+		if age, found, _ := req.Option("max-age").String(); found {
+			s.MaxAge, err = time.ParseDuration(age)
+			if err != nil {
+				res.SetError(fmt.Errorf("error parsing max-age option: %s", err), cmds.ErrClient)
+				return
+			}
+		}
+
+		if err := n.PubsubHistory.Add(s); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var pubsubPersistRmCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove a persistent subscription and its stored messages.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the persistent subscription."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := pubsubHistory(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		if err := n.PubsubHistory.Remove(req.Arguments()[0]); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+	},
+}
+
+var pubsubPersistLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List persistent subscriptions.",
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := pubsubHistory(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&PubsubPersistList{n.PubsubHistory.List()})
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			list, ok := res.Output().(*PubsubPersistList)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+
+			buf := new(bytes.Buffer)
+			for _, s := range list.Subscriptions {
+				fmt.Fprintf(buf, "%s\t%s\n", s.Name, s.Topic)
+			}
+			return buf, nil
+		},
+	},
+	Type: PubsubPersistList{},
+}
+
+type PubsubPersistList struct {
+	Subscriptions []pubsub.Subscription
+}
+
+// pubsubHistory returns the node of req, making sure persistent
+// subscriptions can be used on it.
+func pubsubHistory(req cmds.Request) (*core.IpfsNode, error) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		return nil, err
+	}
+
+	// Must be online!
+	if !n.OnlineMode() {
+		return nil, errNotOnline
+	}
+
+	if n.PubsubHistory == nil {
+		return nil, fmt.Errorf("experimental pubsub feature not enabled. Run daemon with --enable-pubsub-experiment to use.")
+	}
+
+	return n, nil
+}
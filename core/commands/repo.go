@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
@@ -15,6 +16,7 @@ import (
 	config "github.com/scroot/go-ipfs/repo/config"
 	fsrepo "github.com/scroot/go-ipfs/repo/fsrepo"
 	lockfile "github.com/scroot/go-ipfs/repo/fsrepo/lock"
+	mfsr "github.com/scroot/go-ipfs/repo/fsrepo/migrations"
 
 	u "gx/ipfs/QmWbjfz3u6HkAdPh34dgPchGbQjob6LXLhAeCGii2TX69n/go-ipfs-util"
 	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
@@ -33,11 +35,15 @@ var RepoCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"gc":      repoGcCmd,
-		"stat":    repoStatCmd,
-		"fsck":    RepoFsckCmd,
-		"version": repoVersionCmd,
-		"verify":  repoVerifyCmd,
+		"gc":        repoGcCmd,
+		"stat":      repoStatCmd,
+		"fsck":      RepoFsckCmd,
+		"version":   repoVersionCmd,
+		"verify":    repoVerifyCmd,
+		"migrate":   RepoMigrateCmd,
+		"export":    repoExportCmd,
+		"import":    RepoImportCmd,
+		"reencrypt": RepoReencryptCmd,
 	},
 }
 
@@ -54,14 +60,18 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+
+With --namespace, it drops the references of the namespace to the blocks
+which aren't pinned in it, and removes the ones no other namespace needs.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("quiet", "q", "Write minimal output.").Default(false),
 		cmds.BoolOption("stream-errors", "Stream errors.").Default(false),
+		namespaceOption,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -149,16 +159,36 @@ NumObjects      int Number of objects in the local repo.
 RepoPath        string The path to the repo being currently used.
 RepoSize        int Size in bytes that the repo is currently taking.
 Version         string The repo version.
+Namespace       string The namespace, with --namespace. The sizes are then
+                the ones of the blocks the namespace references.
+
+With --verbose, it also reads all the blocks to output their sizes:
+LogicalSize     int Size in bytes of the blocks in the repo.
+PhysicalSize    int Size in bytes of the blocks as stored, once compressed.
+It counts the blocks by the codec of their CID and the type of their
+multihash, and prints the stats of the blockstore since the daemon started:
+the operations by codec and multihash type, the sizes of the blocks read and
+written, and the hit rates of the caches.
 `,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
+		n, err := getNamespacedNode(req)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
 
-		stat, err := corerepo.RepoStat(n, req.Context())
+		verbose, _, err := req.Option("verbose").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		repoStat := corerepo.RepoStat
+		if verbose {
+			repoStat = corerepo.RepoStatVerbose
+		}
+		stat, err := repoStat(n, req.Context())
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -167,7 +197,9 @@ Version         string The repo version.
 		res.SetOutput(stat)
 	},
 	Options: []cmds.Option{
-		cmds.BoolOption("human", "Output RepoSize in MiB.").Default(false),
+		cmds.BoolOption("human", "Output sizes in MiB.").Default(false),
+		cmds.BoolOption("verbose", "v", "Also output the stats of the blocks and the blockstore.").Default(false),
+		namespaceOption,
 	},
 	Type: corerepo.Stat{},
 	Marshalers: cmds.MarshalerMap{
@@ -181,6 +213,10 @@ Version         string The repo version.
 			if err != nil {
 				return nil, err
 			}
+			verbose, _, err := res.Request().Option("verbose").Bool()
+			if err != nil {
+				return nil, err
+			}
 
 			buf := new(bytes.Buffer)
 			wtr := tabwriter.NewWriter(buf, 0, 0, 1, ' ', 0)
@@ -191,6 +227,20 @@ Version         string The repo version.
 			} else {
 				fmt.Fprintf(wtr, "RepoSize:\t%d\n", stat.RepoSize)
 			}
+			if verbose {
+				logicalInMiB := stat.LogicalSize / (1024 * 1024)
+				if human && logicalInMiB > 0 {
+					fmt.Fprintf(wtr, "LogicalSize (MiB):\t%d\n", logicalInMiB)
+				} else {
+					fmt.Fprintf(wtr, "LogicalSize:\t%d\n", stat.LogicalSize)
+				}
+				physicalInMiB := stat.PhysicalSize / (1024 * 1024)
+				if human && physicalInMiB > 0 {
+					fmt.Fprintf(wtr, "PhysicalSize (MiB):\t%d\n", physicalInMiB)
+				} else {
+					fmt.Fprintf(wtr, "PhysicalSize:\t%d\n", stat.PhysicalSize)
+				}
+			}
 			maxSizeInMiB := stat.StorageMax / (1024 * 1024)
 			if human && maxSizeInMiB > 0 {
 				fmt.Fprintf(wtr, "StorageMax (MiB):\t%d\n", maxSizeInMiB)
@@ -199,6 +249,14 @@ Version         string The repo version.
 			}
 			fmt.Fprintf(wtr, "RepoPath:\t%s\n", stat.RepoPath)
 			fmt.Fprintf(wtr, "Version:\t%s\n", stat.Version)
+			if stat.Namespace != "" {
+				fmt.Fprintf(wtr, "Namespace:\t%s\n", stat.Namespace)
+			}
+			printCounts(wtr, "BlockCodecs", stat.BlockCodecs)
+			printCounts(wtr, "BlockHashes", stat.BlockHashes)
+			if stat.Blockstore != nil {
+				printBlockstoreStats(wtr, stat.Blockstore)
+			}
 			wtr.Flush()
 
 			return buf, nil
@@ -206,6 +264,69 @@ Version         string The repo version.
 	},
 }
 
+func printCounts(w io.Writer, name string, counts map[string]uint64) {
+	if len(counts) == 0 {
+		return
+	}
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "%s:\n", name)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s:\t%d\n", k, counts[k])
+	}
+}
+
+func printBlockstoreStats(w io.Writer, st *bstore.BlockstoreStats) {
+	fmt.Fprintf(w, "Blockstore:\n")
+	for _, ops := range []struct {
+		name   string
+		counts map[string]bstore.OpCounts
+	}{{"Codec", st.Codecs}, {"Hash", st.Hashes}} {
+		var keys []string
+		for k := range ops.counts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			c := ops.counts[k]
+			fmt.Fprintf(w, "  %s %s:\tgets %d, puts %d, deletes %d\n", ops.name, k, c.Gets, c.Puts, c.Deletes)
+		}
+	}
+	printSizes(w, "GetSizes", st.GetSizes)
+	printSizes(w, "PutSizes", st.PutSizes)
+	if c := st.ARCCache; c != nil {
+		fmt.Fprintf(w, "  ARCCache:\thits %d, misses %d, hit rate %.1f%%\n", c.Hits, c.Misses, 100*c.HitRate())
+	}
+	if c := st.BloomCache; c != nil {
+		fmt.Fprintf(w, "  BloomCache:\thits %d, misses %d, false positives %d, false positive rate %.1f%%\n",
+			c.Hits, c.Misses, c.FalsePositives, 100*c.FalsePositiveRate())
+	}
+}
+
+func printSizes(w io.Writer, name string, h bstore.SizeHistogram) {
+	var buckets []string
+	for i, n := range h.Counts {
+		if i < len(bstore.BlockSizeBuckets) {
+			buckets = append(buckets, fmt.Sprintf("<=%s %d", sizeLabel(bstore.BlockSizeBuckets[i]), n))
+		} else {
+			buckets = append(buckets, fmt.Sprintf(">%s %d", sizeLabel(bstore.BlockSizeBuckets[i-1]), n))
+		}
+	}
+	fmt.Fprintf(w, "  %s:\t%s, total %d bytes\n", name, strings.Join(buckets, ", "), h.Sum)
+}
+
+func sizeLabel(size uint64) string {
+	if size >= 1<<20 {
+		return fmt.Sprintf("%dMiB", size>>20)
+	}
+	return fmt.Sprintf("%dKiB", size>>10)
+}
+
 var RepoFsckCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Remove repo lockfiles.",
@@ -256,6 +377,215 @@ daemons are running.
 	},
 }
 
+var RepoMigrateCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Migrate the repo to another version.",
+		ShortDescription: `
+'ipfs repo migrate' runs the migrations built in ipfs to bring the repo to
+the version this ipfs expects, or to the one given with --to, reverting
+the migrations down to it when it's older than the repo. The repo is left
+at the version of the last migration which succeeded. This command can only
+run when no ipfs daemons are running.
+`,
+		LongDescription: `
+'ipfs repo migrate' runs the migrations built in ipfs to bring the repo to
+the version this ipfs expects, or to the one given with --to, reverting
+the migrations down to it when it's older than the repo. The repo is left
+at the version of the last migration which succeeded. This command can only
+run when no ipfs daemons are running.
+
+Repos older than the built-in migrations are first migrated with the
+fs-repo-migrations binary, found in the PATH or downloaded from
+https://dist.ipfs.io.
+
+With --dry-run, the changes the migrations would make are listed, and the
+repo is left untouched. With --backup, the repo is copied to the given
+directory before migrating it:
+
+  $ ipfs repo migrate --backup=$HOME/ipfs-backup
+`,
+	},
+	Options: []cmds.Option{
+		cmds.IntOption("to", "Version to migrate the repo to. Defaults to the one of this ipfs."),
+		cmds.BoolOption("dry-run", "List the changes without making them.").Default(false),
+		cmds.StringOption("backup", "Copy the repo to this directory before migrating it."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		to, found, err := req.Option("to").Int()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !found {
+			to = fsrepo.RepoVersion
+		}
+		dryRun, _, err := req.Option("dry-run").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		backup, _, err := req.Option("backup").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		var log bytes.Buffer
+		err = fsrepo.Migrate(req.InvocContext().ConfigRoot, to, mfsr.Options{
+			DryRun: dryRun,
+			Backup: backup,
+			Log:    &log,
+		})
+		if err != nil {
+			res.SetError(fmt.Errorf("%s%s", log.String(), err), cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&MessageOutput{log.String()})
+	},
+	Type: MessageOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: MessageTextMarshaler,
+	},
+}
+
+var repoExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Write an archive of the repo to stdout.",
+		ShortDescription: `
+'ipfs repo export' writes a tar archive of the repo, with its config,
+keystore, pins, files API root and IPNS records, which 'ipfs repo import'
+restores. The daemon can keep running during the export.
+`,
+		LongDescription: `
+'ipfs repo export' writes a tar archive of the repo, with its config,
+keystore, pins, files API root and IPNS records, which 'ipfs repo import'
+restores. The daemon can keep running during the export, garbage
+collections being held off until it completes.
+
+The blocks written to the archive depend on --blocks:
+
+  all:    every block of the repo.
+  pinned: the blocks of the pins and of the files API, the ones a garbage
+          collection would keep.
+  roots:  only the blocks needed to load the pins and the files API. The
+          pinned content is referenced by its roots, and fetched from the
+          network once the repo is imported.
+
+The archive holds the private keys of the node, keep it safe:
+
+  $ ipfs repo export > ipfs-repo.tar
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("blocks", "Blocks to include: all, pinned or roots.").Default(corerepo.ArchiveAllBlocks),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		mode, _, err := req.Option("blocks").String()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		switch mode {
+		case corerepo.ArchiveAllBlocks, corerepo.ArchivePinnedBlocks, corerepo.ArchiveRootBlocks:
+		default:
+			res.SetError(fmt.Errorf("unknown blocks mode %q, expected all, pinned or roots", mode), cmds.ErrClient)
+			return
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := corerepo.Export(req.Context(), n, pw, mode)
+			pw.CloseWithError(err)
+		}()
+
+		res.SetOutput(pr)
+	},
+}
+
+var RepoImportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Restore a repo from an archive.",
+		ShortDescription: `
+'ipfs repo import' restores the repo archived by 'ipfs repo export' in a new
+repo, at the path of the repo ($IPFS_PATH or ~/.ipfs), which must not exist
+or be empty. The hash of every block is checked, as well as the presence of
+the pinned content, unless the archive only references it. Nothing is left
+behind when the import fails.
+`,
+		LongDescription: `
+'ipfs repo import' restores the repo archived by 'ipfs repo export' in a new
+repo, at the path of the repo ($IPFS_PATH or ~/.ipfs), which must not exist
+or be empty. The hash of every block is checked, as well as the presence of
+the pinned content, unless the archive only references it. Nothing is left
+behind when the import fails.
+
+The archive must come from an ipfs using the same repo version:
+
+  $ IPFS_PATH=/path/to/new/repo ipfs repo import ipfs-repo.tar
+
+The restored node has the identity of the exported one, the two shouldn't
+run at the same time.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("archive", true, false, "Archive written by 'ipfs repo export'.").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		file, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer file.Close()
+
+		path := req.InvocContext().ConfigRoot
+		stat, err := corerepo.Import(req.Context(), path, file)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&MessageOutput{fmt.Sprintf("imported %d keys, %d datastore entries and %d blocks to %s\n",
+			stat.Keys, stat.Entries, stat.Blocks, path)})
+	},
+	Type: MessageOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: MessageTextMarshaler,
+	},
+}
+
+var RepoReencryptCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Encrypt the datastores of the repo with their current key.",
+		ShortDescription: `
+'ipfs repo reencrypt' encrypts the values of the 'encrypted' datastores of the
+repo which were encrypted with one of their 'oldKeys' with their 'key', after
+which the old keys can be removed from the datastore spec and the keystore.
+The daemon must not be running.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		n, err := fsrepo.Reencrypt(req.InvocContext().ConfigRoot)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		res.SetOutput(&MessageOutput{fmt.Sprintf("encrypted %d values again\n", n)})
+	},
+	Type: MessageOutput{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: MessageTextMarshaler,
+	},
+}
+
 type VerifyProgress struct {
 	Message  string
 	Progress int
@@ -264,6 +594,18 @@ type VerifyProgress struct {
 var repoVerifyCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Verify all blocks in repo are not corrupted.",
+		ShortDescription: `
+'ipfs repo verify' checks that the hash of every block in the repo matches
+its content, in both tiers when Datastore.Tiering is set.
+
+With --repair, the corrupted blocks are deleted, and the blocks the pins need
+which were corrupted or are missing from the repo are fetched from the
+network, which requires the daemon to be running. The pins which can't be
+repaired are reported.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("repair", "Delete the corrupted blocks and fetch the blocks the pins miss.").Default(false),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		nd, err := req.InvocContext().GetNode()
@@ -272,36 +614,93 @@ var repoVerifyCmd = &cmds.Command{
 			return
 		}
 
+		repair, _, err := req.Option("repair").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		// the blocks of every tier
+		stores, err := corerepo.StoredBlockstores(nd.Repo)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
 		out := make(chan interface{})
 		go func() {
 			defer close(out)
-			bs := bstore.NewBlockstore(nd.Repo.Datastore())
 
-			bs.HashOnRead(true)
+			var fails, deleted int
+			var i int
+			for _, bs := range stores {
+				bs.HashOnRead(true)
 
-			keys, err := bs.AllKeysChan(req.Context())
-			if err != nil {
-				log.Error(err)
+				keys, err := bs.AllKeysChan(req.Context())
+				if err != nil {
+					log.Error(err)
+					return
+				}
+
+				for k := range keys {
+					_, err := bs.Get(k)
+					if err != nil {
+						out <- &VerifyProgress{
+							Message: fmt.Sprintf("block %s was corrupt (%s)", k, err),
+						}
+						fails++
+
+						if repair {
+							// through the node, for its caches to forget it
+							if err := nd.Blockstore.DeleteBlock(k); err != nil {
+								out <- &VerifyProgress{
+									Message: fmt.Sprintf("failed to delete block %s: %s", k, err),
+								}
+							} else {
+								deleted++
+							}
+						}
+					}
+					i++
+					out <- &VerifyProgress{Progress: i}
+				}
+			}
+			if !repair {
+				if fails == 0 {
+					out <- &VerifyProgress{Message: "verify complete, all blocks validated."}
+				} else {
+					out <- &VerifyProgress{Message: "verify complete, some blocks were corrupt."}
+				}
 				return
 			}
 
-			var fails int
-			var i int
-			for k := range keys {
-				_, err := bs.Get(k)
-				if err != nil {
+			var fetched, broken int
+			for r := range corerepo.RepairPins(req.Context(), nd) {
+				fetched += len(r.Fetched)
+				if r.Err != nil {
+					broken++
+					out <- &VerifyProgress{
+						Message: fmt.Sprintf("pin %s could not be repaired: %s", r.Pin, r.Err),
+					}
+				} else {
 					out <- &VerifyProgress{
-						Message: fmt.Sprintf("block %s was corrupt (%s)", k, err),
+						Message: fmt.Sprintf("pin %s repaired, fetched %d blocks", r.Pin, len(r.Fetched)),
 					}
-					fails++
 				}
-				i++
-				out <- &VerifyProgress{Progress: i}
 			}
-			if fails == 0 {
+			switch {
+			case broken > 0:
+				out <- &VerifyProgress{Message: "repair complete, some pins could not be repaired."}
+			case deleted < fails:
+				out <- &VerifyProgress{
+					Message: fmt.Sprintf("repair complete, deleted %d of %d corrupt blocks, the others could not be deleted.", deleted, fails),
+				}
+			case fails == 0 && fetched == 0:
 				out <- &VerifyProgress{Message: "verify complete, all blocks validated."}
-			} else {
-				out <- &VerifyProgress{Message: "verify complete, some blocks were corrupt."}
+			default:
+				out <- &VerifyProgress{
+					Message: fmt.Sprintf("repair complete, deleted %d corrupt blocks and fetched %d blocks.", deleted, fetched),
+				}
 			}
 		}()
 
@@ -320,7 +719,9 @@ var repoVerifyCmd = &cmds.Command{
 
 				buf := new(bytes.Buffer)
 				if obj.Message != "" {
-					if strings.Contains(obj.Message, "blocks were corrupt") {
+					if strings.Contains(obj.Message, "blocks were corrupt") ||
+						strings.Contains(obj.Message, "could not be repaired.") ||
+						strings.Contains(obj.Message, "could not be deleted.") {
 						return nil, fmt.Errorf(obj.Message)
 					}
 					if len(obj.Message) < 20 {
@@ -46,6 +46,7 @@ ADVANCED COMMANDS
   dns           Resolve DNS links
   pin           Pin objects to local storage
   repo          Manipulate the IPFS repository
+  namespace     Interact with the namespaces of the node
   stats         Various operational stats
   p2p           Libp2p stream mounting
   filestore     Manage the filestore (experimental)
@@ -111,6 +112,7 @@ var rootSubcommands = map[string]*cmds.Command{
 	"ls":        LsCmd,
 	"mount":     MountCmd,
 	"name":      NameCmd,
+	"namespace": NamespaceCmd,
 	"object":    ocmd.ObjectCmd,
 	"pin":       PinCmd,
 	"ping":      PingCmd,
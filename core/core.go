@@ -19,6 +19,7 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
@@ -36,6 +37,7 @@ import (
 	p2p "github.com/scroot/go-ipfs/p2p"
 	path "github.com/scroot/go-ipfs/path"
 	pin "github.com/scroot/go-ipfs/pin"
+	pshist "github.com/scroot/go-ipfs/pubsub"
 	repo "github.com/scroot/go-ipfs/repo"
 	config "github.com/scroot/go-ipfs/repo/config"
 	nilrouting "github.com/scroot/go-ipfs/routing/none"
@@ -106,6 +108,7 @@ type IpfsNode struct {
 	Mounts         Mounts     // current mount state, if any.
 	PrivateKey     ic.PrivKey // the local node's private Key
 	PNetFingerpint []byte     // fingerprint of private network
+	Namespace      *Namespace // the namespace the node works in, nil in the default one
 
 	// Services
 	Peerstore  pstore.Peerstore     // storage for other Peer instances
@@ -130,14 +133,20 @@ type IpfsNode struct {
 	Reprovider   *rp.Reprovider // the value reprovider system
 	IpnsRepub    *ipnsrp.Republisher
 
-	Floodsub *floodsub.PubSub
-	P2P      *p2p.P2P
+	Floodsub      *floodsub.PubSub
+	PubsubHistory *pshist.Manager // persistent pubsub subscriptions
+	P2P           *p2p.P2P
 
 	proc goprocess.Process
 	ctx  context.Context
 
 	mode         mode
 	localModeSet bool
+
+	// nsLk protects namespaces, the nodes working in the namespaces of
+	// this one
+	nsLk       sync.Mutex
+	namespaces map[string]*IpfsNode
 }
 
 // Mounts defines what the node's mount state is. This should
@@ -245,6 +254,11 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 
 	if pubsub {
 		n.Floodsub = floodsub.NewFloodSub(ctx, peerhost)
+
+		n.PubsubHistory, err = pshist.NewManager(ctx, n.Floodsub, n.Repo.Datastore())
+		if err != nil {
+			return err
+		}
 	}
 
 	n.P2P = p2p.NewP2P(n.Identity, n.PeerHost, n.Peerstore)
@@ -340,8 +354,13 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 		return err
 	}
 
+	txt, err := n.getTXTResolver()
+	if err != nil {
+		return err
+	}
+
 	// setup name system
-	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
+	n.Namesys = namesys.NewNameSystemWithDNS(n.Routing, n.Repo.Datastore(), txt, size)
 
 	// setup ipns republishing
 	return n.setupIpnsRepublisher()
@@ -364,6 +383,17 @@ func (n *IpfsNode) getCacheSize() (int, error) {
 	return cs, nil
 }
 
+// getTXTResolver returns the resolver used for DNSLink lookups, as set in
+// the DNS section of the config
+func (n *IpfsNode) getTXTResolver() (namesys.TXTResolver, error) {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return namesys.NewTXTResolver(cfg.DNS.Servers, cfg.DNS.Resolvers)
+}
+
 func (n *IpfsNode) setupIpnsRepublisher() error {
 	cfg, err := n.Repo.Config()
 	if err != nil {
@@ -460,6 +490,11 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, n.PeerHost)
 	}
 
+	// the blockstore saves its bloom filter to the repo
+	if c, ok := n.BaseBlocks.(io.Closer); ok {
+		closers = append(closers, c)
+	}
+
 	// Repo closed last, most things need to preserve state here
 	closers = append(closers, n.Repo)
 
@@ -601,14 +636,17 @@ func (n *IpfsNode) loadBootstrapPeers() ([]pstore.PeerInfo, error) {
 	return toPeerInfos(parsed), nil
 }
 
+// FilesRootKey is the datastore key under which the root of the files API
+// (mfs) is kept.
+var FilesRootKey = ds.NewKey("/local/filesroot")
+
 func (n *IpfsNode) loadFilesRoot() error {
-	dsk := ds.NewKey("/local/filesroot")
 	pf := func(ctx context.Context, c *cid.Cid) error {
-		return n.Repo.Datastore().Put(dsk, c.Bytes())
+		return n.Repo.Datastore().Put(FilesRootKey, c.Bytes())
 	}
 
 	var nd *merkledag.ProtoNode
-	val, err := n.Repo.Datastore().Get(dsk)
+	val, err := n.Repo.Datastore().Get(FilesRootKey)
 
 	switch {
 	case err == ds.ErrNotFound || val == nil:
@@ -667,7 +705,12 @@ func (n *IpfsNode) SetupOfflineRouting() error {
 		return err
 	}
 
-	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
+	txt, err := n.getTXTResolver()
+	if err != nil {
+		return err
+	}
+
+	n.Namesys = namesys.NewNameSystemWithDNS(n.Routing, n.Repo.Datastore(), txt, size)
 
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"net"
 	"net/http"
 
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
 	core "github.com/scroot/go-ipfs/core"
 
 	prometheus "gx/ipfs/QmX3QZ5jHEPidwUrymXV1iSCSUhdGxj15sm2gP4jKMef7B/client_golang/prometheus"
@@ -30,6 +31,28 @@ var (
 	peersTotalMetric = prometheus.NewDesc(
 		prometheus.BuildFQName("ipfs", "p2p", "peers_total"),
 		"Number of connected peers", []string{"transport"}, nil)
+
+	codecOpsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "blockstore", "codec_ops_total"),
+		"Number of operations on blocks by CID codec", []string{"op", "codec"}, nil)
+	hashOpsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "blockstore", "hash_ops_total"),
+		"Number of operations on blocks by multihash type", []string{"op", "hash"}, nil)
+	blockSizeMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "blockstore", "block_size_bytes"),
+		"Size of the blocks read and written", []string{"op"}, nil)
+	cacheHitsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "blockstore", "cache_hits_total"),
+		"Number of requests answered by the blockstore caches", []string{"cache"}, nil)
+	cacheMissesMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "blockstore", "cache_misses_total"),
+		"Number of requests the blockstore caches couldn't answer", []string{"cache"}, nil)
+	bloomFalsePositivesMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "blockstore", "bloom_false_positives_total"),
+		"Number of missing blocks the bloom filter didn't rule out", nil, nil)
+	bloomFalsePositiveRatioMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "blockstore", "bloom_false_positive_ratio"),
+		"Ratio of the missing blocks the bloom filter didn't rule out", nil, nil)
 )
 
 type IpfsNodeCollector struct {
@@ -38,6 +61,13 @@ type IpfsNodeCollector struct {
 
 func (_ IpfsNodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- peersTotalMetric
+	ch <- codecOpsMetric
+	ch <- hashOpsMetric
+	ch <- blockSizeMetric
+	ch <- cacheHitsMetric
+	ch <- cacheMissesMetric
+	ch <- bloomFalsePositivesMetric
+	ch <- bloomFalsePositiveRatioMetric
 }
 
 func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
@@ -49,6 +79,58 @@ func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
 			tr,
 		)
 	}
+
+	if st := c.BlockstoreStats(); st != nil {
+		collectBlockstoreStats(ch, st)
+	}
+}
+
+// BlockstoreStats returns the stats of the blockstore of the node, or nil
+// when it doesn't gather them.
+func (c IpfsNodeCollector) BlockstoreStats() *bstore.BlockstoreStats {
+	sbs, ok := c.Node.BaseBlocks.(*bstore.StatsBlockstore)
+	if !ok {
+		return nil
+	}
+	return sbs.Stats()
+}
+
+func collectBlockstoreStats(ch chan<- prometheus.Metric, st *bstore.BlockstoreStats) {
+	for _, ops := range []struct {
+		desc   *prometheus.Desc
+		counts map[string]bstore.OpCounts
+	}{{codecOpsMetric, st.Codecs}, {hashOpsMetric, st.Hashes}} {
+		for name, counts := range ops.counts {
+			ch <- prometheus.MustNewConstMetric(ops.desc, prometheus.CounterValue, float64(counts.Gets), "get", name)
+			ch <- prometheus.MustNewConstMetric(ops.desc, prometheus.CounterValue, float64(counts.Puts), "put", name)
+			ch <- prometheus.MustNewConstMetric(ops.desc, prometheus.CounterValue, float64(counts.Deletes), "delete", name)
+		}
+	}
+
+	for op, h := range map[string]bstore.SizeHistogram{"get": st.GetSizes, "put": st.PutSizes} {
+		// the buckets of prometheus are cumulative
+		buckets := make(map[float64]uint64)
+		var count uint64
+		for i, n := range h.Counts {
+			count += n
+			if i < len(bstore.BlockSizeBuckets) {
+				buckets[float64(bstore.BlockSizeBuckets[i])] = count
+			}
+		}
+		ch <- prometheus.MustNewConstHistogram(blockSizeMetric, count, float64(h.Sum), buckets, op)
+	}
+
+	for name, cs := range map[string]*bstore.CacheStats{"arc": st.ARCCache, "bloom": st.BloomCache} {
+		if cs == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(cacheHitsMetric, prometheus.CounterValue, float64(cs.Hits), name)
+		ch <- prometheus.MustNewConstMetric(cacheMissesMetric, prometheus.CounterValue, float64(cs.Misses), name)
+	}
+	if cs := st.BloomCache; cs != nil {
+		ch <- prometheus.MustNewConstMetric(bloomFalsePositivesMetric, prometheus.CounterValue, float64(cs.FalsePositives))
+		ch <- prometheus.MustNewConstMetric(bloomFalsePositiveRatioMetric, prometheus.GaugeValue, cs.FalsePositiveRate())
+	}
 }
 
 func (c IpfsNodeCollector) PeersTotalValues() map[string]float64 {
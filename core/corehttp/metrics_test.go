@@ -5,10 +5,15 @@ import (
 	"testing"
 	"time"
 
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
 	core "github.com/scroot/go-ipfs/core"
+	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
 
 	bhost "gx/ipfs/QmQA5mdxru8Bh6dpC9PJfSkumqnmHgJX7knxSgBo5Lpime/go-libp2p/p2p/host/basic"
 	inet "gx/ipfs/QmRscs8KxrSmSv4iuevHv8JfuUzHBMoqiaHzxfDRiksd6e/go-libp2p-net"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	prometheus "gx/ipfs/QmX3QZ5jHEPidwUrymXV1iSCSUhdGxj15sm2gP4jKMef7B/client_golang/prometheus"
 	testutil "gx/ipfs/Qma2j8dYePrvN5DoNgwh1uAuu3FFtEtrUQFmr737ws8nCp/go-libp2p-netutil"
 )
 
@@ -48,3 +53,24 @@ func TestPeersTotal(t *testing.T) {
 		t.Fatalf("expected 3 peers, got %s", actual["/ip4/tcp"])
 	}
 }
+
+func TestBlockstoreStatsMetrics(t *testing.T) {
+	bs := bstore.NewStatsBlockstore(bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore())))
+	if err := bs.Put(blocks.NewBlock([]byte("block"))); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := IpfsNodeCollector{Node: &core.IpfsNode{BaseBlocks: bs}}
+	ch := make(chan prometheus.Metric, 100)
+	collectBlockstoreStats(ch, collector.BlockstoreStats())
+	close(ch)
+
+	// the operations by codec and hash, and the two histograms
+	var n int
+	for range ch {
+		n++
+	}
+	if n != 8 {
+		t.Fatalf("expected 8 metrics, got %d", n)
+	}
+}
@@ -0,0 +1,610 @@
+package corerepo
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
+	bserv "github.com/scroot/go-ipfs/blockservice"
+	"github.com/scroot/go-ipfs/core"
+	offline "github.com/scroot/go-ipfs/exchange/offline"
+	dag "github.com/scroot/go-ipfs/merkledag"
+	pin "github.com/scroot/go-ipfs/pin"
+	gc "github.com/scroot/go-ipfs/pin/gc"
+	repo "github.com/scroot/go-ipfs/repo"
+	config "github.com/scroot/go-ipfs/repo/config"
+	fsrepo "github.com/scroot/go-ipfs/repo/fsrepo"
+
+	ci "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// ArchiveVersion is the version of the format of the archives written by
+// Export.
+const ArchiveVersion = 1
+
+// The blocks Export can write to an archive.
+const (
+	// ArchiveAllBlocks includes every block of the repo.
+	ArchiveAllBlocks = "all"
+
+	// ArchivePinnedBlocks includes the blocks of the pins and of the files
+	// API, the ones a garbage collection would keep.
+	ArchivePinnedBlocks = "pinned"
+
+	// ArchiveRootBlocks only includes the blocks the pinner and the files
+	// API need to load. The pinned content is referenced by its roots, and
+	// fetched from the network once imported.
+	ArchiveRootBlocks = "roots"
+)
+
+// The entries of an archive, in the order they are written.
+const (
+	archiveManifest  = "manifest.json"
+	archiveConfig    = "config"
+	archiveKeystore  = "keystore/"
+	archiveDatastore = "datastore"
+	archiveBlocks    = "blocks/"
+	archiveEnd       = "end.json"
+)
+
+// ArchiveManifest describes the repo an archive was exported from.
+type ArchiveManifest struct {
+	Version     int
+	RepoVersion int
+	Blocks      string
+	FilesRoot   string
+	Pins        []string
+	Created     time.Time
+}
+
+// ArchiveStat counts the entries of an archive.
+type ArchiveStat struct {
+	Keys    int
+	Entries int
+	Blocks  int
+}
+
+// Export writes an archive of the repo of n to w: its config, keystore, the
+// non-block entries of its datastore (pins, files API root, IPNS records...)
+// and, depending on mode, its blocks. The node keeps running during the
+// export, which holds off garbage collections, so that the archive is
+// consistent.
+func Export(ctx context.Context, n *core.IpfsNode, w io.Writer, mode string) (*ArchiveStat, error) {
+	switch mode {
+	case ArchiveAllBlocks, ArchivePinnedBlocks, ArchiveRootBlocks:
+	default:
+		return nil, fmt.Errorf("unknown blocks mode %q", mode)
+	}
+
+	unlocker := n.Blockstore.PinLock()
+	defer unlocker.Unlock()
+
+	root, err := FilesRootNode(n)
+	if err != nil {
+		return nil, err
+	}
+	if err := n.Pinning.Flush(); err != nil {
+		return nil, err
+	}
+
+	conf, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := datastoreEntries(n.Repo.Datastore(), conf)
+	if err != nil {
+		return nil, err
+	}
+	// the files root is written to the datastore asynchronously, record the
+	// one which was just flushed
+	entries[core.FilesRootKey] = root.Cid().Bytes()
+
+	// the pins are loaded from the exported entries rather than taken from
+	// the pinner, which may have changed since it was flushed
+	offlineDag := dag.NewDAGService(bserv.New(n.Blockstore, offline.Exchange(n.Blockstore)))
+	pinner, err := archivedPinner(entries, offlineDag)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ArchiveManifest{
+		Version:     ArchiveVersion,
+		RepoVersion: fsrepo.RepoVersion,
+		Blocks:      mode,
+		FilesRoot:   root.Cid().String(),
+		Created:     time.Now(),
+	}
+	for _, c := range append(pinner.RecursiveKeys(), pinner.DirectKeys()...) {
+		manifest.Pins = append(manifest.Pins, c.String())
+	}
+
+	var keys <-chan *cid.Cid
+	switch mode {
+	case ArchiveAllBlocks:
+		keys, err = n.Blockstore.AllKeysChan(ctx)
+	case ArchivePinnedBlocks:
+		keys, err = pinnedBlocks(ctx, pinner, offlineDag, []*cid.Cid{root.Cid()})
+	case ArchiveRootBlocks:
+		keys, err = rootBlocks(ctx, pinner, offlineDag, root.Cid())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aw := &archiveWriter{tw: tar.NewWriter(w), mtime: manifest.Created}
+	if err := aw.writeJSON(archiveManifest, manifest); err != nil {
+		return nil, err
+	}
+
+	if err := aw.writeJSON(archiveConfig, conf); err != nil {
+		return nil, err
+	}
+
+	ks := n.Repo.Keystore()
+	names, err := ks.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		k, err := ks.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ci.MarshalPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		if err := aw.write(archiveKeystore+name, b); err != nil {
+			return nil, err
+		}
+		aw.stat.Keys++
+	}
+
+	for k, v := range entries {
+		if err := aw.write(archiveDatastore+k.String(), v); err != nil {
+			return nil, err
+		}
+		aw.stat.Entries++
+	}
+
+	// the blocks of the cold tier are read where they are stored, rather
+	// than promoted by the blockstore of the node
+	stores, err := StoredBlockstores(n.Repo)
+	if err != nil {
+		return nil, err
+	}
+	for c := range keys {
+		b, err := storedBlock(stores, c)
+		if err != nil {
+			return nil, fmt.Errorf("block %s: %s", c, err)
+		}
+		if err := aw.write(archiveBlocks+c.String(), b.RawData()); err != nil {
+			return nil, err
+		}
+		aw.stat.Blocks++
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := aw.writeJSON(archiveEnd, aw.stat); err != nil {
+		return nil, err
+	}
+	return &aw.stat, aw.tw.Close()
+}
+
+// datastoreEntries returns the entries of d, but the blocks, including the
+// ones of the cold tier when the blockstore is tiered, and the state the
+// blockstore keeps about them: the saved bloom filter and the sizes of the
+// blocks of the hot tier.
+func datastoreEntries(d ds.Datastore, conf *config.Config) (map[ds.Key][]byte, error) {
+	skipped := []ds.Key{bstore.BlockPrefix, bstore.BloomFilterKey, bstore.TierSizesKey}
+	if tc := conf.Datastore.Tiering; tc != nil {
+		skipped = append(skipped, ds.NewKey(tc.ColdPrefix))
+	}
+
+	res, err := d.Query(dsq.Query{Prefix: "/"})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	entries := make(map[ds.Key][]byte)
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		k := ds.NewKey(r.Key)
+		if underAny(k, skipped) {
+			continue
+		}
+		v, ok := r.Value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("value of %s is not a byte slice", k)
+		}
+		entries[k] = v
+	}
+	return entries, nil
+}
+
+// underAny returns whether k is one of keys or a descendant of one.
+func underAny(k ds.Key, keys []ds.Key) bool {
+	for _, p := range keys {
+		if k.Equal(p) || p.IsAncestorOf(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// storedBlock reads the block c from the first of stores holding it.
+func storedBlock(stores []bstore.Blockstore, c *cid.Cid) (blocks.Block, error) {
+	for _, bs := range stores {
+		b, err := bs.Get(c)
+		if err != bstore.ErrNotFound {
+			return b, err
+		}
+	}
+	return nil, bstore.ErrNotFound
+}
+
+func archivedPinner(entries map[ds.Key][]byte, dserv dag.DAGService) (pin.Pinner, error) {
+	d := ds.NewMapDatastore()
+	for k, v := range entries {
+		if err := d.Put(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	p, err := pin.LoadPinner(d, dserv, dserv)
+	if err != nil {
+		// the repo never had pins, like when the node is built
+		return pin.NewPinner(d, dserv, dserv), nil
+	}
+	return p, nil
+}
+
+// pinnedBlocks returns the blocks a garbage collection would keep.
+func pinnedBlocks(ctx context.Context, pn pin.Pinner, ls dag.LinkService, bestEffortRoots []*cid.Cid) (<-chan *cid.Cid, error) {
+	output := make(chan gc.Result)
+	go func() {
+		for r := range output {
+			log.Error(r.Error)
+		}
+	}()
+	set, err := gc.ColoredSet(ctx, pn, ls, bestEffortRoots, output)
+	close(output)
+	if err != nil {
+		return nil, err
+	}
+	return setChan(set), nil
+}
+
+// rootBlocks returns the blocks of the pin sets and the root of the files
+// API.
+func rootBlocks(ctx context.Context, pn pin.Pinner, ls dag.LinkService, filesRoot *cid.Cid) (<-chan *cid.Cid, error) {
+	set := cid.NewSet()
+	set.Add(filesRoot)
+	if err := gc.Descendants(ctx, ls.GetLinks, set, pn.InternalPins()); err != nil {
+		return nil, err
+	}
+	return setChan(set), nil
+}
+
+func setChan(set *cid.Set) <-chan *cid.Cid {
+	keys := set.Keys()
+	out := make(chan *cid.Cid, len(keys))
+	for _, c := range keys {
+		out <- c
+	}
+	close(out)
+	return out
+}
+
+type archiveWriter struct {
+	tw    *tar.Writer
+	mtime time.Time
+	stat  ArchiveStat
+}
+
+func (aw *archiveWriter) write(name string, data []byte) error {
+	err := aw.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  aw.mtime,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = aw.tw.Write(data)
+	return err
+}
+
+func (aw *archiveWriter) writeJSON(name string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return aw.write(name, b)
+}
+
+// ErrTruncatedArchive is returned when an archive ends before its last entry.
+var ErrTruncatedArchive = errors.New("the archive is truncated")
+
+// Import restores the repo archived in r by Export at repoPath, which must
+// not exist or be an empty directory. The hash of every block is checked
+// against its CID, and the pins and files API root of the repo are checked
+// to be complete, unless the archive only references them. The repo is
+// removed when the import fails.
+func Import(ctx context.Context, repoPath string, r io.Reader) (_ *ArchiveStat, err error) {
+	created, err := prepareRepoDir(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			cleanRepoDir(repoPath, created)
+		}
+	}()
+
+	tr := tar.NewReader(r)
+
+	var manifest ArchiveManifest
+	if err := readJSON(tr, archiveManifest, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version != ArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", manifest.Version)
+	}
+	if manifest.RepoVersion != fsrepo.RepoVersion {
+		return nil, fmt.Errorf("the archive is of a version %d repo, this ipfs uses version %d", manifest.RepoVersion, fsrepo.RepoVersion)
+	}
+
+	conf := new(config.Config)
+	if err := readJSON(tr, archiveConfig, conf); err != nil {
+		return nil, err
+	}
+	if err := fsrepo.Init(repoPath, conf); err != nil {
+		return nil, err
+	}
+	rp, err := fsrepo.Open(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, end, err := importEntries(ctx, tr, rp)
+	if err != nil {
+		rp.Close()
+		return nil, err
+	}
+	if end == nil {
+		rp.Close()
+		return nil, ErrTruncatedArchive
+	}
+	if *end != *stat {
+		rp.Close()
+		return nil, fmt.Errorf("the archive has %d keys, %d datastore entries and %d blocks, expected %d, %d and %d",
+			stat.Keys, stat.Entries, stat.Blocks, end.Keys, end.Entries, end.Blocks)
+	}
+
+	// building an offline node loads the pins and the files root, and closes
+	// the repo once closed
+	n, err := core.NewNode(ctx, &core.BuildCfg{Repo: rp})
+	if err != nil {
+		return nil, err
+	}
+	defer n.Close()
+
+	if err := checkArchivedRepo(ctx, n, &manifest); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+func importEntries(ctx context.Context, tr *tar.Reader, rp repo.Repo) (*ArchiveStat, *ArchiveStat, error) {
+	stat := new(ArchiveStat)
+	conf, err := rp.Config()
+	if err != nil {
+		return nil, nil, err
+	}
+	bs := bstore.NewBlockstore(rp.Datastore())
+	if conf.Datastore.BlockCompression != "" {
+		bs, err = bstore.NewCompressedBlockstore(rp.Datastore(), conf.Datastore.BlockCompression)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return stat, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if hdr.Name == archiveEnd {
+			end := new(ArchiveStat)
+			if err := json.NewDecoder(tr).Decode(end); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s: %s", archiveEnd, err)
+			}
+			return stat, end, nil
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch name := hdr.Name; {
+		case strings.HasPrefix(name, archiveKeystore):
+			k, err := ci.UnmarshalPrivateKey(data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("key %s: %s", name, err)
+			}
+			kname := strings.TrimPrefix(name, archiveKeystore)
+			// the keys encrypting the datastores were generated with the
+			// new repo, the entries are encrypted with these
+			has, err := rp.Keystore().Has(kname)
+			if err != nil {
+				return nil, nil, err
+			}
+			if has {
+				log.Warningf("keeping the key %s of the new repo", kname)
+			} else if err := rp.Keystore().Put(kname, k); err != nil {
+				return nil, nil, err
+			}
+			stat.Keys++
+		case strings.HasPrefix(name, archiveDatastore+"/"):
+			if err := rp.Datastore().Put(ds.NewKey(strings.TrimPrefix(name, archiveDatastore)), data); err != nil {
+				return nil, nil, err
+			}
+			stat.Entries++
+		case strings.HasPrefix(name, archiveBlocks):
+			c, err := cid.Decode(strings.TrimPrefix(name, archiveBlocks))
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid block name %s: %s", name, err)
+			}
+			sum, err := c.Prefix().Sum(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !sum.Equals(c) {
+				return nil, nil, fmt.Errorf("block %s is corrupt", c)
+			}
+			b, err := blocks.NewBlockWithCid(data, c)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := bs.Put(b); err != nil {
+				return nil, nil, err
+			}
+			stat.Blocks++
+		default:
+			return nil, nil, fmt.Errorf("unexpected archive entry %s", name)
+		}
+	}
+}
+
+// checkArchivedRepo checks that the repo of n holds what manifest describes.
+func checkArchivedRepo(ctx context.Context, n *core.IpfsNode, manifest *ArchiveManifest) error {
+	root, err := n.FilesRoot.GetValue().GetNode()
+	if err != nil {
+		return err
+	}
+	if root.Cid().String() != manifest.FilesRoot {
+		return fmt.Errorf("the files root is %s, expected %s", root.Cid(), manifest.FilesRoot)
+	}
+
+	pins := make(map[string]bool)
+	for _, c := range append(n.Pinning.RecursiveKeys(), n.Pinning.DirectKeys()...) {
+		pins[c.String()] = true
+	}
+	if len(pins) != len(manifest.Pins) {
+		return fmt.Errorf("the repo has %d pins, expected %d", len(pins), len(manifest.Pins))
+	}
+	for _, p := range manifest.Pins {
+		if !pins[p] {
+			return fmt.Errorf("pin %s is missing", p)
+		}
+	}
+
+	if manifest.Blocks == ArchiveRootBlocks {
+		return nil
+	}
+	keys, err := pinnedBlocks(ctx, n.Pinning, n.DAG.GetOfflineLinkService(), []*cid.Cid{root.Cid()})
+	if err != nil {
+		return fmt.Errorf("the pinned content is incomplete: %s", err)
+	}
+	for c := range keys {
+		has, err := n.Blockstore.Has(c)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return fmt.Errorf("the pinned content is incomplete: block %s is missing", c)
+		}
+	}
+	return nil
+}
+
+func readJSON(tr *tar.Reader, name string, v interface{}) error {
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return ErrTruncatedArchive
+	}
+	if err != nil {
+		return err
+	}
+	if hdr.Name != name {
+		return fmt.Errorf("expected the archive entry %s, found %s", name, hdr.Name)
+	}
+	if err := json.NewDecoder(tr).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %s", name, err)
+	}
+	return nil
+}
+
+// prepareRepoDir checks that path can receive a new repo, creating it when
+// it doesn't exist.
+func prepareRepoDir(path string) (created bool, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return true, os.MkdirAll(path, 0700)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(1)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if len(names) > 0 {
+		return false, fmt.Errorf("%s is not empty, the repo must be imported in a new directory", path)
+	}
+	return false, nil
+}
+
+// cleanRepoDir removes the repo partially imported at path.
+func cleanRepoDir(path string, created bool) {
+	if created {
+		if err := os.RemoveAll(path); err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, fi := range fis {
+		if err := os.RemoveAll(filepath.Join(path, fi.Name())); err != nil {
+			log.Error(err)
+		}
+	}
+}
@@ -6,13 +6,17 @@ import (
 	"errors"
 	"time"
 
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
 	"github.com/scroot/go-ipfs/core"
+	"github.com/scroot/go-ipfs/core/coreunix"
 	mfs "github.com/scroot/go-ipfs/mfs"
+	namespace "github.com/scroot/go-ipfs/namespace"
 	gc "github.com/scroot/go-ipfs/pin/gc"
 	repo "github.com/scroot/go-ipfs/repo"
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
 	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
 )
 
@@ -30,6 +34,10 @@ type GC struct {
 }
 
 func NewGC(n *core.IpfsNode) (*GC, error) {
+	if n.Namespace != nil {
+		return newNamespaceGC(n)
+	}
+
 	r := n.Repo
 	cfg, err := r.Config()
 	if err != nil {
@@ -70,6 +78,24 @@ func NewGC(n *core.IpfsNode) (*GC, error) {
 	}, nil
 }
 
+// newNamespaceGC returns the GC of the namespace n works in, collecting its
+// garbage once its usage reaches StorageGCWatermark percents of its quota.
+func newNamespaceGC(n *core.IpfsNode) (*GC, error) {
+	watermark := n.Namespace.Config.StorageGCWatermark
+	if watermark == 0 {
+		watermark = 90
+	}
+
+	storageMax := n.Namespace.Quota()
+	return &GC{
+		Node:       n,
+		Repo:       n.Repo,
+		StorageMax: storageMax,
+		StorageGC:  storageMax * uint64(watermark) / 100,
+		SlackGB:    1,
+	}, nil
+}
+
 func BestEffortRoots(filesRoot *mfs.Root) ([]*cid.Cid, error) {
 	rootDag, err := filesRoot.GetValue().GetNode()
 	if err != nil {
@@ -82,13 +108,90 @@ func BestEffortRoots(filesRoot *mfs.Root) ([]*cid.Cid, error) {
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel() // in case error occurs during operation
+	rmed := GarbageCollectAsync(n, ctx)
+
+	return CollectResult(ctx, rmed, nil)
+}
+
+// gcRoots returns the roots of the blocks the garbage collection of the
+// default namespace keeps besides the pins, the files root, and the blocks
+// the other namespaces reference. These are all referenced, their links
+// aren't followed.
+func gcRoots(n *core.IpfsNode) ([]*cid.Cid, *cid.Set, error) {
 	roots, err := BestEffortRoots(n.FilesRoot)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	rmed := gc.GC(ctx, n.Blockstore, n.DAG, n.Pinning, roots)
 
-	return CollectResult(ctx, rmed, nil)
+	refs, err := namespace.AllRefs(n.Repo.Datastore())
+	if err != nil {
+		return nil, nil, err
+	}
+	return roots, refs, nil
+}
+
+// namespaceGC drops the references of the namespace n works in to the
+// blocks its pins don't need, and deletes the ones nothing else needs from
+// the blockstore. The removed keys it outputs are the references dropped.
+func namespaceGC(ctx context.Context, n *core.IpfsNode) <-chan gc.Result {
+	output := make(chan gc.Result, 128)
+	go func() {
+		defer close(output)
+		unlocker := n.Blockstore.GCLock()
+		defer unlocker.Unlock()
+
+		marked, err := gc.ColoredSet(ctx, n.Pinning, n.DAG.GetOfflineLinkService(), nil, output)
+		if err != nil {
+			output <- gc.Result{Error: err}
+			return
+		}
+
+		refs, err := n.Blockstore.AllKeysChan(ctx)
+		if err != nil {
+			output <- gc.Result{Error: err}
+			return
+		}
+		var dropped []*cid.Cid
+		for k := range refs {
+			if marked.Has(k) {
+				continue
+			}
+			if err := n.Blockstore.DeleteBlock(k); err != nil {
+				output <- gc.Result{Error: &gc.CannotDeleteBlockError{Key: k, Err: err}}
+				continue
+			}
+			dropped = append(dropped, k)
+			select {
+			case output <- gc.Result{KeyRemoved: k}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if len(dropped) == 0 {
+			return
+		}
+
+		base := n.Namespace.Base
+		roots, refs, err := gcRoots(base)
+		if err != nil {
+			output <- gc.Result{Error: err}
+			return
+		}
+		kept, err := gc.ColoredSet(ctx, base.Pinning, base.DAG.GetOfflineLinkService(), roots, output)
+		if err != nil {
+			output <- gc.Result{Error: err}
+			return
+		}
+		for _, k := range dropped {
+			if kept.Has(k) || refs.Has(k) {
+				continue
+			}
+			if err := base.Blockstore.DeleteBlock(k); err != nil && err != bstore.ErrNotFound {
+				output <- gc.Result{Error: &gc.CannotDeleteBlockError{Key: k, Err: err}}
+			}
+		}
+	}()
+	return output
 }
 
 // CollectResult collects the output of a garbage collection run and calls the
@@ -146,15 +249,55 @@ func (e *MultiError) Error() string {
 }
 
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
-	roots, err := BestEffortRoots(n.FilesRoot)
+	if n.Namespace != nil {
+		rmed := namespaceGC(ctx, n)
+		return pruneJournalAfter(ctx, rmed, n.Namespace.Datastore(), n.Blockstore)
+	}
+
+	roots, refs, err := gcRoots(n)
 	if err != nil {
-		out := make(chan gc.Result)
+		out := make(chan gc.Result, 1)
 		out <- gc.Result{Error: err}
 		close(out)
 		return out
 	}
 
-	return gc.GC(ctx, n.Blockstore, n.DAG, n.Pinning, roots)
+	rmed := gc.GCKeeping(ctx, n.Blockstore, n.DAG, n.Pinning, roots, refs)
+	return pruneJournalAfter(ctx, rmed, n.Repo.Datastore(), n.Blockstore)
+}
+
+// pruneJournalAfter forwards the results of a garbage collection, then
+// prunes the add journal kept in d of the entries it made stale, if it
+// removed any block.
+func pruneJournalAfter(ctx context.Context, rmed <-chan gc.Result, d ds.Datastore, bs bstore.Blockstore) <-chan gc.Result {
+	out := make(chan gc.Result, 128)
+	go func() {
+		defer close(out)
+
+		removed := false
+		for r := range rmed {
+			if r.KeyRemoved != nil {
+				removed = true
+			}
+			select {
+			case out <- r:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil || !removed {
+			return
+		}
+
+		pruned, err := coreunix.PruneJournal(d, bs)
+		if err != nil {
+			out <- gc.Result{Error: err}
+			return
+		}
+		if pruned > 0 {
+			log.Infof("pruned %d entries of the add journal", pruned)
+		}
+	}()
+	return out
 }
 
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
@@ -180,6 +323,20 @@ func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 	if err != nil {
 		return err
 	}
+	gcs := []*GC{gc}
+	if node.Namespace == nil {
+		for name := range cfg.Namespaces {
+			nn, err := node.WithNamespace(name)
+			if err != nil {
+				return err
+			}
+			ngc, err := NewGC(nn)
+			if err != nil {
+				return err
+			}
+			gcs = append(gcs, ngc)
+		}
+	}
 
 	for {
 		select {
@@ -187,8 +344,10 @@ func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 			return nil
 		case <-time.After(period):
 			// the private func maybeGC doesn't compute storageMax, storageGC, slackGC so that they are not re-computed for every cycle
-			if err := gc.maybeGC(ctx, 0); err != nil {
-				log.Error(err)
+			for _, gc := range gcs {
+				if err := gc.maybeGC(ctx, 0); err != nil {
+					log.Error(err)
+				}
 			}
 		}
 	}
@@ -203,9 +362,19 @@ func ConditionalGC(ctx context.Context, node *core.IpfsNode, offset uint64) erro
 }
 
 func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
-	storage, err := gc.Repo.GetStorageUsage()
-	if err != nil {
-		return err
+	var storage uint64
+	if ns := gc.Node.Namespace; ns != nil {
+		if gc.StorageMax == 0 {
+			// unlimited
+			return nil
+		}
+		storage = ns.Usage()
+	} else {
+		var err error
+		storage, err = gc.Repo.GetStorageUsage()
+		if err != nil {
+			return err
+		}
 	}
 
 	if storage+offset > gc.StorageGC {
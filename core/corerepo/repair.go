@@ -0,0 +1,150 @@
+package corerepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
+	"github.com/scroot/go-ipfs/core"
+	dag "github.com/scroot/go-ipfs/merkledag"
+	repo "github.com/scroot/go-ipfs/repo"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsns "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/namespace"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// repairFetchTimeout bounds the time spent fetching each missing block, as
+// no peer may have it.
+const repairFetchTimeout = time.Minute
+
+// StoredBlockstores returns the blockstores reading the blocks of r as
+// stored in its datastore, without caches: the one of the hot tier and, when
+// the blockstore is tiered, the one of the cold tier.
+func StoredBlockstores(r repo.Repo) ([]bstore.Blockstore, error) {
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	stores := []bstore.Blockstore{bstore.NewBlockstore(r.Datastore())}
+	if tc := cfg.Datastore.Tiering; tc != nil {
+		stores = append(stores, bstore.NewBlockstore(dsns.Wrap(r.Datastore(), ds.NewKey(tc.ColdPrefix))))
+	}
+	return stores, nil
+}
+
+// RepairResult is the outcome of repairing a pin.
+type RepairResult struct {
+	Pin *cid.Cid
+
+	// Fetched are the blocks of the pin which were missing, fetched from
+	// the network.
+	Fetched []*cid.Cid
+
+	// Err is set when the pin couldn't be repaired.
+	Err error
+}
+
+// RepairPins fetches the blocks the pins of n need which are missing from
+// its blockstore, as are the blocks deleted because they were corrupted,
+// and reports every pin which was missing blocks on the returned channel.
+// Blocks can only be fetched when n is online, the pins of offline nodes
+// missing blocks are reported as failed.
+func RepairPins(ctx context.Context, n *core.IpfsNode) <-chan RepairResult {
+	r := &pinRepairer{
+		n:       n,
+		ls:      n.DAG.GetOfflineLinkService(),
+		visited: make(map[string]error),
+	}
+
+	out := make(chan RepairResult)
+	go func() {
+		defer close(out)
+
+		for _, p := range []struct {
+			keys      []*cid.Cid
+			recursive bool
+		}{
+			{n.Pinning.RecursiveKeys(), true},
+			{n.Pinning.DirectKeys(), false},
+		} {
+			for _, k := range p.keys {
+				res := RepairResult{Pin: k}
+				res.Err = r.repair(ctx, k, p.recursive, &res)
+				if res.Err == nil && len(res.Fetched) == 0 {
+					continue
+				}
+
+				select {
+				case out <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+type pinRepairer struct {
+	n  *core.IpfsNode
+	ls dag.LinkService
+
+	// visited has the DAGs already repaired, and why they couldn't be
+	visited map[string]error
+}
+
+// repair makes sure the block c and, when recursive, the blocks it links to
+// are in the blockstore, adding the ones it fetches to res.
+func (r *pinRepairer) repair(ctx context.Context, c *cid.Cid, recursive bool, res *RepairResult) error {
+	if err, ok := r.visited[c.KeyString()]; ok && recursive {
+		return err
+	}
+
+	err := r.repairDAG(ctx, c, recursive, res)
+	if recursive {
+		r.visited[c.KeyString()] = err
+	}
+	return err
+}
+
+func (r *pinRepairer) repairDAG(ctx context.Context, c *cid.Cid, recursive bool, res *RepairResult) error {
+	has, err := r.n.Blockstore.Has(c)
+	if err != nil {
+		return err
+	}
+	if !has {
+		if err := r.fetch(ctx, c); err != nil {
+			return fmt.Errorf("block %s is missing: %s", c, err)
+		}
+		res.Fetched = append(res.Fetched, c)
+	}
+	if !recursive {
+		return nil
+	}
+
+	links, err := r.ls.GetLinks(ctx, c)
+	if err != nil {
+		return fmt.Errorf("block %s: %s", c, err)
+	}
+	for _, l := range links {
+		if err := r.repair(ctx, l.Cid, true, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *pinRepairer) fetch(ctx context.Context, c *cid.Cid) error {
+	if !r.n.OnlineMode() {
+		return errors.New("it can't be fetched offline")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, repairFetchTimeout)
+	defer cancel()
+	_, err := r.n.Blocks.GetBlock(ctx, c)
+	return err
+}
@@ -0,0 +1,297 @@
+package corerepo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	gopath "path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/scroot/go-ipfs/core"
+	mfs "github.com/scroot/go-ipfs/mfs"
+	path "github.com/scroot/go-ipfs/path"
+	pin "github.com/scroot/go-ipfs/pin"
+	uio "github.com/scroot/go-ipfs/unixfs/io"
+
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// snapshotsKey is the datastore prefix under which mfs snapshots are kept.
+var snapshotsKey = ds.NewKey("/local/filessnapshots")
+
+// snapshotLk serializes the changes to the snapshot list, so that concurrent
+// creates don't pick the same id.
+var snapshotLk sync.Mutex
+
+// ErrNoSuchSnapshot is returned when a snapshot can't be found by id or label.
+var ErrNoSuchSnapshot = errors.New("no such snapshot")
+
+// Snapshot records the root of the files API (mfs) at a point in time.
+type Snapshot struct {
+	ID    uint64
+	Root  string
+	Label string
+	Time  time.Time
+}
+
+// CreateSnapshot flushes the files API root, pins it, and records it as a
+// new snapshot with the given label.
+func CreateSnapshot(ctx context.Context, n *core.IpfsNode, label string) (*Snapshot, error) {
+	if _, err := strconv.ParseUint(label, 10, 64); err == nil {
+		return nil, fmt.Errorf("snapshot labels can't be numbers, these are used as ids")
+	}
+
+	nd, err := FilesRootNode(n)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotLk.Lock()
+	defer snapshotLk.Unlock()
+
+	snaps, err := ListSnapshots(n)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		ID:    1,
+		Root:  nd.Cid().String(),
+		Label: label,
+		Time:  time.Now(),
+	}
+	for _, o := range snaps {
+		if label != "" && o.Label == label {
+			return nil, fmt.Errorf("a snapshot labeled %q already exists", label)
+		}
+		if o.ID >= s.ID {
+			s.ID = o.ID + 1
+		}
+	}
+
+	err = n.Pinning.Pin(ctx, nd, true)
+	if err != nil {
+		return nil, fmt.Errorf("pin: %s", err)
+	}
+
+	err = n.Pinning.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	err = n.Repo.Datastore().Put(snapshotKey(s.ID), b)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ListSnapshots returns all the snapshots of the files API, oldest first.
+func ListSnapshots(n *core.IpfsNode) ([]*Snapshot, error) {
+	res, err := n.Repo.Datastore().Query(dsq.Query{Prefix: snapshotsKey.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []*Snapshot
+	for _, e := range entries {
+		b, ok := e.Value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type for snapshot %s: %T", e.Key, e.Value)
+		}
+
+		s := new(Snapshot)
+		if err := json.Unmarshal(b, s); err != nil {
+			return nil, fmt.Errorf("invalid snapshot %s: %s", e.Key, err)
+		}
+		out = append(out, s)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// GetSnapshot finds a snapshot by id or label.
+func GetSnapshot(n *core.IpfsNode, ref string) (*Snapshot, error) {
+	snaps, err := ListSnapshots(n)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseUint(ref, 10, 64)
+	for _, s := range snaps {
+		if (err == nil && s.ID == id) || (s.Label != "" && s.Label == ref) {
+			return s, nil
+		}
+	}
+	return nil, ErrNoSuchSnapshot
+}
+
+// RemoveSnapshot forgets a snapshot, unpinning its root unless another
+// snapshot shares it.
+func RemoveSnapshot(ctx context.Context, n *core.IpfsNode, ref string) (*Snapshot, error) {
+	snapshotLk.Lock()
+	defer snapshotLk.Unlock()
+
+	s, err := GetSnapshot(n, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps, err := ListSnapshots(n)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := false
+	for _, o := range snaps {
+		if o.ID != s.ID && o.Root == s.Root {
+			shared = true
+			break
+		}
+	}
+
+	if !shared {
+		c, err := cid.Decode(s.Root)
+		if err != nil {
+			return nil, err
+		}
+
+		err = n.Pinning.Unpin(ctx, c, true)
+		if err != nil && err != pin.ErrNotPinned {
+			return nil, err
+		}
+
+		err = n.Pinning.Flush()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = n.Repo.Datastore().Delete(snapshotKey(s.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SnapshotNode returns the node at the given path of a snapshot. An empty
+// path or "/" returns the root of the snapshot.
+func SnapshotNode(ctx context.Context, n *core.IpfsNode, s *Snapshot, p string) (node.Node, error) {
+	r := &path.Resolver{
+		DAG:         n.DAG,
+		ResolveOnce: uio.ResolveUnixfsOnce,
+	}
+
+	fpath, err := path.ParsePath("/ipfs/" + s.Root + gopath.Clean("/"+p))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.ResolvePath(ctx, fpath)
+}
+
+// RestoreSnapshot rolls the given path of the files API back to its state
+// in the snapshot. Restoring "/" replaces all the entries of the root.
+func RestoreSnapshot(ctx context.Context, n *core.IpfsNode, s *Snapshot, p string) error {
+	p = gopath.Clean("/" + p)
+
+	nd, err := SnapshotNode(ctx, n, s, p)
+	if err != nil {
+		return err
+	}
+
+	if p == "/" {
+		return restoreRoot(ctx, n, nd)
+	}
+
+	dir, name := gopath.Split(p)
+	parent, err := mfs.Lookup(n.FilesRoot, dir)
+	if err != nil {
+		return fmt.Errorf("parent lookup: %s", err)
+	}
+
+	pdir, ok := parent.(*mfs.Directory)
+	if !ok {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	if _, err := pdir.Child(name); err == nil {
+		if err := pdir.Unlink(name); err != nil {
+			return err
+		}
+	}
+
+	if err := pdir.AddChild(name, nd); err != nil {
+		return err
+	}
+
+	return mfs.FlushPath(n.FilesRoot, p)
+}
+
+// restoreRoot replaces the entries of the files root with the ones of nd,
+// which may be a sharded directory. The entries of nd are all fetched before
+// the root is swapped for it in one step, so that it is left untouched when
+// that fails.
+func restoreRoot(ctx context.Context, n *core.IpfsNode, nd node.Node) error {
+	root, ok := n.FilesRoot.GetValue().(*mfs.Directory)
+	if !ok {
+		return errors.New("files root is not a directory")
+	}
+
+	dir, err := uio.NewDirectoryFromNode(n.DAG, nd)
+	if err != nil {
+		return err
+	}
+
+	err = dir.ForEachLink(ctx, func(l *node.Link) error {
+		_, err := l.GetNode(ctx, n.DAG)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := root.SetNode(nd); err != nil {
+		return err
+	}
+
+	return n.FilesRoot.Flush()
+}
+
+// FilesRootNode flushes the files API and returns its root node.
+func FilesRootNode(n *core.IpfsNode) (node.Node, error) {
+	if n.FilesRoot == nil {
+		return nil, errors.New("files root not loaded")
+	}
+
+	root := n.FilesRoot.GetValue()
+	if err := root.Flush(); err != nil {
+		return nil, err
+	}
+
+	return root.GetNode()
+}
+
+func snapshotKey(id uint64) ds.Key {
+	return snapshotsKey.ChildString(fmt.Sprintf("%016x", id))
+}
@@ -4,10 +4,14 @@ import (
 	"fmt"
 
 	context "context"
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
 	"github.com/scroot/go-ipfs/core"
+	repo "github.com/scroot/go-ipfs/repo"
 	fsrepo "github.com/scroot/go-ipfs/repo/fsrepo"
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsns "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/namespace"
 )
 
 type Stat struct {
@@ -16,15 +20,38 @@ type Stat struct {
 	RepoPath   string
 	Version    string
 	StorageMax uint64 // size in bytes
+
+	// LogicalSize and PhysicalSize are the sizes of the blocks, and of the
+	// blocks as stored, compressed, in bytes. BlockCodecs and BlockHashes
+	// count the blocks by the codec of their CID and the type of their
+	// multihash, Blockstore has the stats of the blockstore since the node
+	// started. They are only set by RepoStatVerbose, the sizes needing to
+	// read all the blocks.
+	LogicalSize  uint64                  `json:",omitempty"`
+	PhysicalSize uint64                  `json:",omitempty"`
+	BlockCodecs  map[string]uint64       `json:",omitempty"`
+	BlockHashes  map[string]uint64       `json:",omitempty"`
+	Blockstore   *bstore.BlockstoreStats `json:",omitempty"`
+
+	// Namespace is the namespace of the stats, when not the default one.
+	// RepoSize and LogicalSize are then the size of the blocks it
+	// references, StorageMax its quota, and PhysicalSize isn't known as
+	// the namespaces share the blocks.
+	Namespace string `json:",omitempty"`
 }
 
 func RepoStat(n *core.IpfsNode, ctx context.Context) (*Stat, error) {
-	r := n.Repo
+	return repoStat(n, ctx, false)
+}
 
-	usage, err := r.GetStorageUsage()
-	if err != nil {
-		return nil, err
-	}
+// RepoStatVerbose returns the stats of RepoStat along with the sizes and
+// the counts by CID prefix of the blocks, and the stats of the blockstore.
+func RepoStatVerbose(n *core.IpfsNode, ctx context.Context) (*Stat, error) {
+	return repoStat(n, ctx, true)
+}
+
+func repoStat(n *core.IpfsNode, ctx context.Context, verbose bool) (*Stat, error) {
+	r := n.Repo
 
 	allKeys, err := n.Blockstore.AllKeysChan(ctx)
 	if err != nil {
@@ -32,8 +59,15 @@ func RepoStat(n *core.IpfsNode, ctx context.Context) (*Stat, error) {
 	}
 
 	count := uint64(0)
-	for range allKeys {
+	codecs := make(map[string]uint64)
+	hashes := make(map[string]uint64)
+	for k := range allKeys {
 		count++
+		if verbose {
+			codec, hash := bstore.PrefixNames(k)
+			codecs[codec]++
+			hashes[hash]++
+		}
 	}
 
 	path, err := fsrepo.BestKnownPath()
@@ -41,21 +75,78 @@ func RepoStat(n *core.IpfsNode, ctx context.Context) (*Stat, error) {
 		return nil, err
 	}
 
+	stat := &Stat{
+		NumObjects: count,
+		RepoPath:   path,
+		Version:    fmt.Sprintf("fs-repo@%d", fsrepo.RepoVersion),
+	}
+	if ns := n.Namespace; ns != nil {
+		stat.RepoSize = ns.Usage()
+		stat.StorageMax = ns.Quota()
+		stat.Namespace = ns.Name()
+	} else if err := repoSizes(r, stat); err != nil {
+		return nil, err
+	}
+
+	if verbose {
+		if n.Namespace != nil {
+			stat.LogicalSize = stat.RepoSize
+		} else if err := blockSizes(ctx, r, stat); err != nil {
+			return nil, err
+		}
+		stat.BlockCodecs = codecs
+		stat.BlockHashes = hashes
+		if sbs, ok := n.BaseBlocks.(*bstore.StatsBlockstore); ok {
+			stat.Blockstore = sbs.Stats()
+		}
+	}
+	return stat, nil
+}
+
+// repoSizes sets the sizes of the stat of the default namespace.
+func repoSizes(r repo.Repo, stat *Stat) error {
+	usage, err := r.GetStorageUsage()
+	if err != nil {
+		return err
+	}
+
 	cfg, err := r.Config()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	storageMax, err := humanize.ParseBytes(cfg.Datastore.StorageMax)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &Stat{
-		NumObjects: count,
-		RepoSize:   usage,
-		RepoPath:   path,
-		Version:    fmt.Sprintf("fs-repo@%d", fsrepo.RepoVersion),
-		StorageMax: storageMax,
-	}, nil
+	stat.RepoSize = usage
+	stat.StorageMax = storageMax
+	return nil
+}
+
+// blockSizes sets the logical and physical sizes of the blocks of the
+// default namespace, reading all of them.
+func blockSizes(ctx context.Context, r repo.Repo, stat *Stat) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	logical, physical, err := bstore.BlockSizes(ctx, r.Datastore())
+	if err != nil {
+		return err
+	}
+	if tc := cfg.Datastore.Tiering; tc != nil {
+		coldLogical, coldPhysical, err := bstore.BlockSizes(ctx, dsns.Wrap(r.Datastore(), ds.NewKey(tc.ColdPrefix)))
+		if err != nil {
+			return err
+		}
+		logical += coldLogical
+		physical += coldPhysical
+	}
+
+	stat.LogicalSize = logical
+	stat.PhysicalSize = physical
+	return nil
 }
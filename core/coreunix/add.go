@@ -1,12 +1,16 @@
 package coreunix
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	gopath "path"
+	"runtime"
+	"strings"
+	"time"
 
 	bs "github.com/scroot/go-ipfs/blocks/blockstore"
 	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
@@ -21,6 +25,7 @@ import (
 	dag "github.com/scroot/go-ipfs/merkledag"
 	mfs "github.com/scroot/go-ipfs/mfs"
 	"github.com/scroot/go-ipfs/pin"
+	ignore "github.com/scroot/go-ipfs/thirdparty/ignore"
 	posinfo "github.com/scroot/go-ipfs/thirdparty/posinfo"
 	unixfs "github.com/scroot/go-ipfs/unixfs"
 
@@ -65,9 +70,10 @@ func (e *ignoreFileError) Error() string {
 }
 
 type AddedObject struct {
-	Name  string
-	Hash  string `json:",omitempty"`
-	Bytes int64  `json:",omitempty"`
+	Name    string
+	Hash    string `json:",omitempty"`
+	Bytes   int64  `json:",omitempty"`
+	Ignored bool   `json:",omitempty"`
 }
 
 func NewAdder(ctx context.Context, p pin.Pinner, bs bstore.GCBlockstore, ds dag.DAGService) (*Adder, error) {
@@ -82,6 +88,7 @@ func NewAdder(ctx context.Context, p pin.Pinner, bs bstore.GCBlockstore, ds dag.
 		Trickle:    false,
 		Wrap:       false,
 		Chunker:    "",
+		Workers:    runtime.NumCPU(),
 	}, nil
 }
 
@@ -107,6 +114,28 @@ type Adder struct {
 	tempRoot   *cid.Cid
 	Prefix     *cid.Prefix
 	liveNodes  uint64
+
+	// PreserveMode and PreserveMtime record the permissions and the
+	// modification time of the added files in their unixfs nodes.
+	PreserveMode  bool
+	PreserveMtime bool
+
+	// Workers is the number of goroutines building and hashing the leaves
+	// of the added files, see ihelper.DagBuilderParams.
+	Workers int
+
+	// Journal, when set, records the files added from the local filesystem
+	// along with their size and modification time. Files found unchanged
+	// in it aren't read and hashed again, which makes interrupted adds
+	// resumable.
+	Journal ds.Datastore
+
+	// Ignore lists the patterns of the paths to skip when adding
+	// directories, to which the patterns of the ignore files found in them
+	// are added. When ReportIgnored is set, the skipped paths are sent to
+	// Out.
+	Ignore        *ignore.Matcher
+	ReportIgnored bool
 }
 
 func (adder *Adder) mfsRoot() (*mfs.Root, error) {
@@ -120,6 +149,9 @@ func (adder *Adder) mfsRoot() (*mfs.Root, error) {
 	if err != nil {
 		return nil, err
 	}
+	// added directories are sharded whatever their size when sharding is
+	// enabled, the threshold only applies to the files API
+	mr.GetValue().(*mfs.Directory).SetShardSplitThreshold(0)
 	adder.mroot = mr
 	return adder.mroot, nil
 }
@@ -129,7 +161,9 @@ func (adder *Adder) SetMfsRoot(r *mfs.Root) {
 }
 
 // Constructs a node from reader's data, and adds it. Doesn't pin.
-func (adder Adder) add(reader io.Reader) (node.Node, error) {
+// add imports the content of reader, recording the given attributes in the
+// root of the file.
+func (adder Adder) add(reader io.Reader, mode *os.FileMode, mtime *time.Time) (node.Node, error) {
 	chnk, err := chunk.FromString(reader, adder.Chunker)
 	if err != nil {
 		return nil, err
@@ -141,6 +175,9 @@ func (adder Adder) add(reader io.Reader) (node.Node, error) {
 		Maxlinks:  ihelper.DefaultLinksPerBlock,
 		NoCopy:    adder.NoCopy,
 		Prefix:    adder.Prefix,
+		Workers:   adder.Workers,
+		Mode:      mode,
+		ModTime:   mtime,
 	}
 
 	if adder.Trickle {
@@ -420,6 +457,12 @@ func (adder *Adder) AddFile(file files.File) error {
 }
 
 func (adder *Adder) addFile(file files.File) error {
+	return adder.addEntry(file, file.FileName(), adder.Ignore)
+}
+
+// addEntry adds file, found in the tree added from root. The paths of the
+// tree ignored by rules are skipped.
+func (adder *Adder) addEntry(file files.File, root string, rules *ignore.Matcher) error {
 	err := adder.maybePauseForGC()
 	if err != nil {
 		return err
@@ -439,7 +482,7 @@ func (adder *Adder) addFile(file files.File) error {
 	adder.liveNodes++
 
 	if file.IsDirectory() {
-		return adder.addDir(file)
+		return adder.addDir(file, root, rules)
 	}
 
 	// case for symlink
@@ -460,6 +503,24 @@ func (adder *Adder) addFile(file files.File) error {
 	}
 
 	// case for regular file
+	if adder.Journal != nil {
+		dagnode, err := adder.journalLookup(file)
+		if err != nil {
+			return err
+		}
+		if dagnode != nil {
+			log.Infof("%s is unchanged since it was last added, skipping", file.FileName())
+			if adder.Progress {
+				stat := file.(files.FileInfo).Stat()
+				adder.Out <- &AddedObject{
+					Name:  file.FileName(),
+					Bytes: stat.Size(),
+				}
+			}
+			return adder.addNode(dagnode, file.FileName())
+		}
+	}
+
 	// if the progress flag was specified, wrap the file so that we can send
 	// progress updates to the client (over the output channel)
 	var reader io.Reader = file
@@ -472,23 +533,36 @@ func (adder *Adder) addFile(file files.File) error {
 		}
 	}
 
-	dagnode, err := adder.add(reader)
+	mode, mtime := adder.fileAttrs(file)
+	dagnode, err := adder.add(reader, mode, mtime)
 	if err != nil {
 		return err
 	}
 
 	// patch it into the root
-	return adder.addNode(dagnode, file.FileName())
+	if err := adder.addNode(dagnode, file.FileName()); err != nil {
+		return err
+	}
+
+	if adder.Journal != nil {
+		return adder.journalRecord(file, dagnode)
+	}
+	return nil
 }
 
-func (adder *Adder) addDir(dir files.File) error {
+func (adder *Adder) addDir(dir files.File, root string, rules *ignore.Matcher) error {
 	log.Infof("adding directory: %s", dir.FileName())
 
 	mr, err := adder.mfsRoot()
 	if err != nil {
 		return err
 	}
-	err = mfs.Mkdir(mr, dir.FileName(), true, false)
+
+	if mode, mtime := adder.fileAttrs(dir); mode != nil || mtime != nil {
+		err = adder.putDir(mr, dir.FileName(), mode, mtime)
+	} else {
+		err = mfs.Mkdir(mr, dir.FileName(), true, false)
+	}
 	if err != nil {
 		return err
 	}
@@ -502,12 +576,32 @@ func (adder *Adder) addDir(dir files.File) error {
 			break
 		}
 
+		// The ignore file applies to the entries following it, which is
+		// all of them when listed first, as serial files do.
+		if gopath.Base(file.FileName()) == ignore.IgnoreFile && !file.IsDirectory() {
+			file, rules, err = readIgnoreFile(file, relPath(root, dir.FileName()), rules)
+			if err != nil {
+				return err
+			}
+		}
+
+		if rules.Ignored(relPath(root, file.FileName()), file.IsDirectory()) {
+			log.Infof("%s", &ignoreFileError{file.FileName()})
+			if adder.ReportIgnored && adder.Out != nil {
+				adder.Out <- &AddedObject{
+					Name:    file.FileName(),
+					Ignored: true,
+				}
+			}
+			continue
+		}
+
 		// Skip hidden files when adding recursively, unless Hidden is enabled.
 		if files.IsHidden(file) && !adder.Hidden {
 			log.Infof("%s is hidden, skipping", file.FileName())
 			continue
 		}
-		err = adder.addFile(file)
+		err = adder.addEntry(file, root, rules)
 		if err != nil {
 			return err
 		}
@@ -516,6 +610,97 @@ func (adder *Adder) addDir(dir files.File) error {
 	return nil
 }
 
+// readIgnoreFile adds the patterns of the ignore file of the directory dir
+// to rules. As the content of file is consumed, it returns a new file to add
+// in its place.
+func readIgnoreFile(file files.File, dir string, rules *ignore.Matcher) (files.File, *ignore.Matcher, error) {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rules, err = rules.WithIgnoreFile(dir, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path := file.FullPath()
+	var stat os.FileInfo
+	if fi, ok := file.(files.FileInfo); ok {
+		path = fi.AbsPath()
+		stat = fi.Stat()
+	}
+	return files.NewReaderFile(file.FileName(), path, ioutil.NopCloser(bytes.NewReader(data)), stat), rules, nil
+}
+
+// relPath returns the path of name in the tree added from root.
+func relPath(root, name string) string {
+	if name == root {
+		return ""
+	}
+	return strings.TrimPrefix(name, root+"/")
+}
+
+// putDir creates an empty directory carrying the given attributes at path.
+func (adder *Adder) putDir(mr *mfs.Root, path string, mode *os.FileMode, mtime *time.Time) error {
+	nd, err := adder.withAttrs(unixfs.EmptyDirNode(), mode, mtime)
+	if err != nil {
+		return err
+	}
+
+	if parent := gopath.Dir(path); parent != "." {
+		if err := mfs.Mkdir(mr, parent, true, false); err != nil {
+			return err
+		}
+	}
+
+	return mfs.PutNode(mr, path, nd)
+}
+
+// fileAttrs returns the attributes of file which should be recorded in its
+// unixfs node, depending on PreserveMode and PreserveMtime.
+func (adder *Adder) fileAttrs(file files.File) (*os.FileMode, *time.Time) {
+	if !adder.PreserveMode && !adder.PreserveMtime {
+		return nil, nil
+	}
+
+	sf, ok := file.(files.StatFile)
+	if !ok {
+		return nil, nil
+	}
+	stat := sf.Stat()
+	if stat == nil {
+		return nil, nil
+	}
+
+	var mode *os.FileMode
+	var mtime *time.Time
+	if adder.PreserveMode {
+		m := stat.Mode()
+		mode = &m
+	}
+	if adder.PreserveMtime {
+		t := stat.ModTime()
+		mtime = &t
+	}
+	return mode, mtime
+}
+
+// withAttrs records the given attributes in nd and adds the new node.
+func (adder *Adder) withAttrs(nd node.Node, mode *os.FileMode, mtime *time.Time) (node.Node, error) {
+	out, err := unixfs.WithAttrs(nd, mode, mtime)
+	if err != nil {
+		return nil, err
+	}
+	out.SetPrefix(adder.Prefix)
+
+	_, err = adder.dagService.Add(out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (adder *Adder) maybePauseForGC() error {
 	if adder.unlocker != nil && adder.blockstore.GCRequested() {
 		err := adder.PinRoot()
@@ -3,6 +3,8 @@ package coreunix
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"math/rand"
@@ -18,10 +20,12 @@ import (
 	"github.com/scroot/go-ipfs/pin/gc"
 	"github.com/scroot/go-ipfs/repo"
 	"github.com/scroot/go-ipfs/repo/config"
+	ignore "github.com/scroot/go-ipfs/thirdparty/ignore"
 	pi "github.com/scroot/go-ipfs/thirdparty/posinfo"
 	"github.com/scroot/go-ipfs/thirdparty/testutil"
 	"gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
 
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
 	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
 )
 
@@ -267,3 +271,262 @@ func (fi *dummyFileInfo) Mode() os.FileMode  { return 0 }
 func (fi *dummyFileInfo) ModTime() time.Time { return fi.modTime }
 func (fi *dummyFileInfo) IsDir() bool        { return false }
 func (fi *dummyFileInfo) Sys() interface{}   { return nil }
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("file should not have been read")
+}
+
+func TestAddIncremental(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: "Qmfoo", // required by offline node
+			},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+	mtime := time.Now()
+
+	addDir := func(a, b io.Reader, bTime time.Time) string {
+		adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adder.Journal = r.Datastore()
+
+		fa := files.NewReaderFile("dir/a", "/tmp/dir/a", ioutil.NopCloser(a), &dummyFileInfo{"a", int64(len(data)), mtime})
+		fb := files.NewReaderFile("dir/b", "/tmp/dir/b", ioutil.NopCloser(b), &dummyFileInfo{"b", 5, bTime})
+		dir := files.NewSliceFile("dir", "/tmp/dir", []files.File{fa, fb})
+
+		if err := adder.AddFile(dir); err != nil {
+			t.Fatal(err)
+		}
+		nd, err := adder.Finalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := adder.PinRoot(); err != nil {
+			t.Fatal(err)
+		}
+		return nd.Cid().String()
+	}
+
+	first := addDir(bytes.NewReader(data), bytes.NewBufferString("hello"), mtime)
+
+	// unchanged files are taken from the journal, without being read
+	if again := addDir(failingReader{}, failingReader{}, mtime); again != first {
+		t.Fatalf("expected the same root when adding again, got %s and %s", first, again)
+	}
+
+	// modified files are added again
+	changed := addDir(failingReader{}, bytes.NewBufferString("world"), mtime.Add(time.Second))
+	if changed == first {
+		t.Fatal("expected a different root once a file changed")
+	}
+
+	// other settings don't reuse the journal entries
+	adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder.Journal = r.Datastore()
+	adder.RawLeaves = true
+	fa := files.NewReaderFile("a", "/tmp/dir/a", ioutil.NopCloser(failingReader{}), &dummyFileInfo{"a", int64(len(data)), mtime})
+	if err := adder.AddFile(fa); err == nil {
+		t.Fatal("expected the file to be read with other settings")
+	}
+}
+
+// journalHash returns the hash recorded in the only entry of the journal.
+func journalHash(t *testing.T, r repo.Repo) *cid.Cid {
+	res, err := r.Datastore().Query(dsq.Query{Prefix: journalKey.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 journal entry, got %d", len(entries))
+	}
+
+	var e journalEntry
+	if err := json.Unmarshal(entries[0].Value.([]byte), &e); err != nil {
+		t.Fatal(err)
+	}
+	c, err := cid.Decode(e.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestAddIncrementalIncomplete(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: "Qmfoo", // required by offline node
+			},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(4)).Read(data)
+	mtime := time.Now()
+
+	addFile := func(rd io.Reader) error {
+		adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adder.Journal = r.Datastore()
+
+		fa := files.NewReaderFile("a", f.Name(), ioutil.NopCloser(rd), &dummyFileInfo{"a", int64(len(data)), mtime})
+		return adder.AddFile(fa)
+	}
+
+	if err := addFile(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	// lose a leaf of the file, as a partial gc would
+	nd, err := node.DAG.Get(context.Background(), journalHash(t, r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nd.Links()) == 0 {
+		t.Fatal("expected the file to have leaves")
+	}
+	if err := node.Blockstore.DeleteBlock(nd.Links()[0].Cid); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := addFile(failingReader{}); err == nil {
+		t.Fatal("expected the file to be read again when its dag is incomplete")
+	}
+	if err := addFile(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	// entries are pruned once their root is gone, not their file, which
+	// may not be on the host of the daemon
+	os.Remove(f.Name())
+	pruned, err := PruneJournal(r.Datastore(), node.Blockstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 0 {
+		t.Fatalf("expected no entry to be pruned, got %d", pruned)
+	}
+
+	if err := node.Blockstore.DeleteBlock(journalHash(t, r)); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err = PruneJournal(r.Datastore(), node.Blockstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Fatalf("expected 1 entry to be pruned, got %d", pruned)
+	}
+}
+
+func TestAddIgnore(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: "Qmfoo", // required by offline node
+			},
+		},
+		D: testutil.ThreadSafeCloserMapDatastore(),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rf := func(name, data string) files.File {
+		return files.NewReaderFile(name, name, ioutil.NopCloser(bytes.NewBufferString(data)), nil)
+	}
+	sub := files.NewSliceFile("dir/sub", "dir/sub", []files.File{
+		rf("dir/sub/.ipfsignore", "!b.log\n*.tmp\n"),
+		rf("dir/sub/a.log", "a"),
+		rf("dir/sub/b.log", "b"),
+		rf("dir/sub/c.tmp", "c"),
+	})
+	dir := files.NewSliceFile("dir", "dir", []files.File{
+		rf("dir/.ipfsignore", "*.log\n/top.txt\n"),
+		rf("dir/a.log", "a"),
+		rf("dir/keep.log", "keep"),
+		rf("dir/c.tmp", "c"),
+		rf("dir/top.txt", "top"),
+		files.NewSliceFile("dir/build", "dir/build", []files.File{rf("dir/build/x", "x")}),
+		sub,
+	})
+
+	adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder.Ignore, err = ignore.New([]string{"build/"}, []string{"keep.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder.ReportIgnored = true
+	adder.Hidden = true
+
+	out := make(chan interface{})
+	adder.Out = out
+	errs := make(chan error, 1)
+	go func() {
+		defer close(out)
+		errs <- adder.AddFile(dir)
+	}()
+
+	ignored := make(map[string]bool)
+	added := make(map[string]bool)
+	for o := range out {
+		ao := o.(*AddedObject)
+		if ao.Ignored {
+			ignored[ao.Name] = true
+		} else {
+			added[ao.Name] = true
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"dir/a.log", "dir/top.txt", "dir/build", "dir/sub/a.log", "dir/sub/c.tmp"} {
+		if !ignored[name] {
+			t.Errorf("expected %s to be ignored", name)
+		}
+	}
+	for _, name := range []string{"dir/.ipfsignore", "dir/keep.log", "dir/c.tmp", "dir/sub/.ipfsignore", "dir/sub/b.log"} {
+		if !added[name] {
+			t.Errorf("expected %s to be added", name)
+		}
+	}
+}
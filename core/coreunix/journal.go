@@ -0,0 +1,213 @@
+package coreunix
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
+	"github.com/scroot/go-ipfs/commands/files"
+	dag "github.com/scroot/go-ipfs/merkledag"
+
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// journalKey is the datastore prefix under which the add journal is kept.
+var journalKey = ds.NewKey("/local/addjournal")
+
+// journalEntry records a file added from the local filesystem.
+type journalEntry struct {
+	Path  string
+	Size  int64
+	Mtime int64
+	Hash  string
+}
+
+// journalFile returns the absolute path and the attributes of file if it can
+// be looked up in the journal, which needs both to know whether it changed.
+func journalFile(file files.File) (string, os.FileInfo, bool) {
+	fi, ok := file.(files.FileInfo)
+	if !ok || fi.AbsPath() == "" {
+		return "", nil, false
+	}
+
+	stat := fi.Stat()
+	if stat == nil || !stat.Mode().IsRegular() || stat.ModTime().IsZero() {
+		return "", nil, false
+	}
+	return fi.AbsPath(), stat, true
+}
+
+// journalEntryKey returns the key of the entry for path. Entries are
+// grouped by the settings changing the hashes of the added files, so that
+// adding the same file with other settings doesn't reuse its entry.
+func (adder *Adder) journalEntryKey(path string) ds.Key {
+	settings := fmt.Sprintf("%s,%t,%t,%t,%t,%t", adder.Chunker, adder.Trickle,
+		adder.RawLeaves, adder.NoCopy, adder.PreserveMode, adder.PreserveMtime)
+	if adder.Prefix != nil {
+		settings += fmt.Sprintf(",%d,%d,%d,%d", adder.Prefix.Version,
+			adder.Prefix.Codec, adder.Prefix.MhType, adder.Prefix.MhLength)
+	}
+
+	s := sha256.Sum256([]byte(settings))
+	p := sha256.Sum256([]byte(path))
+	return journalKey.ChildString(hex.EncodeToString(s[:8])).ChildString(hex.EncodeToString(p[:]))
+}
+
+// journalLookup returns the node the file was added as, if it is in the
+// journal and it didn't change since. It returns nil otherwise.
+func (adder *Adder) journalLookup(file files.File) (node.Node, error) {
+	path, stat, ok := journalFile(file)
+	if !ok {
+		return nil, nil
+	}
+
+	key := adder.journalEntryKey(path)
+	v, err := adder.Journal.Get(key)
+	if err == ds.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type for journal entry of %s: %T", path, v)
+	}
+
+	var e journalEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		log.Warningf("invalid journal entry for %s: %s", path, err)
+		return nil, nil
+	}
+	if e.Size != stat.Size() || e.Mtime != stat.ModTime().UnixNano() {
+		return nil, nil
+	}
+
+	c, err := cid.Decode(e.Hash)
+	if err != nil {
+		log.Warningf("invalid journal entry for %s: %s", path, err)
+		return nil, nil
+	}
+
+	// blocks may have been garbage collected, or deleted as corrupt, since
+	complete, err := adder.journalComplete(c)
+	if err != nil {
+		return nil, err
+	}
+	if !complete {
+		log.Infof("the dag %s of %s is incomplete, dropping its journal entry", c, path)
+		return nil, adder.Journal.Delete(key)
+	}
+
+	return adder.dagService.Get(adder.ctx, c)
+}
+
+// journalComplete returns whether all the blocks of the dag c are in the
+// blockstore, looking for them offline as 'pin verify' does.
+func (adder *Adder) journalComplete(c *cid.Cid) (bool, error) {
+	has, err := adder.blockstore.Has(c)
+	if err != nil || !has {
+		return false, err
+	}
+
+	var missing bool
+	var herr error
+	set := cid.NewSet()
+	getLinks := adder.dagService.GetOfflineLinkService().GetLinks
+	err = dag.EnumerateChildren(adder.ctx, getLinks, c, func(k *cid.Cid) bool {
+		if missing || herr != nil || !set.Visit(k) {
+			return false
+		}
+		// raw leaves have no links, so GetLinks doesn't read them
+		has, err := adder.blockstore.Has(k)
+		if err != nil {
+			herr = err
+			return false
+		}
+		missing = !has
+		return has
+	})
+	if herr != nil {
+		return false, herr
+	}
+	if err != nil {
+		log.Infof("reading the dag %s: %s", c, err)
+		return false, nil
+	}
+	return !missing, nil
+}
+
+// journalRecord records that file was added as nd.
+func (adder *Adder) journalRecord(file files.File, nd node.Node) error {
+	path, stat, ok := journalFile(file)
+	if !ok {
+		return nil
+	}
+
+	b, err := json.Marshal(&journalEntry{
+		Path:  path,
+		Size:  stat.Size(),
+		Mtime: stat.ModTime().UnixNano(),
+		Hash:  nd.Cid().String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return adder.Journal.Put(adder.journalEntryKey(path), b)
+}
+
+// PruneJournal deletes the entries of the add journal kept in d whose root
+// block isn't in bs anymore, as after a garbage collection. The added files
+// themselves aren't looked at: they are on the host of the client, which may
+// not be the one of the daemon. It returns the number of entries deleted.
+func PruneJournal(d ds.Datastore, bs bstore.Blockstore) (int, error) {
+	res, err := d.Query(dsq.Query{Prefix: journalKey.String()})
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := res.Rest()
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, r := range entries {
+		if !journalStale(r, bs) {
+			continue
+		}
+		if err := d.Delete(ds.RawKey(r.Key)); err != nil && err != ds.ErrNotFound {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// journalStale returns whether the journal entry r can be deleted.
+func journalStale(r dsq.Entry, bs bstore.Blockstore) bool {
+	b, ok := r.Value.([]byte)
+	if !ok {
+		return true
+	}
+
+	var e journalEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return true
+	}
+
+	c, err := cid.Decode(e.Hash)
+	if err != nil {
+		return true
+	}
+	has, err := bs.Has(c)
+	return err == nil && !has
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	bserv "github.com/scroot/go-ipfs/blockservice"
+	offline "github.com/scroot/go-ipfs/exchange/offline"
+	dag "github.com/scroot/go-ipfs/merkledag"
+	namespace "github.com/scroot/go-ipfs/namespace"
+	path "github.com/scroot/go-ipfs/path"
+	pin "github.com/scroot/go-ipfs/pin"
+	config "github.com/scroot/go-ipfs/repo/config"
+
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
+)
+
+// Namespace is the namespace a node works in.
+type Namespace struct {
+	*namespace.Namespace
+
+	Config *config.Namespace
+
+	// Base is the node working in the default namespace, sharing its
+	// blockstore with the namespaces.
+	Base *IpfsNode
+}
+
+// WithNamespace returns the node working in the namespace of the given
+// name, one of the Namespaces of the config. It shares the blockstore, the
+// exchange and the name system of n, has its own pins, quota and garbage
+// collection, and has no files root. It must not be closed, closing n
+// closes it.
+func (n *IpfsNode) WithNamespace(name string) (*IpfsNode, error) {
+	if n.Namespace != nil {
+		return n.Namespace.Base.WithNamespace(name)
+	}
+
+	n.nsLk.Lock()
+	defer n.nsLk.Unlock()
+	if nn, ok := n.namespaces[name]; ok {
+		return nn, nil
+	}
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	nc, ok := cfg.Namespaces[name]
+	if !ok || nc == nil {
+		return nil, fmt.Errorf("unknown namespace %q", name)
+	}
+	var quota uint64
+	if nc.StorageMax != "" {
+		quota, err = humanize.ParseBytes(nc.StorageMax)
+		if err != nil {
+			return nil, err
+		}
+		if quota == 0 {
+			return nil, errors.New("the StorageMax of a namespace can't be 0")
+		}
+	}
+
+	ns, err := namespace.Open(n.Repo.Datastore(), name, quota)
+	if err != nil {
+		return nil, err
+	}
+
+	nn := &IpfsNode{
+		Identity:       n.Identity,
+		Repo:           n.Repo,
+		Mounts:         n.Mounts,
+		PrivateKey:     n.PrivateKey,
+		PNetFingerpint: n.PNetFingerpint,
+		Namespace:      &Namespace{Namespace: ns, Config: nc, Base: n},
+		Peerstore:      n.Peerstore,
+		GCLocker:       n.GCLocker,
+		Reporter:       n.Reporter,
+		Discovery:      n.Discovery,
+		PeerHost:       n.PeerHost,
+		Bootstrapper:   n.Bootstrapper,
+		Routing:        n.Routing,
+		Exchange:       n.Exchange,
+		Namesys:        n.Namesys,
+		Ping:           n.Ping,
+		Reprovider:     n.Reprovider,
+		IpnsRepub:      n.IpnsRepub,
+		Floodsub:       n.Floodsub,
+		PubsubHistory:  n.PubsubHistory,
+		P2P:            n.P2P,
+		proc:           n.proc,
+		ctx:            n.ctx,
+		mode:           n.mode,
+		localModeSet:   n.localModeSet,
+	}
+
+	nn.Blockstore = ns.Blockstore(n.Blockstore)
+	nn.BaseBlocks = nn.Blockstore
+	nn.Blocks = bserv.New(nn.Blockstore, n.Exchange)
+	nn.DAG = dag.NewDAGService(nn.Blocks)
+	nn.Resolver = path.NewBasicResolver(nn.DAG)
+
+	internalDag := dag.NewDAGService(bserv.New(nn.Blockstore, offline.Exchange(nn.Blockstore)))
+	pinning, err := pin.LoadPinner(ns.Datastore(), nn.DAG, internalDag)
+	if err != nil {
+		// the namespace wasn't used yet
+		pinning = pin.NewPinner(ns.Datastore(), nn.DAG, internalDag)
+	}
+	nn.Pinning = ns.Pinner(pinning, nn.Blockstore, nn.DAG)
+
+	if n.namespaces == nil {
+		n.namespaces = make(map[string]*IpfsNode)
+	}
+	n.namespaces[name] = nn
+	return nn, nil
+}
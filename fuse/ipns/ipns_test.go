@@ -211,6 +211,55 @@ func TestFilePersistence(t *testing.T) {
 	}
 }
 
+// Test creating relative and dangling symlinks and reading them back
+func TestSymlinks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	node, mnt := setupIpnsTest(t, nil)
+
+	dir := mnt.Dir + "/local"
+	mkdir(t, dir+"/sub")
+	writeFile(t, 10, dir+"/sub/file")
+
+	links := map[string]string{
+		"rel":      "sub/file",
+		"dangling": "../does/not/exist",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, dir+"/"+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkLinks := func(dir string) {
+		for name, target := range links {
+			fi, err := os.Lstat(dir + "/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode()&os.ModeSymlink == 0 {
+				t.Fatalf("%s is not a symlink: %s", name, fi.Mode())
+			}
+
+			out, err := os.Readlink(dir + "/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != target {
+				t.Fatalf("%s links to %q, expected %q", name, out, target)
+			}
+		}
+	}
+	checkLinks(dir)
+
+	mnt.Close()
+
+	_, mnt = setupIpnsTest(t, node)
+	defer mnt.Close()
+	checkLinks(mnt.Dir + "/local")
+}
+
 func TestMultipleDirs(t *testing.T) {
 	node, mnt := setupIpnsTest(t, nil)
 
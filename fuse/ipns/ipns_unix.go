@@ -282,7 +282,7 @@ func (d *Directory) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Mode = os.ModeDir | 0555
 	a.Uid = uint32(os.Getuid())
 	a.Gid = uint32(os.Getgid())
-	return nil
+	return setRecordedAttrs(d.dir, a)
 }
 
 // Attr returns the attributes of a given node.
@@ -297,6 +297,34 @@ func (fi *FileNode) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Size = uint64(size)
 	a.Uid = uint32(os.Getuid())
 	a.Gid = uint32(os.Getgid())
+	return setRecordedAttrs(fi.fi, a)
+}
+
+// setRecordedAttrs overrides the mode and modification time in a with the
+// ones recorded in the unixfs node of n, if any.
+func setRecordedAttrs(n mfs.FSNode, a *fuse.Attr) error {
+	nd, err := n.GetNode()
+	if err != nil {
+		return err
+	}
+
+	pbnd, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		// raw leaves carry no attributes
+		return nil
+	}
+
+	d, err := ft.FromBytes(pbnd.Data())
+	if err != nil {
+		return err
+	}
+
+	if mode, ok := ft.Mode(d); ok {
+		a.Mode = a.Mode&os.ModeType | mode
+	}
+	if mtime, ok := ft.ModTime(d); ok {
+		a.Mtime = mtime
+	}
 	return nil
 }
 
@@ -312,6 +340,9 @@ func (s *Directory) Lookup(ctx context.Context, name string) (fs.Node, error) {
 	case *mfs.Directory:
 		return &Directory{dir: child}, nil
 	case *mfs.File:
+		if target, err := child.Readlink(); err == nil {
+			return &Link{Target: target}, nil
+		}
 		return &FileNode{fi: child}, nil
 	default:
 		// NB: if this happens, we do not want to continue, unpredictable behaviour
@@ -335,6 +366,8 @@ func (dir *Directory) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 			dirent.Type = fuse.DT_Dir
 		case mfs.TFile:
 			dirent.Type = fuse.DT_File
+		case mfs.TSymlink:
+			dirent.Type = fuse.DT_Link
 		}
 
 		entries = append(entries, dirent)
@@ -488,6 +521,21 @@ func (fi *File) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
 	return fi.fi.Close()
 }
 
+// Symlink creates a symlink under this directory. Its target is stored as is.
+func (dir *Directory) Symlink(ctx context.Context, req *fuse.SymlinkRequest) (fs.Node, error) {
+	data, err := ft.SymlinkData(req.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dir.dir.AddChild(req.NewName, dag.NodeWithData(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Link{Target: req.Target}, nil
+}
+
 func (dir *Directory) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
 	// New 'empty' file
 	nd := dag.NodeWithData(ft.FilePBData(nil, 0))
@@ -593,6 +641,7 @@ type ipnsDirectory interface {
 	fs.NodeRemover
 	fs.NodeRenamer
 	fs.NodeStringLookuper
+	fs.NodeSymlinker
 }
 
 var _ ipnsDirectory = (*Directory)(nil)
@@ -20,6 +20,7 @@ import (
 	chunk "github.com/scroot/go-ipfs/importer/chunk"
 	dag "github.com/scroot/go-ipfs/merkledag"
 	ci "github.com/scroot/go-ipfs/thirdparty/testutil/ci"
+	ft "github.com/scroot/go-ipfs/unixfs"
 	uio "github.com/scroot/go-ipfs/unixfs/io"
 
 	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
@@ -252,6 +253,70 @@ func TestIpfsBasicDirRead(t *testing.T) {
 	}
 }
 
+// Test reading back relative and dangling symlinks
+func TestIpfsSymlinks(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	nd, mnt := setupIpfsTest(t, nil)
+	defer mnt.Close()
+
+	fi, _ := randObj(t, nd, 100)
+
+	links := map[string]string{
+		"rel":      "actual",
+		"dangling": "../does/not/exist",
+	}
+
+	db := uio.NewDirectory(nd.DAG)
+	err := db.AddChild(nd.Context(), "actual", fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range links {
+		data, err := ft.SymlinkData(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lnk := dag.NodeWithData(data)
+		if _, err := nd.DAG.Add(lnk); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AddChild(nd.Context(), name, lnk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dnd, err := db.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dk, err := nd.DAG.Add(dnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirname := path.Join(mnt.Dir, dk.String())
+	for name, target := range links {
+		st, err := os.Lstat(path.Join(dirname, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("%s is not a symlink: %s", name, st.Mode())
+		}
+
+		out, err := os.Readlink(path.Join(dirname, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != target {
+			t.Fatalf("%s links to %q, expected %q", name, out, target)
+		}
+	}
+}
+
 // Test to make sure the filesystem reports file sizes correctly
 func TestFileSizeReporting(t *testing.T) {
 	if testing.Short() {
@@ -13,6 +13,7 @@ import (
 	core "github.com/scroot/go-ipfs/core"
 	mdag "github.com/scroot/go-ipfs/merkledag"
 	path "github.com/scroot/go-ipfs/path"
+	ft "github.com/scroot/go-ipfs/unixfs"
 	uio "github.com/scroot/go-ipfs/unixfs/io"
 	ftpb "github.com/scroot/go-ipfs/unixfs/pb"
 
@@ -127,6 +128,15 @@ func (s *Node) Attr(ctx context.Context, a *fuse.Attr) error {
 	default:
 		return fmt.Errorf("Invalid data type - %s", s.cached.GetType())
 	}
+
+	// use the recorded attributes, if any, without the write bits as this
+	// filesystem is readonly
+	if mode, ok := ft.Mode(s.cached); ok && s.cached.GetType() != ftpb.Data_Symlink {
+		a.Mode = a.Mode&os.ModeType | mode&^0222
+	}
+	if mtime, ok := ft.ModTime(s.cached); ok {
+		a.Mtime = mtime
+	}
 	return nil
 }
 
@@ -189,14 +199,11 @@ func (s *Node) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 	if err != nil {
 		return err
 	}
-	o, err := r.Seek(req.Offset, io.SeekStart)
-	lm["res_offset"] = o
-	if err != nil {
-		return err
-	}
+	defer r.Close()
+	lm["res_offset"] = req.Offset
 
 	buf := resp.Data[:min(req.Size, int(int64(r.Size())-req.Offset))]
-	n, err := io.ReadFull(r, buf)
+	n, err := r.ReadAt(buf, req.Offset)
 	if err != nil && err != io.EOF {
 		return err
 	}
@@ -8,7 +8,16 @@ import (
 	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
 )
 
-func BalancedLayout(db *h.DagBuilderHelper) (node.Node, error) {
+func BalancedLayout(db *h.DagBuilderHelper) (out node.Node, err error) {
+	defer func() {
+		if err != nil {
+			db.Abort()
+		}
+	}()
+
+	// leaves become the data of File nodes
+	db.UseFileLeaves()
+
 	var offset uint64 = 0
 	var root *h.UnixfsNode
 	for level := 0; !db.Done(); level++ {
@@ -36,7 +45,7 @@ func BalancedLayout(db *h.DagBuilderHelper) (node.Node, error) {
 		root = db.NewUnixfsNode()
 	}
 
-	out, err := db.Add(root)
+	out, err = db.Add(root)
 	if err != nil {
 		return nil, err
 	}
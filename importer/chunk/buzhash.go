@@ -0,0 +1,88 @@
+package chunk
+
+import "io"
+
+// BuzhashWindow is the number of bytes the buzhash chunker hashes to find
+// chunk boundaries. Chunks are never smaller than this, except the last one.
+const BuzhashWindow = 32
+
+var buzhashTable = func() [256]uint32 {
+	var t [256]uint32
+	for i, v := range chunkTable(0x62757a6861736821) {
+		t[i] = uint32(v)
+	}
+	return t
+}()
+
+// Buzhash is a content-defined chunker using a cyclic polynomial rolling
+// hash over a window of BuzhashWindow bytes. It's much faster than Rabin.
+type Buzhash struct {
+	*cdcSplitter
+
+	min  int
+	mask uint32
+}
+
+// NewBuzhash returns a buzhash chunker producing blocks of avgBlkSize bytes
+// on average, with the same bounds as NewRabin.
+func NewBuzhash(r io.Reader, avgBlkSize uint64) *Buzhash {
+	min := avgBlkSize / 3
+	max := avgBlkSize + (avgBlkSize / 2)
+
+	b, err := NewBuzhashMinMax(r, min, avgBlkSize, max)
+	if err != nil {
+		// only happens for tiny average sizes, clamp them
+		b, _ = NewBuzhashMinMax(r, BuzhashWindow, BuzhashWindow, BuzhashWindow)
+	}
+	return b
+}
+
+// NewBuzhashMinMax returns a buzhash chunker producing blocks of avg bytes on
+// average, never smaller than min or larger than max.
+func NewBuzhashMinMax(r io.Reader, min, avg, max uint64) (*Buzhash, error) {
+	if min > avg || avg > max || max == 0 {
+		return nil, ErrBadChunkSizes
+	}
+	if min < BuzhashWindow {
+		min = BuzhashWindow
+		if max < min {
+			return nil, ErrBadChunkSizes
+		}
+	}
+
+	b := &Buzhash{min: int(min)}
+
+	// boundaries are looked for past min, aim for avg
+	if avg > min {
+		b.mask = 1<<log2(avg-min) - 1
+	}
+
+	b.cdcSplitter = newCDCSplitter(r, int(max), b.cut)
+	return b, nil
+}
+
+func (b *Buzhash) cut(buf []byte) int {
+	if len(buf) <= b.min {
+		return len(buf)
+	}
+
+	var h uint32
+	for _, c := range buf[b.min-BuzhashWindow : b.min] {
+		h = rotl(h) ^ buzhashTable[c]
+	}
+
+	for i := b.min; i < len(buf); i++ {
+		if h&b.mask == 0 {
+			return i
+		}
+		// the window is as large as the hash, so the byte leaving it
+		// comes back to its original rotation
+		h = rotl(h) ^ buzhashTable[buf[i-BuzhashWindow]] ^ buzhashTable[buf[i]]
+	}
+	return len(buf)
+}
+
+// rotl rotates h left by one bit.
+func rotl(h uint32) uint32 {
+	return h<<1 | h>>31
+}
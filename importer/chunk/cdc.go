@@ -0,0 +1,94 @@
+package chunk
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrBadChunkSizes is returned when the sizes given to a content-defined
+// chunker aren't ordered as min <= avg <= max.
+var ErrBadChunkSizes = errors.New("chunk sizes must satisfy min <= avg <= max")
+
+// cdcSplitter holds the data read ahead by the content-defined chunkers.
+// Chunk boundaries are found by cut, which is given at most max buffered
+// bytes and returns the length of the next chunk.
+type cdcSplitter struct {
+	r   io.Reader
+	buf []byte
+	n   int
+	err error
+
+	cut func(buf []byte) int
+}
+
+func newCDCSplitter(r io.Reader, max int, cut func([]byte) int) *cdcSplitter {
+	return &cdcSplitter{
+		r:   r,
+		buf: make([]byte, max),
+		cut: cut,
+	}
+}
+
+func (s *cdcSplitter) NextBytes() ([]byte, error) {
+	if s.err == nil && s.n < len(s.buf) {
+		n, err := io.ReadFull(s.r, s.buf[s.n:])
+		s.n += n
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			s.err = io.EOF
+		default:
+			return nil, err
+		}
+	}
+
+	if s.n == 0 {
+		return nil, s.err
+	}
+
+	c := s.cut(s.buf[:s.n])
+	if s.err != nil && s.n < len(s.buf) && c == s.n {
+		// last chunk, no need to keep the buffer
+		out := s.buf[:s.n]
+		s.buf = nil
+		s.n = 0
+		return out, nil
+	}
+
+	out := make([]byte, c)
+	copy(out, s.buf[:c])
+	s.n = copy(s.buf, s.buf[c:s.n])
+	return out, nil
+}
+
+func (s *cdcSplitter) Reader() io.Reader {
+	return s.r
+}
+
+// chunkTable returns a table of pseudo random values used by the rolling
+// hashes. It must never change, or the same data would be chunked
+// differently.
+func chunkTable(seed uint64) [256]uint64 {
+	var t [256]uint64
+	for i := range t {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}
+
+// log2 returns the base 2 logarithm of v, rounded to the nearest integer.
+func log2(v uint64) uint {
+	var b uint
+	for v>>(b+1) != 0 {
+		b++
+	}
+	if b > 0 && v&(1<<(b-1)) != 0 {
+		b++
+	}
+	return b
+}
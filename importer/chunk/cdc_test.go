@@ -0,0 +1,169 @@
+package chunk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+type cdcChunker struct {
+	name     string
+	min, max int
+	new      func(r io.Reader) Splitter
+}
+
+var cdcChunkers = []cdcChunker{
+	{"buzhash", 1024 * 64, 1024 * 384, func(r io.Reader) Splitter {
+		s, err := NewBuzhashMinMax(r, 1024*64, 1024*256, 1024*384)
+		if err != nil {
+			panic(err)
+		}
+		return s
+	}},
+	{"fastcdc", 1024 * 64, 1024 * 384, func(r io.Reader) Splitter {
+		s, err := NewFastCDCMinMax(r, 1024*64, 1024*256, 1024*384)
+		if err != nil {
+			panic(err)
+		}
+		return s
+	}},
+}
+
+func seededBuf(seed int64, size int) []byte {
+	buf := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(buf)
+	return buf
+}
+
+func splitAll(t testing.TB, s Splitter) [][]byte {
+	var chunks [][]byte
+	for {
+		c, err := s.NextBytes()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, c)
+	}
+}
+
+func TestCDCChunking(t *testing.T) {
+	data := seededBuf(1, 1024*1024*16)
+
+	for _, c := range cdcChunkers {
+		chunks := splitAll(t, c.new(bytes.NewReader(data)))
+
+		if !bytes.Equal(bytes.Join(chunks, nil), data) {
+			t.Fatalf("%s: data was chunked incorrectly", c.name)
+		}
+
+		for i, ch := range chunks {
+			if len(ch) > c.max || (len(ch) < c.min && i != len(chunks)-1) {
+				t.Fatalf("%s: chunk %d has out of bounds size %d", c.name, i, len(ch))
+			}
+		}
+		t.Logf("%s: average block size: %d", c.name, len(data)/len(chunks))
+
+		again := splitAll(t, c.new(bytes.NewReader(data)))
+		if len(again) != len(chunks) {
+			t.Fatalf("%s: chunking is not deterministic", c.name)
+		}
+	}
+}
+
+func TestCDCSmallInputs(t *testing.T) {
+	for _, c := range cdcChunkers {
+		if chunks := splitAll(t, c.new(bytes.NewReader(nil))); len(chunks) != 0 {
+			t.Fatalf("%s: empty input gave %d chunks", c.name, len(chunks))
+		}
+
+		data := seededBuf(2, 100)
+		chunks := splitAll(t, c.new(bytes.NewReader(data)))
+		if len(chunks) != 1 || !bytes.Equal(chunks[0], data) {
+			t.Fatalf("%s: small input should be a single chunk", c.name)
+		}
+	}
+}
+
+// dedupRatio returns the fraction of the bytes of b found in chunks of a.
+func dedupRatio(t *testing.T, newSplitter func(io.Reader) Splitter, a, b []byte) float64 {
+	seen := make(map[[sha256.Size]byte]bool)
+	for _, c := range splitAll(t, newSplitter(bytes.NewReader(a))) {
+		seen[sha256.Sum256(c)] = true
+	}
+
+	var reused int
+	for _, c := range splitAll(t, newSplitter(bytes.NewReader(b))) {
+		if seen[sha256.Sum256(c)] {
+			reused += len(c)
+		}
+	}
+	return float64(reused) / float64(len(b))
+}
+
+func TestCDCDedupShiftedData(t *testing.T) {
+	data := seededBuf(3, 1024*1024*16)
+
+	// the same data shifted by a prefix, and with bytes inserted and
+	// removed in the middle
+	shifted := append(seededBuf(4, 1000), data...)
+	edited := append(append(append([]byte{}, data[:1024*1024*5]...), seededBuf(5, 777)...), data[1024*1024*5+100:]...)
+
+	for _, c := range cdcChunkers {
+		if r := dedupRatio(t, c.new, data, shifted); r < 0.9 {
+			t.Fatalf("%s: only %.2f of the shifted data was deduplicated", c.name, r)
+		}
+		if r := dedupRatio(t, c.new, data, edited); r < 0.9 {
+			t.Fatalf("%s: only %.2f of the edited data was deduplicated", c.name, r)
+		}
+	}
+
+	// fixed size chunks don't survive a shift
+	if r := dedupRatio(t, DefaultSplitter, data, shifted); r > 0.1 {
+		t.Fatalf("size splitter deduplicated %.2f of the shifted data", r)
+	}
+}
+
+func TestFromStringCDC(t *testing.T) {
+	good := []string{
+		"buzhash", "buzhash-4096", "buzhash-1024-4096-8192", "buzhash-min:1024-avg:4096-max:8192",
+		"fastcdc", "fastcdc-4096", "fastcdc-1024-4096-8192", "fastcdc-min:1024-avg:4096-max:8192",
+	}
+	for _, s := range good {
+		if _, err := FromString(bytes.NewReader(nil), s); err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+	}
+
+	bad := []string{
+		"buzhash-", "buzhash-0", "buzhash-8192-4096-1024", "buzhash-1-2", "buzhash-avg:1-min:2-max:3",
+		"fastcdc-x", "fastcdc-8192-4096-1024", "fastcdc-1-2-3-4",
+	}
+	for _, s := range bad {
+		if _, err := FromString(bytes.NewReader(nil), s); err == nil {
+			t.Fatalf("%s: expected an error", s)
+		}
+	}
+}
+
+func benchmarkChunker(b *testing.B, newSplitter func(io.Reader) Splitter) {
+	data := seededBuf(6, 1024*1024*16)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		splitAll(b, newSplitter(bytes.NewReader(data)))
+	}
+}
+
+func BenchmarkBuzhash(b *testing.B) {
+	benchmarkChunker(b, func(r io.Reader) Splitter { return NewBuzhash(r, 1024*256) })
+}
+
+func BenchmarkFastCDC(b *testing.B) {
+	benchmarkChunker(b, func(r io.Reader) Splitter { return NewFastCDC(r, 1024*256) })
+}
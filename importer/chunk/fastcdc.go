@@ -0,0 +1,87 @@
+package chunk
+
+import "io"
+
+var gearTable = chunkTable(0x6661737463646321)
+
+// FastCDC is a content-defined chunker using the gear rolling hash with
+// normalized chunking: boundaries are harder to find before the average size
+// and easier past it, which narrows the distribution of chunk sizes.
+type FastCDC struct {
+	*cdcSplitter
+
+	min, avg     int
+	maskS, maskL uint64
+}
+
+// NewFastCDC returns a FastCDC chunker producing blocks of avgBlkSize bytes
+// on average, with the same bounds as NewRabin.
+func NewFastCDC(r io.Reader, avgBlkSize uint64) *FastCDC {
+	min := avgBlkSize / 3
+	max := avgBlkSize + (avgBlkSize / 2)
+
+	f, err := NewFastCDCMinMax(r, min, avgBlkSize, max)
+	if err != nil {
+		f, _ = NewFastCDCMinMax(r, 1, 1, 1)
+	}
+	return f
+}
+
+// NewFastCDCMinMax returns a FastCDC chunker producing blocks of avg bytes on
+// average, never smaller than min or larger than max.
+func NewFastCDCMinMax(r io.Reader, min, avg, max uint64) (*FastCDC, error) {
+	if min > avg || avg > max || max == 0 {
+		return nil, ErrBadChunkSizes
+	}
+
+	f := &FastCDC{
+		min: int(min),
+		avg: int(avg),
+	}
+
+	// the gear hash shifts bytes out to the left, so test the high bits,
+	// which depend on the most recent ones
+	bits := log2(avg)
+	f.maskS = gearMask(bits + 2)
+	f.maskL = gearMask(bits - 2)
+	if bits < 2 {
+		f.maskL = 0
+	}
+
+	f.cdcSplitter = newCDCSplitter(r, int(max), f.cut)
+	return f, nil
+}
+
+func gearMask(bits uint) uint64 {
+	if bits > 64 {
+		bits = 64
+	}
+	return ^uint64(0) << (64 - bits)
+}
+
+func (f *FastCDC) cut(buf []byte) int {
+	if len(buf) <= f.min {
+		return len(buf)
+	}
+
+	normal := f.avg
+	if normal > len(buf) {
+		normal = len(buf)
+	}
+
+	var h uint64
+	i := f.min
+	for ; i < normal; i++ {
+		h = h<<1 + gearTable[buf[i]]
+		if h&f.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < len(buf); i++ {
+		h = h<<1 + gearTable[buf[i]]
+		if h&f.maskL == 0 {
+			return i + 1
+		}
+	}
+	return len(buf)
+}
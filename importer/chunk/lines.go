@@ -0,0 +1,64 @@
+package chunk
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// lineSplitter makes chunks of whole lines, as many as fit in max bytes.
+// Lines longer than max are split in chunks of max bytes.
+type lineSplitter struct {
+	r   io.Reader
+	br  *bufio.Reader
+	max int
+	err error
+}
+
+// NewLineSplitter returns a Splitter for newline-delimited text, ending
+// chunks on line boundaries with chunks of at most max bytes.
+func NewLineSplitter(r io.Reader, max int64) Splitter {
+	return &lineSplitter{
+		r:   r,
+		br:  bufio.NewReaderSize(r, int(max)),
+		max: int(max),
+	}
+}
+
+func (ls *lineSplitter) NextBytes() ([]byte, error) {
+	if ls.err != nil {
+		return nil, ls.err
+	}
+
+	// look at everything which could go in this chunk
+	buf, err := ls.br.Peek(ls.max)
+	switch err {
+	case nil, bufio.ErrBufferFull:
+	case io.EOF:
+		ls.err = io.EOF
+		if len(buf) == 0 {
+			return nil, io.EOF
+		}
+	default:
+		return nil, err
+	}
+
+	n := len(buf)
+	if ls.err == nil {
+		// more data follows, end the chunk after the last full line
+		if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+			n = i + 1
+		}
+	}
+
+	out := make([]byte, n)
+	copy(out, buf)
+	if _, err := ls.br.Discard(n); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (ls *lineSplitter) Reader() io.Reader {
+	return ls.r
+}
@@ -0,0 +1,48 @@
+package chunk
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLineSplitter(t *testing.T) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, strings.Repeat("x", i%97))
+	}
+	data := []byte(strings.Join(lines, "\n") + "\nno newline at the end")
+
+	chunks := splitAll(t, NewLineSplitter(bytes.NewReader(data), 1000))
+	if !bytes.Equal(bytes.Join(chunks, nil), data) {
+		t.Fatal("data was chunked incorrectly")
+	}
+
+	for i, c := range chunks {
+		if len(c) > 1000 {
+			t.Fatalf("chunk %d too large: %d", i, len(c))
+		}
+		if i != len(chunks)-1 && c[len(c)-1] != '\n' {
+			t.Fatalf("chunk %d doesn't end on a line boundary", i)
+		}
+	}
+}
+
+func TestLineSplitterLongLines(t *testing.T) {
+	data := []byte(strings.Repeat("y", 2500) + "\n" + strings.Repeat("z", 600) + "\n" + strings.Repeat("w", 600))
+
+	chunks := splitAll(t, NewLineSplitter(bytes.NewReader(data), 1000))
+	if !bytes.Equal(bytes.Join(chunks, nil), data) {
+		t.Fatal("data was chunked incorrectly")
+	}
+
+	sizes := []int{1000, 1000, 501, 601, 600}
+	if len(chunks) != len(sizes) {
+		t.Fatalf("expected %d chunks, got %d", len(sizes), len(chunks))
+	}
+	for i, s := range sizes {
+		if len(chunks[i]) != s {
+			t.Fatalf("chunk %d has size %d, expected %d", i, len(chunks[i]), s)
+		}
+	}
+}
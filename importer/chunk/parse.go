@@ -8,25 +8,117 @@ import (
 	"strings"
 )
 
+// SplitterParser builds a Splitter from a chunker string, such as
+// "size-1024". The string always starts with the name the parser was
+// registered under.
+type SplitterParser func(r io.Reader, chunker string) (Splitter, error)
+
+var splitterParsers = make(map[string]SplitterParser)
+
+// RegisterSplitter makes the chunkers handled by p available to FromString
+// under the given name. Chunker strings are made of the name, optionally
+// followed by '-' and the parameters of the chunker.
+func RegisterSplitter(name string, p SplitterParser) error {
+	if name == "" || strings.Contains(name, "-") {
+		return fmt.Errorf("invalid chunker name: %q", name)
+	}
+	if _, ok := splitterParsers[name]; ok {
+		return fmt.Errorf("chunker %q already registered", name)
+	}
+
+	splitterParsers[name] = p
+	return nil
+}
+
+func init() {
+	builtin := map[string]SplitterParser{
+		"size":  parseSizeString,
+		"rabin": parseRabinString,
+		"buzhash": func(r io.Reader, chunker string) (Splitter, error) {
+			return parseCDCString(r, chunker,
+				func(r io.Reader, avg uint64) Splitter { return NewBuzhash(r, avg) },
+				func(r io.Reader, min, avg, max uint64) (Splitter, error) { return NewBuzhashMinMax(r, min, avg, max) })
+		},
+		"fastcdc": func(r io.Reader, chunker string) (Splitter, error) {
+			return parseCDCString(r, chunker,
+				func(r io.Reader, avg uint64) Splitter { return NewFastCDC(r, avg) },
+				func(r io.Reader, min, avg, max uint64) (Splitter, error) { return NewFastCDCMinMax(r, min, avg, max) })
+		},
+		"tar":   parseTarString,
+		"lines": parseLinesString,
+	}
+
+	for name, p := range builtin {
+		if err := RegisterSplitter(name, p); err != nil {
+			panic(err)
+		}
+	}
+}
+
 func FromString(r io.Reader, chunker string) (Splitter, error) {
-	switch {
-	case chunker == "" || chunker == "default":
+	if chunker == "" || chunker == "default" {
 		return NewSizeSplitter(r, DefaultBlockSize), nil
+	}
 
-	case strings.HasPrefix(chunker, "size-"):
-		sizeStr := strings.Split(chunker, "-")[1]
-		size, err := strconv.Atoi(sizeStr)
+	name := strings.SplitN(chunker, "-", 2)[0]
+	p, ok := splitterParsers[name]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized chunker option: %s", chunker)
+	}
+	return p(r, chunker)
+}
+
+func parseSizeString(r io.Reader, chunker string) (Splitter, error) {
+	parts := strings.Split(chunker, "-")
+	if len(parts) != 2 {
+		return nil, errors.New("incorrect format (expected 'size-[bytes]')")
+	}
+
+	size, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive: %d", size)
+	}
+	return NewSizeSplitter(r, int64(size)), nil
+}
+
+// parseMaxSize parses the chunker strings made of a name and an optional
+// maximum chunk size, as in 'lines' or 'lines-4096'.
+func parseMaxSize(chunker string) (int64, error) {
+	parts := strings.Split(chunker, "-")
+	switch len(parts) {
+	case 1:
+		return DefaultBlockSize, nil
+	case 2:
+		size, err := strconv.Atoi(parts[1])
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		return NewSizeSplitter(r, int64(size)), nil
+		if size <= 0 {
+			return 0, fmt.Errorf("chunk size must be positive: %d", size)
+		}
+		return int64(size), nil
+	default:
+		return 0, fmt.Errorf("incorrect format (expected '%s' or '%s-[max]')", parts[0], parts[0])
+	}
+}
 
-	case strings.HasPrefix(chunker, "rabin"):
-		return parseRabinString(r, chunker)
+func parseTarString(r io.Reader, chunker string) (Splitter, error) {
+	max, err := parseMaxSize(chunker)
+	if err != nil {
+		return nil, err
+	}
+	return NewTarSplitter(r, max), nil
+}
 
-	default:
-		return nil, fmt.Errorf("unrecognized chunker option: %s", chunker)
+func parseLinesString(r io.Reader, chunker string) (Splitter, error) {
+	max, err := parseMaxSize(chunker)
+	if err != nil {
+		return nil, err
 	}
+	return NewLineSplitter(r, max), nil
 }
 
 func parseRabinString(r io.Reader, chunker string) (Splitter, error) {
@@ -41,36 +133,78 @@ func parseRabinString(r io.Reader, chunker string) (Splitter, error) {
 		}
 		return NewRabin(r, uint64(size)), nil
 	case 4:
-		sub := strings.Split(parts[1], ":")
-		if len(sub) > 1 && sub[0] != "min" {
-			return nil, errors.New("first label must be min")
-		}
-		min, err := strconv.Atoi(sub[len(sub)-1])
+		min, avg, max, err := parseMinAvgMax(parts[1:])
 		if err != nil {
 			return nil, err
 		}
 
-		sub = strings.Split(parts[2], ":")
-		if len(sub) > 1 && sub[0] != "avg" {
-			log.Error("sub == ", sub)
-			return nil, errors.New("second label must be avg")
-		}
-		avg, err := strconv.Atoi(sub[len(sub)-1])
+		return NewRabinMinMax(r, min, avg, max), nil
+	default:
+		return nil, errors.New("incorrect format (expected 'rabin' 'rabin-[avg]' or 'rabin-[min]-[avg]-[max]'")
+	}
+}
+
+// parseCDCString parses the options of the buzhash and fastcdc chunkers,
+// which take the same forms as rabin's.
+func parseCDCString(r io.Reader, chunker string, newAvg func(io.Reader, uint64) Splitter, newMinMax func(io.Reader, uint64, uint64, uint64) (Splitter, error)) (Splitter, error) {
+	parts := strings.Split(chunker, "-")
+	switch len(parts) {
+	case 1:
+		return newAvg(r, uint64(DefaultBlockSize)), nil
+	case 2:
+		size, err := strconv.Atoi(parts[1])
 		if err != nil {
 			return nil, err
 		}
-
-		sub = strings.Split(parts[3], ":")
-		if len(sub) > 1 && sub[0] != "max" {
-			return nil, errors.New("final label must be max")
+		if size <= 0 {
+			return nil, ErrBadChunkSizes
 		}
-		max, err := strconv.Atoi(sub[len(sub)-1])
+		return newAvg(r, uint64(size)), nil
+	case 4:
+		min, avg, max, err := parseMinAvgMax(parts[1:])
 		if err != nil {
 			return nil, err
 		}
 
-		return NewRabinMinMax(r, uint64(min), uint64(avg), uint64(max)), nil
+		return newMinMax(r, min, avg, max)
 	default:
-		return nil, errors.New("incorrect format (expected 'rabin' 'rabin-[avg]' or 'rabin-[min]-[avg]-[max]'")
+		return nil, fmt.Errorf("incorrect format (expected '%s' '%s-[avg]' or '%s-[min]-[avg]-[max]'", parts[0], parts[0], parts[0])
+	}
+}
+
+// parseMinAvgMax parses the '[min]-[avg]-[max]' sizes of a chunker string,
+// each optionally labelled as in 'min:1024'.
+func parseMinAvgMax(parts []string) (uint64, uint64, uint64, error) {
+	sub := strings.Split(parts[0], ":")
+	if len(sub) > 1 && sub[0] != "min" {
+		return 0, 0, 0, errors.New("first label must be min")
+	}
+	min, err := strconv.Atoi(sub[len(sub)-1])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	sub = strings.Split(parts[1], ":")
+	if len(sub) > 1 && sub[0] != "avg" {
+		log.Error("sub == ", sub)
+		return 0, 0, 0, errors.New("second label must be avg")
+	}
+	avg, err := strconv.Atoi(sub[len(sub)-1])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	sub = strings.Split(parts[2], ":")
+	if len(sub) > 1 && sub[0] != "max" {
+		return 0, 0, 0, errors.New("final label must be max")
+	}
+	max, err := strconv.Atoi(sub[len(sub)-1])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if min < 0 || avg < 0 || max < 0 {
+		return 0, 0, 0, ErrBadChunkSizes
 	}
+	return uint64(min), uint64(avg), uint64(max), nil
 }
@@ -0,0 +1,46 @@
+package chunk
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFromStringFormats(t *testing.T) {
+	for _, s := range []string{"", "default", "size-1024", "rabin", "tar", "tar-1048576", "lines", "lines-4096"} {
+		if _, err := FromString(bytes.NewReader(nil), s); err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+	}
+
+	for _, s := range []string{"size-0", "size", "tar-x", "lines-0", "lines-1-2", "nope", "tarball"} {
+		if _, err := FromString(bytes.NewReader(nil), s); err == nil {
+			t.Fatalf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestRegisterSplitter(t *testing.T) {
+	called := false
+	err := RegisterSplitter("testchunker", func(r io.Reader, chunker string) (Splitter, error) {
+		called = chunker == "testchunker-arg"
+		return DefaultSplitter(r), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FromString(bytes.NewReader(nil), "testchunker-arg"); err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("registered chunker wasn't used")
+	}
+
+	if RegisterSplitter("testchunker", nil) == nil {
+		t.Fatal("registering a name twice should fail")
+	}
+	if RegisterSplitter("bad-name", nil) == nil {
+		t.Fatal("names with dashes should be rejected")
+	}
+}
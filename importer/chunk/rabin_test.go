@@ -78,3 +78,23 @@ func TestRabinChunkReuse(t *testing.T) {
 		t.Log("too many spare chunks made")
 	}
 }
+
+func BenchmarkRabin(b *testing.B) {
+	data := make([]byte, 1024*1024*16)
+	util.NewTimeSeededRand().Read(data)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r := NewRabin(bytes.NewReader(data), 1024*256)
+		for {
+			_, err := r.NextBytes()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package chunk
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+const tarBlockSize = 512
+
+// tarSplitter splits a tar stream so that every member header and every
+// member body starts a new chunk. Identical files then give identical
+// chunks, wherever they are in the archive. Bodies larger than the maximum
+// chunk size are split in fixed size chunks. Whatever can't be parsed as tar,
+// from the end of the archive on, is split in fixed size chunks too.
+type tarSplitter struct {
+	r   io.Reader
+	max int64
+
+	// bytes of the current member body left to emit, padding included
+	body int64
+	// set once the stream stops looking like a tar archive
+	rest Splitter
+	err  error
+}
+
+// NewTarSplitter returns a Splitter cutting tar streams on member
+// boundaries, with chunks of at most max bytes.
+func NewTarSplitter(r io.Reader, max int64) Splitter {
+	if max < tarBlockSize {
+		max = tarBlockSize
+	}
+	return &tarSplitter{r: r, max: max}
+}
+
+func (ts *tarSplitter) NextBytes() ([]byte, error) {
+	if ts.err != nil {
+		return nil, ts.err
+	}
+	if ts.rest != nil {
+		return ts.rest.NextBytes()
+	}
+
+	if ts.body > 0 {
+		n := ts.body
+		if n > ts.max {
+			n = ts.max
+		}
+		buf := make([]byte, n)
+		read, err := io.ReadFull(ts.r, buf)
+		ts.body -= int64(read)
+		return ts.result(buf[:read], err)
+	}
+
+	hdr := make([]byte, tarBlockSize)
+	read, err := io.ReadFull(ts.r, hdr)
+	if err != nil {
+		return ts.result(hdr[:read], err)
+	}
+
+	size, ok := tarMemberSize(hdr)
+	if !ok {
+		// end of archive, or not a tar stream at all: chunk what's left
+		// by size, starting with this block
+		ts.rest = NewSizeSplitter(io.MultiReader(bytes.NewReader(hdr), ts.r), ts.max)
+		return ts.rest.NextBytes()
+	}
+
+	ts.body = (size + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+	return hdr, nil
+}
+
+// result returns the bytes read so far, remembering the end of the stream
+// for the next call.
+func (ts *tarSplitter) result(buf []byte, err error) ([]byte, error) {
+	switch err {
+	case nil:
+		return buf, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		ts.err = io.EOF
+		if len(buf) == 0 {
+			return nil, io.EOF
+		}
+		return buf, nil
+	default:
+		return nil, err
+	}
+}
+
+func (ts *tarSplitter) Reader() io.Reader {
+	return ts.r
+}
+
+// tarMemberSize returns the size of the body following the given header
+// block, and whether it is a valid header at all.
+func tarMemberSize(hdr []byte) (int64, bool) {
+	// the checksum is computed with its own field filled with spaces
+	var sum int64
+	for i, c := range hdr {
+		if i >= 148 && i < 156 {
+			c = ' '
+		}
+		sum += int64(c)
+	}
+	if sum == 8*' ' {
+		// all zero block, the end of the archive
+		return 0, false
+	}
+
+	chk, ok := parseTarNumber(hdr[148:156])
+	if !ok || chk != sum {
+		return 0, false
+	}
+
+	// only regular files and such have their size as body, although
+	// links and directories should have a zero size anyway
+	switch hdr[156] {
+	case '1', '2', '3', '4', '5', '6':
+		return 0, true
+	}
+
+	size, ok := parseTarNumber(hdr[124:136])
+	if !ok || size < 0 {
+		return 0, false
+	}
+	return size, true
+}
+
+// parseTarNumber parses a numeric tar header field, either as octal text or
+// as a base-256 number when its high bit is set.
+func parseTarNumber(b []byte) (int64, bool) {
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		var n int64
+		for i, c := range b {
+			if i == 0 {
+				c &= 0x7f
+			}
+			if n > (1<<55)-1 {
+				return 0, false
+			}
+			n = n<<8 | int64(c)
+		}
+		return n, true
+	}
+
+	s := string(bytes.Trim(b, " \x00"))
+	if s == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(s, 8, 64)
+	return n, err == nil
+}
@@ -0,0 +1,100 @@
+package chunk
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func makeTar(t *testing.T, files map[string][]byte, order []string) []byte {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, name := range order {
+		data := files[name]
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTarSplitter(t *testing.T) {
+	files := map[string][]byte{
+		"a":     seededBuf(10, 1000),
+		"b":     seededBuf(11, 5000),
+		"c":     nil,
+		"large": seededBuf(12, 10000),
+	}
+	archive := makeTar(t, files, []string{"a", "b", "c", "large"})
+
+	chunks := splitAll(t, NewTarSplitter(bytes.NewReader(archive), 4096))
+	if !bytes.Equal(bytes.Join(chunks, nil), archive) {
+		t.Fatal("data was chunked incorrectly")
+	}
+
+	// header and body of each member, bodies split in chunks of 4096 bytes,
+	// the empty file has no body
+	sizes := []int{512, 1024, 512, 4096, 1024, 512, 512, 4096, 4096, 2048}
+	for i, s := range sizes {
+		if len(chunks[i]) != s {
+			t.Fatalf("chunk %d has size %d, expected %d", i, len(chunks[i]), s)
+		}
+	}
+	for _, c := range chunks {
+		if len(c) > 4096 {
+			t.Fatalf("chunk too large: %d", len(c))
+		}
+	}
+}
+
+func TestTarSplitterDedup(t *testing.T) {
+	files := map[string][]byte{
+		"one":    seededBuf(13, 3000),
+		"two":    seededBuf(14, 7000),
+		"shared": seededBuf(15, 20000),
+	}
+	a := makeTar(t, files, []string{"one", "shared"})
+	b := makeTar(t, files, []string{"two", "one", "shared"})
+
+	seen := make(map[[sha256.Size]byte]bool)
+	for _, c := range splitAll(t, NewTarSplitter(bytes.NewReader(a), 1<<20)) {
+		seen[sha256.Sum256(c)] = true
+	}
+
+	var reused int
+	for _, c := range splitAll(t, NewTarSplitter(bytes.NewReader(b), 1<<20)) {
+		if seen[sha256.Sum256(c)] {
+			reused += len(c)
+		}
+	}
+
+	// both bodies and headers of 'one' and 'shared' are found again
+	if reused < 3072+20480+1024 {
+		t.Fatalf("only %d bytes deduplicated", reused)
+	}
+}
+
+func TestTarSplitterNotTar(t *testing.T) {
+	data := seededBuf(16, 10000)
+
+	chunks := splitAll(t, NewTarSplitter(bytes.NewReader(data), 4096))
+	if !bytes.Equal(bytes.Join(chunks, nil), data) {
+		t.Fatal("data was chunked incorrectly")
+	}
+	if len(chunks) != 3 || len(chunks[0]) != 4096 {
+		t.Fatal("non tar data should be split by size")
+	}
+}
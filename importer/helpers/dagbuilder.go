@@ -3,10 +3,12 @@ package helpers
 import (
 	"io"
 	"os"
+	"time"
 
 	"github.com/scroot/go-ipfs/commands/files"
 	"github.com/scroot/go-ipfs/importer/chunk"
 	dag "github.com/scroot/go-ipfs/merkledag"
+	pi "github.com/scroot/go-ipfs/thirdparty/posinfo"
 	ft "github.com/scroot/go-ipfs/unixfs"
 
 	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
@@ -26,6 +28,16 @@ type DagBuilderHelper struct {
 	fullPath  string
 	stat      os.FileInfo
 	prefix    *cid.Prefix
+	mode      *os.FileMode
+	mtime     *time.Time
+
+	// fileLeaves makes protobuf leaves File nodes instead of Raw ones
+	fileLeaves bool
+
+	// set when building with a pipeline, see DagBuilderParams.Workers
+	workers  int
+	pipe     *pipeline
+	nextLeaf *UnixfsNode
 }
 
 type DagBuilderParams struct {
@@ -45,6 +57,16 @@ type DagBuilderParams struct {
 	// NoCopy signals to the chunker that it should track fileinfo for
 	// filestore adds
 	NoCopy bool
+
+	// Workers is the number of goroutines building and hashing leaves.
+	// When set, chunking, hashing and writing blocks run concurrently with
+	// the layout. The resulting DAG is the same as without.
+	Workers int
+
+	// Mode and ModTime, when set, are recorded in the root node of the
+	// file, see ft.WithAttrs.
+	Mode    *os.FileMode
+	ModTime *time.Time
 }
 
 // Generate a new DagBuilderHelper from the given params, which data source comes
@@ -57,6 +79,9 @@ func (dbp *DagBuilderParams) New(spl chunk.Splitter) *DagBuilderHelper {
 		prefix:    dbp.Prefix,
 		maxlinks:  dbp.Maxlinks,
 		batch:     dbp.Dagserv.Batch(),
+		workers:   dbp.Workers,
+		mode:      dbp.Mode,
+		mtime:     dbp.ModTime,
 	}
 	if fi, ok := spl.Reader().(files.FileInfo); dbp.NoCopy && ok {
 		db.fullPath = fi.AbsPath()
@@ -74,6 +99,16 @@ func (db *DagBuilderHelper) prepareNext() {
 		return
 	}
 
+	if db.workers > 0 {
+		// the pipeline starts with the first read, once the layout is
+		// set up
+		if db.pipe == nil {
+			db.startPipeline(db.spl, db.workers)
+		}
+		db.nextData, db.nextLeaf, db.recvdErr = db.pipe.next()
+		return
+	}
+
 	db.nextData, db.recvdErr = db.spl.NextBytes()
 	if db.recvdErr == io.EOF {
 		db.recvdErr = nil
@@ -98,6 +133,7 @@ func (db *DagBuilderHelper) Next() ([]byte, error) {
 	db.prepareNext() // idempotent
 	d := db.nextData
 	db.nextData = nil // signal we've consumed it
+	db.nextLeaf = nil
 	if db.recvdErr != nil {
 		return nil, db.recvdErr
 	} else {
@@ -151,6 +187,9 @@ func (db *DagBuilderHelper) FillNodeLayer(node *UnixfsNode) error {
 }
 
 func (db *DagBuilderHelper) GetNextDataNode() (*UnixfsNode, error) {
+	db.prepareNext()
+	leaf := db.nextLeaf
+
 	data, err := db.Next()
 	if err != nil {
 		return nil, err
@@ -160,6 +199,22 @@ func (db *DagBuilderHelper) GetNextDataNode() (*UnixfsNode, error) {
 		return nil, nil
 	}
 
+	if leaf != nil {
+		// built by the pipeline
+		return leaf, nil
+	}
+	return db.newLeaf(data)
+}
+
+// UseFileLeaves makes the protobuf leaves unixfs File nodes rather than Raw
+// ones, for layouts storing data in File nodes. It must be called before
+// reading any data.
+func (db *DagBuilderHelper) UseFileLeaves() {
+	db.fileLeaves = true
+}
+
+// newLeaf builds the leaf node holding data.
+func (db *DagBuilderHelper) newLeaf(data []byte) (*UnixfsNode, error) {
 	if len(data) > BlockSizeLimit {
 		return nil, ErrSizeLimitExceeded
 	}
@@ -180,6 +235,10 @@ func (db *DagBuilderHelper) GetNextDataNode() (*UnixfsNode, error) {
 				raw:     true,
 			}, nil
 		}
+	} else if db.fileLeaves {
+		blk := db.NewUnixfsNode()
+		blk.SetData(data)
+		return blk, nil
 	} else {
 		blk := db.NewUnixfsBlock()
 		blk.SetData(data)
@@ -193,12 +252,21 @@ func (db *DagBuilderHelper) SetPosInfo(node *UnixfsNode, offset uint64) {
 	}
 }
 
+// Add adds the root node of the file, recording the attributes of the
+// params in it.
 func (db *DagBuilderHelper) Add(node *UnixfsNode) (node.Node, error) {
 	dn, err := node.GetDagNode()
 	if err != nil {
 		return nil, err
 	}
 
+	if db.mode != nil || db.mtime != nil {
+		dn, err = db.withAttrs(dn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	_, err = db.dserv.Add(dn)
 	if err != nil {
 		return nil, err
@@ -207,10 +275,56 @@ func (db *DagBuilderHelper) Add(node *UnixfsNode) (node.Node, error) {
 	return dn, nil
 }
 
+// withAttrs returns the root dn carrying the attributes of the params. A raw
+// root is added as is, as the file node wrapping it links to it.
+func (db *DagBuilderHelper) withAttrs(dn node.Node) (node.Node, error) {
+	if fn, ok := dn.(*pi.FilestoreNode); ok {
+		if _, err := db.dserv.Add(fn); err != nil {
+			return nil, err
+		}
+		dn = fn.Node
+	} else if rn, ok := dn.(*dag.RawNode); ok {
+		if _, err := db.dserv.Add(rn); err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := ft.WithAttrs(dn, db.mode, db.mtime)
+	if err != nil {
+		return nil, err
+	}
+	out.SetPrefix(db.prefix)
+	return out, nil
+}
+
 func (db *DagBuilderHelper) Maxlinks() int {
 	return db.maxlinks
 }
 
+// addToBatch writes nd along with the other nodes of the DAG.
+func (db *DagBuilderHelper) addToBatch(nd node.Node) error {
+	if db.pipe != nil {
+		db.pipe.add(nd)
+		return nil
+	}
+
+	_, err := db.batch.Add(nd)
+	return err
+}
+
 func (db *DagBuilderHelper) Close() error {
+	if db.pipe != nil {
+		if err := db.pipe.close(); err != nil {
+			return err
+		}
+	}
 	return db.batch.Commit()
 }
+
+// Abort stops the goroutines of a pipelined build, when the layout fails
+// before reaching Close.
+func (db *DagBuilderHelper) Abort() {
+	if db.pipe != nil {
+		db.pipe.close()
+	}
+}
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -110,9 +111,7 @@ func (n *UnixfsNode) AddChild(child *UnixfsNode, db *DagBuilderHelper) error {
 		return err
 	}
 
-	_, err = db.batch.Add(childnode)
-
-	return err
+	return db.addToBatch(childnode)
 }
 
 // Removes the child node at the given index
@@ -165,6 +164,10 @@ func (n *UnixfsNode) getBaseDagNode() (node.Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	n.node.SetData(data)
+	// keep the cached encoding and CID of unchanged nodes, such as leaves
+	// hashed ahead of time
+	if !bytes.Equal(n.node.Data(), data) {
+		n.node.SetData(data)
+	}
 	return n.node, nil
 }
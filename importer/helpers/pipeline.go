@@ -0,0 +1,152 @@
+package helpers
+
+import (
+	"io"
+	"sync"
+
+	"github.com/scroot/go-ipfs/importer/chunk"
+
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
+)
+
+// leafResult is a chunk of data and the leaf built from it. Results are
+// handed over in chunk order, done is closed once the leaf is ready.
+type leafResult struct {
+	data []byte
+	leaf *UnixfsNode
+	err  error
+	done chan struct{}
+}
+
+// pipeline reads the chunks, builds and hashes the leaves, and writes the
+// nodes of a DagBuilderHelper on separate goroutines. The layouts still see
+// the leaves in order, so the resulting DAG is the same as when building
+// sequentially.
+type pipeline struct {
+	leaves <-chan *leafResult
+	stop   chan struct{}
+
+	nodes    chan node.Node
+	written  chan struct{}
+	writeErr error
+
+	stopOnce  sync.Once
+	closeOnce sync.Once
+}
+
+// startPipeline starts reading chunks from spl, with the given number of
+// goroutines building leaves.
+func (db *DagBuilderHelper) startPipeline(spl chunk.Splitter, workers int) {
+	p := &pipeline{
+		stop:    make(chan struct{}),
+		nodes:   make(chan node.Node, 2*db.maxlinks),
+		written: make(chan struct{}),
+	}
+
+	jobs := make(chan *leafResult, 2*workers)
+	leaves := make(chan *leafResult, 4*workers)
+	p.leaves = leaves
+
+	go func() {
+		defer close(leaves)
+		defer close(jobs)
+
+		for {
+			data, err := spl.NextBytes()
+			if err != nil {
+				if err == io.EOF {
+					return
+				}
+
+				r := &leafResult{err: err, done: make(chan struct{})}
+				close(r.done)
+				select {
+				case leaves <- r:
+				case <-p.stop:
+				}
+				return
+			}
+
+			r := &leafResult{data: data, done: make(chan struct{})}
+			select {
+			case leaves <- r:
+			case <-p.stop:
+				return
+			}
+			select {
+			case jobs <- r:
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for r := range jobs {
+				r.leaf, r.err = db.newLeaf(r.data)
+				if r.err == nil {
+					// hash the leaf now, its CID is cached for when
+					// it gets linked
+					var nd node.Node
+					nd, r.err = r.leaf.GetDagNode()
+					if r.err == nil {
+						nd.Cid()
+					}
+				}
+				close(r.done)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.written)
+
+		batch := db.dserv.Batch()
+		for nd := range p.nodes {
+			if p.writeErr != nil {
+				continue
+			}
+			_, p.writeErr = batch.Add(nd)
+		}
+		if p.writeErr == nil {
+			p.writeErr = batch.Commit()
+		}
+	}()
+
+	db.pipe = p
+}
+
+// next returns the next chunk and its leaf, or nil data when all the chunks
+// were read.
+func (p *pipeline) next() ([]byte, *UnixfsNode, error) {
+	r, ok := <-p.leaves
+	if !ok {
+		return nil, nil, nil
+	}
+
+	<-r.done
+	return r.data, r.leaf, r.err
+}
+
+// add queues nd to be written.
+func (p *pipeline) add(nd node.Node) {
+	p.nodes <- nd
+}
+
+// close waits for the queued nodes to be written and stops the pipeline.
+func (p *pipeline) close() error {
+	p.abort()
+	p.closeOnce.Do(func() {
+		close(p.nodes)
+	})
+	<-p.written
+	return p.writeErr
+}
+
+// abort stops reading chunks and building leaves.
+func (p *pipeline) abort() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
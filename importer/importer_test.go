@@ -5,9 +5,13 @@ import (
 	"context"
 	"io"
 	"io/ioutil"
+	"runtime"
 	"testing"
 
+	bal "github.com/scroot/go-ipfs/importer/balanced"
 	chunk "github.com/scroot/go-ipfs/importer/chunk"
+	h "github.com/scroot/go-ipfs/importer/helpers"
+	trickle "github.com/scroot/go-ipfs/importer/trickle"
 	dag "github.com/scroot/go-ipfs/merkledag"
 	mdtest "github.com/scroot/go-ipfs/merkledag/test"
 	uio "github.com/scroot/go-ipfs/unixfs/io"
@@ -117,3 +121,100 @@ func runReadBench(b *testing.B, nd node.Node, ds dag.DAGService) {
 		cancel()
 	}
 }
+
+type layoutFunc func(*h.DagBuilderHelper) (node.Node, error)
+
+func buildWithParams(t testing.TB, data []byte, blksize int64, layout layoutFunc, dbp h.DagBuilderParams) (node.Node, dag.DAGService) {
+	ds := mdtest.Mock()
+	dbp.Dagserv = ds
+	nd, err := layout(dbp.New(chunk.NewSizeSplitter(bytes.NewReader(data), blksize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nd, ds
+}
+
+func TestPipelinedBuildMatchesSequential(t *testing.T) {
+	prefix, err := dag.PrefixForCidVersion(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layouts := map[string]layoutFunc{
+		"balanced": bal.BalancedLayout,
+		"trickle":  trickle.TrickleLayout,
+	}
+	params := map[string]h.DagBuilderParams{
+		"default":    {Maxlinks: 4},
+		"raw-leaves": {Maxlinks: 4, RawLeaves: true},
+		"cidv1":      {Maxlinks: 4, RawLeaves: true, Prefix: &prefix},
+	}
+
+	for _, size := range []int{0, 100, 1000, 100000} {
+		data := make([]byte, size)
+		u.NewTimeSeededRand().Read(data)
+
+		for lname, layout := range layouts {
+			for pname, dbp := range params {
+				seq, _ := buildWithParams(t, data, 500, layout, dbp)
+
+				dbp.Workers = 4
+				par, ds := buildWithParams(t, data, 500, layout, dbp)
+
+				if !seq.Cid().Equals(par.Cid()) {
+					t.Fatalf("%s/%s/%d: pipelined build gave %s, expected %s", lname, pname, size, par.Cid(), seq.Cid())
+				}
+
+				dr, err := uio.NewDagReader(context.Background(), par, ds)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out, err := ioutil.ReadAll(dr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(out, data) {
+					t.Fatalf("%s/%s/%d: pipelined build lost data", lname, pname, size)
+				}
+			}
+		}
+	}
+}
+
+func TestPipelinedBuildError(t *testing.T) {
+	data := make([]byte, h.BlockSizeLimit*3)
+
+	for _, layout := range []layoutFunc{bal.BalancedLayout, trickle.TrickleLayout} {
+		dbp := h.DagBuilderParams{
+			Dagserv:  mdtest.Mock(),
+			Maxlinks: h.DefaultLinksPerBlock,
+			Workers:  2,
+		}
+		spl := chunk.NewSizeSplitter(bytes.NewReader(data), int64(h.BlockSizeLimit+1))
+		if _, err := layout(dbp.New(spl)); err != h.ErrSizeLimitExceeded {
+			t.Fatalf("expected ErrSizeLimitExceeded, got %v", err)
+		}
+	}
+}
+
+func benchmarkBuild(b *testing.B, workers int) {
+	data := make([]byte, 1024*1024*16)
+	u.NewTimeSeededRand().Read(data)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buildWithParams(b, data, chunk.DefaultBlockSize, bal.BalancedLayout, h.DagBuilderParams{
+			Maxlinks: h.DefaultLinksPerBlock,
+			Workers:  workers,
+		})
+	}
+}
+
+func BenchmarkBuildSequential(b *testing.B) {
+	benchmarkBuild(b, 0)
+}
+
+func BenchmarkBuildPipelined(b *testing.B) {
+	benchmarkBuild(b, runtime.NumCPU())
+}
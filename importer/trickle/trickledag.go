@@ -17,7 +17,13 @@ import (
 // improves seek speeds.
 const layerRepeat = 4
 
-func TrickleLayout(db *h.DagBuilderHelper) (node.Node, error) {
+func TrickleLayout(db *h.DagBuilderHelper) (out node.Node, err error) {
+	defer func() {
+		if err != nil {
+			db.Abort()
+		}
+	}()
+
 	root := db.NewUnixfsNode()
 	if err := db.FillNodeLayer(root); err != nil {
 		return nil, err
@@ -34,7 +40,7 @@ func TrickleLayout(db *h.DagBuilderHelper) (node.Node, error) {
 		}
 	}
 
-	out, err := db.Add(root)
+	out, err = db.Add(root)
 	if err != nil {
 		return nil, err
 	}
@@ -164,26 +164,46 @@ func GetLinksDirect(serv node.NodeGetter) GetLinks {
 	}
 }
 
-type sesGetter struct {
-	bs *bserv.Session
+// sessionDAG is a DAGService fetching the nodes it doesn't have through a
+// single exchange session.
+type sessionDAG struct {
+	*dagService
+	ses *bserv.Session
+}
+
+// NewSession returns a DAGService fetching the nodes missing from ds through
+// a single exchange session, bound to ctx, which allows fetching related
+// nodes from the peers which had the previous ones. DAGServices not backed by
+// a BlockService are returned as they are.
+func NewSession(ctx context.Context, ds DAGService) DAGService {
+	switch ds := ds.(type) {
+	case *dagService:
+		return &sessionDAG{dagService: ds, ses: bserv.NewSession(ctx, ds.Blocks)}
+	default:
+		// sessionDAG included
+		return ds
+	}
 }
 
-func (sg *sesGetter) Get(ctx context.Context, c *cid.Cid) (node.Node, error) {
-	blk, err := sg.bs.GetBlock(ctx, c)
+func (sd *sessionDAG) Get(ctx context.Context, c *cid.Cid) (node.Node, error) {
+	blk, err := sd.ses.GetBlock(ctx, c)
 	if err != nil {
+		if err == bserv.ErrNotFound {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
 
 	return decodeBlock(blk)
 }
 
+func (sd *sessionDAG) GetMany(ctx context.Context, keys []*cid.Cid) <-chan *NodeOption {
+	return decodeBlocks(ctx, sd.ses.GetBlocks(ctx, keys), len(keys))
+}
+
 // FetchGraph fetches all nodes that are children of the given node
 func FetchGraph(ctx context.Context, root *cid.Cid, serv DAGService) error {
-	var ng node.NodeGetter = serv
-	ds, ok := serv.(*dagService)
-	if ok {
-		ng = &sesGetter{bserv.NewSession(ctx, ds.Blocks)}
-	}
+	var ng node.NodeGetter = NewSession(ctx, serv)
 
 	v, _ := ctx.Value("progress").(*ProgressTracker)
 	if v == nil {
@@ -219,8 +239,13 @@ type NodeOption struct {
 }
 
 func (ds *dagService) GetMany(ctx context.Context, keys []*cid.Cid) <-chan *NodeOption {
-	out := make(chan *NodeOption, len(keys))
-	blocks := ds.Blocks.GetBlocks(ctx, keys)
+	return decodeBlocks(ctx, ds.Blocks.GetBlocks(ctx, keys), len(keys))
+}
+
+// decodeBlocks decodes the expected blocks received on blocks, reporting an
+// error if some of them are missing.
+func decodeBlocks(ctx context.Context, blocks <-chan blocks.Block, expected int) <-chan *NodeOption {
+	out := make(chan *NodeOption, expected)
 	var count int
 
 	go func() {
@@ -229,7 +254,7 @@ func (ds *dagService) GetMany(ctx context.Context, keys []*cid.Cid) <-chan *Node
 			select {
 			case b, ok := <-blocks:
 				if !ok {
-					if count != len(keys) {
+					if count != expected {
 						out <- &NodeOption{Err: fmt.Errorf("failed to fetch all nodes")}
 					}
 					return
@@ -328,24 +353,25 @@ func dedupeKeys(cids []*cid.Cid) []*cid.Cid {
 
 func newNodePromise(ctx context.Context) NodeGetter {
 	return &nodePromise{
-		recv: make(chan node.Node, 1),
+		done: make(chan struct{}),
 		ctx:  ctx,
-		err:  make(chan error, 1),
 	}
 }
 
 type nodePromise struct {
 	cache node.Node
+	err   error
 	clk   sync.Mutex
-	recv  chan node.Node
-	ctx   context.Context
-	err   chan error
+
+	// done is closed once the node or an error is received
+	done chan struct{}
+	ctx  context.Context
 }
 
 // NodeGetter provides a promise like interface for a dag Node
-// the first call to Get will block until the Node is received
+// calls to Get block until the Node or an error is received
 // from its internal channels, subsequent calls will return the
-// cached node.
+// cached node. Get may be called concurrently.
 type NodeGetter interface {
 	Get(context.Context) (node.Node, error)
 	Fail(err error)
@@ -354,51 +380,53 @@ type NodeGetter interface {
 
 func (np *nodePromise) Fail(err error) {
 	np.clk.Lock()
-	v := np.cache
-	np.clk.Unlock()
+	defer np.clk.Unlock()
 
 	// if promise has a value, don't fail it
-	if v != nil {
+	select {
+	case <-np.done:
 		return
+	default:
 	}
 
-	np.err <- err
+	np.err = err
+	close(np.done)
 }
 
 func (np *nodePromise) Send(nd node.Node) {
-	var already bool
 	np.clk.Lock()
-	if np.cache != nil {
-		already = true
-	}
-	np.cache = nd
-	np.clk.Unlock()
+	defer np.clk.Unlock()
 
-	if already {
+	if np.cache != nil {
 		panic("sending twice to the same promise is an error!")
 	}
+	select {
+	case <-np.done:
+		// failed already
+		return
+	default:
+	}
 
-	np.recv <- nd
+	np.cache = nd
+	close(np.done)
 }
 
 func (np *nodePromise) Get(ctx context.Context) (node.Node, error) {
-	np.clk.Lock()
-	c := np.cache
-	np.clk.Unlock()
-	if c != nil {
-		return c, nil
-	}
-
 	select {
-	case nd := <-np.recv:
-		return nd, nil
-	case <-np.ctx.Done():
-		return nil, np.ctx.Err()
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case err := <-np.err:
-		return nil, err
+	case <-np.done:
+	default:
+		select {
+		case <-np.done:
+		case <-np.ctx.Done():
+			return nil, np.ctx.Err()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
+
+	np.clk.Lock()
+	defer np.clk.Unlock()
+	return np.cache, np.err
 }
 
 type Batch struct {
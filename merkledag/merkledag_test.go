@@ -327,6 +327,54 @@ func TestFetchFailure(t *testing.T) {
 	}
 }
 
+func TestConcurrentPromiseGet(t *testing.T) {
+	ds := dstest.Mock()
+
+	nd := NodeWithData([]byte("foo"))
+	if _, err := ds.Add(nd); err != nil {
+		t.Fatal(err)
+	}
+
+	getters := GetNodes(context.Background(), NewSession(context.Background(), ds), []*cid.Cid{nd.Cid()})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			out, err := getters[0].Get(ctx)
+			if err == nil && !out.Cid().Equals(nd.Cid()) {
+				err = errors.New("got the wrong node")
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// failures are reported to all the callers too
+	missing := NodeWithData([]byte("bar"))
+	failing := GetNodes(context.Background(), ds, []*cid.Cid{missing.Cid()})
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		_, err := failing[0].Get(ctx)
+		cancel()
+		if err == nil || err == context.DeadlineExceeded {
+			t.Fatalf("expected the fetch to fail, got %v", err)
+		}
+	}
+}
+
 func TestUnmarshalFailure(t *testing.T) {
 	badData := []byte("hello world")
 
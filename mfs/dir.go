@@ -35,6 +35,10 @@ type Directory struct {
 
 	dirbuilder *uio.Directory
 
+	// splitThreshold is the shard split threshold of the directory and of
+	// its children, the default one when nil
+	splitThreshold *int
+
 	modTime time.Time
 
 	name string
@@ -63,6 +67,28 @@ func (d *Directory) SetPrefix(prefix *cid.Prefix) {
 	d.dirbuilder.SetPrefix(prefix)
 }
 
+// SetShardSplitThreshold sets the number of entries over which the
+// directory, and the child directories opened or created from then on, are
+// sharded when sharding is enabled, instead of uio.ShardSplitThreshold.
+func (d *Directory) SetShardSplitThreshold(threshold int) {
+	d.splitThreshold = &threshold
+	d.dirbuilder.SetShardSplitThreshold(threshold)
+}
+
+// newChildDirectory opens the child directory nd, inheriting the shard
+// split threshold of d.
+func (d *Directory) newChildDirectory(name string, nd node.Node) (*Directory, error) {
+	ndir, err := NewDirectory(d.ctx, name, nd, d, d.dserv)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.splitThreshold != nil {
+		ndir.SetShardSplitThreshold(*d.splitThreshold)
+	}
+	return ndir, nil
+}
+
 // closeChild updates the child by the given name to the dag node 'nd'
 // and changes its own dag node
 func (d *Directory) closeChild(name string, nd node.Node, sync bool) error {
@@ -149,7 +175,7 @@ func (d *Directory) cacheNode(name string, nd node.Node) (FSNode, error) {
 
 		switch i.GetType() {
 		case ufspb.Data_Directory, ufspb.Data_HAMTShard:
-			ndir, err := NewDirectory(d.ctx, name, nd, d, d.dserv)
+			ndir, err := d.newChildDirectory(name, nd)
 			if err != nil {
 				return nil, err
 			}
@@ -310,7 +336,7 @@ func (d *Directory) Mkdir(name string) (*Directory, error) {
 		return nil, err
 	}
 
-	dirobj, err := NewDirectory(d.ctx, name, ndir, d, d.dserv)
+	dirobj, err := d.newChildDirectory(name, ndir)
 	if err != nil {
 		return nil, err
 	}
@@ -329,6 +355,33 @@ func (d *Directory) Unlink(name string) error {
 	return d.dirbuilder.RemoveChild(d.ctx, name)
 }
 
+// SetNode replaces all the entries of the directory with the ones of the
+// directory node nd in one step, and publishes the change to its parent.
+func (d *Directory) SetNode(nd node.Node) error {
+	db, err := uio.NewDirectoryFromNode(d.dserv, nd)
+	if err != nil {
+		return err
+	}
+
+	if d.splitThreshold != nil {
+		db.SetShardSplitThreshold(*d.splitThreshold)
+	}
+
+	_, err = d.dserv.Add(nd)
+	if err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	d.dirbuilder = db
+	d.childDirs = make(map[string]*Directory)
+	d.files = make(map[string]*File)
+	d.modTime = time.Now()
+	d.lock.Unlock()
+
+	return d.parent.closeChild(d.name, nd, true)
+}
+
 func (d *Directory) Flush() error {
 	nd, err := d.GetNode()
 	if err != nil {
@@ -2,6 +2,7 @@ package mfs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -114,6 +115,16 @@ func (fi *File) GetNode() (node.Node, error) {
 }
 
 func (fi *File) Flush() error {
+	if fi.Type() == TSymlink {
+		// symlinks have no content to write out, only their parent
+		// needs updating
+		nd, err := fi.GetNode()
+		if err != nil {
+			return err
+		}
+		return fi.parent.closeChild(fi.name, nd, true)
+	}
+
 	// open the file in fullsync mode
 	fd, err := fi.Open(OpenWriteOnly, true)
 	if err != nil {
@@ -134,5 +145,31 @@ func (fi *File) Sync() error {
 
 // Type returns the type FSNode this is
 func (fi *File) Type() NodeType {
+	if _, err := fi.Readlink(); err == nil {
+		return TSymlink
+	}
 	return TFile
 }
+
+// ErrNotSymlink is returned when reading the target of a file which isn't a
+// symlink.
+var ErrNotSymlink = errors.New("not a symlink")
+
+// Readlink returns the target of the symlink this file represents.
+func (fi *File) Readlink() (string, error) {
+	fi.nodelk.Lock()
+	nd, ok := fi.node.(*dag.ProtoNode)
+	fi.nodelk.Unlock()
+	if !ok {
+		return "", ErrNotSymlink
+	}
+
+	pbd, err := ft.FromBytes(nd.Data())
+	if err != nil {
+		return "", err
+	}
+	if pbd.GetType() != ft.TSymlink {
+		return "", ErrNotSymlink
+	}
+	return string(pbd.GetData()), nil
+}
@@ -742,6 +742,112 @@ func TestMfsHugeDir(t *testing.T) {
 	}
 }
 
+func TestShardedDirectory(t *testing.T) {
+	defer func(use bool, threshold int) {
+		uio.UseHAMTSharding = use
+		uio.ShardSplitThreshold = threshold
+	}(uio.UseHAMTSharding, uio.ShardSplitThreshold)
+	uio.UseHAMTSharding = true
+	uio.ShardSplitThreshold = 20
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds, rt := setupRoot(ctx, t)
+
+	err := Mkdir(rt, "/big", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("file%d", i)
+		names = append(names, name)
+
+		err := PutNode(rt, "/big/"+name, getRandFile(t, ds, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = Mkdir(rt, "/big/sub", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = append(names, "sub")
+
+	err = rt.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rnd, err := rt.GetValue().GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reload the tree from the dag, so that nothing is cached
+	rt, err = NewRoot(ctx, ds, rnd.(*dag.ProtoNode), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	big, err := Lookup(rt, "/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bnd, err := big.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsn, err := ft.FromBytes(bnd.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fsn.GetType() != ft.THAMTShard {
+		t.Fatal("directory wasn't sharded over the threshold")
+	}
+
+	err = assertDirAtPath(rt.GetValue().(*Directory), "/big", names)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Mv(rt, "/big/file3", "/big/sub/moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Lookup(rt, "/big/file3"); err != os.ErrNotExist {
+		t.Fatal("expected os.ErrNotExist, got", err)
+	}
+
+	if _, err := Lookup(rt, "/big/sub/moved"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = big.(*Directory).Unlink("file4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := big.(*Directory).Unlink("file4"); err != os.ErrNotExist {
+		t.Fatal("expected os.ErrNotExist, got", err)
+	}
+
+	lnames, err := big.(*Directory).ListNames(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lnames) != len(names)-2 {
+		t.Fatal("wrong number of entries", len(lnames))
+	}
+}
+
 func TestMkdirP(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -753,6 +859,82 @@ func TestMkdirP(t *testing.T) {
 	}
 }
 
+func TestSymlink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds, rt := setupRoot(ctx, t)
+
+	err := Mkdir(rt, "/a", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := map[string]string{
+		"/a/rel":      "../b/file",
+		"/a/abs":      "/a/rel",
+		"/a/dangling": "does/not/exist",
+	}
+	for p, target := range links {
+		if err := Symlink(rt, target, p); err != nil {
+			t.Fatal(err)
+		}
+		if err := FlushPath(rt, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Symlink(rt, "other", "/a/rel"); err == nil {
+		t.Fatal("expected an error replacing an existing entry")
+	}
+
+	// reload the tree to check the links were stored
+	rnd, err := rt.GetValue().GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt2, err := NewRoot(ctx, ds, rnd.(*dag.ProtoNode), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for p, target := range links {
+		fsn, err := Lookup(rt2, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fsn.Type() != TSymlink {
+			t.Fatalf("%s should be a symlink", p)
+		}
+
+		out, err := fsn.(*File).Readlink()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != target {
+			t.Fatalf("%s links to %q, expected %q", p, out, target)
+		}
+	}
+
+	err = Mkdir(rt, "/b", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PutNode(rt, "/b/file", getRandFile(t, ds, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsn, err := Lookup(rt, "/b/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsn.Type() != TFile {
+		t.Fatal("regular file reported as a symlink")
+	}
+	if _, err := fsn.(*File).Readlink(); err != ErrNotSymlink {
+		t.Fatalf("expected ErrNotSymlink, got %v", err)
+	}
+}
+
 func TestConcurrentWriteAndFlush(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -1106,3 +1288,80 @@ func TestFileDescriptors(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestShardSplitThresholdInherited(t *testing.T) {
+	defer func(use bool) {
+		uio.UseHAMTSharding = use
+	}(uio.UseHAMTSharding)
+	uio.UseHAMTSharding = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds, rt := setupRoot(ctx, t)
+	rt.GetValue().(*Directory).SetShardSplitThreshold(0)
+
+	err := Mkdir(rt, "/a/b", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = PutNode(rt, "/a/b/file", getRandFile(t, ds, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Lookup(rt, "/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bnd, err := b.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsn, err := ft.FromBytes(bnd.(*dag.ProtoNode).Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fsn.GetType() != ft.THAMTShard {
+		t.Fatal("child directory didn't inherit the shard split threshold")
+	}
+}
+
+func TestDirectorySetNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds, rt := setupRoot(ctx, t)
+
+	rootdir := rt.GetValue().(*Directory)
+	mkdirP(t, rootdir, "old/dir")
+
+	nd := emptyDirNode()
+	fi := getRandFile(t, ds, 1000)
+	if err := nd.AddNodeLinkClean("file", fi); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rootdir.SetNode(nd); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := assertDirAtPath(rootdir, "/", []string{"file"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := assertFileAtPath(ds, rootdir, fi, "file"); err != nil {
+		t.Fatal(err)
+	}
+
+	rnd, err := rootdir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rnd.Cid().Equals(nd.Cid()) {
+		t.Fatal("directory node wasn't replaced")
+	}
+}
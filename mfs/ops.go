@@ -7,7 +7,9 @@ import (
 	gopath "path"
 	"strings"
 
+	dag "github.com/scroot/go-ipfs/merkledag"
 	path "github.com/scroot/go-ipfs/path"
+	ft "github.com/scroot/go-ipfs/unixfs"
 
 	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
 )
@@ -97,6 +99,23 @@ func PutNode(r *Root, path string, nd node.Node) error {
 	return pdir.AddChild(filename, nd)
 }
 
+// Symlink creates a symlink to target at 'path'. The target isn't resolved,
+// it may be relative or not exist at all.
+func Symlink(r *Root, target, path string) error {
+	if target == "" {
+		return fmt.Errorf("cannot create symlink with empty target")
+	}
+
+	data, err := ft.SymlinkData(target)
+	if err != nil {
+		return err
+	}
+
+	nd := dag.NodeWithData(data)
+	nd.SetPrefix(r.Prefix)
+	return PutNode(r, path, nd)
+}
+
 // Mkdir creates a directory at 'path' under the directory 'd', creating
 // intermediary directories as needed if 'mkparents' is set to true
 func Mkdir(r *Root, pth string, mkparents bool, flush bool) error {
@@ -39,6 +39,7 @@ type NodeType int
 const (
 	TFile NodeType = iota
 	TDir
+	TSymlink
 )
 
 // FSNode represents any node (directory, root, or file) in the mfs filesystem
@@ -98,7 +99,7 @@ func NewRoot(parent context.Context, ds dag.DAGService, node *dag.ProtoNode, pf
 		}
 
 		root.val = rval
-	case ft.TFile, ft.TMetadata, ft.TRaw:
+	case ft.TFile, ft.TMetadata, ft.TRaw, ft.TSymlink:
 		fi, err := NewFile(node.String(), node, root, ds)
 		if err != nil {
 			return nil, err
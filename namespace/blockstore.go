@@ -0,0 +1,61 @@
+package namespace
+
+import (
+	"context"
+
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
+
+	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// Blockstore returns a blockstore writing the blocks to bs and referencing
+// them in the namespace. It has and lists the blocks the namespace
+// references, but reads any block of bs, so that the blocks already in bs
+// aren't fetched again. Deleting a block only drops its reference, the
+// garbage collection deletes it from bs once nothing else needs it.
+func (ns *Namespace) Blockstore(bs bstore.GCBlockstore) bstore.GCBlockstore {
+	return &blockstore{GCBlockstore: bs, ns: ns}
+}
+
+type blockstore struct {
+	bstore.GCBlockstore
+
+	ns *Namespace
+}
+
+func (b *blockstore) Has(c *cid.Cid) (bool, error) {
+	return b.ns.HasRef(c)
+}
+
+func (b *blockstore) Put(bl blocks.Block) error {
+	return b.PutMany([]blocks.Block{bl})
+}
+
+func (b *blockstore) PutMany(bls []blocks.Block) error {
+	// only the references added here are dropped when writing fails
+	var added []*cid.Cid
+	for _, bl := range bls {
+		ok, err := b.ns.ref(bl.Cid(), uint64(len(bl.RawData())))
+		if err != nil {
+			b.ns.UnrefAll(added)
+			return err
+		}
+		if ok {
+			added = append(added, bl.Cid())
+		}
+	}
+	if err := b.GCBlockstore.PutMany(bls); err != nil {
+		b.ns.UnrefAll(added)
+		return err
+	}
+	return nil
+}
+
+func (b *blockstore) DeleteBlock(c *cid.Cid) error {
+	return b.ns.Unref(c)
+}
+
+func (b *blockstore) AllKeysChan(ctx context.Context) (<-chan *cid.Cid, error) {
+	return b.ns.Refs(ctx)
+}
@@ -0,0 +1,340 @@
+// Package namespace implements the namespaces of a node. They share the
+// blockstore of the node, storing each block once, while each namespace
+// keeps its own pins and references the blocks written and pinned in it,
+// which are accounted to it and limited by its quota.
+package namespace
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
+	dag "github.com/scroot/go-ipfs/merkledag"
+	dshelp "github.com/scroot/go-ipfs/thirdparty/ds-help"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsns "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/namespace"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+var log = logging.Logger("namespace")
+
+// Prefix is the key under which the namespaces keep their pins and
+// references in the datastore of the repo.
+var Prefix = ds.NewKey("/local/namespaces")
+
+// refsKey is the key of the references of a namespace, under its own key.
+const refsKey = "refs"
+
+// ErrQuotaExceeded is returned when referencing blocks would take a
+// namespace over its quota.
+var ErrQuotaExceeded = errors.New("namespace quota exceeded")
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ValidName returns whether name can be the name of a namespace.
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Namespace references blocks of a shared blockstore, counting their size.
+type Namespace struct {
+	name  string
+	root  ds.Datastore
+	refs  ds.Datastore
+	quota uint64
+
+	// lk protects the references and usage
+	lk    sync.Mutex
+	usage uint64
+}
+
+// Open opens the namespace of the given name in d, counting the size of the
+// blocks it references. Referencing blocks past quota bytes fails, unless
+// quota is 0.
+func Open(d ds.Datastore, name string, quota uint64) (*Namespace, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid namespace name %q", name)
+	}
+
+	root := dsns.Wrap(d, Prefix.ChildString(name))
+	ns := &Namespace{
+		name:  name,
+		root:  root,
+		refs:  dsns.Wrap(root, ds.NewKey(refsKey)),
+		quota: quota,
+	}
+
+	res, err := ns.refs.Query(dsq.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		size, err := decodeSize(r.Value)
+		if err != nil {
+			return nil, fmt.Errorf("reference %s of namespace %s: %s", r.Key, name, err)
+		}
+		ns.usage += size
+	}
+	return ns, nil
+}
+
+// Name returns the name of the namespace.
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// Datastore returns the datastore where the namespace keeps its state, such
+// as its pins.
+func (ns *Namespace) Datastore() ds.Datastore {
+	return ns.root
+}
+
+// Quota returns the maximum size of the blocks the namespace can reference,
+// 0 when it is unlimited.
+func (ns *Namespace) Quota() uint64 {
+	return ns.quota
+}
+
+// Usage returns the size of the blocks the namespace references.
+func (ns *Namespace) Usage() uint64 {
+	ns.lk.Lock()
+	defer ns.lk.Unlock()
+	return ns.usage
+}
+
+// Ref references the block c, of the given size.
+func (ns *Namespace) Ref(c *cid.Cid, size uint64) error {
+	_, err := ns.ref(c, size)
+	return err
+}
+
+// ref references the block c, returning whether it wasn't referenced yet.
+func (ns *Namespace) ref(c *cid.Cid, size uint64) (bool, error) {
+	ns.lk.Lock()
+	defer ns.lk.Unlock()
+
+	k := dshelp.CidToDsKey(c)
+	has, err := ns.refs.Has(k)
+	if err != nil || has {
+		return false, err
+	}
+	if ns.quota != 0 && ns.usage+size > ns.quota {
+		return false, ErrQuotaExceeded
+	}
+
+	if err := ns.refs.Put(k, encodeSize(size)); err != nil {
+		return false, err
+	}
+	ns.usage += size
+	return true, nil
+}
+
+// Unref drops the reference to the block c. It returns
+// blockstore.ErrNotFound when the namespace doesn't reference it.
+func (ns *Namespace) Unref(c *cid.Cid) error {
+	ns.lk.Lock()
+	defer ns.lk.Unlock()
+	return ns.unref(c)
+}
+
+// UnrefAll drops the references to cids, such as the ones RefDAG added.
+func (ns *Namespace) UnrefAll(cids []*cid.Cid) {
+	ns.lk.Lock()
+	defer ns.lk.Unlock()
+
+	for _, c := range cids {
+		if err := ns.unref(c); err != nil && err != bstore.ErrNotFound {
+			log.Errorf("failed to drop the reference to %s: %s", c, err)
+		}
+	}
+}
+
+func (ns *Namespace) unref(c *cid.Cid) error {
+	k := dshelp.CidToDsKey(c)
+	v, err := ns.refs.Get(k)
+	if err == ds.ErrNotFound {
+		return bstore.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	size, err := decodeSize(v)
+	if err != nil {
+		return err
+	}
+
+	if err := ns.refs.Delete(k); err != nil {
+		return err
+	}
+	ns.usage -= size
+	return nil
+}
+
+// HasRef returns whether the namespace references the block c.
+func (ns *Namespace) HasRef(c *cid.Cid) (bool, error) {
+	return ns.refs.Has(dshelp.CidToDsKey(c))
+}
+
+// Refs lists the blocks the namespace references.
+func (ns *Namespace) Refs(ctx context.Context) (<-chan *cid.Cid, error) {
+	res, err := ns.refs.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan *cid.Cid, dsq.KeysOnlyBufSize)
+	go func() {
+		defer close(output)
+		defer res.Close()
+
+		for r := range res.Next() {
+			if r.Error != nil {
+				log.Errorf("listing the references of namespace %s: %s", ns.name, r.Error)
+				return
+			}
+			c, err := dshelp.DsKeyToCid(ds.RawKey(r.Key))
+			if err != nil {
+				log.Warningf("error parsing key from DsKey: %s", err)
+				continue
+			}
+
+			select {
+			case output <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return output, nil
+}
+
+// RefDAG references the block root, read from bs, and when recursive all
+// the blocks it links to, found with ls. The blocks which aren't referenced
+// yet are all referenced, or none when they would take the namespace over
+// its quota. It returns the ones it referenced.
+func (ns *Namespace) RefDAG(ctx context.Context, bs bstore.Blockstore, ls dag.LinkService, root *cid.Cid, recursive bool) ([]*cid.Cid, error) {
+	set := cid.NewSet()
+	set.Add(root)
+	if recursive {
+		if err := dag.EnumerateChildren(ctx, ls.GetLinks, root, set.Visit); err != nil {
+			return nil, err
+		}
+	}
+
+	var refs []blockRef
+	for _, c := range set.Keys() {
+		has, err := ns.HasRef(c)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			continue
+		}
+		b, err := bs.Get(c)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, blockRef{c, uint64(len(b.RawData()))})
+	}
+	return ns.refAll(refs)
+}
+
+type blockRef struct {
+	c    *cid.Cid
+	size uint64
+}
+
+// refAll references the blocks of refs which aren't yet, or none when they
+// would take the namespace over its quota. It returns the ones it
+// referenced.
+func (ns *Namespace) refAll(refs []blockRef) ([]*cid.Cid, error) {
+	ns.lk.Lock()
+	defer ns.lk.Unlock()
+
+	var missing []blockRef
+	var size uint64
+	for _, r := range refs {
+		has, err := ns.refs.Has(dshelp.CidToDsKey(r.c))
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			missing = append(missing, r)
+			size += r.size
+		}
+	}
+	if ns.quota != 0 && ns.usage+size > ns.quota {
+		return nil, ErrQuotaExceeded
+	}
+
+	var added []*cid.Cid
+	for _, r := range missing {
+		if err := ns.refs.Put(dshelp.CidToDsKey(r.c), encodeSize(r.size)); err != nil {
+			for _, c := range added {
+				if uerr := ns.unref(c); uerr != nil {
+					log.Errorf("failed to drop the reference to %s: %s", c, uerr)
+				}
+			}
+			return nil, err
+		}
+		ns.usage += r.size
+		added = append(added, r.c)
+	}
+	return added, nil
+}
+
+// AllRefs returns the blocks referenced by any of the namespaces in d.
+func AllRefs(d ds.Datastore) (*cid.Set, error) {
+	res, err := d.Query(dsq.Query{Prefix: Prefix.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	set := cid.NewSet()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		// the references are at Prefix/<name>/refs/<block>
+		k := ds.NewKey(r.Key)
+		if k.Parent().BaseNamespace() != refsKey || !k.Parent().Parent().Parent().Equal(Prefix) {
+			continue
+		}
+		c, err := dshelp.DsKeyToCid(ds.NewKey(k.BaseNamespace()))
+		if err != nil {
+			log.Warningf("error parsing key from DsKey: %s", err)
+			continue
+		}
+		set.Add(c)
+	}
+	return set, nil
+}
+
+func encodeSize(size uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, size)]
+}
+
+func decodeSize(v interface{}) (uint64, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return 0, errors.New("value is not a byte slice")
+	}
+	size, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, errors.New("invalid size")
+	}
+	return size, nil
+}
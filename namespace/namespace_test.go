@@ -0,0 +1,190 @@
+package namespace
+
+import (
+	"context"
+	"testing"
+
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
+	bserv "github.com/scroot/go-ipfs/blockservice"
+	offline "github.com/scroot/go-ipfs/exchange/offline"
+	dag "github.com/scroot/go-ipfs/merkledag"
+	pin "github.com/scroot/go-ipfs/pin"
+
+	blocks "gx/ipfs/QmXxGS5QsUxpR3iqL5DjmsYPHR1Yz74siRQ4ChJqWFosMh/go-block-format"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	syncds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+func TestNamespaceRefs(t *testing.T) {
+	d := syncds.MutexWrap(ds.NewMapDatastore())
+	ns, err := Open(d, "team", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := blocks.NewBlock([]byte("aaaa"))
+	b := blocks.NewBlock([]byte("bbbbbb"))
+	if err := ns.Ref(a.Cid(), 4); err != nil {
+		t.Fatal(err)
+	}
+	// referencing a block twice doesn't count it twice
+	if err := ns.Ref(a.Cid(), 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Ref(b.Cid(), 6); err != nil {
+		t.Fatal(err)
+	}
+	if ns.Usage() != 10 {
+		t.Fatalf("expected a usage of 10, got %d", ns.Usage())
+	}
+
+	c := blocks.NewBlock([]byte("c"))
+	if err := ns.Ref(c.Cid(), 1); err != ErrQuotaExceeded {
+		t.Fatalf("expected the quota to be exceeded, got %v", err)
+	}
+
+	if err := ns.Unref(a.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Unref(a.Cid()); err != bstore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// the usage is counted again when opening the namespace
+	ns, err = Open(d, "team", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns.Usage() != 6 {
+		t.Fatalf("expected a usage of 6, got %d", ns.Usage())
+	}
+
+	refs, err := AllRefs(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs.Len() != 1 || !refs.Has(b.Cid()) {
+		t.Fatalf("expected only %s to be referenced, got %v", b.Cid(), refs.Keys())
+	}
+}
+
+func TestInvalidName(t *testing.T) {
+	d := ds.NewMapDatastore()
+	for _, name := range []string{"", "a/b", ".team", "-team"} {
+		if _, err := Open(d, name, 0); err == nil {
+			t.Fatalf("expected %q to be an invalid name", name)
+		}
+	}
+}
+
+func TestNamespaceBlockstore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := syncds.MutexWrap(ds.NewMapDatastore())
+	shared := bstore.NewBlockstore(d)
+	base := bstore.NewGCBlockstore(shared, bstore.NewGCLocker())
+
+	a := blocks.NewBlock([]byte("aaaa"))
+	b := blocks.NewBlock([]byte("bbbbbb"))
+	if err := base.Put(a); err != nil {
+		t.Fatal(err)
+	}
+
+	ns, err := Open(d, "team", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := ns.Blockstore(base)
+
+	// blocks of the shared blockstore are read but not listed
+	if has, err := bs.Has(a.Cid()); err != nil || has {
+		t.Fatalf("expected %s not to be in the namespace: %v", a.Cid(), err)
+	}
+	if _, err := bs.Get(a.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bs.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(a); err != ErrQuotaExceeded {
+		t.Fatalf("expected the quota to be exceeded, got %v", err)
+	}
+
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for k := range keys {
+		if !k.Equals(b.Cid()) {
+			t.Fatalf("unexpected block %s in the namespace", k)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 block in the namespace, got %d", n)
+	}
+
+	// deleting a block only drops the reference of the namespace
+	if err := bs.DeleteBlock(b.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := base.Has(b.Cid()); err != nil || !has {
+		t.Fatalf("expected %s to stay in the shared blockstore: %v", b.Cid(), err)
+	}
+	if ns.Usage() != 0 {
+		t.Fatalf("expected a usage of 0, got %d", ns.Usage())
+	}
+}
+
+func TestNamespacePinQuota(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := syncds.MutexWrap(ds.NewMapDatastore())
+	base := bstore.NewGCBlockstore(bstore.NewBlockstore(d), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(base, offline.Exchange(base)))
+
+	child := dag.NodeWithData([]byte("child"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLinkClean("child", child); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []*dag.ProtoNode{child, root} {
+		if _, err := dserv.Add(nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ns, err := Open(d, "team", uint64(len(child.RawData())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pn := pin.NewPinner(ns.Datastore(), dserv, dserv)
+	if err := pn.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+	p := ns.Pinner(pn, base, dserv)
+
+	// nothing is referenced when the DAG doesn't fit, and the pin which
+	// was already there is kept
+	if err := p.Pin(ctx, root, true); err != ErrQuotaExceeded {
+		t.Fatalf("expected the quota to be exceeded, got %v", err)
+	}
+	if ns.Usage() != 0 {
+		t.Fatalf("expected a usage of 0, got %d", ns.Usage())
+	}
+	if _, pinned, err := pn.IsPinned(root.Cid()); err != nil || !pinned {
+		t.Fatalf("expected %s to stay pinned: %v", root.Cid(), err)
+	}
+
+	if err := p.Pin(ctx, child, true); err != nil {
+		t.Fatal(err)
+	}
+	if ns.Usage() != uint64(len(child.RawData())) {
+		t.Fatalf("expected a usage of %d, got %d", len(child.RawData()), ns.Usage())
+	}
+}
@@ -0,0 +1,65 @@
+package namespace
+
+import (
+	"context"
+
+	bstore "github.com/scroot/go-ipfs/blocks/blockstore"
+	dag "github.com/scroot/go-ipfs/merkledag"
+	pin "github.com/scroot/go-ipfs/pin"
+
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// Pinner returns a pinner referencing in the namespace the blocks of the
+// DAGs pinned with pn, fetched with dserv and read from bs, as they may have
+// been written to bs out of the namespace. Pinning fails, without pinning
+// anything, when it would take the namespace over its quota.
+func (ns *Namespace) Pinner(pn pin.Pinner, bs bstore.Blockstore, dserv dag.DAGService) pin.Pinner {
+	return &pinner{Pinner: pn, ns: ns, bs: bs, dserv: dserv}
+}
+
+type pinner struct {
+	pin.Pinner
+
+	ns    *Namespace
+	bs    bstore.Blockstore
+	dserv dag.DAGService
+}
+
+// refDAG fetches the DAG c, or only its root when not recursive, and
+// references it, returning the blocks it referenced.
+func (p *pinner) refDAG(ctx context.Context, c *cid.Cid, recursive bool) ([]*cid.Cid, error) {
+	if recursive {
+		if err := dag.FetchGraph(ctx, c, p.dserv); err != nil {
+			return nil, err
+		}
+	} else if _, err := p.dserv.Get(ctx, c); err != nil {
+		return nil, err
+	}
+	return p.ns.RefDAG(ctx, p.bs, p.dserv.GetOfflineLinkService(), c, recursive)
+}
+
+func (p *pinner) Pin(ctx context.Context, nd node.Node, recurse bool) error {
+	added, err := p.refDAG(ctx, nd.Cid(), recurse)
+	if err != nil {
+		return err
+	}
+	if err := p.Pinner.Pin(ctx, nd, recurse); err != nil {
+		p.ns.UnrefAll(added)
+		return err
+	}
+	return nil
+}
+
+func (p *pinner) Update(ctx context.Context, from, to *cid.Cid, unpin bool) error {
+	added, err := p.refDAG(ctx, to, true)
+	if err != nil {
+		return err
+	}
+	if err := p.Pinner.Update(ctx, from, to, unpin); err != nil {
+		p.ns.UnrefAll(added)
+		return err
+	}
+	return nil
+}
@@ -3,32 +3,82 @@ package namesys
 import (
 	"context"
 	"errors"
-	"net"
 	"strings"
+	"time"
 
 	path "github.com/scroot/go-ipfs/path"
 
+	lru "gx/ipfs/QmVYxfoJQiZijTgPNHCHgHELvQpbsJNTg6Crmc3dQkj3yy/golang-lru"
 	isd "gx/ipfs/QmZmmuAXgX73UQmX1jRKjTGmjzq24Jinqkq8vzkBtno4uX/go-is-domain"
 )
 
-type LookupTXTFunc func(name string) (txt []string, err error)
-
 // DNSResolver implements a Resolver on DNS domains
 type DNSResolver struct {
-	lookupTXT LookupTXTFunc
-	// TODO: maybe some sort of caching?
-	// cache would need a timeout
+	lookup TXTResolver
+
+	cache *lru.Cache
 }
 
 // NewDNSResolver constructs a name resolver using DNS TXT records.
 func NewDNSResolver() Resolver {
-	return &DNSResolver{lookupTXT: net.LookupTXT}
+	return &DNSResolver{lookup: SystemTXTResolver}
 }
 
-// newDNSResolver constructs a name resolver using DNS TXT records,
-// returning a resolver instead of NewDNSResolver's Resolver.
-func newDNSResolver() resolver {
-	return &DNSResolver{lookupTXT: net.LookupTXT}
+// NewDNSResolverWithLookup constructs a name resolver using the TXT records
+// returned by lookup. Resolved names are cached for the TTL of the records
+// they were read from; cachesize is the limit of the number of entries in the
+// lru cache, '0' disables caching.
+func NewDNSResolverWithLookup(lookup TXTResolver, cachesize int) *DNSResolver {
+	var cache *lru.Cache
+	if cachesize > 0 {
+		cache, _ = lru.New(cachesize)
+	}
+
+	return &DNSResolver{
+		lookup: lookup,
+		cache:  cache,
+	}
+}
+
+func (r *DNSResolver) cacheGet(domain string) (path.Path, bool) {
+	if r.cache == nil {
+		return "", false
+	}
+
+	ientry, ok := r.cache.Get(domain)
+	if !ok {
+		return "", false
+	}
+
+	entry, ok := ientry.(cacheEntry)
+	if !ok {
+		// should never happen, purely for sanity
+		log.Panicf("unexpected type %T in cache for %q.", ientry, domain)
+	}
+
+	if time.Now().Before(entry.eol) {
+		return entry.val, true
+	}
+
+	r.cache.Remove(domain)
+
+	return "", false
+}
+
+func (r *DNSResolver) cacheSet(domain string, val path.Path, ttl time.Duration) {
+	if r.cache == nil {
+		return
+	}
+
+	// if the lookup didn't tell us, just use one minute
+	if ttl <= 0 {
+		ttl = DefaultResolverCacheTTL
+	}
+
+	r.cache.Add(domain, cacheEntry{
+		val: val,
+		eol: time.Now().Add(ttl),
+	})
 }
 
 // Resolve implements Resolver.
@@ -43,6 +93,7 @@ func (r *DNSResolver) ResolveN(ctx context.Context, name string, depth int) (pat
 
 type lookupRes struct {
 	path  path.Path
+	ttl   time.Duration
 	error error
 }
 
@@ -56,13 +107,34 @@ func (r *DNSResolver) resolveOnce(ctx context.Context, name string) (path.Path,
 	if !isd.IsDomain(domain) {
 		return "", errors.New("not a valid domain name")
 	}
+
+	p, ok := r.cacheGet(domain)
+	if !ok {
+		var err error
+		p, err = r.resolveDomain(ctx, domain)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if len(segments) > 1 {
+		return path.FromSegments("", strings.TrimRight(p.String(), "/"), segments[1])
+	} else {
+		return p, nil
+	}
+}
+
+func (r *DNSResolver) resolveDomain(ctx context.Context, domain string) (path.Path, error) {
 	log.Infof("DNSResolver resolving %s", domain)
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	rootChan := make(chan lookupRes, 1)
-	go workDomain(r, domain, rootChan)
+	go workDomain(ctx, r, domain, rootChan)
 
 	subChan := make(chan lookupRes, 1)
-	go workDomain(r, "_dnslink."+domain, subChan)
+	go workDomain(ctx, r, "_dnslink."+domain, subChan)
 
 	var subRes lookupRes
 	select {
@@ -71,46 +143,39 @@ func (r *DNSResolver) resolveOnce(ctx context.Context, name string) (path.Path,
 		return "", ctx.Err()
 	}
 
-	var p path.Path
-	if subRes.error == nil {
-		p = subRes.path
-	} else {
-		var rootRes lookupRes
+	res := subRes
+	if subRes.error != nil {
 		select {
-		case rootRes = <-rootChan:
+		case res = <-rootChan:
 		case <-ctx.Done():
 			return "", ctx.Err()
 		}
-		if rootRes.error == nil {
-			p = rootRes.path
-		} else {
+		if res.error != nil {
 			return "", ErrResolveFailed
 		}
 	}
-	if len(segments) > 1 {
-		return path.FromSegments("", strings.TrimRight(p.String(), "/"), segments[1])
-	} else {
-		return p, nil
-	}
+
+	r.cacheSet(domain, res.path, res.ttl)
+	return res.path, nil
 }
 
-func workDomain(r *DNSResolver, name string, res chan lookupRes) {
-	txt, err := r.lookupTXT(name)
+func workDomain(ctx context.Context, r *DNSResolver, name string, res chan lookupRes) {
+	txt, ttl, err := r.lookup.LookupTXT(ctx, name)
 
 	if err != nil {
 		// Error is != nil
-		res <- lookupRes{"", err}
+		res <- lookupRes{"", 0, err}
 		return
 	}
 
 	for _, t := range txt {
 		p, err := parseEntry(t)
 		if err == nil {
-			res <- lookupRes{p, nil}
+			res <- lookupRes{p, ttl, nil}
 			return
 		}
 	}
-	res <- lookupRes{"", ErrResolveFailed}
+	res <- lookupRes{"", 0, ErrResolveFailed}
 }
 
 func parseEntry(txt string) (path.Path, error) {
@@ -127,7 +127,7 @@ func newMockDNS() *mockDNS {
 
 func TestDNSResolution(t *testing.T) {
 	mock := newMockDNS()
-	r := &DNSResolver{lookupTXT: mock.lookupTXT}
+	r := NewDNSResolverWithLookup(LookupTXTFunc(mock.lookupTXT), 0)
 	testResolution(t, r, "multihash.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
 	testResolution(t, r, "ipfs.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
 	testResolution(t, r, "dipfs.example.com", DefaultDepthLimit, "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD", nil)
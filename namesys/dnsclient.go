@@ -0,0 +1,289 @@
+package namesys
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultDNSTimeout is the time given to a single DNS server to answer.
+const DefaultDNSTimeout = 5 * time.Second
+
+// maxDoHResponseSize bounds the size of DNS-over-HTTPS responses we read.
+const maxDoHResponseSize = 64 * 1024
+
+// TXTResolver looks up the TXT records of a domain name. A zero ttl means
+// the resolver does not know how long the records may be cached for.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) (txt []string, ttl time.Duration, err error)
+}
+
+// LookupTXTFunc adapts a plain lookup function, such as net.LookupTXT, to
+// the TXTResolver interface.
+type LookupTXTFunc func(name string) (txt []string, err error)
+
+// LookupTXT implements TXTResolver.
+func (f LookupTXTFunc) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	txt, err := f(name)
+	return txt, 0, err
+}
+
+// SystemTXTResolver resolves TXT records using the resolver of the host.
+var SystemTXTResolver TXTResolver = LookupTXTFunc(net.LookupTXT)
+
+// NewTXTResolver builds a TXTResolver from a list of servers, plus a map of
+// per-domain overrides. Servers are either "host[:port]" addresses of plain
+// DNS servers, or "https://" URLs of DNS-over-HTTPS endpoints; they are
+// tried in order until one answers. An empty server list selects the system
+// resolver.
+func NewTXTResolver(servers []string, overrides map[string][]string) (TXTResolver, error) {
+	def, err := newServersTXTResolver(servers)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(overrides) == 0 {
+		return def, nil
+	}
+
+	dr := &domainTXTResolver{
+		def:       def,
+		overrides: make(map[string]TXTResolver, len(overrides)),
+	}
+	for domain, srvs := range overrides {
+		if len(srvs) == 0 {
+			return nil, fmt.Errorf("no DNS servers given for domain %q", domain)
+		}
+		r, err := newServersTXTResolver(srvs)
+		if err != nil {
+			return nil, err
+		}
+		dr.overrides[normalizeDomain(domain)] = r
+	}
+	return dr, nil
+}
+
+func newServersTXTResolver(servers []string) (TXTResolver, error) {
+	if len(servers) == 0 {
+		return SystemTXTResolver, nil
+	}
+
+	var rs fallbackTXTResolver
+	for _, s := range servers {
+		if strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://") {
+			rs = append(rs, NewDoHTXTResolver(s))
+			continue
+		}
+
+		addr, err := dnsServerAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, NewDNSServerTXTResolver(addr))
+	}
+
+	if len(rs) == 1 {
+		return rs[0], nil
+	}
+	return rs, nil
+}
+
+func dnsServerAddr(s string) (string, error) {
+	if _, _, err := net.SplitHostPort(s); err == nil {
+		return s, nil
+	}
+	if net.ParseIP(strings.Trim(s, "[]")) == nil {
+		return "", fmt.Errorf("invalid DNS server address %q", s)
+	}
+	return net.JoinHostPort(strings.Trim(s, "[]"), "53"), nil
+}
+
+func normalizeDomain(d string) string {
+	return strings.ToLower(strings.Trim(d, "."))
+}
+
+// fallbackTXTResolver tries each of its resolvers in turn. NXDOMAIN answers
+// are authoritative and end the lookup.
+type fallbackTXTResolver []TXTResolver
+
+func (rs fallbackTXTResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	var lastErr error
+	for _, r := range rs {
+		txt, ttl, err := r.LookupTXT(ctx, name)
+		if err == nil || err == errNoSuchDomain {
+			return txt, ttl, err
+		}
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		lastErr = err
+	}
+	return nil, 0, lastErr
+}
+
+// domainTXTResolver dispatches lookups to the resolver configured for the
+// longest matching domain suffix, or to def if none matches.
+type domainTXTResolver struct {
+	def       TXTResolver
+	overrides map[string]TXTResolver
+}
+
+func (dr *domainTXTResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	return dr.resolverFor(name).LookupTXT(ctx, name)
+}
+
+func (dr *domainTXTResolver) resolverFor(name string) TXTResolver {
+	d := normalizeDomain(name)
+	for {
+		if r, ok := dr.overrides[d]; ok {
+			return r
+		}
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			return dr.def
+		}
+		d = d[i+1:]
+	}
+}
+
+// dnsServerTXTResolver queries a single DNS server over UDP, retrying over
+// TCP when the answer does not fit in a datagram.
+type dnsServerTXTResolver struct {
+	addr    string
+	timeout time.Duration
+}
+
+// NewDNSServerTXTResolver constructs a TXTResolver querying the DNS server
+// listening at addr ("host:port").
+func NewDNSServerTXTResolver(addr string) TXTResolver {
+	return &dnsServerTXTResolver{addr: addr, timeout: DefaultDNSTimeout}
+}
+
+func (r *dnsServerTXTResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	txt, ttl, truncated, err := r.exchange(ctx, "udp", name)
+	if err != nil || !truncated {
+		return txt, ttl, err
+	}
+
+	txt, ttl, truncated, err = r.exchange(ctx, "tcp", name)
+	if err == nil && truncated {
+		err = errors.New("truncated dns response over tcp")
+	}
+	return txt, ttl, err
+}
+
+func (r *dnsServerTXTResolver) exchange(ctx context.Context, network, name string) ([]string, time.Duration, bool, error) {
+	id := uint16(rand.Uint32())
+	query, err := packTXTQuery(id, name)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, r.addr)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var resp []byte
+	if network == "tcp" {
+		// messages over tcp are prefixed with their length
+		buf := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(buf, uint16(len(query)))
+		copy(buf[2:], query)
+		if _, err := conn.Write(buf); err != nil {
+			return nil, 0, false, err
+		}
+
+		var l [2]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return nil, 0, false, err
+		}
+		resp = make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, 0, false, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, 0, false, err
+		}
+
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		resp = buf[:n]
+	}
+
+	return unpackTXTResponse(id, resp)
+}
+
+// dohTXTResolver queries a DNS-over-HTTPS endpoint (RFC 8484).
+type dohTXTResolver struct {
+	url    string
+	client *http.Client
+}
+
+// NewDoHTXTResolver constructs a TXTResolver posting DNS queries to the
+// DNS-over-HTTPS endpoint at url.
+func NewDoHTXTResolver(url string) TXTResolver {
+	return &dohTXTResolver{
+		url:    url,
+		client: &http.Client{Timeout: DefaultDNSTimeout},
+	}
+}
+
+func (r *dohTXTResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	// RFC 8484 recommends an id of zero, to make responses cache friendly
+	query, err := packTXTQuery(0, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest("POST", r.url, bytes.NewReader(query))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DNS-over-HTTPS server returned %s", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDoHResponseSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	txt, ttl, truncated, err := unpackTXTResponse(0, body)
+	if err == nil && truncated {
+		err = errors.New("truncated DNS-over-HTTPS response")
+	}
+	return txt, ttl, err
+}
@@ -0,0 +1,293 @@
+package namesys
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDNSServer is a minimal stand-in DNS server answering TXT queries from
+// a fixed set of records, over udp and tcp.
+type testDNSServer struct {
+	records  map[string][]string
+	ttl      uint32
+	truncate bool // answer udp queries with the TC flag set
+
+	udp     net.PacketConn
+	tcp     net.Listener
+	queries chan string
+}
+
+func newTestDNSServer(t *testing.T, records map[string][]string, ttl uint32) *testDNSServer {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		t.Fatal(err)
+	}
+
+	s := &testDNSServer{
+		records: records,
+		ttl:     ttl,
+		udp:     udp,
+		tcp:     tcp,
+		queries: make(chan string, 100),
+	}
+	go s.serveUDP()
+	go s.serveTCP()
+	return s
+}
+
+func (s *testDNSServer) Addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// countQueries drains the queries received so far and returns how many of
+// them were for name.
+func (s *testDNSServer) countQueries(name string) int {
+	n := 0
+	for {
+		select {
+		case q := <-s.queries:
+			if q == name {
+				n++
+			}
+		default:
+			return n
+		}
+	}
+}
+
+func (s *testDNSServer) Close() {
+	s.udp.Close()
+	s.tcp.Close()
+}
+
+func (s *testDNSServer) serveUDP() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		s.udp.WriteTo(s.answer(buf[:n], s.truncate), addr)
+	}
+}
+
+func (s *testDNSServer) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var l [2]byte
+			if _, err := io.ReadFull(conn, l[:]); err != nil {
+				return
+			}
+			query := make([]byte, binary.BigEndian.Uint16(l[:]))
+			if _, err := io.ReadFull(conn, query); err != nil {
+				return
+			}
+			resp := s.answer(query, false)
+			binary.BigEndian.PutUint16(l[:], uint16(len(resp)))
+			conn.Write(append(l[:], resp...))
+		}()
+	}
+}
+
+func (s *testDNSServer) answer(query []byte, truncate bool) []byte {
+	end, err := skipDNSName(query, dnsHeaderLen)
+	if err != nil {
+		return nil
+	}
+	question := query[dnsHeaderLen : end+4]
+
+	var labels []string
+	for off := dnsHeaderLen; query[off] != 0; off += 1 + int(query[off]) {
+		labels = append(labels, string(query[off+1:off+1+int(query[off])]))
+	}
+	name := strings.Join(labels, ".")
+	s.queries <- name
+
+	txt, ok := s.records[name]
+
+	resp := make([]byte, dnsHeaderLen)
+	copy(resp, query[:2])
+	flags := uint16(dnsFlagResponse | dnsFlagRecursion)
+	switch {
+	case truncate:
+		flags |= dnsFlagTruncated
+	case !ok:
+		flags |= dnsRcodeNameError
+	}
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	resp = append(resp, question...)
+	if truncate || !ok {
+		return resp
+	}
+
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(txt)))
+	for _, t := range txt {
+		var rr [12]byte
+		binary.BigEndian.PutUint16(rr[0:], 0xc000|dnsHeaderLen) // pointer to the question name
+		binary.BigEndian.PutUint16(rr[2:], dnsTypeTXT)
+		binary.BigEndian.PutUint16(rr[4:], dnsClassINET)
+		binary.BigEndian.PutUint32(rr[6:], s.ttl)
+		binary.BigEndian.PutUint16(rr[10:], uint16(len(t)+1))
+		resp = append(resp, rr[:]...)
+		resp = append(resp, byte(len(t)))
+		resp = append(resp, t...)
+	}
+	return resp
+}
+
+var testDNSRecords = map[string][]string{
+	"_dnslink.example.com": []string{
+		"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD",
+	},
+	"_dnslink.internal.corp": []string{
+		"some stuff",
+		"dnslink=/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjE",
+	},
+}
+
+func TestDNSServerTXTResolver(t *testing.T) {
+	srv := newTestDNSServer(t, testDNSRecords, 300)
+	defer srv.Close()
+
+	r := NewDNSServerTXTResolver(srv.Addr())
+	txt, ttl, err := r.LookupTXT(context.Background(), "_dnslink.internal.corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txt) != 2 || txt[1] != testDNSRecords["_dnslink.internal.corp"][1] {
+		t.Fatalf("unexpected TXT records: %v", txt)
+	}
+	if ttl != 300*time.Second {
+		t.Fatalf("expected a TTL of 300s, got %s", ttl)
+	}
+
+	_, _, err = r.LookupTXT(context.Background(), "_dnslink.nothere.com")
+	if err != errNoSuchDomain {
+		t.Fatalf("expected errNoSuchDomain, got %v", err)
+	}
+}
+
+func TestDNSServerTXTResolverTCPFallback(t *testing.T) {
+	srv := newTestDNSServer(t, testDNSRecords, 300)
+	srv.truncate = true
+	defer srv.Close()
+
+	r := NewDNSServerTXTResolver(srv.Addr())
+	txt, _, err := r.LookupTXT(context.Background(), "_dnslink.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txt) != 1 {
+		t.Fatalf("unexpected TXT records: %v", txt)
+	}
+}
+
+func TestDoHTXTResolver(t *testing.T) {
+	dns := newTestDNSServer(t, testDNSRecords, 42)
+	defer dns.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(dns.answer(query, false))
+	}))
+	defer srv.Close()
+
+	r, err := NewTXTResolver([]string{srv.URL}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txt, ttl, err := r.LookupTXT(context.Background(), "_dnslink.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txt) != 1 || ttl != 42*time.Second {
+		t.Fatalf("unexpected answer: %v, ttl %s", txt, ttl)
+	}
+}
+
+func TestTXTResolverOverrides(t *testing.T) {
+	public := newTestDNSServer(t, testDNSRecords, 300)
+	defer public.Close()
+	internal := newTestDNSServer(t, testDNSRecords, 300)
+	defer internal.Close()
+
+	r, err := NewTXTResolver([]string{public.Addr()}, map[string][]string{
+		"corp.": []string{internal.Addr()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := r.LookupTXT(context.Background(), "_dnslink.internal.corp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.LookupTXT(context.Background(), "_dnslink.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if q := <-internal.queries; q != "_dnslink.internal.corp" {
+		t.Fatalf("internal server got unexpected query %q", q)
+	}
+	if q := <-public.queries; q != "_dnslink.example.com" {
+		t.Fatalf("public server got unexpected query %q", q)
+	}
+	if len(internal.queries) != 0 || len(public.queries) != 0 {
+		t.Fatal("queries sent to the wrong server")
+	}
+}
+
+func TestNewTXTResolverBadServer(t *testing.T) {
+	if _, err := NewTXTResolver([]string{"not a server"}, nil); err == nil {
+		t.Fatal("expected invalid server address to fail")
+	}
+}
+
+func TestDNSResolverCacheTTL(t *testing.T) {
+	srv := newTestDNSServer(t, testDNSRecords, 1)
+	defer srv.Close()
+
+	r := NewDNSResolverWithLookup(NewDNSServerTXTResolver(srv.Addr()), 10)
+	exp := "/ipfs/QmY3hE8xgFCjGcz6PHgnvJz5HZi1BaKRfPkn1ghZUcYMjD"
+
+	testResolution(t, r, "example.com", DefaultDepthLimit, exp, nil)
+	testResolution(t, r, "example.com", DefaultDepthLimit, exp, nil)
+	if n := srv.countQueries("_dnslink.example.com"); n != 1 {
+		t.Fatalf("expected a single query, got %d", n)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	testResolution(t, r, "example.com", DefaultDepthLimit, exp, nil)
+	if n := srv.countQueries("_dnslink.example.com"); n != 1 {
+		t.Fatalf("expected the cache entry to expire after its TTL, got %d queries", n)
+	}
+}
@@ -0,0 +1,178 @@
+package namesys
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// This file implements just enough of the DNS wire format (RFC 1035) to
+// send TXT queries and read the answers along with their TTL, which the
+// standard library resolver does not expose.
+
+const (
+	dnsTypeTXT   = 16
+	dnsClassINET = 1
+
+	dnsHeaderLen = 12
+
+	dnsFlagResponse  = 1 << 15
+	dnsFlagTruncated = 1 << 9
+	dnsFlagRecursion = 1 << 8
+
+	dnsRcodeNameError = 3
+)
+
+var errDNSMessage = errors.New("malformed dns message")
+
+// errNoSuchDomain is returned when the server answers with NXDOMAIN.
+var errNoSuchDomain = errors.New("no such domain")
+
+// packTXTQuery builds a recursive TXT query for name.
+func packTXTQuery(id uint16, name string) ([]byte, error) {
+	msg := make([]byte, dnsHeaderLen, dnsHeaderLen+len(name)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], dnsFlagRecursion)
+	binary.BigEndian.PutUint16(msg[4:], 1) // QDCOUNT
+
+	msg, err := appendDNSName(msg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var q [4]byte
+	binary.BigEndian.PutUint16(q[0:], dnsTypeTXT)
+	binary.BigEndian.PutUint16(q[2:], dnsClassINET)
+	return append(msg, q[:]...), nil
+}
+
+func appendDNSName(msg []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("invalid domain name %q", name)
+			}
+			msg = append(msg, byte(len(label)))
+			msg = append(msg, label...)
+		}
+	}
+	return append(msg, 0), nil
+}
+
+// unpackTXTResponse parses a response to a query built by packTXTQuery. It
+// returns the TXT strings of all answers, the smallest TTL among them, and
+// whether the server flagged the response as truncated.
+func unpackTXTResponse(id uint16, msg []byte) (txt []string, ttl time.Duration, truncated bool, err error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, 0, false, errDNSMessage
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return nil, 0, false, errors.New("dns response id mismatch")
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&dnsFlagResponse == 0 {
+		return nil, 0, false, errDNSMessage
+	}
+	if flags&dnsFlagTruncated != 0 {
+		return nil, 0, true, nil
+	}
+	switch rcode := flags & 0xf; rcode {
+	case 0:
+	case dnsRcodeNameError:
+		return nil, 0, false, errNoSuchDomain
+	default:
+		return nil, 0, false, fmt.Errorf("dns server returned error code %d", rcode)
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := dnsHeaderLen
+	for i := 0; i < qdcount; i++ {
+		off, err = skipDNSName(msg, off)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		off += 4 // QTYPE, QCLASS
+	}
+
+	minttl := uint32(0)
+	for i := 0; i < ancount; i++ {
+		off, err = skipDNSName(msg, off)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if off+10 > len(msg) {
+			return nil, 0, false, errDNSMessage
+		}
+
+		typ := binary.BigEndian.Uint16(msg[off:])
+		rrttl := binary.BigEndian.Uint32(msg[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, 0, false, errDNSMessage
+		}
+		rdata := msg[off : off+rdlen]
+		off += rdlen
+
+		if typ != dnsTypeTXT {
+			// most likely a CNAME pointing to the record we asked for
+			continue
+		}
+
+		s, err := parseTXTData(rdata)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		txt = append(txt, s)
+
+		if len(txt) == 1 || rrttl < minttl {
+			minttl = rrttl
+		}
+	}
+
+	return txt, time.Duration(minttl) * time.Second, false, nil
+}
+
+// parseTXTData joins the character-strings of a single TXT record, the same
+// way net.LookupTXT does.
+func parseTXTData(rdata []byte) (string, error) {
+	var parts []string
+	for len(rdata) > 0 {
+		l := int(rdata[0])
+		if 1+l > len(rdata) {
+			return "", errDNSMessage
+		}
+		parts = append(parts, string(rdata[1:1+l]))
+		rdata = rdata[1+l:]
+	}
+	return strings.Join(parts, ""), nil
+}
+
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errDNSMessage
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1, nil
+		case l&0xc0 == 0xc0:
+			// compression pointer, ends the name
+			if off+2 > len(msg) {
+				return 0, errDNSMessage
+			}
+			return off + 2, nil
+		case l&0xc0 != 0:
+			return 0, errDNSMessage
+		default:
+			off += 1 + l
+		}
+	}
+}
@@ -29,9 +29,15 @@ type mpns struct {
 
 // NewNameSystem will construct the IPFS naming system based on Routing
 func NewNameSystem(r routing.ValueStore, ds ds.Datastore, cachesize int) NameSystem {
+	return NewNameSystemWithDNS(r, ds, SystemTXTResolver, cachesize)
+}
+
+// NewNameSystemWithDNS constructs the IPFS naming system, resolving DNSLink
+// names with the given TXT resolver.
+func NewNameSystemWithDNS(r routing.ValueStore, ds ds.Datastore, txt TXTResolver, cachesize int) NameSystem {
 	return &mpns{
 		resolvers: map[string]resolver{
-			"dns":      newDNSResolver(),
+			"dns":      NewDNSResolverWithLookup(txt, cachesize),
 			"proquint": new(ProquintResolver),
 			"dht":      NewRoutingResolver(r, cachesize),
 		},
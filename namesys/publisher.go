@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	dag "github.com/scroot/go-ipfs/merkledag"
@@ -32,6 +33,15 @@ var ErrExpiredRecord = errors.New("expired record")
 // unknown validity type.
 var ErrUnrecognizedValidity = errors.New("unrecognized validity type")
 
+// ErrSignature is returned when an ipns record was not signed by the
+// private key corresponding to the name it is published under.
+var ErrSignature = errors.New("record signature verification failed")
+
+// ErrSequenceTooLow is returned when trying to put a record whose sequence
+// number isn't higher than the one of the record currently in the routing
+// system.
+var ErrSequenceTooLow = errors.New("record sequence number is lower than the current one")
+
 const PublishPutValTimeout = time.Minute
 const DefaultRecordTTL = 24 * time.Hour
 
@@ -122,6 +132,87 @@ func (p *ipnsPublisher) getPreviousSeqNo(ctx context.Context, ipnskey string) (u
 	return e.GetSequence(), nil
 }
 
+// LocalSequence returns the sequence number of the last ipns record for id
+// found in the given datastore, without querying the routing system. Zero
+// is returned if no such record exists.
+func LocalSequence(dstore ds.Datastore, id peer.ID) (uint64, error) {
+	_, ipnskey := IpnsKeysForID(id)
+	prevrec, err := dstore.Get(dshelp.NewKeyFromBinary([]byte(ipnskey)))
+	if err == ds.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	prbytes, ok := prevrec.([]byte)
+	if !ok {
+		return 0, fmt.Errorf("unexpected type returned from datastore: %#v", prevrec)
+	}
+	dhtrec := new(dhtpb.Record)
+	if err := proto.Unmarshal(prbytes, dhtrec); err != nil {
+		return 0, err
+	}
+
+	e := new(pb.IpnsEntry)
+	if err := proto.Unmarshal(dhtrec.GetValue(), e); err != nil {
+		return 0, err
+	}
+
+	return e.GetSequence(), nil
+}
+
+// issuedSequenceKey is the key under which the sequence number of the last
+// record created for id without being published is kept.
+func issuedSequenceKey(id peer.ID) ds.Key {
+	return ds.NewKey("/local/ipns/issued/" + id.Pretty())
+}
+
+// NextSequence returns the sequence number of the next ipns record for id,
+// one more than the highest of the one of the last record found in dstore
+// and the last one recorded by SetIssuedSequence.
+func NextSequence(dstore ds.Datastore, id peer.ID) (uint64, error) {
+	seq, err := LocalSequence(dstore, id)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := dstore.Get(issuedSequenceKey(id))
+	switch err {
+	case nil:
+		b, ok := v.([]byte)
+		if !ok {
+			return 0, fmt.Errorf("unexpected type returned from datastore: %#v", v)
+		}
+		issued, err := strconv.ParseUint(string(b), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if issued > seq {
+			seq = issued
+		}
+	case ds.ErrNotFound:
+	default:
+		return 0, err
+	}
+	return seq + 1, nil
+}
+
+// SetIssuedSequence records that a record of id with the sequence number seq
+// was created, so that NextSequence doesn't issue it again even though the
+// record wasn't published from this node. Lower sequence numbers than the
+// one already recorded are ignored.
+func SetIssuedSequence(dstore ds.Datastore, id peer.ID, seq uint64) error {
+	next, err := NextSequence(dstore, id)
+	if err != nil {
+		return err
+	}
+	if seq < next {
+		return nil
+	}
+	return dstore.Put(issuedSequenceKey(id), []byte(strconv.FormatUint(seq, 10)))
+}
+
 // setting the TTL on published records is an experimental feature.
 // as such, i'm using the context to wire it through to avoid changing too
 // much code along the way.
@@ -167,6 +258,56 @@ func PutRecordToRouting(ctx context.Context, k ci.PrivKey, value path.Path, seqn
 	return waitOnErrChan(ctx, errs)
 }
 
+// PutRoutingEntry validates an already signed entry and pushes it, along
+// with the public key it was signed with, to the routing system. The entry
+// is rejected if its signature or EOL are invalid, or if the routing system
+// already holds a record with the same or a higher sequence number.
+func PutRoutingEntry(ctx context.Context, r routing.ValueStore, pubk ci.PubKey, entry *pb.IpnsEntry) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	id, err := peer.IDFromPublicKey(pubk)
+	if err != nil {
+		return err
+	}
+
+	if err := VerifyRoutingEntry(pubk, entry); err != nil {
+		return err
+	}
+
+	namekey, ipnskey := IpnsKeysForID(id)
+
+	seqctx, seqcancel := context.WithTimeout(ctx, time.Second*30)
+	prev, err := r.GetValue(seqctx, ipnskey)
+	seqcancel()
+	switch err {
+	case nil:
+		e := new(pb.IpnsEntry)
+		if err := proto.Unmarshal(prev, e); err == nil && e.GetSequence() >= entry.GetSequence() {
+			return ErrSequenceTooLow
+		}
+	case routing.ErrNotFound, ds.ErrNotFound:
+	default:
+		return err
+	}
+
+	errs := make(chan error, 2)
+
+	go func() {
+		errs <- PublishEntry(ctx, r, ipnskey, entry)
+	}()
+
+	go func() {
+		errs <- PublishPublicKey(ctx, r, namekey, pubk)
+	}()
+
+	if err := waitOnErrChan(ctx, errs); err != nil {
+		return err
+	}
+
+	return waitOnErrChan(ctx, errs)
+}
+
 func waitOnErrChan(ctx context.Context, errs chan error) error {
 	select {
 	case err := <-errs:
@@ -220,6 +361,21 @@ func CreateRoutingEntryData(pk ci.PrivKey, val path.Path, seq uint64, eol time.T
 	return entry, nil
 }
 
+// VerifyRoutingEntry checks that the given entry was signed by the private
+// key corresponding to pubk and that it has not expired yet.
+func VerifyRoutingEntry(pubk ci.PubKey, e *pb.IpnsEntry) error {
+	if ok, err := pubk.Verify(ipnsEntryDataForSig(e), e.GetSignature()); err != nil || !ok {
+		return ErrSignature
+	}
+
+	data, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return ValidateIpnsRecord("", data)
+}
+
 func ipnsEntryDataForSig(e *pb.IpnsEntry) []byte {
 	return bytes.Join([][]byte{
 		e.Value,
@@ -124,6 +124,109 @@ func TestPrexistingRecord(t *testing.T) {
 	}
 }
 
+func TestPutRoutingEntry(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	d := mockrouting.NewServer().ClientWithDatastore(context.Background(), testutil.RandIdentityOrFatal(t), dstore)
+
+	resolver := NewRoutingResolver(d, 0)
+
+	privk, pubk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := peer.IDFromPublicKey(pubk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sign the records without touching the routing system
+	h := path.FromString("/ipfs/QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN")
+	eol := time.Now().Add(time.Hour)
+	entry, err := CreateRoutingEntryData(privk, h, 5, eol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = PutRoutingEntry(context.Background(), d, pubk, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = verifyCanResolve(resolver, id.Pretty(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A record with a lower or the same sequence number must be rejected
+	for _, seq := range []uint64{4, 5} {
+		old, err := CreateRoutingEntryData(privk, h, seq, eol)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = PutRoutingEntry(context.Background(), d, pubk, old)
+		if err != ErrSequenceTooLow {
+			t.Fatalf("expected ErrSequenceTooLow with sequence %d, got: %v", seq, err)
+		}
+	}
+
+	// A record signed by another key must be rejected
+	otherk, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged, err := CreateRoutingEntryData(otherk, h, 6, eol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = PutRoutingEntry(context.Background(), d, pubk, forged)
+	if err != ErrSignature {
+		t.Fatalf("expected ErrSignature, got: %v", err)
+	}
+
+	// An expired record must be rejected
+	expired, err := CreateRoutingEntryData(privk, h, 7, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = PutRoutingEntry(context.Background(), d, pubk, expired)
+	if err != ErrExpiredRecord {
+		t.Fatalf("expected ErrExpiredRecord, got: %v", err)
+	}
+}
+
+func TestIssuedSequence(t *testing.T) {
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	id := testutil.RandIdentityOrFatal(t).ID()
+
+	for _, c := range []struct {
+		issue, next uint64
+	}{
+		{0, 1},
+		{1, 2},
+		{5, 6},
+		// lower sequence numbers don't go back
+		{3, 6},
+	} {
+		if c.issue > 0 {
+			if err := SetIssuedSequence(dstore, id, c.issue); err != nil {
+				t.Fatal(err)
+			}
+		}
+		next, err := NextSequence(dstore, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next != c.next {
+			t.Fatalf("expected %d after issuing %d, got %d", c.next, c.issue, next)
+		}
+	}
+}
+
 func verifyCanResolve(r Resolver, name string, exp path.Path) error {
 	res, err := r.Resolve(context.Background(), name)
 	if err != nil {
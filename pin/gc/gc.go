@@ -31,6 +31,12 @@ type Result struct {
 // deletes any block that is not found in the marked set.
 //
 func GC(ctx context.Context, bs bstore.GCBlockstore, ls dag.LinkService, pn pin.Pinner, bestEffortRoots []*cid.Cid) <-chan Result {
+	return GCKeeping(ctx, bs, ls, pn, bestEffortRoots, nil)
+}
+
+// GCKeeping is GC, also keeping the blocks of keep, which may be nil. Their
+// links aren't followed: keep must hold all the blocks to keep.
+func GCKeeping(ctx context.Context, bs bstore.GCBlockstore, ls dag.LinkService, pn pin.Pinner, bestEffortRoots []*cid.Cid, keep *cid.Set) <-chan Result {
 	unlocker := bs.GCLock()
 	ls = ls.GetOfflineLinkService()
 
@@ -61,7 +67,7 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, ls dag.LinkService, pn pin.
 				if !ok {
 					break loop
 				}
-				if !gcs.Has(k) {
+				if !gcs.Has(k) && (keep == nil || !keep.Has(k)) {
 					err := bs.DeleteBlock(k)
 					if err != nil {
 						errors = true
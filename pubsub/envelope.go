@@ -0,0 +1,272 @@
+// Package pubsub implements message level features on top of floodsub, such
+// as signed and encrypted messages for private topics.
+package pubsub
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/scroot/go-ipfs/pubsub/pb"
+
+	ci "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
+)
+
+// envelopePrefix marks messages wrapped by Seal, so that they can be told
+// apart from plain payloads published to the same topic.
+var envelopePrefix = []byte("/ipfs/pubsub-envelope/1.0.0\n")
+
+// signaturePrefix is prepended to the signed data, so that envelope
+// signatures can't be replayed as signatures of anything else.
+var signaturePrefix = []byte("ipfs-pubsub-envelope:")
+
+// ErrNoTopicKey is returned when opening an encrypted envelope without a
+// topic key.
+var ErrNoTopicKey = errors.New("message is encrypted and no topic key was given")
+
+// ErrNotEncrypted is returned when opening a message which wasn't encrypted
+// with a topic key, while one was given: anyone can publish plain messages on
+// the topic.
+var ErrNotEncrypted = errors.New("message isn't encrypted with the topic key")
+
+// ErrDecrypt is returned when an encrypted envelope can't be decrypted with
+// the given topic key.
+var ErrDecrypt = errors.New("failed to decrypt message")
+
+// Message is the result of opening a message published to a topic.
+type Message struct {
+	// Data is the payload of the message.
+	Data []byte
+
+	// Signer is the peer that signed the message, if any.
+	Signer peer.ID
+
+	// Seqno is the sequence number of the message, unique for its signer.
+	Seqno []byte
+
+	// Signed is true when the message carried a signature.
+	Signed bool
+
+	// Valid is true when the signature matches the signer.
+	Valid bool
+
+	// Encrypted is true when the payload was encrypted with a topic key.
+	Encrypted bool
+}
+
+// TopicKey derives the symmetric key used to encrypt messages on a topic
+// from a key of the keystore. All the peers sharing that keystore key can
+// read and write the topic.
+func TopicKey(sk ci.PrivKey) ([]byte, error) {
+	b, err := sk.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte("ipfs-pubsub-topic-key:"))
+	h.Write(b)
+	return h.Sum(nil), nil
+}
+
+// seqno is the last sequence number given to a sealed message. It starts at
+// the current time, so that the sequence numbers aren't reused across
+// restarts.
+var seqno = uint64(time.Now().UnixNano())
+
+func nextSeqno() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, atomic.AddUint64(&seqno, 1))
+	return b
+}
+
+// Seal wraps data for publishing on topic. The message is signed with sk
+// when it is not nil, and its payload encrypted with key when it is not nil.
+func Seal(topic string, data []byte, sk ci.PrivKey, key []byte) ([]byte, error) {
+	env := new(pb.Envelope)
+	env.Data = data
+	env.Seqno = nextSeqno()
+
+	if key != nil {
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+
+		env.Nonce = make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, env.Nonce); err != nil {
+			return nil, err
+		}
+		env.Data = gcm.Seal(nil, env.Nonce, data, []byte(topic))
+	}
+
+	if sk != nil {
+		id, err := peer.IDFromPrivateKey(sk)
+		if err != nil {
+			return nil, err
+		}
+
+		env.From = []byte(id)
+		env.Key, err = ci.MarshalPublicKey(sk.GetPublic())
+		if err != nil {
+			return nil, err
+		}
+
+		env.Signature, err = sk.Sign(envelopeDataForSig(topic, env))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := proto.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte{}, envelopePrefix...), b...), nil
+}
+
+// IsEnvelope returns whether msg was produced by Seal.
+func IsEnvelope(msg []byte) bool {
+	return bytes.HasPrefix(msg, envelopePrefix)
+}
+
+// Open unwraps a message published on topic. Messages which weren't sealed
+// are returned as is, unless key is set. Signatures are checked, but an
+// invalid signature is not an error: it is up to the caller to decide what
+// to do with the message, based on its Valid field. key is the topic key
+// used to decrypt the payload, if any, in which case the messages which
+// aren't encrypted are rejected with ErrNotEncrypted.
+func Open(topic string, msg []byte, key []byte) (*Message, error) {
+	if !IsEnvelope(msg) {
+		if key != nil {
+			return nil, ErrNotEncrypted
+		}
+		return &Message{Data: msg}, nil
+	}
+
+	env := new(pb.Envelope)
+	if err := proto.Unmarshal(msg[len(envelopePrefix):], env); err != nil {
+		return nil, err
+	}
+
+	out := &Message{
+		Seqno:     env.GetSeqno(),
+		Signed:    env.Signature != nil,
+		Encrypted: env.Nonce != nil,
+	}
+
+	if out.Signed {
+		out.Signer = peer.ID(env.GetFrom())
+		out.Valid = verifyEnvelope(topic, env)
+	}
+
+	if !out.Encrypted {
+		if key != nil {
+			return nil, ErrNotEncrypted
+		}
+		out.Data = env.GetData()
+		return out, nil
+	}
+
+	if key == nil {
+		return out, ErrNoTopicKey
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out.Data, err = gcm.Open(nil, env.GetNonce(), env.GetData(), []byte(topic))
+	if err != nil {
+		return out, ErrDecrypt
+	}
+
+	return out, nil
+}
+
+func verifyEnvelope(topic string, env *pb.Envelope) bool {
+	pk, err := ci.UnmarshalPublicKey(env.GetKey())
+	if err != nil {
+		return false
+	}
+
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil || id != peer.ID(env.GetFrom()) {
+		return false
+	}
+
+	ok, err := pk.Verify(envelopeDataForSig(topic, env), env.GetSignature())
+	return err == nil && ok
+}
+
+func envelopeDataForSig(topic string, env *pb.Envelope) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(signaturePrefix)
+
+	// length prefix every field, so that their boundaries can't be moved
+	for _, f := range [][]byte{[]byte(topic), env.GetFrom(), env.GetSeqno(), env.GetNonce(), env.GetData()} {
+		var l [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(l[:], uint64(len(f)))
+		buf.Write(l[:n])
+		buf.Write(f)
+	}
+	return buf.Bytes()
+}
+
+// SeenMessages remembers the last signed messages opened, so that the ones
+// published again by other peers can be dropped. It is not safe for
+// concurrent use.
+type SeenMessages struct {
+	size  int
+	seen  map[string]struct{}
+	order []string
+}
+
+// NewSeenMessages returns a SeenMessages remembering up to size messages.
+func NewSeenMessages(size int) *SeenMessages {
+	return &SeenMessages{
+		size: size,
+		seen: make(map[string]struct{}, size),
+	}
+}
+
+// Seen returns whether a message with the same signer and sequence number
+// as m was already seen, and remembers m otherwise. Messages without a valid
+// signature are never reported as seen, as their sender can't be trusted.
+func (s *SeenMessages) Seen(m *Message) bool {
+	if !m.Valid || m.Seqno == nil {
+		return false
+	}
+
+	id := string(m.Signer) + "/" + string(m.Seqno)
+	if _, ok := s.seen[id]; ok {
+		return true
+	}
+
+	if len(s.order) >= s.size {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.seen[id] = struct{}{}
+	s.order = append(s.order, id)
+	return false
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,265 @@
+package pubsub
+
+import (
+	"bytes"
+	"testing"
+
+	pb "github.com/scroot/go-ipfs/pubsub/pb"
+	testutil "github.com/scroot/go-ipfs/thirdparty/testutil"
+
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	peer "gx/ipfs/QmdS9KpbDyPrieswibZhkod1oXqRwZJrUPzxCofAMWpFGq/go-libp2p-peer"
+)
+
+func TestPlainMessage(t *testing.T) {
+	m, err := Open("topic", []byte("hello"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Signed || m.Encrypted || string(m.Data) != "hello" {
+		t.Fatalf("plain message not passed through: %#v", m)
+	}
+}
+
+func TestSignedMessage(t *testing.T) {
+	sk, pk, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := Seal("topic", []byte("hello"), sk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Open("topic", msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Signed || !m.Valid || m.Signer != id || string(m.Data) != "hello" {
+		t.Fatalf("signed message not opened correctly: %#v", m)
+	}
+
+	// the signature covers the topic
+	m, err = Open("other", msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Valid {
+		t.Fatal("signature shouldn't be valid on another topic")
+	}
+}
+
+func TestTamperedMessage(t *testing.T) {
+	sk, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := Seal("topic", []byte("hello"), sk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := new(pb.Envelope)
+	if err := proto.Unmarshal(msg[len(envelopePrefix):], env); err != nil {
+		t.Fatal(err)
+	}
+	env.Data = []byte("goodbye")
+
+	b, err := proto.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Open("topic", append(append([]byte{}, envelopePrefix...), b...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Signed || m.Valid {
+		t.Fatal("tampered message shouldn't have a valid signature")
+	}
+
+	// claiming to be someone else must fail too
+	otherk, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherid, err := peer.IDFromPrivateKey(otherk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.Data = []byte("hello")
+	env.From = []byte(otherid)
+
+	b, err = proto.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = Open("topic", append(append([]byte{}, envelopePrefix...), b...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Valid {
+		t.Fatal("message with a forged sender shouldn't have a valid signature")
+	}
+}
+
+func TestEncryptedMessage(t *testing.T) {
+	sk, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topick, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := TopicKey(topick)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := Seal("topic", []byte("secret"), sk, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(msg, []byte("secret")) {
+		t.Fatal("payload wasn't encrypted")
+	}
+
+	m, err := Open("topic", msg, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Encrypted || !m.Valid || string(m.Data) != "secret" {
+		t.Fatalf("encrypted message not opened correctly: %#v", m)
+	}
+
+	_, err = Open("topic", msg, nil)
+	if err != ErrNoTopicKey {
+		t.Fatalf("expected ErrNoTopicKey, got: %v", err)
+	}
+
+	otherk, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrong, err := TopicKey(otherk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Open("topic", msg, wrong)
+	if err != ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt, got: %v", err)
+	}
+}
+
+func TestUnencryptedMessageWithKey(t *testing.T) {
+	sk, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := TopicKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// plain and signed messages can't be injected in an encrypted topic
+	if _, err := Open("topic", []byte("hello"), key); err != ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted, got: %v", err)
+	}
+
+	msg, err := Seal("topic", []byte("hello"), sk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open("topic", msg, key); err != ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted, got: %v", err)
+	}
+}
+
+func TestReplayedMessage(t *testing.T) {
+	sk, _, err := testutil.RandTestKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := Seal("topic", []byte("hello"), sk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := NewSeenMessages(1)
+	m, err := Open("topic", msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen.Seen(m) {
+		t.Fatal("message seen before it was opened")
+	}
+	if !seen.Seen(m) {
+		t.Fatal("replayed message wasn't seen")
+	}
+
+	// the seqno is signed, it can't be changed to replay the message
+	env := new(pb.Envelope)
+	if err := proto.Unmarshal(msg[len(envelopePrefix):], env); err != nil {
+		t.Fatal(err)
+	}
+	env.Seqno = []byte("other")
+
+	b, err := proto.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = Open("topic", append(append([]byte{}, envelopePrefix...), b...), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Valid {
+		t.Fatal("message with a changed seqno shouldn't have a valid signature")
+	}
+
+	// messages are forgotten past the size of the cache
+	other, err := Seal("topic", []byte("hello"), sk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := Open("topic", other, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen.Seen(m2) {
+		t.Fatal("messages with different seqnos shouldn't be the same")
+	}
+
+	m, err = Open("topic", msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen.Seen(m) {
+		t.Fatal("message should have been forgotten")
+	}
+}
@@ -0,0 +1,544 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
+	floodsub "gx/ipfs/QmUpeULWfmtsgCnfuRN3BHsfhHvBxNphoYh4La4CMxGt2Z/floodsub"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsns "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/namespace"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+var log = logging.Logger("pubsub")
+
+// ErrNoSuchSubscription is returned when a persistent subscription can't be
+// found.
+var ErrNoSuchSubscription = errors.New("no such persistent subscription")
+
+// ErrSubscriptionExists is returned when adding a persistent subscription
+// whose name is already taken.
+var ErrSubscriptionExists = errors.New("persistent subscription already exists")
+
+// listenerBufSize is the number of live messages buffered for each reader of
+// a replay stream before it is considered lagging.
+const listenerBufSize = 64
+
+var (
+	subsKey    = ds.NewKey("/subs")
+	historyKey = ds.NewKey("/history")
+)
+
+// DefaultMaxMessages is the number of messages kept by the persistent
+// subscriptions created without retention bounds.
+const DefaultMaxMessages = 1000
+
+// Retention bounds the history kept by a persistent subscription. Zero
+// values mean no bound, and DefaultMaxMessages is used when there is none.
+type Retention struct {
+	MaxMessages int
+	MaxAge      time.Duration
+}
+
+// Subscription describes a daemon managed subscription, which keeps
+// receiving messages on its topic when no client is listening.
+type Subscription struct {
+	Name  string
+	Topic string
+	Retention
+}
+
+// StoredMessage is a message kept in the history of a persistent
+// subscription. Index numbers the messages of a subscription in the order
+// they were received.
+type StoredMessage struct {
+	Index    uint64
+	Received time.Time
+
+	From     []byte
+	Data     []byte
+	Seqno    []byte
+	TopicIDs []string
+}
+
+// Since selects the messages to replay: the ones with an index greater than
+// or equal to Index, and received at or after Time.
+type Since struct {
+	Index uint64
+	Time  time.Time
+}
+
+// ParseSince parses a message index, or a RFC3339 timestamp.
+func ParseSince(s string) (Since, error) {
+	if idx, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return Since{Index: idx}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return Since{}, fmt.Errorf("%q is neither a message index nor a RFC3339 time", s)
+	}
+	return Since{Time: t}, nil
+}
+
+func (s Since) match(m *StoredMessage) bool {
+	return m.Index >= s.Index && !m.Received.Before(s.Time)
+}
+
+// messageSource is the part of a floodsub subscription used by the Manager.
+type messageSource interface {
+	Next(ctx context.Context) (*floodsub.Message, error)
+	Cancel()
+}
+
+// Manager runs the persistent subscriptions of a node, and stores the
+// messages they receive in the datastore so they can be replayed later.
+type Manager struct {
+	ctx       context.Context
+	ds        ds.Datastore
+	subscribe func(topic string) (messageSource, error)
+
+	lk   sync.Mutex
+	subs map[string]*persistentSub
+}
+
+type persistentSub struct {
+	Subscription
+
+	lk        sync.Mutex
+	first     uint64 // index of the oldest message kept
+	next      uint64 // index of the next message received
+	removed   bool
+	cancel    context.CancelFunc
+	listeners map[chan *StoredMessage]struct{}
+}
+
+// NewManager constructs a Manager, restarting the persistent subscriptions
+// previously stored in d.
+func NewManager(ctx context.Context, ps *floodsub.PubSub, d ds.Datastore) (*Manager, error) {
+	return newManager(ctx, d, func(topic string) (messageSource, error) {
+		sub, err := ps.Subscribe(topic)
+		if err != nil {
+			return nil, err
+		}
+		return sub, nil
+	})
+}
+
+func newManager(ctx context.Context, d ds.Datastore, subscribe func(string) (messageSource, error)) (*Manager, error) {
+	m := &Manager{
+		ctx:       ctx,
+		ds:        dsns.Wrap(d, ds.NewKey("/pubsub")),
+		subscribe: subscribe,
+		subs:      make(map[string]*persistentSub),
+	}
+
+	res, err := m.ds.Query(dsq.Query{Prefix: subsKey.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	for _, e := range entries {
+		b, ok := e.Value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type for persistent subscription %s: %T", e.Key, e.Value)
+		}
+
+		var s Subscription
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, fmt.Errorf("invalid persistent subscription %s: %s", e.Key, err)
+		}
+
+		s.Retention = s.Retention.bounded()
+		if err := m.start(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Add creates a new persistent subscription and starts it.
+func (m *Manager) Add(s Subscription) error {
+	if err := validateName(s.Name); err != nil {
+		return err
+	}
+	if s.Topic == "" {
+		return errors.New("persistent subscriptions need a topic")
+	}
+	if s.MaxMessages < 0 || s.MaxAge < 0 {
+		return errors.New("retention bounds must not be negative")
+	}
+	s.Retention = s.Retention.bounded()
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if _, exists := m.subs[s.Name]; exists {
+		return ErrSubscriptionExists
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	if err := m.ds.Put(subsKey.ChildString(s.Name), b); err != nil {
+		return err
+	}
+
+	return m.start(s)
+}
+
+// Remove stops a persistent subscription and deletes its history. The
+// subscription keeps running if its history can't be deleted.
+func (m *Manager) Remove(name string) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	ps, ok := m.subs[name]
+	if !ok {
+		return ErrNoSuchSubscription
+	}
+
+	ps.lk.Lock()
+	defer ps.lk.Unlock()
+
+	for ; ps.first < ps.next; ps.first++ {
+		if err := m.ds.Delete(messageKey(name, ps.first)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	if err := m.ds.Delete(subsKey.ChildString(name)); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+
+	delete(m.subs, name)
+	ps.cancel()
+	ps.removed = true
+	for l := range ps.listeners {
+		close(l)
+		delete(ps.listeners, l)
+	}
+	return nil
+}
+
+// List returns the persistent subscriptions, sorted by name.
+func (m *Manager) List() []Subscription {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	out := make([]Subscription, 0, len(m.subs))
+	for _, ps := range m.subs {
+		out = append(out, ps.Subscription)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Replay returns the stored messages of topic matching since, followed by
+// the messages received from then on, until ctx is cancelled. The first
+// persistent subscription on topic, by name, is used. If the reader lags
+// too far behind, the channel is closed early; calling Replay again from the
+// index following the last message read resumes the stream without gaps.
+func (m *Manager) Replay(ctx context.Context, topic string, since Since) (<-chan *StoredMessage, error) {
+	var ps *persistentSub
+	for _, s := range m.List() {
+		if s.Topic == topic {
+			m.lk.Lock()
+			ps = m.subs[s.Name]
+			m.lk.Unlock()
+			break
+		}
+	}
+	if ps == nil {
+		return nil, ErrNoSuchSubscription
+	}
+
+	// the listener receives the messages stored from now on, the ones
+	// before are read from the history without holding the lock
+	l := make(chan *StoredMessage, listenerBufSize)
+
+	ps.lk.Lock()
+	if ps.removed {
+		ps.lk.Unlock()
+		return nil, ErrNoSuchSubscription
+	}
+	first, next := ps.first, ps.next
+	ps.listeners[l] = struct{}{}
+	ps.lk.Unlock()
+
+	if first < since.Index {
+		first = since.Index
+	}
+	var history []*StoredMessage
+	for i := first; i < next; i++ {
+		sm, err := m.get(ps.Name, i)
+		if err == ds.ErrNotFound {
+			// pruned meanwhile
+			continue
+		}
+		if err != nil {
+			ps.removeListener(l)
+			return nil, err
+		}
+
+		if since.match(sm) && !ps.expired(sm) {
+			history = append(history, sm)
+		}
+	}
+
+	out := make(chan *StoredMessage)
+	go func() {
+		defer close(out)
+		defer ps.removeListener(l)
+
+		for _, sm := range history {
+			select {
+			case out <- sm:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for {
+			select {
+			case sm, ok := <-l:
+				if !ok {
+					log.Infof("replay of %s ended: reader lagging behind", topic)
+					return
+				}
+				if !since.match(sm) {
+					continue
+				}
+				select {
+				case out <- sm:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// start starts the persistent subscription s. It must be called with m.lk
+// held.
+func (m *Manager) start(s Subscription) error {
+	src, err := m.subscribe(s.Topic)
+	if err != nil {
+		return err
+	}
+
+	first, next, err := m.historyBounds(s.Name)
+	if err != nil {
+		src.Cancel()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	ps := &persistentSub{
+		Subscription: s,
+		first:        first,
+		next:         next,
+		cancel:       cancel,
+		listeners:    make(map[chan *StoredMessage]struct{}),
+	}
+
+	m.subs[s.Name] = ps
+
+	go m.run(ctx, ps, src)
+	return nil
+}
+
+func (m *Manager) run(ctx context.Context, ps *persistentSub, src messageSource) {
+	defer src.Cancel()
+
+	for {
+		msg, err := src.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("persistent subscription %s: %s", ps.Name, err)
+			}
+			return
+		}
+
+		if err := m.store(ps, msg); err != nil {
+			log.Errorf("persistent subscription %s: storing message: %s", ps.Name, err)
+		}
+	}
+}
+
+func (m *Manager) store(ps *persistentSub, msg *floodsub.Message) error {
+	ps.lk.Lock()
+	defer ps.lk.Unlock()
+
+	if ps.removed {
+		return nil
+	}
+
+	sm := &StoredMessage{
+		Index:    ps.next,
+		Received: time.Now(),
+		From:     msg.GetFrom(),
+		Data:     msg.GetData(),
+		Seqno:    msg.GetSeqno(),
+		TopicIDs: msg.GetTopicIDs(),
+	}
+
+	b, err := json.Marshal(sm)
+	if err != nil {
+		return err
+	}
+
+	if err := m.ds.Put(messageKey(ps.Name, sm.Index), b); err != nil {
+		return err
+	}
+	ps.next++
+
+	for l := range ps.listeners {
+		select {
+		case l <- sm:
+		default:
+			// the reader will have to resume from the history
+			close(l)
+			delete(ps.listeners, l)
+		}
+	}
+
+	return m.prune(ps)
+}
+
+// prune deletes the oldest messages of ps beyond its retention bounds. It
+// must be called with ps.lk held.
+func (m *Manager) prune(ps *persistentSub) error {
+	for ps.first < ps.next {
+		if ps.MaxMessages == 0 || ps.next-ps.first <= uint64(ps.MaxMessages) {
+			if ps.MaxAge == 0 {
+				return nil
+			}
+
+			sm, err := m.get(ps.Name, ps.first)
+			if err != nil && err != ds.ErrNotFound {
+				return err
+			}
+			if err == nil && !ps.expired(sm) {
+				return nil
+			}
+		}
+
+		if err := m.ds.Delete(messageKey(ps.Name, ps.first)); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+		ps.first++
+	}
+	return nil
+}
+
+func (m *Manager) get(name string, idx uint64) (*StoredMessage, error) {
+	v, err := m.ds.Get(messageKey(name, idx))
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type for stored message: %T", v)
+	}
+
+	sm := new(StoredMessage)
+	if err := json.Unmarshal(b, sm); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+// historyBounds returns the index of the oldest message stored for the
+// subscription called name, and the index of the next one.
+func (m *Manager) historyBounds(name string) (first, next uint64, err error) {
+	// the trailing slash keeps the history of "foobar" out of the one of
+	// "foo", as does checking the parent of the keys for datastores which
+	// clean the prefix
+	parent := historyKey.ChildString(name)
+	res, err := m.ds.Query(dsq.Query{
+		Prefix:   parent.String() + "/",
+		KeysOnly: true,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	entries, err := res.Rest()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	found := false
+	for _, e := range entries {
+		k := ds.RawKey(e.Key)
+		if !k.Parent().Equal(parent) {
+			continue
+		}
+		idx, err := strconv.ParseUint(k.BaseNamespace(), 16, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid stored message key %s", e.Key)
+		}
+		if !found || idx < first {
+			first = idx
+		}
+		found = true
+		if idx >= next {
+			next = idx + 1
+		}
+	}
+	return first, next, nil
+}
+
+// bounded returns r, or the default retention when r has no bound.
+func (r Retention) bounded() Retention {
+	if r.MaxMessages == 0 && r.MaxAge == 0 {
+		r.MaxMessages = DefaultMaxMessages
+	}
+	return r
+}
+
+func (ps *persistentSub) expired(sm *StoredMessage) bool {
+	return ps.MaxAge > 0 && time.Since(sm.Received) > ps.MaxAge
+}
+
+func (ps *persistentSub) removeListener(l chan *StoredMessage) {
+	ps.lk.Lock()
+	defer ps.lk.Unlock()
+	delete(ps.listeners, l)
+}
+
+func messageKey(name string, idx uint64) ds.Key {
+	return historyKey.ChildString(name).ChildString(fmt.Sprintf("%016x", idx))
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("persistent subscription names must be at least one character")
+	}
+	if strings.Contains(name, "/") {
+		return errors.New("persistent subscription names may not contain slashes")
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	floodsub "gx/ipfs/QmUpeULWfmtsgCnfuRN3BHsfhHvBxNphoYh4La4CMxGt2Z/floodsub"
+	fspb "gx/ipfs/QmUpeULWfmtsgCnfuRN3BHsfhHvBxNphoYh4La4CMxGt2Z/floodsub/pb"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+// fakeSource feeds messages published on a fake network to the Manager.
+type fakeSource struct {
+	msgs chan *floodsub.Message
+}
+
+func (s *fakeSource) Next(ctx context.Context) (*floodsub.Message, error) {
+	select {
+	case m := <-s.msgs:
+		return m, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *fakeSource) Cancel() {}
+
+type fakeNet struct {
+	sources map[string]*fakeSource
+}
+
+func newFakeNet() *fakeNet {
+	return &fakeNet{sources: make(map[string]*fakeSource)}
+}
+
+func (n *fakeNet) subscribe(topic string) (messageSource, error) {
+	s := &fakeSource{msgs: make(chan *floodsub.Message)}
+	n.sources[topic] = s
+	return s, nil
+}
+
+func (n *fakeNet) publish(t *testing.T, topic string, data string) {
+	msg := &floodsub.Message{Message: &fspb.Message{
+		Data:     []byte(data),
+		TopicIDs: []string{topic},
+	}}
+
+	select {
+	case n.sources[topic].msgs <- msg:
+	case <-time.After(time.Second):
+		t.Fatal("timed out publishing message")
+	}
+}
+
+// waitStored waits for the manager to have stored count messages for name.
+func waitStored(t *testing.T, m *Manager, name string, count uint64) {
+	for i := 0; i < 100; i++ {
+		m.lk.Lock()
+		ps := m.subs[name]
+		m.lk.Unlock()
+
+		ps.lk.Lock()
+		next := ps.next
+		ps.lk.Unlock()
+		if next >= count {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("messages not stored in time")
+}
+
+func readN(t *testing.T, ch <-chan *StoredMessage, n int) []*StoredMessage {
+	var out []*StoredMessage
+	for i := 0; i < n; i++ {
+		select {
+		case sm, ok := <-ch:
+			if !ok {
+				t.Fatalf("replay ended after %d messages, expected %d", i, n)
+			}
+			out = append(out, sm)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d messages, expected %d", i, n)
+		}
+	}
+	return out
+}
+
+func TestReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	net := newFakeNet()
+	m, err := newManager(ctx, dssync.MutexWrap(ds.NewMapDatastore()), net.subscribe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Add(Subscription{Name: "sub", Topic: "topic", Retention: Retention{MaxMessages: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		net.publish(t, "topic", fmt.Sprint(i))
+	}
+	waitStored(t, m, "sub", 5)
+
+	// only the last 3 messages are kept
+	ch, err := m.Replay(ctx, "topic", Since{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := readN(t, ch, 3)
+	for i, sm := range msgs {
+		if sm.Index != uint64(i+2) || string(sm.Data) != fmt.Sprint(i+2) {
+			t.Fatalf("unexpected message %d: %d %q", i, sm.Index, sm.Data)
+		}
+	}
+
+	// the replay continues with live messages
+	net.publish(t, "topic", "5")
+	if sm := readN(t, ch, 1)[0]; sm.Index != 5 || string(sm.Data) != "5" {
+		t.Fatalf("unexpected live message: %d %q", sm.Index, sm.Data)
+	}
+
+	// resuming from an index skips the messages already seen
+	rctx, rcancel := context.WithCancel(ctx)
+	defer rcancel()
+	ch, err = m.Replay(rctx, "topic", Since{Index: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs = readN(t, ch, 2)
+	if msgs[0].Index != 4 || msgs[1].Index != 5 {
+		t.Fatalf("unexpected messages: %d, %d", msgs[0].Index, msgs[1].Index)
+	}
+
+	if _, err := m.Replay(ctx, "other", Since{}); err != ErrNoSuchSubscription {
+		t.Fatalf("expected ErrNoSuchSubscription, got %v", err)
+	}
+}
+
+func TestSubscriptionsPersist(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+
+	net := newFakeNet()
+	m, err := newManager(ctx, dstore, net.subscribe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Add(Subscription{Name: "sub", Topic: "topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Add(Subscription{Name: "sub", Topic: "topic"}); err != ErrSubscriptionExists {
+		t.Fatalf("expected ErrSubscriptionExists, got %v", err)
+	}
+
+	net.publish(t, "topic", "a")
+	net.publish(t, "topic", "b")
+	waitStored(t, m, "sub", 2)
+
+	// a new manager on the same datastore picks up where the first left
+	net2 := newFakeNet()
+	m2, err := newManager(ctx, dstore, net2.subscribe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs := m2.List()
+	if len(subs) != 1 || subs[0].Name != "sub" || subs[0].Topic != "topic" {
+		t.Fatalf("persistent subscriptions not restored: %v", subs)
+	}
+	if subs[0].MaxMessages != DefaultMaxMessages {
+		t.Fatalf("expected the default retention of %d messages, got %d", DefaultMaxMessages, subs[0].MaxMessages)
+	}
+
+	net2.publish(t, "topic", "c")
+	waitStored(t, m2, "sub", 3)
+
+	ch, err := m2.Replay(ctx, "topic", Since{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := readN(t, ch, 3)
+	for i, exp := range []string{"a", "b", "c"} {
+		if string(msgs[i].Data) != exp || msgs[i].Index != uint64(i) {
+			t.Fatalf("unexpected message %d: %d %q", i, msgs[i].Index, msgs[i].Data)
+		}
+	}
+
+	if err := m2.Remove("sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m2.List()) != 0 {
+		t.Fatal("subscription not removed")
+	}
+
+	if err := m2.Remove("sub"); err != ErrNoSuchSubscription {
+		t.Fatalf("expected ErrNoSuchSubscription, got %v", err)
+	}
+}
+
+func TestHistoryOfPrefixedNames(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+
+	net := newFakeNet()
+	m, err := newManager(ctx, dstore, net.subscribe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Add(Subscription{Name: "foo", Topic: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add(Subscription{Name: "foobar", Topic: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	net.publish(t, "b", "x")
+	net.publish(t, "b", "y")
+	waitStored(t, m, "foobar", 2)
+
+	first, next, err := m.historyBounds("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 0 || next != 0 {
+		t.Fatalf("history of foo includes the one of foobar: [%d, %d)", first, next)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	s, err := ParseSince("42")
+	if err != nil || s.Index != 42 {
+		t.Fatalf("failed to parse index: %v %v", s, err)
+	}
+
+	s, err = ParseSince("2017-06-01T10:00:00Z")
+	if err != nil || s.Time.Year() != 2017 {
+		t.Fatalf("failed to parse time: %v %v", s, err)
+	}
+
+	if _, err := ParseSince("yesterday"); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
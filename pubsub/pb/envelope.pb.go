@@ -0,0 +1,80 @@
+// Code generated by protoc-gen-gogo.
+// source: envelope.proto
+// DO NOT EDIT!
+
+/*
+Package pubsub_pb is a generated protocol buffer package.
+
+It is generated from these files:
+	envelope.proto
+
+It has these top-level messages:
+	Envelope
+*/
+package pubsub_pb
+
+import proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type Envelope struct {
+	From             []byte `protobuf:"bytes,1,opt,name=from" json:"from,omitempty"`
+	Key              []byte `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	Data             []byte `protobuf:"bytes,3,opt,name=data" json:"data,omitempty"`
+	Nonce            []byte `protobuf:"bytes,4,opt,name=nonce" json:"nonce,omitempty"`
+	Signature        []byte `protobuf:"bytes,5,opt,name=signature" json:"signature,omitempty"`
+	Seqno            []byte `protobuf:"bytes,6,opt,name=seqno" json:"seqno,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Envelope) Reset()         { *m = Envelope{} }
+func (m *Envelope) String() string { return proto.CompactTextString(m) }
+func (*Envelope) ProtoMessage()    {}
+
+func (m *Envelope) GetFrom() []byte {
+	if m != nil {
+		return m.From
+	}
+	return nil
+}
+
+func (m *Envelope) GetKey() []byte {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+func (m *Envelope) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Envelope) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
+func (m *Envelope) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+func (m *Envelope) GetSeqno() []byte {
+	if m != nil {
+		return m.Seqno
+	}
+	return nil
+}
+
+func init() {
+}
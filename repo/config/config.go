@@ -20,6 +20,7 @@ type Config struct {
 	Mounts           Mounts                // local node's mount points
 	Discovery        Discovery             // local node's discovery mechanisms
 	Ipns             Ipns                  // Ipns settings
+	DNS              DNS                   // DNSLink resolution settings
 	Bootstrap        []string              // local nodes's bootstrap peer addresses
 	Tour             Tour                  // local node's tour position
 	Gateway          Gateway               // local node's gateway server options
@@ -29,6 +30,9 @@ type Config struct {
 
 	Reprovider   Reprovider
 	Experimental Experiments
+
+	// Namespaces are the namespaces of the node, by name.
+	Namespaces map[string]*Namespace `json:",omitempty"`
 }
 
 const (
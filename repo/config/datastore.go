@@ -9,6 +9,10 @@ const DefaultDataStoreDirectory = "datastore"
 
 // Datastore tracks the configuration of the datastore.
 type Datastore struct {
+	// Spec describes the tree of datastores backing the repo, see
+	// DefaultDatastoreSpec. When nil, the default one is used.
+	Spec map[string]interface{} `json:",omitempty"`
+
 	Type               string
 	Path               string
 	StorageMax         string // in B, kB, kiB, MB, ...
@@ -19,6 +23,22 @@ type Datastore struct {
 	NoSync          bool
 	HashOnRead      bool
 	BloomFilterSize int
+
+	// BlockCompression is the codec compressing the blocks written to the
+	// blockstore, only "gzip" for now. They aren't compressed when empty.
+	BlockCompression string `json:",omitempty"`
+
+	// Tiering demotes the blocks which aren't used to a cold tier, when set.
+	Tiering *Tiering `json:",omitempty"`
+}
+
+// Tiering tracks the configuration of the tiered blockstore. The hot tier
+// is the datastore mounted at "/blocks", the cold tier is the one mounted
+// at ColdPrefix + "/blocks".
+type Tiering struct {
+	ColdPrefix string
+	HotSize    string // in B, kB, kiB, MB, ...
+	MaxAge     string // in ns, us, ms, s, m, h; blocks aren't demoted by age when empty
 }
 
 func (d *Datastore) ParamData() []byte {
@@ -29,6 +49,38 @@ func (d *Datastore) ParamData() []byte {
 	return []byte(*d.Params)
 }
 
+// DefaultDatastoreSpec returns the spec of the default datastore: blocks in
+// a flatfs datastore, sharded by the next to last two characters of their
+// keys, and everything else in a leveldb datastore.
+func DefaultDatastoreSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "mount",
+		"mounts": []interface{}{
+			map[string]interface{}{
+				"mountpoint": "/blocks",
+				"type":       "measure",
+				"prefix":     "ipfs.fsrepo.datastore.blocks",
+				"child": map[string]interface{}{
+					"type":      "flatfs",
+					"path":      "blocks",
+					"sync":      true,
+					"shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
+				},
+			},
+			map[string]interface{}{
+				"mountpoint": "/",
+				"type":       "measure",
+				"prefix":     "ipfs.fsrepo.datastore.leveldb",
+				"child": map[string]interface{}{
+					"type":        "levelds",
+					"path":        "datastore",
+					"compression": "none",
+				},
+			},
+		},
+	}
+}
+
 type S3Datastore struct {
 	Region string `json:"region"`
 	Bucket string `json:"bucket"`
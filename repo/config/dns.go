@@ -0,0 +1,14 @@
+package config
+
+// DNS configures how DNSLink names are resolved.
+type DNS struct {
+	// Servers are queried, in order, for all domains not matched by
+	// Resolvers. Entries are either "host[:port]" addresses of plain DNS
+	// servers or "https://" URLs of DNS-over-HTTPS endpoints. When empty,
+	// the system resolver is used.
+	Servers []string
+
+	// Resolvers maps domain suffixes to the servers used to resolve names
+	// under them, taking precedence over Servers.
+	Resolvers map[string][]string
+}
@@ -3,5 +3,7 @@ package config
 type Experiments struct {
 	FilestoreEnabled     bool
 	ShardingEnabled      bool
+	ShardingThreshold    int
+	PrefetchWindow       int
 	Libp2pStreamMounting bool
 }
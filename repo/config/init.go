@@ -82,6 +82,7 @@ func datastoreConfig() (Datastore, error) {
 		return Datastore{}, err
 	}
 	return Datastore{
+		Spec:               DefaultDatastoreSpec(),
 		Path:               dspath,
 		Type:               "leveldb",
 		StorageMax:         "10GB",
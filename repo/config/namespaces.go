@@ -0,0 +1,8 @@
+package config
+
+// Namespace tracks the configuration of a namespace, which has its own pins,
+// quota and garbage collection while sharing the blockstore of the node.
+type Namespace struct {
+	StorageMax         string // in B, kB, kiB, MB, ...; unlimited when empty
+	StorageGCWatermark int64  // in percentage to multiply on StorageMax
+}
@@ -0,0 +1,419 @@
+package fsrepo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	repo "github.com/scroot/go-ipfs/repo"
+	ds2 "github.com/scroot/go-ipfs/thirdparty/datastore2"
+
+	levelds "gx/ipfs/QmPdvXuXWAR6gtxxqZw42RtSADMwz4ijVmYHGS542b6cMz/go-ds-leveldb"
+	measure "gx/ipfs/QmSb95iHExSSb47zpmyn5CyY5PZidVWSjyKyDqgYQrnKor/go-ds-measure"
+	flatfs "gx/ipfs/QmUTshC2PP4ZDqkrFfDU4JGJFMWjYnunxPgkQ6ZCA2hGqh/go-ds-flatfs"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+	mount "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/syncmount"
+	ldbopts "gx/ipfs/QmbBhyDKsY4mbY6xsKt3qu9Y7FPvMJ6qbD8AMjYYvPRw1g/goleveldb/leveldb/opt"
+)
+
+// ConfigFromMap parses a datastore spec, as found in the Datastore.Spec
+// field of the config, into a DatastoreConfig.
+type ConfigFromMap func(map[string]interface{}) (DatastoreConfig, error)
+
+// DatastoreConfig is the parsed spec of a datastore.
+type DatastoreConfig interface {
+	// DiskSpec returns the part of the spec describing the data on disk.
+	// The repo refuses to open when it differs from the one recorded at
+	// init, as the datastore would then be built over data it can't read.
+	DiskSpec() DiskSpec
+
+	// Create builds the datastore. Relative paths are relative to the repo
+	// at path.
+	Create(path string) (repo.Datastore, error)
+}
+
+// DiskSpec is the part of a datastore spec describing the data on disk.
+type DiskSpec map[string]interface{}
+
+// Bytes returns the canonical serialization of the spec, its keys sorted.
+func (spec DiskSpec) Bytes() []byte {
+	b, err := json.Marshal(map[string]interface{}(spec))
+	if err != nil {
+		// a spec is made of values decoded from json
+		panic(err)
+	}
+	return b
+}
+
+func (spec DiskSpec) String() string {
+	return string(spec.Bytes())
+}
+
+var (
+	datastoresLk sync.Mutex
+	datastores   = map[string]ConfigFromMap{
+		"mount":     MountDatastoreConfig,
+		"flatfs":    FlatfsDatastoreConfig,
+		"levelds":   LeveldsDatastoreConfig,
+		"mem":       MemDatastoreConfig,
+		"log":       LogDatastoreConfig,
+		"measure":   MeasureDatastoreConfig,
+		"encrypted": EncryptedDatastoreConfig,
+	}
+)
+
+// AddDatastoreConfigHandler registers the parser of the specs of the
+// datastores of the given type, for plugins to add their own backends.
+func AddDatastoreConfigHandler(name string, dsc ConfigFromMap) error {
+	datastoresLk.Lock()
+	defer datastoresLk.Unlock()
+
+	if _, ok := datastores[name]; ok {
+		return fmt.Errorf("datastore config handler for %s already registered", name)
+	}
+	datastores[name] = dsc
+	return nil
+}
+
+// AnyDatastoreConfig parses the spec of a datastore of any registered type.
+func AnyDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	which, ok := params["type"].(string)
+	if !ok {
+		return nil, errors.New("'type' field missing or not a string")
+	}
+
+	datastoresLk.Lock()
+	fun, ok := datastores[which]
+	datastoresLk.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown datastore type: %s", which)
+	}
+
+	return fun(params)
+}
+
+// childConfig parses the spec of the child datastore in the field name of
+// params.
+func childConfig(params map[string]interface{}, name string) (DatastoreConfig, error) {
+	child, ok := params[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'%s' field missing or not a map", name)
+	}
+	return AnyDatastoreConfig(child)
+}
+
+// stringParam returns the string field name of params, or def if unset.
+func stringParam(params map[string]interface{}, name, def string) (string, error) {
+	v, ok := params[name]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("'%s' field is not a string", name)
+	}
+	return s, nil
+}
+
+// boolParam returns the boolean field name of params, or def if unset.
+func boolParam(params map[string]interface{}, name string, def bool) (bool, error) {
+	v, ok := params[name]
+	if !ok {
+		return def, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("'%s' field is not a boolean", name)
+	}
+	return b, nil
+}
+
+// resolvePath resolves p relative to the repo at path.
+func resolvePath(path, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(path, p)
+}
+
+type premount struct {
+	ds     DatastoreConfig
+	prefix ds.Key
+}
+
+type mountDatastoreConfig struct {
+	mounts []premount
+}
+
+// MountDatastoreConfig parses the spec of a datastore mounting the datastores
+// listed in its 'mounts' field at their 'mountpoint'.
+func MountDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	var res mountDatastoreConfig
+	mounts, ok := params["mounts"].([]interface{})
+	if !ok {
+		return nil, errors.New("'mounts' field is missing or not an array")
+	}
+
+	seen := make(map[string]bool)
+	for _, iface := range mounts {
+		cfg, ok := iface.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("expected map for mountpoint")
+		}
+
+		prefix, ok := cfg["mountpoint"].(string)
+		if !ok {
+			return nil, errors.New("no 'mountpoint' on mount")
+		}
+		key := ds.NewKey(prefix)
+		if seen[key.String()] {
+			return nil, fmt.Errorf("mountpoint %s used twice", key)
+		}
+		seen[key.String()] = true
+
+		child, err := AnyDatastoreConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		res.mounts = append(res.mounts, premount{ds: child, prefix: key})
+	}
+
+	// the mountpoints nested in others come first
+	sort.Slice(res.mounts, func(i, j int) bool {
+		return res.mounts[i].prefix.String() > res.mounts[j].prefix.String()
+	})
+	return &res, nil
+}
+
+func (c *mountDatastoreConfig) DiskSpec() DiskSpec {
+	mounts := make([]interface{}, len(c.mounts))
+	for i, m := range c.mounts {
+		spec := m.ds.DiskSpec()
+		if spec == nil {
+			spec = make(DiskSpec)
+		}
+		spec["mountpoint"] = m.prefix.String()
+		mounts[i] = map[string]interface{}(spec)
+	}
+	return DiskSpec{
+		"type":   "mount",
+		"mounts": mounts,
+	}
+}
+
+func (c *mountDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	mounts := make([]mount.Mount, 0, len(c.mounts))
+	for _, m := range c.mounts {
+		d, err := m.ds.Create(path)
+		if err != nil {
+			for _, mm := range mounts {
+				mm.Datastore.(repo.Datastore).Close()
+			}
+			return nil, err
+		}
+		mounts = append(mounts, mount.Mount{
+			Prefix:    m.prefix,
+			Datastore: d,
+		})
+	}
+	return mount.New(mounts), nil
+}
+
+type flatfsDatastoreConfig struct {
+	path      string
+	shardFun  *flatfs.ShardIdV1
+	syncField bool
+}
+
+// FlatfsDatastoreConfig parses the spec of a flatfs datastore, storing each
+// value in a file under its 'path', in directories chosen by its
+// 'shardFunc'. Files are synced to disk unless 'sync' is false.
+func FlatfsDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	var c flatfsDatastoreConfig
+	var ok bool
+	var err error
+
+	c.path, ok = params["path"].(string)
+	if !ok {
+		return nil, errors.New("'path' field is missing or not a string")
+	}
+
+	sshardFun, ok := params["shardFunc"].(string)
+	if !ok {
+		return nil, errors.New("'shardFunc' field is missing or not a string")
+	}
+	c.shardFun, err = flatfs.ParseShardFunc(sshardFun)
+	if err != nil {
+		return nil, err
+	}
+
+	c.syncField, err = boolParam(params, "sync", true)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *flatfsDatastoreConfig) DiskSpec() DiskSpec {
+	return DiskSpec{
+		"type":      "flatfs",
+		"path":      c.path,
+		"shardFunc": c.shardFun.String(),
+	}
+}
+
+func (c *flatfsDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	d, err := flatfs.CreateOrOpen(resolvePath(path, c.path), c.shardFun, c.syncField)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open flatfs datastore: %v", err)
+	}
+	return d, nil
+}
+
+type leveldsDatastoreConfig struct {
+	path        string
+	compression ldbopts.Compression
+}
+
+// LeveldsDatastoreConfig parses the spec of a leveldb datastore stored under
+// its 'path', with the 'compression' "none" or "snappy".
+func LeveldsDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	var c leveldsDatastoreConfig
+	var ok bool
+
+	c.path, ok = params["path"].(string)
+	if !ok {
+		return nil, errors.New("'path' field is missing or not a string")
+	}
+
+	compression, err := stringParam(params, "compression", "")
+	if err != nil {
+		return nil, err
+	}
+	switch compression {
+	case "none":
+		c.compression = ldbopts.NoCompression
+	case "snappy":
+		c.compression = ldbopts.SnappyCompression
+	case "":
+		c.compression = ldbopts.DefaultCompression
+	default:
+		return nil, fmt.Errorf("unrecognized value for compression: %s", compression)
+	}
+
+	return &c, nil
+}
+
+func (c *leveldsDatastoreConfig) DiskSpec() DiskSpec {
+	return DiskSpec{
+		"type": "levelds",
+		"path": c.path,
+	}
+}
+
+func (c *leveldsDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	d, err := levelds.NewDatastore(resolvePath(path, c.path), &levelds.Options{
+		Compression: c.compression,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open leveldb datastore: %v", err)
+	}
+	return d, nil
+}
+
+type memDatastoreConfig struct{}
+
+// MemDatastoreConfig parses the spec of an in-memory datastore, losing its
+// content when the repo is closed.
+func MemDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	return &memDatastoreConfig{}, nil
+}
+
+func (c *memDatastoreConfig) DiskSpec() DiskSpec {
+	return nil
+}
+
+func (c *memDatastoreConfig) Create(string) (repo.Datastore, error) {
+	return ds2.CloserWrap(dssync.MutexWrap(ds.NewMapDatastore())), nil
+}
+
+type logDatastoreConfig struct {
+	child DatastoreConfig
+	name  string
+}
+
+// LogDatastoreConfig parses the spec of a datastore logging the operations
+// on its 'child', under its 'name'.
+func LogDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	child, err := childConfig(params, "child")
+	if err != nil {
+		return nil, err
+	}
+	name, ok := params["name"].(string)
+	if !ok {
+		return nil, errors.New("'name' field was missing or not a string")
+	}
+	return &logDatastoreConfig{child: child, name: name}, nil
+}
+
+func (c *logDatastoreConfig) DiskSpec() DiskSpec {
+	return c.child.DiskSpec()
+}
+
+func (c *logDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	child, err := c.child.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &logDatastore{LogDatastore: ds.NewLogDatastore(child, c.name), child: child}, nil
+}
+
+// logDatastore closes and batches the writes to the datastore it logs.
+type logDatastore struct {
+	*ds.LogDatastore
+	child repo.Datastore
+}
+
+func (d *logDatastore) Batch() (ds.Batch, error) {
+	return ds.NewBasicBatch(d), nil
+}
+
+func (d *logDatastore) Close() error {
+	return d.child.Close()
+}
+
+type measureDatastoreConfig struct {
+	child  DatastoreConfig
+	prefix string
+}
+
+// MeasureDatastoreConfig parses the spec of a datastore gathering metrics on
+// the operations on its 'child', named after its 'prefix'.
+func MeasureDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	child, err := childConfig(params, "child")
+	if err != nil {
+		return nil, err
+	}
+	prefix, ok := params["prefix"].(string)
+	if !ok {
+		return nil, errors.New("'prefix' field was missing or not a string")
+	}
+	return &measureDatastoreConfig{child: child, prefix: prefix}, nil
+}
+
+func (c *measureDatastoreConfig) DiskSpec() DiskSpec {
+	return c.child.DiskSpec()
+}
+
+func (c *measureDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	child, err := c.child.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return measure.New(c.prefix, child), nil
+}
@@ -0,0 +1,314 @@
+package fsrepo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	config "github.com/scroot/go-ipfs/repo/config"
+	mfsr "github.com/scroot/go-ipfs/repo/fsrepo/migrations"
+	serialize "github.com/scroot/go-ipfs/repo/fsrepo/serialize"
+
+	ci "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+	datastore "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+)
+
+const testSpec = `{
+	"type": "mount",
+	"mounts": [
+		{
+			"mountpoint": "/",
+			"type": "log",
+			"name": "test",
+			"child": {"type": "levelds", "path": "datastore"}
+		},
+		{
+			"mountpoint": "/blocks",
+			"type": "measure",
+			"prefix": "test.blocks",
+			"child": {
+				"type": "flatfs",
+				"path": "blocks",
+				"sync": false,
+				"shardFunc": "/repo/flatfs/shard/v1/next-to-last/2"
+			}
+		},
+		{
+			"mountpoint": "/tmp",
+			"type": "mem"
+		}
+	]
+}`
+
+func parseSpec(t *testing.T, s string) map[string]interface{} {
+	var spec map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func setSpec(t *testing.T, path string, spec map[string]interface{}) {
+	conf, err := ConfigAt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Datastore.Spec = spec
+
+	fn, err := config.Filename(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := serialize.WriteConfigFile(fn, conf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatastoreSpec(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("spec", t)
+	defer os.RemoveAll(path)
+
+	conf := new(config.Config)
+	conf.Datastore.Spec = parseSpec(t, testSpec)
+	if err := Init(path, conf); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"/key", "/blocks/CIQKEY", "/tmp/key"} {
+		if err := r.Datastore().Put(datastore.NewKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the parameters which don't change the data on disk can change
+	changed := strings.Replace(testSpec, `"sync": false`, `"sync": true`, 1)
+	changed = strings.Replace(changed, `"test.blocks"`, `"other.blocks"`, 1)
+	setSpec(t, path, parseSpec(t, changed))
+
+	r, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, exists := range map[string]bool{"/key": true, "/blocks/CIQKEY": true, "/tmp/key": false} {
+		has, err := r.Datastore().Has(datastore.NewKey(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has != exists {
+			t.Fatalf("expected %s to exist: %t", k, exists)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the others can't
+	changed = strings.Replace(testSpec, "next-to-last/2", "prefix/4", 1)
+	setSpec(t, path, parseSpec(t, changed))
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected a spec mismatch, got %v", err)
+	}
+}
+
+func TestDatastoreSpecMigration(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("oldspec", t)
+	defer os.RemoveAll(path)
+
+	if err := Init(path, &config.Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// make it look like a repo predating datastore specs
+	if err := os.Remove(filepath.Join(path, specFile)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mfsr.RepoPath(path).WriteVersion(5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err != ErrNeedMigration {
+		t.Fatalf("expected %s, got %v", ErrNeedMigration, err)
+	}
+
+	if err := Migrate(path, 6, mfsr.Options{DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err != ErrNeedMigration {
+		t.Fatalf("expected the dry run to leave the repo as is, got %v", err)
+	}
+
+	if err := Migrate(path, RepoVersion, mfsr.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Datastore.Spec == nil {
+		t.Fatal("expected the spec to be set in the config")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reverting the migration removes the spec of the repo
+	if err := Migrate(path, 5, mfsr.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(path, specFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected the spec to be removed, got %v", err)
+	}
+
+	// and a repo using another datastore can't be migrated
+	setSpec(t, path, parseSpec(t, testSpec))
+	if err := ioutil.WriteFile(filepath.Join(path, specFile), []byte(`{"type":"mem"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(path, 6, mfsr.Options{}); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+}
+
+const testEncryptedSpec = `{
+	"type": "encrypted",
+	"key": "%s",
+	"oldKeys": [%s],
+	"child": {"type": "levelds", "path": "datastore"}
+}`
+
+func TestEncryptedDatastoreSpec(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("encrypted", t)
+	defer os.RemoveAll(path)
+
+	conf := new(config.Config)
+	conf.Datastore.Spec = parseSpec(t, fmt.Sprintf(testEncryptedSpec, "dskey", ""))
+	if err := Init(path, conf); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has, err := r.Keystore().Has("dskey"); err != nil || !has {
+		t.Fatalf("expected the encryption key to be generated at init: %t, %v", has, err)
+	}
+	key, value := datastore.NewKey("/key"), []byte("value")
+	if err := r.Datastore().Put(key, value); err != nil {
+		t.Fatal(err)
+	}
+	sk, _, err := ci.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Keystore().Put("newkey", sk); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkValue := func() {
+		r, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		v, err := r.Datastore().Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(v.([]byte), value) {
+			t.Fatalf("expected %q, got %q", value, v)
+		}
+	}
+
+	// rotate the key
+	setSpec(t, path, parseSpec(t, fmt.Sprintf(testEncryptedSpec, "newkey", `"dskey"`)))
+	checkValue()
+	n, err := Reencrypt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("expected values to be encrypted again")
+	}
+	setSpec(t, path, parseSpec(t, fmt.Sprintf(testEncryptedSpec, "newkey", "")))
+	checkValue()
+
+	setSpec(t, path, parseSpec(t, fmt.Sprintf(testEncryptedSpec, "missing", "")))
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "missing from the keystore") {
+		t.Fatalf("expected a missing key, got %v", err)
+	}
+}
+
+func TestDatastoreKeys(t *testing.T) {
+	conf := new(config.Config)
+	keys, err := DatastoreKeys(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected the default datastore not to use keys, got %v", keys)
+	}
+
+	conf.Datastore.Spec = parseSpec(t, fmt.Sprintf(testEncryptedSpec, "newkey", `"dskey"`))
+	keys, err = DatastoreKeys(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "newkey" || keys[1] != "dskey" {
+		t.Fatalf("expected the keys newkey and dskey, got %v", keys)
+	}
+}
+
+func TestAddDatastoreConfigHandler(t *testing.T) {
+	if err := AddDatastoreConfigHandler("mount", MemDatastoreConfig); err == nil {
+		t.Fatal("expected an error registering a known type")
+	}
+	if err := AddDatastoreConfigHandler("testmem", MemDatastoreConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddDatastoreConfigHandler("testmem", MemDatastoreConfig); err == nil {
+		t.Fatal("expected an error registering a type twice")
+	}
+
+	spec := parseSpec(t, `{"type": "mount", "mounts": [{"mountpoint": "/", "type": "testmem"}]}`)
+	if _, err := AnyDatastoreConfig(spec); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []string{
+		`{"type": "unknown"}`,
+		`{"path": "datastore"}`,
+		`{"type": "flatfs", "path": "blocks", "shardFunc": "/bad"}`,
+		`{"type": "levelds", "path": "datastore", "compression": "lz4"}`,
+		`{"type": "mount", "mounts": [{"mountpoint": "/", "type": "mem"}, {"mountpoint": "/", "type": "mem"}]}`,
+		`{"type": "measure", "prefix": "foo"}`,
+		`{"type": "encrypted", "child": {"type": "mem"}}`,
+		`{"type": "encrypted", "key": "k", "oldKeys": "o", "child": {"type": "mem"}}`,
+	} {
+		if _, err := AnyDatastoreConfig(parseSpec(t, bad)); err == nil {
+			t.Fatalf("expected an error parsing %s", bad)
+		}
+	}
+}
@@ -1,74 +0,0 @@
-package fsrepo
-
-import (
-	"fmt"
-	"path"
-
-	repo "github.com/scroot/go-ipfs/repo"
-	config "github.com/scroot/go-ipfs/repo/config"
-	"github.com/scroot/go-ipfs/thirdparty/dir"
-
-	levelds "gx/ipfs/QmPdvXuXWAR6gtxxqZw42RtSADMwz4ijVmYHGS542b6cMz/go-ds-leveldb"
-	measure "gx/ipfs/QmSb95iHExSSb47zpmyn5CyY5PZidVWSjyKyDqgYQrnKor/go-ds-measure"
-	flatfs "gx/ipfs/QmUTshC2PP4ZDqkrFfDU4JGJFMWjYnunxPgkQ6ZCA2hGqh/go-ds-flatfs"
-	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
-	mount "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/syncmount"
-	ldbopts "gx/ipfs/QmbBhyDKsY4mbY6xsKt3qu9Y7FPvMJ6qbD8AMjYYvPRw1g/goleveldb/leveldb/opt"
-)
-
-const (
-	leveldbDirectory = "datastore"
-	flatfsDirectory  = "blocks"
-)
-
-func openDefaultDatastore(r *FSRepo) (repo.Datastore, error) {
-	leveldbPath := path.Join(r.path, leveldbDirectory)
-
-	// save leveldb reference so it can be neatly closed afterward
-	leveldbDS, err := levelds.NewDatastore(leveldbPath, &levelds.Options{
-		Compression: ldbopts.NoCompression,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("unable to open leveldb datastore: %v", err)
-	}
-
-	syncfs := !r.config.Datastore.NoSync
-
-	// 2 characters of base32 suffix gives us 10 bits of freedom.
-	// Leaving us with 10 bits, or 1024 way sharding
-	blocksDS, err := flatfs.CreateOrOpen(path.Join(r.path, flatfsDirectory), flatfs.NextToLast(2), syncfs)
-	if err != nil {
-		return nil, fmt.Errorf("unable to open flatfs datastore: %v", err)
-	}
-
-	prefix := "ipfs.fsrepo.datastore."
-	metricsBlocks := measure.New(prefix+"blocks", blocksDS)
-	metricsLevelDB := measure.New(prefix+"leveldb", leveldbDS)
-	mountDS := mount.New([]mount.Mount{
-		{
-			Prefix:    ds.NewKey("/blocks"),
-			Datastore: metricsBlocks,
-		},
-		{
-			Prefix:    ds.NewKey("/"),
-			Datastore: metricsLevelDB,
-		},
-	})
-
-	return mountDS, nil
-}
-
-func initDefaultDatastore(repoPath string, conf *config.Config) error {
-	// The actual datastore contents are initialized lazily when Opened.
-	// During Init, we merely check that the directory is writeable.
-	leveldbPath := path.Join(repoPath, leveldbDirectory)
-	if err := dir.Writable(leveldbPath); err != nil {
-		return fmt.Errorf("datastore: %s", err)
-	}
-
-	flatfsPath := path.Join(repoPath, flatfsDirectory)
-	if err := dir.Writable(flatfsPath); err != nil {
-		return fmt.Errorf("datastore: %s", err)
-	}
-	return nil
-}
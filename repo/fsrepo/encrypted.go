@@ -0,0 +1,229 @@
+package fsrepo
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	keystore "github.com/scroot/go-ipfs/keystore"
+	repo "github.com/scroot/go-ipfs/repo"
+	config "github.com/scroot/go-ipfs/repo/config"
+	lockfile "github.com/scroot/go-ipfs/repo/fsrepo/lock"
+	serialize "github.com/scroot/go-ipfs/repo/fsrepo/serialize"
+	ds2 "github.com/scroot/go-ipfs/thirdparty/datastore2"
+
+	"github.com/scroot/go-ipfs/Godeps/_workspace/src/github.com/mitchellh/go-homedir"
+	ci "gx/ipfs/QmP1DfoUjiWH2ZBo1PBH6FupdBucbDepx3HpWmEY6JMUpY/go-libp2p-crypto"
+)
+
+type encryptedDatastoreConfig struct {
+	child   DatastoreConfig
+	key     string
+	oldKeys []string
+}
+
+// EncryptedDatastoreConfig parses the spec of a datastore encrypting the
+// values of its 'child' with the keystore key named 'key'. The values
+// encrypted with the keys listed in 'oldKeys' are still read, until
+// 'ipfs repo reencrypt' encrypts them with 'key'.
+func EncryptedDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	child, err := childConfig(params, "child")
+	if err != nil {
+		return nil, err
+	}
+	key, ok := params["key"].(string)
+	if !ok || key == "" {
+		return nil, errors.New("'key' field was missing or not a string")
+	}
+
+	c := &encryptedDatastoreConfig{child: child, key: key}
+	if old, ok := params["oldKeys"]; ok {
+		names, ok := old.([]interface{})
+		if !ok {
+			return nil, errors.New("'oldKeys' field is not an array")
+		}
+		for _, n := range names {
+			name, ok := n.(string)
+			if !ok {
+				return nil, errors.New("'oldKeys' field is not an array of strings")
+			}
+			c.oldKeys = append(c.oldKeys, name)
+		}
+	}
+	return c, nil
+}
+
+// DiskSpec leaves the keys out, so that they can be rotated.
+func (c *encryptedDatastoreConfig) DiskSpec() DiskSpec {
+	return DiskSpec{
+		"type":  "encrypted",
+		"child": map[string]interface{}(c.child.DiskSpec()),
+	}
+}
+
+func (c *encryptedDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	ks, err := keystore.NewFSKeystore(filepath.Join(path, "keystore"))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*ds2.EncryptionKey
+	for _, name := range append([]string{c.key}, c.oldKeys...) {
+		k, err := ks.Get(name)
+		if err == keystore.ErrNoSuchKey {
+			return nil, fmt.Errorf("the datastore encryption key %s is missing from the keystore", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := ci.MarshalPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		ek, err := ds2.NewEncryptionKey(b)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, ek)
+	}
+
+	child, err := c.child.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return ds2.Encrypt(child, keys...)
+}
+
+// walkDatastoreConfig calls f on dsc and the configs of the datastores it
+// is built on.
+func walkDatastoreConfig(dsc DatastoreConfig, f func(DatastoreConfig) error) error {
+	if err := f(dsc); err != nil {
+		return err
+	}
+
+	var children []DatastoreConfig
+	switch c := dsc.(type) {
+	case *mountDatastoreConfig:
+		for _, m := range c.mounts {
+			children = append(children, m.ds)
+		}
+	case *logDatastoreConfig:
+		children = append(children, c.child)
+	case *measureDatastoreConfig:
+		children = append(children, c.child)
+	case *encryptedDatastoreConfig:
+		children = append(children, c.child)
+	}
+	for _, c := range children {
+		if err := walkDatastoreConfig(c, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DatastoreKeys returns the names of the keystore keys the encrypted
+// datastores of the config c use, current and old ones. The datastores can't
+// be read without them.
+func DatastoreKeys(c *config.Config) ([]string, error) {
+	dsc, err := AnyDatastoreConfig(datastoreSpec(c))
+	if err != nil {
+		return nil, fmt.Errorf("datastore: %s", err)
+	}
+
+	var names []string
+	err = walkDatastoreConfig(dsc, func(dsc DatastoreConfig) error {
+		if c, ok := dsc.(*encryptedDatastoreConfig); ok {
+			names = append(names, c.key)
+			names = append(names, c.oldKeys...)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// initEncryptionKeys generates the keys encrypting the datastores of dsc
+// which are missing from the keystore of the repo at path.
+func initEncryptionKeys(path string, dsc DatastoreConfig) error {
+	return walkDatastoreConfig(dsc, func(dsc DatastoreConfig) error {
+		c, ok := dsc.(*encryptedDatastoreConfig)
+		if !ok {
+			return nil
+		}
+
+		ks, err := keystore.NewFSKeystore(filepath.Join(path, "keystore"))
+		if err != nil {
+			return err
+		}
+		has, err := ks.Has(c.key)
+		if err != nil || has {
+			return err
+		}
+
+		log.Infof("generating the datastore encryption key %s", c.key)
+		sk, _, err := ci.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			return err
+		}
+		return ks.Put(c.key, sk)
+	})
+}
+
+// Reencrypt encrypts the values of the encrypted datastores of the repo at
+// repoPath which were encrypted with one of their old keys with their
+// current key, so that the old keys can be dropped. It returns the number
+// of values encrypted again. The repo must not be in use.
+func Reencrypt(repoPath string) (int, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	expPath, err := homedir.Expand(filepath.Clean(repoPath))
+	if err != nil {
+		return 0, err
+	}
+	if err := checkInitialized(expPath); err != nil {
+		return 0, err
+	}
+
+	lk, err := lockfile.Lock(expPath)
+	if err != nil {
+		return 0, err
+	}
+	defer lk.Close()
+
+	fn, err := config.Filename(expPath)
+	if err != nil {
+		return 0, err
+	}
+	conf, err := serialize.Load(fn)
+	if err != nil {
+		return 0, err
+	}
+	dsc, err := AnyDatastoreConfig(datastoreSpec(conf))
+	if err != nil {
+		return 0, fmt.Errorf("datastore: %s", err)
+	}
+	if err := checkSpec(expPath, dsc); err != nil {
+		return 0, err
+	}
+
+	var n int
+	err = walkDatastoreConfig(dsc, func(dsc DatastoreConfig) error {
+		c, ok := dsc.(*encryptedDatastoreConfig)
+		if !ok {
+			return nil
+		}
+
+		d, err := c.Create(expPath)
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+
+		count, err := d.(*ds2.EncryptedDatastore).Reencrypt()
+		n += count
+		return err
+	})
+	return n, err
+}
@@ -32,20 +32,21 @@ import (
 var log = logging.Logger("fsrepo")
 
 // version number that we are currently expecting to see
-var RepoVersion = 5
+var RepoVersion = 6
 
-var migrationInstructions = `See https://github.com/ipfs/fs-repo-migrations/blob/master/run.md
-Sorry for the inconvenience. In the future, these will run automatically.`
+var externalMigrationInstructions = `See https://github.com/ipfs/fs-repo-migrations/blob/master/run.md`
 
-var programTooLowMessage = `Your programs version (%d) is lower than your repos (%d).
-Please update ipfs to a version that supports the existing repo, or run
-a migration in reverse.
+var migrationInstructions = `Run 'ipfs repo migrate' to migrate it. The versions older than those built
+in ipfs are migrated with fs-repo-migrations.
+` + externalMigrationInstructions
 
-See https://github.com/ipfs/fs-repo-migrations/blob/master/run.md for details.`
+var programTooLowMessage = `Your programs version (%d) is lower than your repos (%d).
+Please update ipfs to a version that supports the existing repo, or revert
+its migrations with 'ipfs repo migrate --to=%d' using the newer version.`
 
 var (
-	ErrNoVersion     = errors.New("no version file found, please run 0-to-1 migration tool.\n" + migrationInstructions)
-	ErrOldRepo       = errors.New("ipfs repo found in old '~/.go-ipfs' location, please run migration tool.\n" + migrationInstructions)
+	ErrNoVersion     = errors.New("no version file found, the repo is at version 0.\n" + migrationInstructions)
+	ErrOldRepo       = errors.New("ipfs repo found in old '~/.go-ipfs' location, please run the 0-to-1 migration of fs-repo-migrations.\n" + externalMigrationInstructions)
 	ErrNeedMigration = errors.New("ipfs repo needs migration.")
 )
 
@@ -62,6 +63,9 @@ func (err NoRepoError) Error() string {
 const apiFile = "api"
 const swarmKeyFile = "swarm.key"
 
+// specFile records the disk spec of the datastore of the repo.
+const specFile = "datastore_spec"
+
 var (
 
 	// packageLock must be held to while performing any operation that modifies an
@@ -149,7 +153,7 @@ func open(repoPath string) (repo.Repo, error) {
 		return nil, ErrNeedMigration
 	} else if ver > RepoVersion {
 		// program version too low for existing repo
-		return nil, fmt.Errorf(programTooLowMessage, RepoVersion, ver)
+		return nil, fmt.Errorf(programTooLowMessage, RepoVersion, ver, RepoVersion)
 	}
 
 	// check repo path, then check all constituent parts.
@@ -244,7 +248,8 @@ func initConfig(path string, conf *config.Config) error {
 }
 
 // Init initializes a new FSRepo at the given path with the provided config.
-// TODO add support for custom datastores.
+// The datastore is built from the spec in Datastore.Spec, recorded in the
+// repo so that it can't change later on.
 func Init(repoPath string, conf *config.Config) error {
 
 	// packageLock must be held to ensure that the repo is not initialized more
@@ -260,7 +265,7 @@ func Init(repoPath string, conf *config.Config) error {
 		return err
 	}
 
-	if err := initDefaultDatastore(repoPath, conf); err != nil {
+	if err := initSpec(repoPath, conf); err != nil {
 		return err
 	}
 
@@ -359,19 +364,98 @@ func (r *FSRepo) openKeystore() error {
 	return nil
 }
 
-// openDatastore returns an error if the config file is not present.
+// datastoreSpec returns the spec of the datastore in conf, the default one
+// if none is set.
+func datastoreSpec(conf *config.Config) map[string]interface{} {
+	if conf.Datastore.Spec != nil {
+		return conf.Datastore.Spec
+	}
+
+	// configs predating datastore specs used the default datastore, with
+	// a switch to disable syncing the blocks
+	spec := config.DefaultDatastoreSpec()
+	if conf.Datastore.NoSync {
+		blocks := spec["mounts"].([]interface{})[0].(map[string]interface{})
+		blocks["child"].(map[string]interface{})["sync"] = false
+	}
+	return spec
+}
+
+// checkSpec checks that the disk spec of dsc matches the one recorded in
+// the repo at repoPath.
+func checkSpec(repoPath string, dsc DatastoreConfig) error {
+	spec := dsc.DiskSpec().String()
+
+	b, err := ioutil.ReadFile(filepath.Join(repoPath, specFile))
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Errorf("the datastore spec of the repo is missing, run 'ipfs repo migrate'")
+	case err != nil:
+		return err
+	}
+	if oldSpec := strings.TrimSpace(string(b)); oldSpec != spec {
+		return fmt.Errorf("datastore configuration of '%s' does not match what is on disk '%s'", spec, oldSpec)
+	}
+	return nil
+}
+
+// initSpec records the disk spec of the datastore in conf in the repo at
+// repoPath.
+func initSpec(repoPath string, conf *config.Config) error {
+	fn := filepath.Join(repoPath, specFile)
+	if util.FileExists(fn) {
+		return nil
+	}
+
+	dsc, err := AnyDatastoreConfig(datastoreSpec(conf))
+	if err != nil {
+		return fmt.Errorf("datastore: %s", err)
+	}
+
+	if err := dir.Writable(repoPath); err != nil {
+		return fmt.Errorf("datastore: %s", err)
+	}
+
+	if err := initEncryptionKeys(repoPath, dsc); err != nil {
+		return fmt.Errorf("datastore: %s", err)
+	}
+
+	// create the datastore, to report a broken spec now rather than when
+	// opening the repo
+	d, err := dsc.Create(repoPath)
+	if err != nil {
+		return fmt.Errorf("datastore: %s", err)
+	}
+	if err := d.Close(); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fn, dsc.DiskSpec().Bytes(), 0600)
+}
+
+// openDatastore builds the datastore described in the config, after
+// checking it matches the one recorded in the repo.
 func (r *FSRepo) openDatastore() error {
 	switch r.config.Datastore.Type {
 	case "default", "leveldb", "":
-		d, err := openDefaultDatastore(r)
-		if err != nil {
-			return err
-		}
-		r.ds = d
 	default:
 		return fmt.Errorf("unknown datastore type: %s", r.config.Datastore.Type)
 	}
 
+	dsc, err := AnyDatastoreConfig(datastoreSpec(r.config))
+	if err != nil {
+		return fmt.Errorf("datastore: %s", err)
+	}
+	if err := checkSpec(r.path, dsc); err != nil {
+		return err
+	}
+
+	d, err := dsc.Create(r.path)
+	if err != nil {
+		return err
+	}
+	r.ds = d
+
 	// Wrap it with metrics gathering
 	prefix := "ipfs.fsrepo.datastore"
 	r.ds = measure.New(prefix, r.ds)
@@ -0,0 +1,134 @@
+package fsrepo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	repo "github.com/scroot/go-ipfs/repo"
+	config "github.com/scroot/go-ipfs/repo/config"
+	mfsr "github.com/scroot/go-ipfs/repo/fsrepo/migrations"
+
+	"github.com/scroot/go-ipfs/Godeps/_workspace/src/github.com/mitchellh/go-homedir"
+)
+
+func init() {
+	mfsr.Register(&mfsr.Migration{
+		To:          6,
+		Description: "record the datastore spec",
+		Apply:       recordDatastoreSpec,
+		Revert:      forgetDatastoreSpec,
+	})
+}
+
+// Migrate migrates the repo at repoPath to the version to, with the
+// migrations built in ipfs. The datastore of the repo is opened from its
+// spec when a migration needs it, unless opts sets another way to do so.
+func Migrate(repoPath string, to int, opts mfsr.Options) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	expPath, err := homedir.Expand(filepath.Clean(repoPath))
+	if err != nil {
+		return err
+	}
+	if err := checkInitialized(expPath); err != nil {
+		return err
+	}
+
+	if opts.OpenDatastore == nil {
+		opts.OpenDatastore = openRawDatastore
+	}
+	return mfsr.Run(expPath, to, opts)
+}
+
+// rawDatastoreConfig returns the Datastore section of the raw config conf.
+func rawDatastoreConfig(conf map[string]interface{}) (*config.Config, error) {
+	out := new(config.Config)
+
+	b, err := json.Marshal(conf["Datastore"])
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &out.Datastore); err != nil {
+		return nil, fmt.Errorf("invalid Datastore config: %s", err)
+	}
+	return out, nil
+}
+
+// openRawDatastore opens the datastore of the repo at path, given its raw
+// config, without checking its spec against the recorded one.
+func openRawDatastore(path string, conf map[string]interface{}) (repo.Datastore, error) {
+	c, err := rawDatastoreConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	dsc, err := AnyDatastoreConfig(datastoreSpec(c))
+	if err != nil {
+		return nil, err
+	}
+	return dsc.Create(path)
+}
+
+// recordDatastoreSpec sets the spec of the default datastore, used by the
+// repos without one, in the config and records it in the repo.
+func recordDatastoreSpec(e *mfsr.Env) error {
+	c, err := rawDatastoreConfig(e.Config)
+	if err != nil {
+		return err
+	}
+	spec := datastoreSpec(c)
+
+	dsc, err := AnyDatastoreConfig(spec)
+	if err != nil {
+		return err
+	}
+	diskSpec := dsc.DiskSpec().String()
+
+	fn := filepath.Join(e.Path, specFile)
+	old, err := ioutil.ReadFile(fn)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case string(old) != diskSpec:
+		return fmt.Errorf("datastore configuration of '%s' does not match what is on disk '%s'", diskSpec, old)
+	}
+
+	if c.Datastore.Spec == nil {
+		e.Logf("setting Datastore.Spec to the default datastore")
+		if !e.DryRun {
+			dsConf, ok := e.Config["Datastore"].(map[string]interface{})
+			if !ok {
+				dsConf = make(map[string]interface{})
+				e.Config["Datastore"] = dsConf
+			}
+			dsConf["Spec"] = spec
+		}
+	}
+
+	e.Logf("writing %s", fn)
+	if e.DryRun {
+		return nil
+	}
+	return ioutil.WriteFile(fn, []byte(diskSpec), 0600)
+}
+
+// forgetDatastoreSpec reverts recordDatastoreSpec. The spec is left in the
+// config, where older versions ignore it.
+func forgetDatastoreSpec(e *mfsr.Env) error {
+	fn := filepath.Join(e.Path, specFile)
+	e.Logf("removing %s", fn)
+	if e.DryRun {
+		return nil
+	}
+
+	err := os.Remove(fn)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -34,10 +34,14 @@ func migrationsBinName() string {
 	}
 }
 
-func RunMigration(newv int) error {
+// RunMigration migrates the repo at path to the version newv with the
+// fs-repo-migrations binary, downloading it when none supporting newv is
+// found in the PATH. It is used for the versions without built-in
+// migrations.
+func RunMigration(path string, newv int, log io.Writer) error {
 	migrateBin := migrationsBinName()
 
-	fmt.Println("  => Looking for suitable fs-repo-migrations binary.")
+	fmt.Fprintln(log, "  => Looking for suitable fs-repo-migrations binary.")
 
 	var err error
 	migrateBin, err = exec.LookPath(migrateBin)
@@ -47,11 +51,11 @@ func RunMigration(newv int) error {
 	}
 
 	if err != nil {
-		fmt.Println("  => None found, downloading.")
+		fmt.Fprintln(log, "  => None found, downloading.")
 
 		loc, err := GetMigrations()
 		if err != nil {
-			fmt.Println("  => Failed to download fs-repo-migrations.")
+			fmt.Fprintln(log, "  => Failed to download fs-repo-migrations.")
 			return err
 		}
 
@@ -64,19 +68,18 @@ func RunMigration(newv int) error {
 	}
 
 	cmd := exec.Command(migrateBin, "-to", fmt.Sprint(newv), "-y")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "IPFS_PATH="+path)
+	cmd.Stdout = log
+	cmd.Stderr = log
 
-	fmt.Printf("  => Running: %s -to %d -y\n", migrateBin, newv)
+	fmt.Fprintf(log, "  => Running: %s -to %d -y\n", migrateBin, newv)
 
 	err = cmd.Run()
 	if err != nil {
-		fmt.Printf("  => Failed: %s -to %d -y\n", migrateBin, newv)
+		fmt.Fprintf(log, "  => Failed: %s -to %d -y\n", migrateBin, newv)
 		return fmt.Errorf("migration failed: %s", err)
 	}
 
-	fmt.Printf("  => Success: fs-repo has been migrated to version %d.\n", newv)
-
 	return nil
 }
 
@@ -0,0 +1,358 @@
+package mfsr
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	repo "github.com/scroot/go-ipfs/repo"
+	config "github.com/scroot/go-ipfs/repo/config"
+	lockfile "github.com/scroot/go-ipfs/repo/fsrepo/lock"
+	serialize "github.com/scroot/go-ipfs/repo/fsrepo/serialize"
+)
+
+// Migration is the step migrating a repo from the version To-1 to To.
+type Migration struct {
+	// To is the version of the repo once migrated.
+	To int
+
+	// Description says what the migration does, in a few words.
+	Description string
+
+	// Apply migrates the repo. It must honor Env.DryRun.
+	Apply func(*Env) error
+
+	// Revert undoes Apply, including when Apply failed midway. Migrations
+	// without one can't be reverted.
+	Revert func(*Env) error
+}
+
+// Env is the repo a migration operates on.
+type Env struct {
+	// Path is the path of the repo.
+	Path string
+
+	// Config is the raw config of the repo, written back once the migration
+	// succeeded.
+	Config map[string]interface{}
+
+	// DryRun is set when the migration must only report what it would do,
+	// without changing anything.
+	DryRun bool
+
+	log    io.Writer
+	open   func(string, map[string]interface{}) (repo.Datastore, error)
+	dstore repo.Datastore
+}
+
+// Datastore opens the datastore of the repo, as configured by Config.
+func (e *Env) Datastore() (repo.Datastore, error) {
+	if e.dstore != nil {
+		return e.dstore, nil
+	}
+	if e.open == nil {
+		return nil, fmt.Errorf("no way to open the datastore of %s", e.Path)
+	}
+
+	d, err := e.open(e.Path, e.Config)
+	if err != nil {
+		return nil, err
+	}
+	e.dstore = d
+	return d, nil
+}
+
+// Logf reports a change made by the migration, or which would be made
+// during dry runs.
+func (e *Env) Logf(format string, args ...interface{}) {
+	fmt.Fprintf(e.log, "     "+format+"\n", args...)
+}
+
+func (e *Env) close() error {
+	if e.dstore == nil {
+		return nil
+	}
+	err := e.dstore.Close()
+	e.dstore = nil
+	return err
+}
+
+var (
+	registryLk sync.Mutex
+	registry   = make(map[int]*Migration)
+)
+
+// Register adds m to the built-in migrations. It is meant to be called from
+// init functions, and panics if a migration to the same version exists.
+func Register(m *Migration) {
+	registryLk.Lock()
+	defer registryLk.Unlock()
+
+	if m.To < 1 || m.Apply == nil {
+		panic(fmt.Sprintf("invalid migration to version %d", m.To))
+	}
+	if _, ok := registry[m.To]; ok {
+		panic(fmt.Sprintf("migration to version %d registered twice", m.To))
+	}
+	registry[m.To] = m
+}
+
+// Options are the options of Run.
+type Options struct {
+	// OpenDatastore opens the datastore of the repo at path, given its raw
+	// config.
+	OpenDatastore func(path string, conf map[string]interface{}) (repo.Datastore, error)
+
+	// DryRun only reports what the migrations would do.
+	DryRun bool
+
+	// Backup, when set, is the directory the repo is copied to before
+	// migrating it.
+	Backup string
+
+	// Log receives the progress of the migrations, ioutil.Discard when nil.
+	Log io.Writer
+
+	// External migrates the repo at path to the version to, for the versions
+	// without built-in migrations. RunMigration when nil.
+	External func(path string, to int, log io.Writer) error
+}
+
+type step struct {
+	m      *Migration
+	revert bool
+}
+
+// plan returns the steps migrating a repo from the version from to to. The
+// versions right above from without built-in migrations are left to the
+// external migrations, up to the returned version.
+func plan(from, to int) (int, []step, error) {
+	registryLk.Lock()
+	defer registryLk.Unlock()
+
+	ext := from
+	for ext < to {
+		if _, ok := registry[ext+1]; ok {
+			break
+		}
+		ext++
+	}
+
+	var steps []step
+	for v := ext + 1; v <= to; v++ {
+		m, ok := registry[v]
+		if !ok {
+			return 0, nil, fmt.Errorf("no built-in migration to version %d", v)
+		}
+		steps = append(steps, step{m: m})
+	}
+	for v := from; v > to; v-- {
+		m, ok := registry[v]
+		if !ok || m.Revert == nil {
+			return 0, nil, fmt.Errorf("migration to version %d can't be reverted", v)
+		}
+		steps = append(steps, step{m: m, revert: true})
+	}
+	return ext, steps, nil
+}
+
+// Run migrates the repo at path to the version to, applying the migrations
+// above its current version or reverting the ones down to it. The version of
+// the repo is updated after each migration, and a failing migration is
+// reverted, so that the repo is left at the version of the last one
+// which succeeded. Repos older than the built-in migrations are first
+// migrated with opts.External.
+func Run(path string, to int, opts Options) error {
+	log := opts.Log
+	if log == nil {
+		log = ioutil.Discard
+	}
+
+	rp := RepoPath(path)
+	from, err := rp.Version()
+	switch {
+	case os.IsNotExist(err):
+		// repos at version 0 have no version file
+		from = 0
+	case err != nil:
+		return err
+	}
+
+	ext, steps, err := plan(from, to)
+	if err != nil {
+		return err
+	}
+	if ext == from && len(steps) == 0 {
+		fmt.Fprintf(log, "  => fs-repo is already at version %d.\n", to)
+		return nil
+	}
+
+	lk, err := lockfile.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if lk != nil {
+			lk.Close()
+		}
+	}()
+
+	if opts.Backup != "" && !opts.DryRun {
+		fmt.Fprintf(log, "  => Backing up the fs-repo to %s.\n", opts.Backup)
+		if err := backup(path, opts.Backup); err != nil {
+			return fmt.Errorf("backup failed: %s", err)
+		}
+	}
+
+	if ext > from {
+		if opts.DryRun {
+			fmt.Fprintf(log, "  => Would run the external fs-repo-migrations to version %d.\n", ext)
+		} else {
+			external := opts.External
+			if external == nil {
+				external = RunMigration
+			}
+
+			// fs-repo-migrations takes the lock of the repo itself
+			lk.Close()
+			lk = nil
+			if err := external(path, ext, log); err != nil {
+				return err
+			}
+			if v, err := rp.Version(); err != nil {
+				return err
+			} else if v != ext {
+				return fmt.Errorf("fs-repo-migrations left the repo at version %d instead of %d", v, ext)
+			}
+			if lk, err = lockfile.Lock(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, s := range steps {
+		if err := runStep(rp, s, opts, log); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		fmt.Fprintf(log, "  => Dry run: fs-repo would have been migrated to version %d.\n", to)
+	} else {
+		fmt.Fprintf(log, "  => Success: fs-repo has been migrated to version %d.\n", to)
+	}
+	return nil
+}
+
+func runStep(rp RepoPath, s step, opts Options, log io.Writer) error {
+	fn, err := config.Filename(string(rp))
+	if err != nil {
+		return err
+	}
+	var conf map[string]interface{}
+	if err := serialize.ReadConfigFile(fn, &conf); err != nil {
+		return err
+	}
+
+	env := &Env{
+		Path:   string(rp),
+		Config: conf,
+		DryRun: opts.DryRun,
+		log:    log,
+		open:   opts.OpenDatastore,
+	}
+	defer env.close()
+
+	version := s.m.To
+	if s.revert {
+		version = s.m.To - 1
+		fmt.Fprintf(log, "  => Reverting to version %d: %s.\n", version, s.m.Description)
+		if err := s.m.Revert(env); err != nil {
+			return fmt.Errorf("reverting the migration to version %d failed: %s", s.m.To, err)
+		}
+	} else {
+		fmt.Fprintf(log, "  => Migrating to version %d: %s.\n", version, s.m.Description)
+		if err := s.m.Apply(env); err != nil {
+			if s.m.Revert != nil && !opts.DryRun {
+				fmt.Fprintf(log, "  => Failed, reverting.\n")
+				if rerr := s.m.Revert(env); rerr != nil {
+					return fmt.Errorf("migration to version %d failed: %s, and reverting it failed: %s", s.m.To, err, rerr)
+				}
+			}
+			return fmt.Errorf("migration to version %d failed: %s", s.m.To, err)
+		}
+	}
+
+	if err := env.close(); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	if err := serialize.WriteConfigFile(fn, conf); err != nil {
+		return err
+	}
+	return rp.WriteVersion(version)
+}
+
+// backup copies the repo at path to the directory dst, which mustn't exist.
+func backup(path, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	if rel, err := filepath.Rel(path, dst); err == nil && !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%s is in the repo", dst)
+	}
+
+	return filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		if rel == lockfile.LockFile {
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, fi.Mode().Perm()|0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case fi.Mode().IsRegular():
+			return copyFile(p, target, fi.Mode().Perm())
+		default:
+			return nil
+		}
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,236 @@
+package mfsr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	repo "github.com/scroot/go-ipfs/repo"
+	ds2 "github.com/scroot/go-ipfs/thirdparty/datastore2"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+// the test migrations go from version 1000 to 1003, the last one failing
+func init() {
+	Register(&Migration{
+		To:          1001,
+		Description: "set Foo",
+		Apply: func(e *Env) error {
+			e.Logf("setting Foo")
+			if !e.DryRun {
+				e.Config["Foo"] = "bar"
+			}
+			return nil
+		},
+		Revert: func(e *Env) error {
+			delete(e.Config, "Foo")
+			return nil
+		},
+	})
+	Register(&Migration{
+		To:          1002,
+		Description: "write to the datastore",
+		Apply: func(e *Env) error {
+			d, err := e.Datastore()
+			if err != nil {
+				return err
+			}
+			if e.DryRun {
+				return nil
+			}
+			return d.Put(ds.NewKey("/migrated"), []byte("1002"))
+		},
+		Revert: func(e *Env) error {
+			d, err := e.Datastore()
+			if err != nil {
+				return err
+			}
+			return d.Delete(ds.NewKey("/migrated"))
+		},
+	})
+	Register(&Migration{
+		To:          1003,
+		Description: "fail",
+		Apply: func(e *Env) error {
+			e.Config["Broken"] = true
+			return errors.New("broken")
+		},
+		Revert: func(e *Env) error {
+			e.Logf("reverted")
+			return nil
+		},
+	})
+}
+
+type testRepo struct {
+	path   string
+	dstore repo.Datastore
+	opened int
+}
+
+func newTestRepo(t *testing.T, version int) *testRepo {
+	path, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "config"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := RepoPath(path).WriteVersion(version); err != nil {
+		t.Fatal(err)
+	}
+	return &testRepo{
+		path:   path,
+		dstore: ds2.CloserWrap(dssync.MutexWrap(ds.NewMapDatastore())),
+	}
+}
+
+func (r *testRepo) options(log *bytes.Buffer) Options {
+	return Options{
+		OpenDatastore: func(string, map[string]interface{}) (repo.Datastore, error) {
+			r.opened++
+			return r.dstore, nil
+		},
+		Log: log,
+	}
+}
+
+func (r *testRepo) check(t *testing.T, version int, config string, migrated bool) {
+	v, err := RepoPath(r.path).Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != version {
+		t.Fatalf("expected version %d, got %d", version, v)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(r.path, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), config) {
+		t.Fatalf("expected the config to contain %q: %s", config, b)
+	}
+
+	has, err := r.dstore.Has(ds.NewKey("/migrated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has != migrated {
+		t.Fatalf("expected the datastore to be migrated: %t", migrated)
+	}
+}
+
+func TestRunMigrations(t *testing.T) {
+	r := newTestRepo(t, 1000)
+	defer os.RemoveAll(r.path)
+
+	var log bytes.Buffer
+	opts := r.options(&log)
+	opts.DryRun = true
+	if err := Run(r.path, 1002, opts); err != nil {
+		t.Fatal(err)
+	}
+	r.check(t, 1000, "{}", false)
+	if !strings.Contains(log.String(), "setting Foo") {
+		t.Fatalf("dry run didn't report the changes: %s", log.String())
+	}
+
+	opts.DryRun = false
+	opts.Backup = r.path + ".backup"
+	defer os.RemoveAll(opts.Backup)
+	if err := Run(r.path, 1002, opts); err != nil {
+		t.Fatal(err)
+	}
+	r.check(t, 1002, `"Foo": "bar"`, true)
+	if r.opened != 2 {
+		t.Fatalf("expected the datastore to be opened by the migration using it, opened %d times", r.opened)
+	}
+
+	if v, err := RepoPath(opts.Backup).Version(); err != nil || v != 1000 {
+		t.Fatalf("expected a backup of the repo at version 1000, got %d, %v", v, err)
+	}
+	if err := Run(r.path, 1002, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// the failing migration is reverted
+	opts.Backup = ""
+	err := Run(r.path, 1003, opts)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("expected the migration to fail, got %v", err)
+	}
+	if !strings.Contains(log.String(), "reverted") {
+		t.Fatal("the failing migration wasn't reverted")
+	}
+	r.check(t, 1002, `"Foo": "bar"`, true)
+
+	if err := Run(r.path, 1000, opts); err != nil {
+		t.Fatal(err)
+	}
+	r.check(t, 1000, "{}", false)
+
+	if err := Run(r.path, 1004, opts); err == nil {
+		t.Fatal("expected an error migrating to an unknown version")
+	}
+	if err := Run(r.path, 999, opts); err == nil {
+		t.Fatal("expected an error reverting an unknown migration")
+	}
+}
+
+func TestRunExternalMigrations(t *testing.T) {
+	r := newTestRepo(t, 990)
+	defer os.RemoveAll(r.path)
+
+	var ran []int
+	var log bytes.Buffer
+	opts := r.options(&log)
+	opts.External = func(path string, to int, log io.Writer) error {
+		ran = append(ran, to)
+		return RepoPath(path).WriteVersion(to)
+	}
+
+	opts.DryRun = true
+	if err := Run(r.path, 1001, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 0 {
+		t.Fatal("dry run ran the external migrations")
+	}
+	r.check(t, 990, "{}", false)
+
+	opts.DryRun = false
+	if err := Run(r.path, 1001, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 1 || ran[0] != 1000 {
+		t.Fatalf("expected the external migrations to run to version 1000, got %v", ran)
+	}
+	r.check(t, 1001, `"Foo": "bar"`, false)
+
+	// an external migration leaving the repo at another version fails
+	r = newTestRepo(t, 990)
+	defer os.RemoveAll(r.path)
+	opts = r.options(&log)
+	opts.External = func(string, int, io.Writer) error { return nil }
+	if err := Run(r.path, 1001, opts); err == nil {
+		t.Fatal("expected an error when the external migrations didn't migrate the repo")
+	}
+	r.check(t, 990, "{}", false)
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	Register(&Migration{To: 1001, Apply: func(*Env) error { return nil }})
+}
@@ -68,6 +68,19 @@ test_expect_success ".ipfs/ has been created" '
 	test_fsh ls -al .ipfs
 '
 
+test_expect_success "the datastore spec was recorded" '
+	grep "\"shardFunc\":\"/repo/flatfs/shard/v1/next-to-last/2\"" .ipfs/datastore_spec
+'
+
+test_expect_success "ipfs refuses to open with another datastore spec" '
+	ipfs config --json Datastore.Spec.mounts | sed -e "s/next-to-last\/2/prefix\/4/" >mounts &&
+	cp .ipfs/config config_backup &&
+	ipfs config --json Datastore.Spec.mounts "$(cat mounts)" &&
+	test_must_fail ipfs repo stat 2>spec_err &&
+	grep "does not match what is on disk" spec_err &&
+	cp config_backup .ipfs/config
+'
+
 test_expect_success "ipfs config succeeds" '
 	echo /ipfs >expected_config &&
 	ipfs config Mounts.IPFS >actual_config &&
@@ -74,6 +74,69 @@ test_add_cat_file() {
         test_cmp expected actual
     '
 
+    test_expect_success "ipfs add --chunker buzhash succeeds" '
+        ipfs add --chunker buzhash mountdir/hello.txt >actual
+    '
+
+    test_expect_success "ipfs add --chunker buzhash output looks good" '
+    	HASH="QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH" &&
+        echo "added $HASH hello.txt" >expected &&
+        test_cmp expected actual
+    '
+
+    test_expect_success "ipfs add --chunker fastcdc-64-128-256 succeeds" '
+        ipfs add --chunker fastcdc-64-128-256 mountdir/hello.txt >actual
+    '
+
+    test_expect_success "ipfs add --chunker fastcdc-64-128-256 output looks good" '
+    	HASH="QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH" &&
+        echo "added $HASH hello.txt" >expected &&
+        test_cmp expected actual
+    '
+
+    test_expect_success "content-defined chunkers round-trip larger files" '
+        random 1000000 42 >mountdir/cdcfile &&
+        for c in buzhash-4096 fastcdc-1024-4096-16384; do
+            HASH=$(ipfs add -q --chunker $c mountdir/cdcfile) &&
+            ipfs cat $HASH >cdcfile_out &&
+            test_cmp mountdir/cdcfile cdcfile_out || return 1
+        done
+    '
+
+    test_expect_success "format-aware chunkers round-trip" '
+        random 100000 43 >mountdir/tarme &&
+        tar -cf mountdir/archive.tar -C mountdir tarme hello.txt &&
+        HASH=$(ipfs add -q --chunker tar mountdir/archive.tar) &&
+        ipfs cat $HASH >archive_out &&
+        test_cmp mountdir/archive.tar archive_out &&
+        seq 1 20000 >mountdir/lines.txt &&
+        HASH=$(ipfs add -q --chunker lines-4096 mountdir/lines.txt) &&
+        ipfs cat $HASH >lines_out &&
+        test_cmp mountdir/lines.txt lines_out
+    '
+
+    test_expect_success "lines chunker ends blocks on line boundaries" '
+        HASH=$(ipfs add -q --raw-leaves --chunker lines-4096 mountdir/lines.txt) &&
+        ipfs refs $HASH >line_blocks &&
+        for b in $(cat line_blocks); do
+            test $(ipfs block get $b | tail -c 1 | wc -l) -eq 1 || return 1
+        done
+    '
+
+    test_expect_success "ipfs add --chunker rejects bad sizes" '
+        test_expect_code 1 ipfs add --chunker buzhash-8192-4096-1024 mountdir/hello.txt
+    '
+
+    test_expect_success "ipfs add --workers gives the same hash" '
+        HASH=$(ipfs add -q mountdir/cdcfile) &&
+        HASH1=$(ipfs add -q --workers=1 mountdir/cdcfile) &&
+        test "$HASH" = "$HASH1"
+    '
+
+    test_expect_success "ipfs add --workers rejects zero" '
+        test_expect_code 1 ipfs add --workers=0 mountdir/hello.txt
+    '
+
     test_expect_success "ipfs add on hidden file succeeds" '
         echo "Hello Worlds!" >mountdir/.hello.txt &&
         ipfs add mountdir/.hello.txt >actual
@@ -221,6 +284,87 @@ test_add_pwd_is_symlink() {
     '
 }
 
+test_add_incremental() {
+    test_expect_success "setup a directory to add incrementally" '
+      rm -rf incdir &&
+      mkdir -p incdir/sub &&
+      echo "first" > incdir/a &&
+      echo "second" > incdir/sub/b &&
+      ipfs add -r -Q incdir > inc_expected
+    '
+
+    test_expect_success "'ipfs add -r --incremental' gives the usual hash" '
+      ipfs add -r -Q --incremental incdir > inc_actual &&
+      test_cmp inc_expected inc_actual
+    '
+
+    test_expect_success "adding unchanged files again gives the same hash" '
+      ipfs add -r -Q --incremental incdir > inc_actual &&
+      test_cmp inc_expected inc_actual
+    '
+
+    test_expect_success "modified files are added again" '
+      echo "changed" > incdir/sub/b &&
+      touch -d "@1500000000" incdir/sub/b &&
+      ipfs add -r -Q incdir > inc_expected &&
+      ipfs add -r -Q --incremental incdir > inc_actual &&
+      test_cmp inc_expected inc_actual
+    '
+
+    test_expect_success "files are rehashed with other options" '
+      ipfs add -r -Q --raw-leaves incdir > inc_expected &&
+      ipfs add -r -Q --incremental --raw-leaves incdir > inc_actual &&
+      test_cmp inc_expected inc_actual
+    '
+}
+
+test_add_ignore() {
+    test_expect_success "setup a directory with ignored files" '
+      rm -rf igndir &&
+      mkdir -p igndir/sub igndir/build &&
+      echo "a" > igndir/a.txt &&
+      echo "log" > igndir/a.log &&
+      echo "keep" > igndir/keep.log &&
+      echo "out" > igndir/build/out &&
+      echo "b" > igndir/sub/b.txt &&
+      echo "tmp" > igndir/sub/b.tmp &&
+      echo "*.tmp" > igndir/sub/.ipfsignore
+    '
+
+    test_expect_success "'ipfs add --exclude' skips the excluded paths" '
+      ipfs add -r --exclude="*.log,build/" --include=keep.log igndir > ign_actual &&
+      grep "added [^ ]* igndir/a.txt" ign_actual &&
+      grep "added [^ ]* igndir/keep.log" ign_actual &&
+      grep "added [^ ]* igndir/sub/b.txt" ign_actual &&
+      test_must_fail grep "igndir/a.log" ign_actual &&
+      test_must_fail grep "igndir/build" ign_actual &&
+      test_must_fail grep "igndir/sub/b.tmp" ign_actual
+    '
+
+    test_expect_success "'ipfs add --verbose' lists the excluded paths" '
+      ipfs add -r -v --exclude="*.log" igndir >/dev/null 2> ign_err &&
+      grep "excluded igndir/a.log" ign_err &&
+      grep "excluded igndir/keep.log" ign_err &&
+      grep "excluded igndir/sub/b.tmp" ign_err
+    '
+
+    test_expect_success "ignored paths don't change the hash" '
+      rm -rf igndir/sub/b.tmp igndir/sub/.ipfsignore &&
+      ipfs add -r -Q igndir > ign_expected &&
+      echo "tmp" > igndir/sub/b.tmp &&
+      echo "*.tmp" > igndir/sub/.ipfsignore &&
+      ipfs add -r -Q igndir > ign_actual &&
+      test_cmp ign_expected ign_actual &&
+      ipfs add -r -Q -H --exclude=".ipfsignore" igndir > ign_actual &&
+      test_cmp ign_expected ign_actual
+    '
+
+    test_expect_success "ignore files are added with hidden files" '
+      ipfs add -r -H igndir > ign_actual &&
+      grep "added [^ ]* igndir/sub/.ipfsignore" ign_actual
+    '
+}
+
 test_launch_ipfs_daemon_and_mount
 
 test_expect_success "'ipfs add --help' succeeds" '
@@ -474,6 +618,10 @@ test_add_named_pipe " Post http://$API_ADDR/api/v0/add?encoding=json&progress=tr
 
 test_add_pwd_is_symlink
 
+test_add_incremental
+
+test_add_ignore
+
 test_add_cat_raw
 
 test_expect_success "ipfs add --cid-version=9 fails" '
@@ -503,6 +651,10 @@ test_add_named_pipe ""
 
 test_add_pwd_is_symlink
 
+test_add_incremental
+
+test_add_ignore
+
 # Test daemon in offline mode
 test_launch_ipfs_daemon --offline
 
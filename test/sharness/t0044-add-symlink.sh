@@ -56,6 +56,49 @@ test_add_symlinks() {
 		test_cmp badlink_exp badlink_out
 	'
 
+	test_expect_success "ipfs get recreates symlinks" '
+		ipfs get -o files_out $(cat filehash_out) &&
+		test -L files_out/bar/baz &&
+		test -L files_out/bad &&
+		echo files/foo/baz >link_exp &&
+		readlink files_out/bar/baz >link_out &&
+		test_cmp link_exp link_out &&
+		echo files/does/not/exist >link_exp &&
+		readlink files_out/bad >link_out &&
+		test_cmp link_exp link_out &&
+		rm -rf files_out
+	'
+
+	test_expect_success "ipfs get of a lone symlink recreates it" '
+		ipfs get -o badlink_get $(cat badlink_out) &&
+		test -L badlink_get &&
+		echo files/does/not/exist >link_exp &&
+		readlink badlink_get >link_out &&
+		test_cmp link_exp link_out &&
+		ipfs get -o badlink_get $(cat badlink_out) &&
+		test -L badlink_get &&
+		rm badlink_get
+	'
+
+	test_expect_success "relative symlinks still resolve after ipfs get" '
+		mkdir -p rel/dir &&
+		echo "relative target" >rel/dir/target &&
+		ln -s dir/target rel/link &&
+		REL_HASH=$(ipfs add -r -Q rel) &&
+		ipfs get -o rel_out $REL_HASH &&
+		test_cmp rel/dir/target rel_out/link &&
+		rm -rf rel rel_out
+	'
+
+	test_expect_success "ipfs get -a archives symlinks as symlinks" '
+		ipfs get -a -o files.tar $(cat filehash_out) &&
+		mkdir tar_out &&
+		(cd tar_out && tar -xf ../files.tar) &&
+		test -L tar_out/$(cat filehash_out)/bad &&
+		test -L tar_out/$(cat filehash_out)/bar/baz &&
+		rm -rf tar_out files.tar
+	'
+
 	test_expect_success "adding with symlink in middle of path is same as\
 adding with no symlink" '
 		mkdir -p files2/a/b/c &&
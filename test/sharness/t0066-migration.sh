@@ -4,22 +4,15 @@
 # MIT Licensed; see the LICENSE file in this repository.
 #
 
-test_description="Test migrations auto update prompt"
+test_description="Test built-in migrations and the auto update prompt"
 
 . lib/test-lib.sh
 
 test_init_ipfs
 
-test_expect_success "setup mock migrations" '
-	mkdir bin &&
-	echo "#!/bin/bash" > bin/fs-repo-migrations &&
-	echo "echo 5" >> bin/fs-repo-migrations &&
-	chmod +x bin/fs-repo-migrations &&
-	export PATH="$(pwd)/bin":$PATH
-'
-
-test_expect_success "manually reset repo version to 3" '
-	echo "3" > "$IPFS_PATH"/version
+test_expect_success "manually reset repo to version 5" '
+	rm "$IPFS_PATH"/datastore_spec &&
+	echo "5" > "$IPFS_PATH"/version
 '
 
 test_expect_success "ipfs daemon --migrate=false fails" '
@@ -27,16 +20,7 @@ test_expect_success "ipfs daemon --migrate=false fails" '
 '
 
 test_expect_success "output looks good" '
-	grep "Please get fs-repo-migrations from https://dist.ipfs.io" false_out
-'
-
-test_expect_success "ipfs daemon --migrate=true runs migration" '
-	test_expect_code 1 ipfs daemon --migrate=true > true_out
-'
-
-test_expect_success "output looks good" '
-	grep "Running: " true_out > /dev/null &&
-	grep "Success: fs-repo has been migrated to version 5." true_out > /dev/null
+	grep "Please run '"'ipfs repo migrate'"' to migrate it." false_out
 '
 
 test_expect_success "'ipfs daemon' prompts to auto migrate" '
@@ -46,7 +30,91 @@ test_expect_success "'ipfs daemon' prompts to auto migrate" '
 test_expect_success "output looks good" '
 	grep "Found outdated fs-repo" daemon_out > /dev/null &&
 	grep "Run migrations now?" daemon_out > /dev/null &&
-	grep "Please get fs-repo-migrations from https://dist.ipfs.io" daemon_out > /dev/null
+	grep "Please run '"'ipfs repo migrate'"' to migrate it." daemon_out > /dev/null
+'
+
+test_expect_success "'ipfs repo migrate --dry-run' lists the changes" '
+	ipfs repo migrate --dry-run > dry_out &&
+	grep "Migrating to version 6: record the datastore spec." dry_out &&
+	grep "writing $IPFS_PATH/datastore_spec" dry_out &&
+	grep "Dry run: fs-repo would have been migrated to version 6." dry_out
+'
+
+test_expect_success "the dry run left the repo as is" '
+	echo 5 > version_exp &&
+	test_cmp version_exp "$IPFS_PATH"/version &&
+	test ! -f "$IPFS_PATH"/datastore_spec
+'
+
+test_expect_success "'ipfs repo migrate --backup' migrates the repo" '
+	ipfs repo migrate --backup="$(pwd)/backup" > migrate_out &&
+	grep "Success: fs-repo has been migrated to version 6." migrate_out &&
+	echo 6 > version_exp &&
+	test_cmp version_exp "$IPFS_PATH"/version &&
+	test -f "$IPFS_PATH"/datastore_spec
+'
+
+test_expect_success "the backup is at the previous version" '
+	echo 5 > version_exp &&
+	test_cmp version_exp backup/version &&
+	test ! -f backup/datastore_spec
 '
 
+test_expect_success "the migrated repo can be used" '
+	echo "migrated" | ipfs add -q > hash_out &&
+	ipfs cat $(cat hash_out) > cat_out &&
+	echo "migrated" > cat_exp &&
+	test_cmp cat_exp cat_out
+'
+
+test_expect_success "'ipfs repo migrate --to' reverts migrations" '
+	ipfs repo migrate --to=5 > revert_out &&
+	grep "Reverting to version 5: record the datastore spec." revert_out &&
+	echo 5 > version_exp &&
+	test_cmp version_exp "$IPFS_PATH"/version &&
+	test ! -f "$IPFS_PATH"/datastore_spec
+'
+
+test_expect_success "'ipfs repo migrate' fails without a built-in migration" '
+	test_must_fail ipfs repo migrate --to=3 2> unknown_err &&
+	grep "can'"'"'t be reverted" unknown_err
+'
+
+test_expect_success "setup mock migrations" '
+	mkdir bin &&
+	echo "#!/bin/sh" > bin/fs-repo-migrations &&
+	echo "test \"\$1\" = -v && echo 5 && exit 0" >> bin/fs-repo-migrations &&
+	echo "echo \"\$@\" > \"\$IPFS_PATH\"/mock_args" >> bin/fs-repo-migrations &&
+	echo "echo 5 > \"\$IPFS_PATH\"/version" >> bin/fs-repo-migrations &&
+	chmod +x bin/fs-repo-migrations &&
+	export PATH="$(pwd)/bin":$PATH
+'
+
+test_expect_success "manually reset repo version to 3" '
+	echo "3" > "$IPFS_PATH"/version
+'
+
+test_expect_success "'ipfs repo migrate' runs fs-repo-migrations for old versions" '
+	ipfs repo migrate > external_out &&
+	grep "Running: .*fs-repo-migrations -to 5 -y" external_out &&
+	grep "Migrating to version 6: record the datastore spec." external_out &&
+	echo "-to 5 -y" > args_exp &&
+	test_cmp args_exp "$IPFS_PATH"/mock_args &&
+	echo 6 > version_exp &&
+	test_cmp version_exp "$IPFS_PATH"/version
+'
+
+test_expect_success "manually reset repo version to 3" '
+	rm "$IPFS_PATH"/datastore_spec &&
+	echo "3" > "$IPFS_PATH"/version
+'
+
+test_launch_ipfs_daemon --migrate=true
+
+test_expect_success "ipfs daemon --migrate=true ran the migrations" '
+	grep "Success: fs-repo has been migrated to version 6." actual_daemon > /dev/null
+'
+
+test_kill_ipfs_daemon
+
 test_done
@@ -0,0 +1,89 @@
+#!/bin/sh
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs namespaces"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "configure a namespace" '
+  ipfs config --json Namespaces.team "{\"StorageMax\": \"1MB\"}"
+'
+
+test_expect_success "generate files" '
+  random 100000 41 >small &&
+  random 2000000 42 >big &&
+  echo "shared content" >shared
+'
+
+test_expect_success "'ipfs add --namespace' succeeds" '
+  HASH_SMALL=$(ipfs add -q --namespace team small)
+'
+
+test_expect_success "the pin is in the namespace only" '
+  ipfs pin ls --namespace team --type=recursive >team_pins &&
+  grep "$HASH_SMALL" team_pins &&
+  ipfs pin ls --type=recursive >default_pins &&
+  test_must_fail grep "$HASH_SMALL" default_pins
+'
+
+test_expect_success "'ipfs cat --namespace' succeeds" '
+  ipfs cat --namespace team "$HASH_SMALL" >small_out &&
+  test_cmp small small_out
+'
+
+test_expect_success "'ipfs repo stat --namespace' shows the namespace" '
+  ipfs repo stat --namespace team >stat_out &&
+  grep "Namespace: *team" stat_out
+'
+
+test_expect_success "'ipfs namespace ls' lists the namespace" '
+  ipfs namespace ls >ls_out &&
+  grep "^team .* 1000000" ls_out
+'
+
+test_expect_success "adding past the quota fails" '
+  test_must_fail ipfs add -q --namespace team big 2>add_err &&
+  grep "namespace quota exceeded" add_err
+'
+
+test_expect_success "an unknown namespace is rejected" '
+  test_must_fail ipfs pin ls --namespace nope 2>ns_err &&
+  grep "unknown namespace" ns_err
+'
+
+test_expect_success "'ipfs repo gc' keeps the blocks of the namespaces" '
+  ipfs repo gc &&
+  ipfs block stat "$HASH_SMALL"
+'
+
+test_expect_success "add the same file in both namespaces" '
+  HASH_SHARED=$(ipfs add -q shared) &&
+  ipfs add -q --namespace team shared >team_hash &&
+  echo "$HASH_SHARED" >expected_hash &&
+  test_cmp expected_hash team_hash
+'
+
+test_expect_success "unpin everything in the namespace" '
+  ipfs pin rm --namespace team "$HASH_SMALL" "$HASH_SHARED"
+'
+
+test_expect_success "'ipfs repo gc --namespace' removes the unused blocks" '
+  ipfs repo gc --namespace team &&
+  test_must_fail ipfs block stat "$HASH_SMALL"
+'
+
+test_expect_success "the blocks pinned out of the namespace are kept" '
+  ipfs cat "$HASH_SHARED" >shared_out &&
+  test_cmp shared shared_out
+'
+
+test_expect_success "the namespace doesn't reference anything anymore" '
+  ipfs repo stat --namespace team >stat_out &&
+  grep "RepoSize: *0" stat_out
+'
+
+test_done
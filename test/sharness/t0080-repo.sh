@@ -233,6 +233,7 @@ test_expect_success "repo stats came out correct" '
   grep "RepoPath" repo-stats &&
   grep "RepoSize" repo-stats &&
   grep "NumObjects" repo-stats &&
+  test_must_fail grep "LogicalSize" repo-stats &&
   grep "Version" repo-stats &&
   grep "StorageMax" repo-stats
 '
@@ -246,6 +247,31 @@ test_expect_success "repo stats are updated correctly" '
   test $(get_field_num "RepoSize" repo-stats-2) -ge $(get_field_num "RepoSize" repo-stats)
 '
 
+test_expect_success "'ipfs repo stat --verbose' succeeds" '
+  ipfs cat $(ipfs add -q repo-stats) > /dev/null &&
+  ipfs repo stat --verbose > repo-stats-verbose
+'
+
+test_expect_success "verbose repo stats came out correct" '
+  grep "NumObjects" repo-stats-verbose &&
+  grep "LogicalSize" repo-stats-verbose &&
+  grep "PhysicalSize" repo-stats-verbose &&
+  grep "BlockCodecs:" repo-stats-verbose &&
+  grep "  protobuf:" repo-stats-verbose &&
+  grep "BlockHashes:" repo-stats-verbose &&
+  grep "  sha2-256:" repo-stats-verbose &&
+  grep "Codec protobuf:.*puts" repo-stats-verbose &&
+  grep "GetSizes:" repo-stats-verbose &&
+  grep "ARCCache:.*hit rate" repo-stats-verbose
+'
+
+test_expect_success "the blockstore stats are exported to prometheus" '
+  curl -s "$API_ADDR/debug/metrics/prometheus" > metrics &&
+  grep "ipfs_blockstore_codec_ops_total{codec=\"protobuf\",op=\"put\"}" metrics &&
+  grep "ipfs_blockstore_block_size_bytes_bucket" metrics &&
+  grep "ipfs_blockstore_cache_hits_total{cache=\"arc\"}" metrics
+'
+
 test_expect_success "'ipfs repo version' succeeds" '
   ipfs repo version > repo-version
 '
@@ -57,4 +57,54 @@ do
 	check_random_corruption
 done
 
+BS_BLOCK1="XZ/CIQPDDQH5PDJTF4QSNMPFC45FQZH5MBSWCX2W254P7L7HGNHW5MQXZA.data"
+
+test_expect_success "add and corrupt a pinned block" '
+	H_BLOCK1=$(echo "Block 1" | ipfs add -q) &&
+	echo "this is super broken" > "$IPFS_PATH/blocks/$BS_BLOCK1"
+'
+
+test_expect_success "repo verify --repair can't fetch the block offline" '
+	test_expect_code 1 ipfs repo verify --repair > repair_out 2>&1 &&
+	grep "block $H_BLOCK1 was corrupt" repair_out &&
+	grep "pin $H_BLOCK1 could not be repaired" repair_out
+'
+
+test_expect_success "the corrupt block was deleted" '
+	test ! -e "$IPFS_PATH/blocks/$BS_BLOCK1" &&
+	ipfs repo verify
+'
+
+test_expect_success "adding the block again repairs the pin" '
+	echo "Block 1" | ipfs add -q &&
+	ipfs repo verify --repair > repair_out &&
+	grep "all blocks validated" repair_out
+'
+
+test_expect_success "set up two nodes" '
+	iptb init -n 2 -p 0 -f --bootstrap=none &&
+	echo "Block 1" | ipfsi 0 add -q &&
+	echo "Block 1" | ipfsi 1 add -q &&
+	echo "this is super broken" > "$IPTB_ROOT/0/blocks/$BS_BLOCK1"
+'
+
+startup_cluster 2
+
+test_expect_success "repo verify --repair fetches the block from the other node" '
+	ipfsi 0 repo verify --repair > repair_out &&
+	grep "block $H_BLOCK1 was corrupt" repair_out &&
+	grep "pin $H_BLOCK1 repaired, fetched 1 blocks" repair_out
+'
+
+test_expect_success "the block was repaired" '
+	ipfsi 0 repo verify &&
+	ipfsi 0 cat $H_BLOCK1 > block_out &&
+	echo "Block 1" > block_exp &&
+	test_cmp block_exp block_out
+'
+
+test_expect_success "shut down nodes" '
+	iptb stop
+'
+
 test_done
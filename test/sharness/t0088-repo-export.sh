@@ -0,0 +1,117 @@
+#!/bin/sh
+
+test_description="Test ipfs repo export and import"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "setup the repo" '
+	PEERID=$(ipfs config Identity.PeerID) &&
+	PINNED=$(echo "pinned" | ipfs add -q) &&
+	UNPINNED=$(echo "unpinned" | ipfs add -q) &&
+	ipfs pin rm $UNPINNED &&
+	ipfs files mkdir /dir &&
+	echo "in mfs" | ipfs files write --create /dir/file &&
+	FILES_ROOT=$(ipfs files stat --hash /) &&
+	ipfs key gen --type=rsa --size=2048 backupkey > /dev/null
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "ipfs repo export works with a running daemon" '
+	ipfs repo export > all.tar &&
+	ipfs repo export --blocks=pinned > pinned.tar &&
+	ipfs repo export --blocks=roots > roots.tar
+'
+
+test_expect_success "ipfs repo export rejects unknown blocks modes" '
+	test_must_fail ipfs repo export --blocks=some > /dev/null 2> export_err &&
+	grep "unknown blocks mode" export_err
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "the archive starts with its manifest" '
+	tar -tf all.tar > all_entries &&
+	head -n 1 all_entries > manifest_actual &&
+	echo manifest.json > manifest_expected &&
+	test_cmp manifest_expected manifest_actual &&
+	grep "^keystore/backupkey$" all_entries &&
+	grep "^end.json$" all_entries
+'
+
+# import_repo <name> <archive> restores the archive in the repo ./<name>
+import_repo() {
+	IPFS_PATH="$(pwd)/$1" ipfs repo import "$2"
+}
+
+# in_repo <name> <cmd...> runs an ipfs command on the repo ./<name>
+in_repo() {
+	name=$1
+	shift
+	IPFS_PATH="$(pwd)/$name" ipfs "$@"
+}
+
+test_expect_success "ipfs repo import restores the whole repo" '
+	import_repo all all.tar > import_out &&
+	grep "imported 1 keys" import_out &&
+	echo "$PEERID" > peerid_expected &&
+	in_repo all config Identity.PeerID > peerid_actual &&
+	test_cmp peerid_expected peerid_actual &&
+	echo "pinned" > pinned_expected &&
+	in_repo all cat $PINNED > pinned_actual &&
+	test_cmp pinned_expected pinned_actual &&
+	echo "unpinned" > unpinned_expected &&
+	in_repo all cat $UNPINNED > unpinned_actual &&
+	test_cmp unpinned_expected unpinned_actual &&
+	echo "in mfs" > mfs_expected &&
+	in_repo all files read /dir/file > mfs_actual &&
+	test_cmp mfs_expected mfs_actual &&
+	in_repo all key list | grep backupkey
+'
+
+test_expect_success "the pins are restored" '
+	ipfs pin ls --type=recursive | sort > pins_expected &&
+	in_repo all pin ls --type=recursive | sort > pins_actual &&
+	test_cmp pins_expected pins_actual
+'
+
+test_expect_success "ipfs repo import --blocks=pinned leaves the unpinned blocks out" '
+	import_repo pinned pinned.tar &&
+	in_repo pinned refs local > pinned_refs &&
+	grep $PINNED pinned_refs &&
+	grep $FILES_ROOT pinned_refs &&
+	test_must_fail grep $UNPINNED pinned_refs
+'
+
+test_expect_success "ipfs repo import --blocks=roots only references the pins" '
+	import_repo roots roots.tar &&
+	in_repo roots pin ls --type=recursive | grep $PINNED &&
+	in_repo roots refs local > roots_refs &&
+	grep $FILES_ROOT roots_refs &&
+	test_must_fail grep $PINNED roots_refs
+'
+
+test_expect_success "ipfs repo import refuses an existing repo" '
+	test_must_fail import_repo all all.tar 2> exists_err &&
+	grep "is not empty" exists_err
+'
+
+test_expect_success "ipfs repo import fails on truncated archives" '
+	head -c 4096 all.tar > truncated.tar &&
+	test_must_fail import_repo truncated truncated.tar &&
+	test ! -e truncated
+'
+
+test_expect_success "ipfs repo import checks the blocks" '
+	mkdir extracted &&
+	tar -xf all.tar -C extracted &&
+	echo "corrupt" > "extracted/blocks/$UNPINNED" &&
+	(cd extracted && tar -cf ../corrupt.tar $(cat ../all_entries)) &&
+	test_must_fail import_repo corrupt corrupt.tar 2> corrupt_err &&
+	grep "block $UNPINNED is corrupt" corrupt_err &&
+	test ! -e corrupt
+'
+
+test_done
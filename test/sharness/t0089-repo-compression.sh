@@ -0,0 +1,64 @@
+#!/bin/sh
+
+test_description="Test block compression in the blockstore"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+get_field_num() {
+	field=$1
+	file=$2
+	grep "^$field:" "$file" | awk '{ print $2 }'
+}
+
+test_expect_success "setup a text file" '
+	for i in $(test_seq 1 2000); do
+		echo "a line of text which compresses well"
+	done > text
+'
+
+test_expect_success "blocks aren't compressed by default" '
+	UNCOMPRESSED=$(ipfs add -q text) &&
+	ipfs repo stat --verbose > stat_before &&
+	test $(get_field_num LogicalSize stat_before) -eq $(get_field_num PhysicalSize stat_before)
+'
+
+test_expect_success "enable gzip compression" '
+	ipfs config Datastore.BlockCompression gzip &&
+	ipfs config Datastore.HashOnRead --bool true
+'
+
+test_expect_success "ipfs add compresses the blocks" '
+	echo "another file" >> text &&
+	COMPRESSED=$(ipfs add -q text) &&
+	ipfs repo stat --verbose > stat_after &&
+	test $(get_field_num PhysicalSize stat_after) -lt $(get_field_num LogicalSize stat_after)
+'
+
+test_expect_success "compressed blocks are read back and verified" '
+	ipfs cat $COMPRESSED > compressed_out &&
+	test_cmp text compressed_out &&
+	ipfs repo verify
+'
+
+test_expect_success "the blocks written before are still read" '
+	ipfs cat $UNCOMPRESSED > uncompressed_out &&
+	head -n 2000 text > text_before &&
+	test_cmp text_before uncompressed_out
+'
+
+test_expect_success "the compressed blocks are read once compression is disabled" '
+	ipfs config Datastore.BlockCompression "" &&
+	ipfs cat $COMPRESSED > compressed_out &&
+	test_cmp text compressed_out
+'
+
+test_expect_success "unknown compressions are rejected" '
+	ipfs config Datastore.BlockCompression lz4 &&
+	test_must_fail ipfs cat $COMPRESSED 2> lz4_err &&
+	grep "unknown block compression" lz4_err &&
+	ipfs config Datastore.BlockCompression ""
+'
+
+test_done
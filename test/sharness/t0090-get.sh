@@ -145,8 +145,102 @@ test_get_fail() {
 	'
 }
 
+test_get_attrs() {
+
+	test_expect_success "ipfs add --preserve-mode --preserve-mtime succeeds" '
+		mkdir -p attrs/sub &&
+		echo "#!/bin/sh" >attrs/exe &&
+		echo "plain" >attrs/sub/plain &&
+		chmod 0755 attrs/exe &&
+		chmod 0640 attrs/sub/plain &&
+		chmod 0750 attrs/sub &&
+		TZ=UTC touch -t 201701020304.05 attrs/exe attrs/sub/plain attrs/sub mtime_ref &&
+		ATTRS_HASH=$(ipfs add -r -Q --preserve-mode --preserve-mtime attrs)
+	'
+
+	test_expect_success "files stat shows the recorded attributes" '
+		ipfs files cp /ipfs/$ATTRS_HASH /attrs &&
+		ipfs files stat --format="<mode> <mtime>" /attrs/exe >stat_out &&
+		echo "0755 2017-01-02T03:04:05Z" >stat_exp &&
+		ipfs files rm -r /attrs &&
+		test_cmp stat_exp stat_out
+	'
+
+	test_expect_success "ipfs get restores the recorded attributes" '
+		ipfs get -o attrs_out $ATTRS_HASH &&
+		echo "-rwxr-xr-x" >mode_exp &&
+		generic_stat attrs_out/exe >mode_out &&
+		test_cmp mode_exp mode_out &&
+		echo "-rw-r-----" >mode_exp &&
+		generic_stat attrs_out/sub/plain >mode_out &&
+		test_cmp mode_exp mode_out &&
+		echo "drwxr-x---" >mode_exp &&
+		generic_stat attrs_out/sub >mode_out &&
+		test_cmp mode_exp mode_out &&
+		test -z "$(find attrs_out/exe attrs_out/sub -newer mtime_ref)" &&
+		test -z "$(find mtime_ref -newer attrs_out/exe)"
+	'
+
+	test_expect_success "ipfs get drops the setuid bit by default" '
+		mkdir -p suid &&
+		echo "#!/bin/sh" >suid/exe &&
+		chmod 4755 suid/exe &&
+		SUID_HASH=$(ipfs add -r -Q --preserve-mode suid) &&
+		ipfs get -o suid_out $SUID_HASH &&
+		echo "-rwxr-xr-x" >mode_exp &&
+		generic_stat suid_out/exe >mode_out &&
+		test_cmp mode_exp mode_out
+	'
+
+	test_expect_success "ipfs get --special-bits keeps the setuid bit" '
+		ipfs get --special-bits -o suid_special $SUID_HASH &&
+		echo "-rwsr-xr-x" >mode_exp &&
+		generic_stat suid_special/exe >mode_out &&
+		test_cmp mode_exp mode_out &&
+		rm -rf suid suid_out suid_special
+	'
+
+	test_expect_success "ipfs get over an existing file restores its mode" '
+		chmod 0600 attrs_out/exe &&
+		ipfs get -o attrs_out $ATTRS_HASH &&
+		echo "-rwxr-xr-x" >mode_exp &&
+		generic_stat attrs_out/exe >mode_out &&
+		test_cmp mode_exp mode_out
+	'
+
+	test_expect_success "attributes are not recorded by default" '
+		PLAIN_HASH=$(ipfs add -r -Q attrs) &&
+		test "$PLAIN_HASH" != "$ATTRS_HASH" &&
+		rm -rf attrs attrs_out
+	'
+
+	test_expect_success "ipfs get leaves files without attributes alone" '
+		mkdir -p noattrs &&
+		echo "plain" >noattrs/plain &&
+		NOATTRS_HASH=$(ipfs add -r -Q noattrs) &&
+		ipfs get -o noattrs_out $NOATTRS_HASH &&
+		chmod 0600 noattrs_out/plain &&
+		ipfs get -o noattrs_out $NOATTRS_HASH &&
+		echo "-rw-------" >mode_exp &&
+		generic_stat noattrs_out/plain >mode_out &&
+		test_cmp mode_exp mode_out &&
+		test -n "$(find noattrs_out/plain -newer mtime_ref)" &&
+		rm -rf noattrs noattrs_out mtime_ref
+	'
+
+	test_expect_success "ipfs get -a keeps the default directory mode" '
+		mkdir -p defmode/sub &&
+		DEFMODE_HASH=$(ipfs add -r -Q defmode) &&
+		ipfs get -a -o defmode.tar $DEFMODE_HASH &&
+		tar -tvf defmode.tar >defmode_list &&
+		grep "^drwxrwxrwx" defmode_list &&
+		rm -rf defmode defmode.tar defmode_list
+	'
+}
+
 # should work offline
 test_get_cmd
+test_get_attrs
 
 # only really works offline, will try and search network when online
 test_get_fail
@@ -154,6 +248,7 @@ test_get_fail
 # should work online
 test_launch_ipfs_daemon
 test_get_cmd
+test_get_attrs
 
 test_expect_success "empty request to get doesn't panic and returns error" '
 	curl "http://$API_ADDR/api/v0/get" > curl_out || true &&
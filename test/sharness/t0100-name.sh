@@ -90,4 +90,35 @@ test_expect_success "publish an explicit node ID as key name looks good" '
 	test_cmp expected_node_id_publish actual_node_id_publish
 '
 
+# create a record offline and put it separately
+
+test_expect_success "'ipfs name record create' succeeds" '
+	ipfs name record create --key=keyname --sequence=10 "/ipfs/$HASH_WELCOME_DOCS" >record.bin
+'
+
+test_expect_success "'ipfs name record put' succeeds" '
+	ipfs name record put "${NEWID}" record.bin >actual_record_put
+'
+
+test_expect_success "record put output looks good" '
+	echo "Published to ${NEWID}: /ipfs/$HASH_WELCOME_DOCS" >expected_record_put &&
+	test_cmp expected_record_put actual_record_put
+'
+
+test_expect_success "'ipfs name record put' rejects an older record" '
+	ipfs name record create --key=keyname --sequence=1 "/ipfs/$HASH_WELCOME_DOCS" >old_record.bin &&
+	test_must_fail ipfs name record put "${NEWID}" old_record.bin
+'
+
+test_expect_success "'ipfs name record put' rejects a record with the same sequence" '
+	test_must_fail ipfs name record put "${NEWID}" record.bin
+'
+
+test_expect_success "records created without --sequence get increasing sequences" '
+	ipfs name record create --key=keyname "/ipfs/$HASH_WELCOME_DOCS" >next_record.bin &&
+	ipfs name record create --key=keyname "/ipfs/$HASH_WELCOME_DOCS" >last_record.bin &&
+	ipfs name record put "${NEWID}" next_record.bin &&
+	ipfs name record put "${NEWID}" last_record.bin
+'
+
 test_done
@@ -45,6 +45,115 @@ verify_dir_contents() {
 	'
 }
 
+test_symlinks() {
+	test_expect_success "can create symlinks" '
+		ipfs files mkdir -p /links/dir &&
+		echo "linked" | ipfs files write --create /links/dir/target &&
+		ipfs files symlink dir/target /links/rel &&
+		ipfs files symlink ../nowhere /links/dangling
+	'
+
+	test_expect_success "can stat symlinks" '
+		ipfs files stat --format="<type> <target>" /links/rel >link_stat &&
+		echo "symlink dir/target" >link_stat_exp &&
+		test_cmp link_stat_exp link_stat &&
+		ipfs files stat --format="<type> <target>" /links/dangling >link_stat &&
+		echo "symlink ../nowhere" >link_stat_exp &&
+		test_cmp link_stat_exp link_stat
+	'
+
+	test_expect_success "creating a symlink over an existing entry fails" '
+		test_expect_code 1 ipfs files symlink other /links/rel
+	'
+
+	test_expect_success "symlinks made with files survive ipfs get" '
+		ipfs get -o links_out $(ipfs files stat --hash /links) &&
+		echo dir/target >link_exp &&
+		readlink links_out/rel >link_out &&
+		test_cmp link_exp link_out &&
+		test_cmp links_out/dir/target links_out/rel &&
+		test -L links_out/dangling &&
+		rm -rf links_out
+	'
+
+	test_expect_success "added symlinks show up as symlinks" '
+		mkdir -p symdir &&
+		ln -s ../somewhere symdir/link &&
+		ipfs files cp /ipfs/$(ipfs add -r -Q symdir) /symdir &&
+		ipfs files stat --format="<type> <target>" /symdir/link >link_stat &&
+		echo "symlink ../somewhere" >link_stat_exp &&
+		test_cmp link_stat_exp link_stat &&
+		rm -rf symdir
+	'
+
+	test_expect_success "clean up symlinks" '
+		ipfs files rm -r /links /symdir
+	'
+}
+
+test_snapshots() {
+	test_expect_success "make some files to snapshot" '
+		ipfs files mkdir -p /snap/dir &&
+		echo "foo" | ipfs files write --create /snap/a &&
+		echo "bar" | ipfs files write --create /snap/dir/b
+	'
+
+	test_expect_success "can create a snapshot" '
+		ipfs files snapshot create first > snap_id &&
+		echo 1 > snap_id_exp &&
+		test_cmp snap_id_exp snap_id &&
+		ipfs files stat --hash / > snap_root
+	'
+
+	test_expect_success "snapshot root is pinned" '
+		ipfs pin ls --type=recursive > pins &&
+		grep "$(cat snap_root)" pins
+	'
+
+	test_expect_success "snapshot is listed" '
+		ipfs files snapshot ls > snap_ls &&
+		grep "^1	$(cat snap_root)	.*	first$" snap_ls
+	'
+
+	test_expect_success "labels must be unique" '
+		test_must_fail ipfs files snapshot create first
+	'
+
+	test_expect_success "change the files" '
+		ipfs files rm -r /snap/dir &&
+		echo "baz" | ipfs files write --truncate /snap/a
+	'
+
+	test_expect_success "diff shows the changes" '
+		ipfs files snapshot diff first > snap_diff &&
+		grep "^- .* \"snap/dir\"$" snap_diff &&
+		grep "^~ .* \"snap/a\"$" snap_diff
+	'
+
+	test_expect_success "can restore a subdirectory" '
+		ipfs files snapshot restore first /snap/dir &&
+		ipfs files read /snap/dir/b > snap_b &&
+		echo "bar" > snap_b_exp &&
+		test_cmp snap_b_exp snap_b &&
+		ipfs files read /snap/a > snap_a &&
+		echo "baz" > snap_a_exp &&
+		test_cmp snap_a_exp snap_a
+	'
+
+	test_expect_success "can restore the root" '
+		ipfs files snapshot restore 1 &&
+		ipfs files stat --hash / > snap_root_after &&
+		test_cmp snap_root snap_root_after
+	'
+
+	test_expect_success "can remove a snapshot" '
+		ipfs files snapshot rm first &&
+		ipfs files snapshot ls > snap_ls &&
+		test_must_be_empty snap_ls &&
+		ipfs files rm -r /snap
+	'
+}
+
 test_sharding() {
 	test_expect_success "make a directory" '
 		ipfs files mkdir /foo
@@ -86,6 +195,111 @@ test_sharding() {
 		echo QmPkwLJTYZRGPJ8Lazr9qPdrLmswPtUjaDbEpmR9jEh1se > actual_foo_hash &&
 		test_cmp expected_foo_hash actual_foo_hash
 	'
+
+	test_expect_success "can remove a file from sharded directory" '
+		ipfs files rm /foo/file42 &&
+		test_must_fail ipfs files stat /foo/file42 &&
+		ipfs files ls /foo | wc -l | tr -d " " > count_out &&
+		echo 99 > count_exp &&
+		test_cmp count_exp count_out
+	'
+
+	test_expect_success "can diff sharded directories" '
+		ipfs files stat --hash /foo > sharded_before &&
+		echo "changed" | ipfs files write --truncate /foo/file7 &&
+		ipfs files diff /ipfs/$(cat sharded_before) /foo > sharded_diff &&
+		echo "~ \"file7\"" > sharded_diff_exp &&
+		sed -e "s/ .* / /" sharded_diff > sharded_diff_out &&
+		test_cmp sharded_diff_exp sharded_diff_out
+	'
+
+	test_expect_success "can mkdir and cp in sharded directory" '
+		ipfs files mkdir /foo/bar &&
+		ipfs files cp /foo/file1 /foo/bar/file1 &&
+		ipfs files read /foo/bar/file1 > file_out &&
+		echo "1" > file_exp &&
+		test_cmp file_out file_exp
+	'
+
+	test_expect_success "small directories are not sharded" '
+		ipfs files mkdir /small &&
+		echo small | ipfs files write --create /small/file &&
+		ipfs files stat --hash /small > small_hash &&
+		ipfs object links $(cat small_hash) | awk "{print \$3}" > small_links &&
+		echo file > small_links_exp &&
+		test_cmp small_links_exp small_links
+	'
+
+	test_expect_success "directories added with ipfs add are always sharded" '
+		mkdir -p small_add &&
+		echo small > small_add/file &&
+		ipfs add -r -Q small_add > small_add_hash &&
+		ipfs object links $(cat small_add_hash) | awk "{print \$3}" > small_add_links &&
+		grep "^[0-9A-F][0-9A-F]file$" small_add_links
+	'
+
+	test_expect_success "can restore a sharded root" '
+		for i in `seq 60`
+		do
+			echo $i | ipfs files write --create /root$i || return 1
+		done &&
+		ipfs files snapshot create sharded &&
+		ipfs files stat --hash / > sharded_root &&
+		ipfs files rm /root1 &&
+		ipfs files snapshot restore sharded &&
+		ipfs files stat --hash / > sharded_root_after &&
+		test_cmp sharded_root sharded_root_after &&
+		ipfs files read /root1 > root1_out &&
+		echo 1 > root1_exp &&
+		test_cmp root1_exp root1_out &&
+		ipfs files ls / | grep -c "^root" > root_count &&
+		echo 60 > root_count_exp &&
+		test_cmp root_count_exp root_count
+	'
+}
+
+test_files_diff() {
+	test_expect_success "can create directories to diff" '
+		ipfs files mkdir -p /diff/a/sub /diff/a/same &&
+		echo "one" | ipfs files write --create /diff/a/one &&
+		echo "two" | ipfs files write --create /diff/a/two &&
+		echo "same" | ipfs files write --create /diff/a/same/file &&
+		echo "deep" | ipfs files write --create /diff/a/sub/deep &&
+		ipfs files cp /diff/a /diff/b &&
+		echo "changed" | ipfs files write --truncate /diff/b/one &&
+		ipfs files rm /diff/b/two &&
+		echo "three" | ipfs files write --create /diff/b/sub/three
+	'
+
+	test_expect_success "'ipfs files diff' lists the changes" '
+		ipfs files diff /diff/a /diff/b > diff_out &&
+		cut -c1 diff_out | tr -d "\n" > diff_types &&
+		printf "~+-" > diff_types_exp &&
+		test_cmp diff_types_exp diff_types &&
+		grep "\"one\"" diff_out | grep "^~ $(ipfs files stat --hash /diff/a/one) " &&
+		grep "\"two\"" diff_out | grep "^- $(ipfs files stat --hash /diff/a/two) " &&
+		grep "^+ $(ipfs files stat --hash /diff/b/sub/three) [0-9]* \"sub/three\"$" diff_out
+	'
+
+	test_expect_success "'ipfs files diff' accepts /ipfs/ paths" '
+		ipfs files diff /ipfs/$(ipfs files stat --hash /diff/a) /diff/b > diff_out2 &&
+		test_cmp diff_out diff_out2
+	'
+
+	test_expect_success "identical trees have no changes" '
+		ipfs files diff /diff/a /ipfs/$(ipfs files stat --hash /diff/a) > diff_out &&
+		test_must_be_empty diff_out
+	'
+
+	test_expect_success "'ipfs files diff' json output" '
+		ipfs files diff --enc=json /diff/a /diff/b > diff_json &&
+		grep "\"Type\":\"removed\"" diff_json &&
+		grep "\"Path\":\"sub/three\"" diff_json
+	'
+
+	test_expect_success "cleanup diff directories" '
+		ipfs files rm -r /diff
+	'
 }
 
 test_files_api() {
@@ -549,6 +763,10 @@ test_expect_success "can create some files for testing with raw-leaves" '
 '
 test_files_api QmTpKiKcAj4sbeesN6vrs5w3QeVmd4QmGpxRL81hHut4dZ
 
+test_snapshots
+test_symlinks
+test_files_diff
+
 test_launch_ipfs_daemon --offline
 
 ONLINE=1 # set online flag so tests can easily tell
@@ -562,10 +780,14 @@ test_expect_success "can create some files for testing with raw-leaves" '
 '
 test_files_api QmTpKiKcAj4sbeesN6vrs5w3QeVmd4QmGpxRL81hHut4dZ
 
+test_symlinks
+test_files_diff
+
 test_kill_ipfs_daemon --offline
 
 test_expect_success "enable sharding in config" '
-	ipfs config --json Experimental.ShardingEnabled true
+	ipfs config --json Experimental.ShardingEnabled true &&
+	ipfs config --json Experimental.ShardingThreshold 50
 '
 
 test_launch_ipfs_daemon --offline
@@ -27,49 +27,28 @@ test_expect_success "docker image build succeeds" '
 
 test_init_ipfs
 
-test_expect_success "make repo be version 4" '
-	echo 4 > "$IPFS_PATH/version"
-'
-
-test_expect_success "setup http response" '
-	echo "HTTP/1.1 200 OK" > vers_resp &&
-	echo "Content-Length: 7" >> vers_resp &&
-	echo "" >> vers_resp &&
-	echo "v1.1.1" >> vers_resp
-'
-
-pretend_server() {
-	cat vers_resp | nc -l -i 1 -p 17233
-}
-
-test_expect_success "startup fake dists server" '
-	pretend_server > dist_serv_out &
-	echo $! > netcat_pid
+test_expect_success "make repo be version 5" '
+	rm "$IPFS_PATH/datastore_spec" &&
+	echo 5 > "$IPFS_PATH/version"
 '
 
 test_expect_success "docker image runs" '
-	DOC_ID=$(docker run -d -v "$IPFS_PATH":/data/ipfs --net=host -e IPFS_DIST_PATH="http://localhost:17233" "$IMAGE_ID" --migrate)
+	DOC_ID=$(docker run -d -v "$IPFS_PATH":/data/ipfs --net=host "$IMAGE_ID" --migrate)
 '
 
-test_expect_success "docker container tries to pull migrations from netcat" '
+test_expect_success "docker container migrates the repo" '
 	sleep 4 &&
-	cat dist_serv_out
-'
-
-test_expect_success "see logs" '
-	docker logs $DOC_ID
+	docker logs $DOC_ID > docker_logs &&
+	grep "Success: fs-repo has been migrated to version 6." docker_logs > /dev/null
 '
 
 test_expect_success "stop docker container" '
 	docker_stop "$DOC_ID"
 '
 
-test_expect_success "kill the net cat" '
-	kill $(cat netcat_pid) || true
-'
-
-test_expect_success "correct version was requested" '
-	grep "/fs-repo-migrations/v1.1.1/fs-repo-migrations_v1.1.1_linux-musl-amd64.tar.gz" dist_serv_out > /dev/null
+test_expect_success "repo has the new version" '
+	echo 6 > version_exp &&
+	test_cmp version_exp "$IPFS_PATH/version"
 '
 
 test_done
@@ -0,0 +1,256 @@
+package datastore2
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+)
+
+// ErrCorruptValue is returned when a value of an encrypted datastore doesn't
+// decrypt, because it was corrupted, moved to another key, or encrypted
+// with a key the datastore doesn't have.
+var ErrCorruptValue = errors.New("encrypted value is corrupt or encrypted with an unknown key")
+
+// encryptedVersion starts the encrypted values, followed by the id of the
+// key, the nonce and the sealed value.
+const encryptedVersion = 1
+
+const keyIDLen = 8
+
+// EncryptionKey is an AES-256 key encrypting the values of a datastore.
+type EncryptionKey struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+// NewEncryptionKey derives an encryption key from secret, which must be
+// kept secret and have enough entropy, like a private key.
+func NewEncryptionKey(secret []byte) (*EncryptionKey, error) {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("ipfs datastore encryption"))
+	key := mac.Sum(nil)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	id := sha256.Sum256(key)
+	return &EncryptionKey{id: id[:keyIDLen], aead: aead}, nil
+}
+
+// EncryptedDatastore encrypts the values of its child datastore with
+// AES-GCM. The keys are left as is, so that Has, Delete and the queries for
+// keys only are as fast as the ones of the child. The values are
+// authenticated along with their key, so that a value moved to another key
+// doesn't decrypt.
+type EncryptedDatastore struct {
+	child ds.Datastore
+	keys  []*EncryptionKey
+}
+
+var _ ds.Batching = (*EncryptedDatastore)(nil)
+
+// Encrypt wraps child, encrypting the values it writes with the first of
+// keys. The values encrypted with any of keys are read, so that the keys
+// can be rotated.
+func Encrypt(child ds.Datastore, keys ...*EncryptionKey) (*EncryptedDatastore, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("encrypted datastores need a key")
+	}
+	return &EncryptedDatastore{child: child, keys: keys}, nil
+}
+
+func (d *EncryptedDatastore) encrypt(key ds.Key, value interface{}) ([]byte, error) {
+	b, ok := value.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("encrypted datastores only store byte slices, not %T", value)
+	}
+
+	k := d.keys[0]
+	hdr := make([]byte, 1+keyIDLen+k.aead.NonceSize())
+	hdr[0] = encryptedVersion
+	copy(hdr[1:], k.id)
+	nonce := hdr[1+keyIDLen:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(hdr, nonce, b, key.Bytes()), nil
+}
+
+func (d *EncryptedDatastore) decrypt(key ds.Key, value interface{}) ([]byte, *EncryptionKey, error) {
+	b, ok := value.([]byte)
+	if !ok || len(b) < 1+keyIDLen || b[0] != encryptedVersion {
+		return nil, nil, ErrCorruptValue
+	}
+
+	for _, k := range d.keys {
+		if !bytes.Equal(b[1:1+keyIDLen], k.id) {
+			continue
+		}
+		if len(b) < 1+keyIDLen+k.aead.NonceSize() {
+			return nil, nil, ErrCorruptValue
+		}
+		nonce := b[1+keyIDLen : 1+keyIDLen+k.aead.NonceSize()]
+		out, err := k.aead.Open(nil, nonce, b[1+keyIDLen+k.aead.NonceSize():], key.Bytes())
+		if err != nil {
+			return nil, nil, ErrCorruptValue
+		}
+		return out, k, nil
+	}
+	return nil, nil, ErrCorruptValue
+}
+
+func (d *EncryptedDatastore) Put(key ds.Key, value interface{}) error {
+	b, err := d.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return d.child.Put(key, b)
+}
+
+func (d *EncryptedDatastore) Get(key ds.Key) (interface{}, error) {
+	v, err := d.child.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	b, _, err := d.decrypt(key, v)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (d *EncryptedDatastore) Has(key ds.Key) (bool, error) {
+	return d.child.Has(key)
+}
+
+func (d *EncryptedDatastore) Delete(key ds.Key) error {
+	return d.child.Delete(key)
+}
+
+func (d *EncryptedDatastore) Query(q dsq.Query) (dsq.Results, error) {
+	if q.KeysOnly && len(q.Filters) == 0 && len(q.Orders) == 0 {
+		return d.child.Query(q)
+	}
+
+	// the filters and orders may look at the values, they are applied once
+	// these are decrypted
+	naive := len(q.Filters) > 0 || len(q.Orders) > 0
+	cq := dsq.Query{Prefix: q.Prefix, KeysOnly: q.KeysOnly}
+	if !naive {
+		cq.Limit, cq.Offset = q.Limit, q.Offset
+	}
+	res, err := d.child.Query(cq)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := dsq.ResultsWithProcess(cq, func(worker goprocess.Process, out chan<- dsq.Result) {
+		defer res.Close()
+		for r := range res.Next() {
+			if r.Error == nil && !cq.KeysOnly {
+				r.Value, _, r.Error = d.decrypt(ds.RawKey(r.Key), r.Value)
+				if r.Error != nil {
+					r.Error = fmt.Errorf("%s: %s", r.Key, r.Error)
+				}
+			}
+			select {
+			case out <- r:
+			case <-worker.Closing():
+				return
+			}
+		}
+	})
+	if naive {
+		return dsq.NaiveQueryApply(q, decrypted), nil
+	}
+	return decrypted, nil
+}
+
+func (d *EncryptedDatastore) Batch() (ds.Batch, error) {
+	bds, ok := d.child.(ds.Batching)
+	if !ok {
+		return ds.NewBasicBatch(d), nil
+	}
+	b, err := bds.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedBatch{d: d, child: b}, nil
+}
+
+// Close closes the child datastore, when it can be.
+func (d *EncryptedDatastore) Close() error {
+	if c, ok := d.child.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Reencrypt encrypts the values which aren't encrypted with the first key
+// with it, so that the other keys can be dropped. It returns the number of
+// values encrypted again, and fails on the first value which doesn't
+// decrypt.
+func (d *EncryptedDatastore) Reencrypt() (int, error) {
+	res, err := d.child.Query(dsq.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	var n int
+	for r := range res.Next() {
+		if r.Error != nil {
+			return n, r.Error
+		}
+		key := ds.RawKey(r.Key)
+		b, k, err := d.decrypt(key, r.Value)
+		if err != nil {
+			return n, fmt.Errorf("%s: %s", key, err)
+		}
+		if k == d.keys[0] {
+			continue
+		}
+		if err := d.Put(key, b); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+type encryptedBatch struct {
+	d     *EncryptedDatastore
+	child ds.Batch
+}
+
+func (b *encryptedBatch) Put(key ds.Key, value interface{}) error {
+	v, err := b.d.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	return b.child.Put(key, v)
+}
+
+func (b *encryptedBatch) Delete(key ds.Key) error {
+	return b.child.Delete(key)
+}
+
+func (b *encryptedBatch) Commit() error {
+	return b.child.Commit()
+}
@@ -0,0 +1,167 @@
+package datastore2
+
+import (
+	"bytes"
+	"testing"
+
+	ds "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore"
+	dsq "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/query"
+	dssync "gx/ipfs/QmVSase1JP7cq9QkPT46oNwdp9pT6kBkG3oqS14y3QcZjG/go-datastore/sync"
+)
+
+func testKey(t *testing.T, secret string) *EncryptionKey {
+	k, err := NewEncryptionKey([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func testEncrypted(t *testing.T, child ds.Datastore, keys ...*EncryptionKey) *EncryptedDatastore {
+	d, err := Encrypt(child, keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func expectValue(t *testing.T, d ds.Datastore, k string, value []byte) {
+	v, err := d.Get(ds.NewKey(k))
+	if err != nil {
+		t.Fatalf("%s: %s", k, err)
+	}
+	if !bytes.Equal(v.([]byte), value) {
+		t.Fatalf("%s: expected %q, got %q", k, value, v)
+	}
+}
+
+func TestEncryptedDatastore(t *testing.T) {
+	child := dssync.MutexWrap(ds.NewMapDatastore())
+	d := testEncrypted(t, child, testKey(t, "secret"))
+
+	value := []byte("confidential")
+	if err := d.Put(ds.NewKey("/a"), value); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(ds.NewKey("/b"), value); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []string{"/a", "/b"} {
+		raw, err := child.Get(ds.NewKey(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(raw.([]byte), value) {
+			t.Fatalf("%s is stored in plaintext", k)
+		}
+		expectValue(t, d, k, value)
+
+		has, err := d.Has(ds.NewKey(k))
+		if err != nil || !has {
+			t.Fatalf("expected %s to exist: %v", k, err)
+		}
+	}
+
+	res, err := d.Query(dsq.Query{Prefix: "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if !bytes.Equal(e.Value.([]byte), value) {
+			t.Fatalf("%s: query returned %q", e.Key, e.Value)
+		}
+	}
+
+	if err := d.Put(ds.NewKey("/c"), "not bytes"); err == nil {
+		t.Fatal("expected an error storing a string")
+	}
+}
+
+func TestEncryptedKeyRotation(t *testing.T) {
+	child := dssync.MutexWrap(ds.NewMapDatastore())
+	oldKey, newKey := testKey(t, "old"), testKey(t, "new")
+
+	old := testEncrypted(t, child, oldKey)
+	if err := old.Put(ds.NewKey("/old"), []byte("old value")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new key encrypts, the old one still decrypts
+	rotated := testEncrypted(t, child, newKey, oldKey)
+	if err := rotated.Put(ds.NewKey("/new"), []byte("new value")); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, rotated, "/old", []byte("old value"))
+	expectValue(t, rotated, "/new", []byte("new value"))
+
+	if _, err := old.Get(ds.NewKey("/new")); err != ErrCorruptValue {
+		t.Fatalf("expected the old key not to decrypt the new values, got %v", err)
+	}
+
+	n, err := rotated.Reencrypt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 value to be encrypted again, got %d", n)
+	}
+
+	// the old key can then be dropped
+	dropped := testEncrypted(t, child, newKey)
+	expectValue(t, dropped, "/old", []byte("old value"))
+	expectValue(t, dropped, "/new", []byte("new value"))
+}
+
+func TestEncryptedCorruption(t *testing.T) {
+	child := dssync.MutexWrap(ds.NewMapDatastore())
+	d := testEncrypted(t, child, testKey(t, "secret"))
+	if err := d.Put(ds.NewKey("/a"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := child.Get(ds.NewKey("/a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := raw.([]byte)
+
+	corrupt := func(name string, v []byte) {
+		if err := child.Put(ds.NewKey("/corrupt"), v); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(ds.NewKey("/corrupt")); err != ErrCorruptValue {
+			t.Fatalf("%s: expected %v, got %v", name, ErrCorruptValue, err)
+		}
+	}
+
+	flipped := append([]byte{}, b...)
+	flipped[len(flipped)-1] ^= 1
+	corrupt("flipped bit", flipped)
+	corrupt("truncated", b[:len(b)-4])
+	corrupt("header only", b[:5])
+	corrupt("plaintext", []byte("value"))
+	// the value is bound to its key
+	corrupt("moved value", b)
+
+	if _, err := testEncrypted(t, child, testKey(t, "other")).Get(ds.NewKey("/a")); err != ErrCorruptValue {
+		t.Fatalf("expected an unknown key to fail, got %v", err)
+	}
+	if _, err := d.Reencrypt(); err == nil {
+		t.Fatal("expected reencrypting a corrupt datastore to fail")
+	}
+}
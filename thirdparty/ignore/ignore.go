@@ -0,0 +1,290 @@
+// Package ignore matches paths against patterns following the rules of
+// gitignore files.
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile is the name of the files listing the patterns of the paths to
+// ignore in the directory holding them.
+const IgnoreFile = ".ipfsignore"
+
+// maxIgnoreFileSize is the size above which ignore files are rejected.
+const maxIgnoreFileSize = 1 << 20
+
+type pattern struct {
+	// dir is the directory the pattern is relative to, "" for the root
+	dir     string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+func (p *pattern) match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.dir != "" {
+		if !strings.HasPrefix(name, p.dir+"/") {
+			return false
+		}
+		name = name[len(p.dir)+1:]
+	}
+	return p.re.MatchString(name)
+}
+
+// Matcher decides which paths of a tree are ignored. Paths are slash
+// separated and relative to the root of the tree. As in gitignore files,
+// the last pattern matching a path decides whether it's ignored, and
+// patterns starting with '!' re-include the paths they match.
+//
+// A nil Matcher ignores nothing.
+type Matcher struct {
+	patterns []*pattern
+	include  []*pattern
+}
+
+// New returns a Matcher ignoring the paths matched by the exclude patterns,
+// except for those matched by the include patterns. The include patterns
+// take precedence over all the others, including the ones of the ignore
+// files added later on.
+func New(exclude, include []string) (*Matcher, error) {
+	m := new(Matcher)
+	for _, s := range exclude {
+		if err := m.add(&m.patterns, "", s); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range include {
+		if err := m.add(&m.include, "", s); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// SplitPatterns splits a comma separated list of patterns, as given on the
+// command line.
+func SplitPatterns(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (m *Matcher) add(to *[]*pattern, dir, line string) error {
+	p, err := parsePattern(dir, line)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		*to = append(*to, p)
+	}
+	return nil
+}
+
+// WithIgnoreFile returns a copy of m also ignoring the paths matched by the
+// patterns read from r, the ignore file of the directory dir.
+func (m *Matcher) WithIgnoreFile(dir string, r io.Reader) (*Matcher, error) {
+	out := new(Matcher)
+	if m != nil {
+		out.patterns = append(out.patterns, m.patterns...)
+		out.include = m.include
+	}
+
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	s := bufio.NewScanner(io.LimitReader(r, maxIgnoreFileSize))
+	for s.Scan() {
+		if err := out.add(&out.patterns, dir, s.Text()); err != nil {
+			return nil, fmt.Errorf("%s: %s", path.Join(dir, IgnoreFile), err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Ignored returns whether the file or directory at name is ignored. The
+// directories leading to name are not checked, callers walking a tree are
+// expected not to enter the ignored ones.
+func (m *Matcher) Ignored(name string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return false
+	}
+
+	for i := len(m.include) - 1; i >= 0; i-- {
+		if m.include[i].match(name, isDir) {
+			return false
+		}
+	}
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		if p := m.patterns[i]; p.match(name, isDir) {
+			return !p.negate
+		}
+	}
+	return false
+}
+
+// IgnoredPath returns whether the file or directory at name is ignored in
+// the tree rooted at root on the local filesystem. Unlike Ignored, it reads
+// the ignore files of the directories leading to name, and name is ignored
+// if any of these directories is.
+func (m *Matcher) IgnoredPath(root, name string, isDir bool) (bool, error) {
+	rel, err := filepath.Rel(root, name)
+	if err != nil {
+		return false, err
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return false, nil
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return false, fmt.Errorf("%s is not in %s", name, root)
+	}
+
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		dir := strings.Join(parts[:i], "/")
+		m, err = m.withDirIgnoreFile(filepath.Join(root, filepath.FromSlash(dir)), dir)
+		if err != nil {
+			return false, err
+		}
+
+		last := i == len(parts)-1
+		if m.Ignored(strings.Join(parts[:i+1], "/"), isDir || !last) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// withDirIgnoreFile adds the patterns of the ignore file in the directory
+// at osPath, named dir in the tree, if there is one.
+func (m *Matcher) withDirIgnoreFile(osPath, dir string) (*Matcher, error) {
+	f, err := os.Open(filepath.Join(osPath, IgnoreFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return m.WithIgnoreFile(dir, f)
+}
+
+// parsePattern parses a line of an ignore file, relative to dir. It returns
+// nil for blank lines and comments.
+func parsePattern(dir, line string) (*pattern, error) {
+	// trailing spaces are ignored unless escaped
+	trimmed := strings.TrimRight(line, " \t\r")
+	if strings.HasSuffix(trimmed, "\\") && len(trimmed) < len(line) {
+		trimmed += " "
+	}
+	line = trimmed
+
+	if line == "" || line[0] == '#' {
+		return nil, nil
+	}
+
+	p := &pattern{dir: dir}
+	if line[0] == '!' {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil, nil
+	}
+
+	// patterns with a slash other than a trailing one are relative to dir,
+	// the others match names at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %s", line, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+// globToRegexp translates a glob to a regular expression. '*' and '?' don't
+// match slashes, while '**' matches any number of directories.
+func globToRegexp(glob string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		atStart := i == 0 || glob[i-1] == '/'
+
+		switch {
+		case atStart && strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case atStart && glob[i:] == "**":
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == 0 {
+				// a leading ']' is part of the class
+				if next := strings.IndexByte(glob[i+2:], ']'); next >= 0 {
+					end = next + 1
+				} else {
+					end = -1
+				}
+			}
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+
+			class := glob[i+1 : i+1+end]
+			if class[0] == '!' {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.Replace(class, "\\", "\\\\", -1) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,168 @@
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatterns(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		isDir   bool
+		ignored bool
+	}{
+		{"*.log", "a.log", false, true},
+		{"*.log", "dir/sub/a.log", false, true},
+		{"*.log", "a.logs", false, false},
+		{"a?c", "abc", false, true},
+		{"a?c", "a/c", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"/build", "build", false, true},
+		{"/build", "src/build", false, false},
+		{"doc/*.txt", "doc/a.txt", false, true},
+		{"doc/*.txt", "doc/sub/a.txt", false, false},
+		{"doc/*.txt", "x/doc/a.txt", false, false},
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"foo/**", "foo/a/b", false, true},
+		{"foo/**", "foo", true, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "a/xb", false, false},
+		{"[abc].txt", "b.txt", false, true},
+		{"[!abc].txt", "b.txt", false, false},
+		{"[!abc].txt", "d.txt", false, true},
+		{"[a-c]*", "cat", false, true},
+		{"\\#notcomment", "#notcomment", false, true},
+		{"\\!bang", "!bang", false, true},
+		{"# comment", "# comment", false, false},
+		{"a\\*", "a*", false, true},
+		{"a\\*", "ab", false, false},
+		{"trailing   ", "trailing", false, true},
+		{"space\\ ", "space ", false, true},
+		{"foo.c", "foo.c", false, true},
+		{"foo.c", "fooxc", false, false},
+	}
+
+	for _, c := range cases {
+		m, err := New([]string{c.pattern}, nil)
+		if err != nil {
+			t.Fatalf("%q: %s", c.pattern, err)
+		}
+		if got := m.Ignored(c.name, c.isDir); got != c.ignored {
+			t.Errorf("%q on %q (dir: %t): expected %t, got %t", c.pattern, c.name, c.isDir, c.ignored, got)
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	m, err := New([]string{"*.log", "!keep.log"}, []string{"important.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = m.WithIgnoreFile("sub", strings.NewReader("# temporary files\n*.tmp\n\n!other.log\n/top.txt\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"a.log":             true,
+		"keep.log":          false,
+		"sub/a.log":         true,
+		"sub/other.log":     false,
+		"other.log":         true,
+		"a.tmp":             false,
+		"sub/a.tmp":         true,
+		"sub/x/a.tmp":       true,
+		"sub/important.tmp": false,
+		"sub/top.txt":       true,
+		"sub/x/top.txt":     false,
+		"top.txt":           false,
+	}
+	for name, ignored := range cases {
+		if got := m.Ignored(name, false); got != ignored {
+			t.Errorf("%s: expected %t, got %t", name, ignored, got)
+		}
+	}
+
+	var nilm *Matcher
+	if nilm.Ignored("a.log", false) {
+		t.Fatal("a nil matcher shouldn't ignore anything")
+	}
+}
+
+func TestBadPattern(t *testing.T) {
+	if _, err := New([]string{"[!]"}, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSplitPatterns(t *testing.T) {
+	got := SplitPatterns("*.swp,,build/,")
+	if strings.Join(got, "|") != "*.swp|build/" {
+		t.Fatalf("unexpected patterns: %q", got)
+	}
+	if SplitPatterns("") != nil {
+		t.Fatal("expected no patterns")
+	}
+}
+
+func TestIgnoredPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "ignore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	write := func(name, data string) {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(IgnoreFile, "node_modules/\n*.o\n")
+	write("src/"+IgnoreFile, "!keep.o\ngen/\n")
+	write("src/gen/a.c", "")
+	write("src/keep.o", "")
+	write("src/a.o", "")
+	write("src/a.c", "")
+	write("node_modules/x/y.js", "")
+
+	m, err := New([]string{"*.bak"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"src/a.c":             false,
+		"src/a.o":             true,
+		"src/keep.o":          false,
+		"src/gen/a.c":         true,
+		"node_modules/x/y.js": true,
+		"src/old.bak":         true,
+		"other.o":             true,
+	}
+	for name, ignored := range cases {
+		got, err := m.IgnoredPath(root, filepath.Join(root, filepath.FromSlash(name)), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != ignored {
+			t.Errorf("%s: expected %t, got %t", name, ignored, got)
+		}
+	}
+
+	if _, err := m.IgnoredPath(root, filepath.Dir(root), true); err == nil {
+		t.Fatal("expected an error for a path outside of the root")
+	}
+}
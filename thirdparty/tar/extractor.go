@@ -8,11 +8,28 @@ import (
 	gopath "path"
 	fp "path/filepath"
 	"strings"
+	"time"
 )
 
 type Extractor struct {
 	Path     string
 	Progress func(int64) int64
+
+	// SpecialBits keeps the setuid, setgid and sticky bits of the archive,
+	// which are dropped otherwise: the archive may come from anyone.
+	SpecialBits bool
+
+	// directories whose attributes are set once their content is extracted
+	dirs []*tar.Header
+
+	// symlinks, created once everything else is extracted so that no entry
+	// is written through them
+	links []pendingLink
+}
+
+type pendingLink struct {
+	h     *tar.Header
+	depth int
 }
 
 func (te *Extractor) Extract(reader io.Reader) error {
@@ -41,9 +58,15 @@ func (te *Extractor) Extract(reader io.Reader) error {
 			break
 		}
 
+		if i != 0 {
+			if err := te.checkPath(te.outputPath(header.Name)); err != nil {
+				return err
+			}
+		}
+
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if err := te.extractDir(header, i); err != nil {
+			if err := te.extractDir(header, i, rootExists); err != nil {
 				return err
 			}
 		case tar.TypeReg:
@@ -51,13 +74,26 @@ func (te *Extractor) Extract(reader io.Reader) error {
 				return err
 			}
 		case tar.TypeSymlink:
-			if err := te.extractSymlink(header); err != nil {
-				return err
-			}
+			te.links = append(te.links, pendingLink{header, i})
 		default:
 			return fmt.Errorf("unrecognized tar header type: %d", header.Typeflag)
 		}
 	}
+
+	for _, l := range te.links {
+		if err := te.extractSymlink(l.h, l.depth, rootExists, rootIsDir); err != nil {
+			return err
+		}
+	}
+
+	// children come after their parent, so set the attributes of the
+	// deepest directories first: a read-only directory can't be written to
+	for i := len(te.dirs) - 1; i >= 0; i-- {
+		h := te.dirs[i]
+		if err := te.setAttrs(te.outputPath(h.Name), h); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -71,7 +107,48 @@ func (te *Extractor) outputPath(tarPath string) string {
 	return path
 }
 
-func (te *Extractor) extractDir(h *tar.Header, depth int) error {
+// checkPath returns an error when path, the output path of an entry, isn't
+// inside the output directory, as for entries named with "..".
+func (te *Extractor) checkPath(path string) error {
+	rel, err := fp.Rel(te.Path, path)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(fp.Separator)) {
+		return fmt.Errorf("%s is outside of the output directory %s", path, te.Path)
+	}
+	return nil
+}
+
+// checkParent returns an error when the parent directory of path, once its
+// symlinks are resolved, isn't inside the output directory, so that nothing
+// is written through a symlink leaving it.
+func (te *Extractor) checkParent(path string) error {
+	root, err := fp.EvalSymlinks(te.Path)
+	if err != nil {
+		return err
+	}
+
+	parent, err := fp.EvalSymlinks(fp.Dir(path))
+	if os.IsNotExist(err) {
+		// creating the entry will fail
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rel, err := fp.Rel(root, parent)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(fp.Separator)) {
+		return fmt.Errorf("%s is outside of the output directory %s", path, te.Path)
+	}
+	return nil
+}
+
+func (te *Extractor) extractDir(h *tar.Header, depth int, rootExists bool) error {
 	path := te.outputPath(h.Name)
 
 	if depth == 0 {
@@ -79,14 +156,38 @@ func (te *Extractor) extractDir(h *tar.Header, depth int) error {
 		te.Path = path
 	}
 
+	// leave the attributes of a preexisting output directory alone
+	if hasAttrs(h) && (depth != 0 || !rootExists) {
+		te.dirs = append(te.dirs, h)
+	}
+
 	return os.MkdirAll(path, 0755)
 }
 
-func (te *Extractor) extractSymlink(h *tar.Header) error {
-	return os.Symlink(h.Linkname, te.outputPath(h.Name))
+// extractSymlink recreates the link as is: the target isn't resolved, so
+// relative and dangling links are kept. It is only called once all the
+// other entries are extracted, so that a link to a path outside of the
+// output directory can't be used to write there.
+func (te *Extractor) extractSymlink(h *tar.Header, depth int, rootExists bool, rootIsDir bool) error {
+	path := te.leafPath(h, depth, rootExists, rootIsDir)
+	if depth != 0 {
+		if err := te.checkParent(path); err != nil {
+			return err
+		}
+	}
+
+	// like files, replace whatever was there
+	if fi, err := os.Lstat(path); err == nil && !fi.IsDir() {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return os.Symlink(h.Linkname, path)
 }
 
-func (te *Extractor) extractFile(h *tar.Header, r *tar.Reader, depth int, rootExists bool, rootIsDir bool) error {
+// leafPath returns the output path of a file or symlink.
+func (te *Extractor) leafPath(h *tar.Header, depth int, rootExists bool, rootIsDir bool) string {
 	path := te.outputPath(h.Name)
 
 	if depth == 0 { // if depth is 0, this is the only file (we aren't 'ipfs get'ing a directory)
@@ -100,32 +201,100 @@ func (te *Extractor) extractFile(h *tar.Header, r *tar.Reader, depth int, rootEx
 			}
 		} // else if old file exists, just overwrite it.
 	}
+	return path
+}
 
-	file, err := os.Create(path)
+func (te *Extractor) extractFile(h *tar.Header, r *tar.Reader, depth int, rootExists bool, rootIsDir bool) error {
+	path := te.leafPath(h, depth, rootExists, rootIsDir)
+	if depth != 0 {
+		if err := te.checkParent(path); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fileMode(h).Perm())
+	if err != nil {
+		return err
+	}
+
+	err = copyWithProgress(file, r, te.Progress)
 	if err != nil {
+		file.Close()
 		return err
 	}
-	defer file.Close()
 
-	return copyWithProgress(file, r, te.Progress)
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return te.setAttrs(path, h)
+}
+
+// fileMode returns the mode to give to the file or directory of h.
+// Archives with no permissions at all get the defaults.
+func fileMode(h *tar.Header) os.FileMode {
+	mode := h.FileInfo().Mode()
+	if mode.Perm() == 0 {
+		if mode.IsDir() {
+			return mode | 0755
+		}
+		return mode | 0644
+	}
+	return mode
+}
+
+// specialBits are the mode bits only kept with Extractor.SpecialBits.
+const specialBits = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// hasAttrs tells whether h carries a mode or a modification time: ipfs get
+// sends a zero mode and the epoch for the ones unixfs doesn't record.
+func hasAttrs(h *tar.Header) bool {
+	return h.FileInfo().Mode().Perm() != 0 || hasModTime(h)
+}
+
+func hasModTime(h *tar.Header) bool {
+	return !h.ModTime.IsZero() && h.ModTime.Unix() != 0
+}
+
+// setAttrs applies the permissions and the modification time of h to path,
+// when h carries them.
+func (te *Extractor) setAttrs(path string, h *tar.Header) error {
+	if mode := h.FileInfo().Mode(); mode.Perm() != 0 {
+		keep := os.ModePerm
+		if te.SpecialBits {
+			keep |= specialBits
+		}
+
+		// files are created with their permissions, but an existing file
+		// keeps its own, and directories only get theirs once they're
+		// filled
+		if err := os.Chmod(path, mode&keep); err != nil {
+			return err
+		}
+	}
+
+	if !hasModTime(h) {
+		return nil
+	}
+	return os.Chtimes(path, time.Now(), h.ModTime)
 }
 
 func copyWithProgress(to io.Writer, from io.Reader, cb func(int64) int64) error {
 	buf := make([]byte, 4096)
 	for {
 		n, err := from.Read(buf)
+		if n > 0 {
+			// readers may return data along with io.EOF
+			cb(int64(n))
+			if _, werr := to.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
 		if err != nil {
 			if err == io.EOF {
 				return nil
 			}
 			return err
 		}
-
-		cb(int64(n))
-		_, err = to.Write(buf[:n])
-		if err != nil {
-			return err
-		}
 	}
-
 }
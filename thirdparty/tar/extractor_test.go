@@ -0,0 +1,217 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	fp "path/filepath"
+	"testing"
+	"time"
+)
+
+type entry struct {
+	name     string
+	typ      byte
+	linkname string
+	data     string
+	mode     int64
+}
+
+func makeTar(t *testing.T, entries []entry) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	w := tar.NewWriter(buf)
+	for _, e := range entries {
+		h := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typ,
+			Linkname: e.linkname,
+			Mode:     0644,
+			Size:     int64(len(e.data)),
+		}
+		if e.typ == tar.TypeDir {
+			h.Mode = 0755
+		}
+		if e.mode != 0 {
+			h.Mode = e.mode
+		}
+		if err := w.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func testExtractEscape(t *testing.T, entries func(outside string) []entry) {
+	dir, err := ioutil.TempDir("", "extractor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outside := fp.Join(dir, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	te := &Extractor{Path: fp.Join(dir, "out"), Progress: func(n int64) int64 { return n }}
+	if err := te.Extract(makeTar(t, entries(outside))); err == nil {
+		t.Fatal("expected the extraction to fail")
+	}
+
+	names, err := ioutil.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("%s was written outside of the output directory", names[0].Name())
+	}
+}
+
+func TestExtractFileThroughSymlink(t *testing.T) {
+	testExtractEscape(t, func(outside string) []entry {
+		return []entry{
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/a", typ: tar.TypeSymlink, linkname: outside},
+			{name: "root/a/x", typ: tar.TypeReg, data: "x"},
+		}
+	})
+}
+
+func TestExtractSymlinkThroughSymlink(t *testing.T) {
+	testExtractEscape(t, func(outside string) []entry {
+		return []entry{
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/a", typ: tar.TypeSymlink, linkname: outside},
+			{name: "root/a/b", typ: tar.TypeSymlink, linkname: "x"},
+		}
+	})
+}
+
+func TestExtractDotDot(t *testing.T) {
+	testExtractEscape(t, func(outside string) []entry {
+		return []entry{
+			{name: "root", typ: tar.TypeDir},
+			{name: "root/../outside/x", typ: tar.TypeReg, data: "x"},
+		}
+	})
+}
+
+func TestExtractSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extractor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := fp.Join(dir, "out")
+	te := &Extractor{Path: out, Progress: func(n int64) int64 { return n }}
+	err = te.Extract(makeTar(t, []entry{
+		{name: "root", typ: tar.TypeDir},
+		{name: "root/link", typ: tar.TypeSymlink, linkname: "file"},
+		{name: "root/file", typ: tar.TypeReg, data: "hello"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.Readlink(fp.Join(out, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "file" {
+		t.Fatalf("expected the link to point to file, got %s", target)
+	}
+
+	b, err := ioutil.ReadFile(fp.Join(out, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Fatalf("unexpected content through the link: %q", b)
+	}
+}
+
+func TestExtractModeOverExistingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extractor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := fp.Join(dir, "out")
+	if err := ioutil.WriteFile(out, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	te := &Extractor{Path: out, Progress: func(n int64) int64 { return n }}
+	err = te.Extract(makeTar(t, []entry{
+		{name: "file", typ: tar.TypeReg, data: "hello", mode: 0755},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Fatalf("expected mode 0755, got %s", fi.Mode())
+	}
+}
+
+func TestExtractWithoutAttrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extractor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := fp.Join(dir, "out")
+	if err := ioutil.WriteFile(out, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// what ipfs get sends for a file with no recorded mode or mtime
+	buf := new(bytes.Buffer)
+	w := tar.NewWriter(buf)
+	err = w.WriteHeader(&tar.Header{
+		Name:     "file",
+		Typeflag: tar.TypeReg,
+		Size:     5,
+		ModTime:  time.Unix(0, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-time.Minute)
+	te := &Extractor{Path: out, Progress: func(n int64) int64 { return n }}
+	if err := te.Extract(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected the mode to be left alone, got %s", fi.Mode())
+	}
+	if fi.ModTime().Before(start) {
+		t.Fatalf("expected the modification time to be left alone, got %s", fi.ModTime())
+	}
+}
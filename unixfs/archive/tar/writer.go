@@ -25,19 +25,24 @@ type Writer struct {
 	TarW *tar.Writer
 
 	ctx context.Context
+
+	// archive is unset when the tar is only the transport of ipfs get, see
+	// withAttrs
+	archive bool
 }
 
 // NewWriter wraps given io.Writer.
 func NewWriter(ctx context.Context, dag mdag.DAGService, archive bool, compression int, w io.Writer) (*Writer, error) {
 	return &Writer{
-		Dag:  dag,
-		TarW: tar.NewWriter(w),
-		ctx:  ctx,
+		Dag:     dag,
+		TarW:    tar.NewWriter(w),
+		ctx:     ctx,
+		archive: archive,
 	}, nil
 }
 
-func (w *Writer) writeDir(nd *mdag.ProtoNode, fpath string) error {
-	if err := writeDirHeader(w.TarW, fpath); err != nil {
+func (w *Writer) writeDir(nd *mdag.ProtoNode, pb *upb.Data, fpath string) error {
+	if err := w.writeDirHeader(fpath, pb); err != nil {
 		return err
 	}
 
@@ -57,7 +62,7 @@ func (w *Writer) writeDir(nd *mdag.ProtoNode, fpath string) error {
 }
 
 func (w *Writer) writeFile(nd *mdag.ProtoNode, pb *upb.Data, fpath string) error {
-	if err := writeFileHeader(w.TarW, fpath, pb.GetFilesize()); err != nil {
+	if err := w.writeFileHeader(fpath, pb.GetFilesize(), pb); err != nil {
 		return err
 	}
 
@@ -81,7 +86,7 @@ func (w *Writer) WriteNode(nd node.Node, fpath string) error {
 		case upb.Data_Metadata:
 			fallthrough
 		case upb.Data_Directory:
-			return w.writeDir(nd, fpath)
+			return w.writeDir(nd, pb, fpath)
 		case upb.Data_Raw:
 			fallthrough
 		case upb.Data_File:
@@ -92,7 +97,7 @@ func (w *Writer) WriteNode(nd node.Node, fpath string) error {
 			return ft.ErrUnrecognizedType
 		}
 	case *mdag.RawNode:
-		if err := writeFileHeader(w.TarW, fpath, uint64(len(nd.RawData()))); err != nil {
+		if err := w.writeFileHeader(fpath, uint64(len(nd.RawData())), nil); err != nil {
 			return err
 		}
 
@@ -110,25 +115,45 @@ func (w *Writer) Close() error {
 	return w.TarW.Close()
 }
 
-func writeDirHeader(w *tar.Writer, fpath string) error {
-	return w.WriteHeader(&tar.Header{
+func (w *Writer) writeDirHeader(fpath string, pb *upb.Data) error {
+	return w.TarW.WriteHeader(w.withAttrs(&tar.Header{
 		Name:     fpath,
 		Typeflag: tar.TypeDir,
 		Mode:     0777,
 		ModTime:  time.Now(),
-		// TODO: set mode, dates, etc. when added to unixFS
-	})
+	}, pb))
 }
 
-func writeFileHeader(w *tar.Writer, fpath string, size uint64) error {
-	return w.WriteHeader(&tar.Header{
+func (w *Writer) writeFileHeader(fpath string, size uint64, pb *upb.Data) error {
+	return w.TarW.WriteHeader(w.withAttrs(&tar.Header{
 		Name:     fpath,
 		Size:     int64(size),
 		Typeflag: tar.TypeReg,
 		Mode:     0644,
 		ModTime:  time.Now(),
-		// TODO: set mode, dates, etc. when added to unixFS
-	})
+	}, pb))
+}
+
+// withAttrs sets the mode and modification time recorded in pb, if any, on
+// the header. Unless writing an archive, the ones not recorded are cleared
+// instead, a zero mode and the epoch, so that the extractor of ipfs get
+// leaves them alone.
+func (w *Writer) withAttrs(h *tar.Header, pb *upb.Data) *tar.Header {
+	if !w.archive {
+		h.Mode = 0
+		h.ModTime = time.Unix(0, 0)
+	}
+	if pb == nil {
+		return h
+	}
+
+	if mode, ok := ft.Mode(pb); ok {
+		h.Mode = int64(ft.ModeFromOS(mode))
+	}
+	if mtime, ok := ft.ModTime(pb); ok {
+		h.ModTime = mtime
+	}
+	return h
 }
 
 func writeSymlinkHeader(w *tar.Writer, target, fpath string) error {
@@ -137,5 +162,6 @@ func writeSymlinkHeader(w *tar.Writer, target, fpath string) error {
 		Linkname: target,
 		Mode:     0777,
 		Typeflag: tar.TypeSymlink,
+		ModTime:  time.Now(),
 	})
 }
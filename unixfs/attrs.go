@@ -0,0 +1,140 @@
+package unixfs
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	dag "github.com/scroot/go-ipfs/merkledag"
+	pb "github.com/scroot/go-ipfs/unixfs/pb"
+
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
+	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+)
+
+// unix permission bits stored in the mode field
+const (
+	modeSetuid = 04000
+	modeSetgid = 02000
+	modeSticky = 01000
+	modePerm   = 0777
+)
+
+// ModeFromOS converts the permission bits of an os.FileMode to the unix
+// mode bits stored in unixfs nodes.
+func ModeFromOS(m os.FileMode) uint32 {
+	out := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		out |= modeSetuid
+	}
+	if m&os.ModeSetgid != 0 {
+		out |= modeSetgid
+	}
+	if m&os.ModeSticky != 0 {
+		out |= modeSticky
+	}
+	return out
+}
+
+// ModeToOS converts unix mode bits stored in unixfs nodes to an os.FileMode.
+func ModeToOS(m uint32) os.FileMode {
+	out := os.FileMode(m & modePerm)
+	if m&modeSetuid != 0 {
+		out |= os.ModeSetuid
+	}
+	if m&modeSetgid != 0 {
+		out |= os.ModeSetgid
+	}
+	if m&modeSticky != 0 {
+		out |= os.ModeSticky
+	}
+	return out
+}
+
+// Mode returns the permissions recorded in d, if any.
+func Mode(d *pb.Data) (os.FileMode, bool) {
+	if d.Mode == nil {
+		return 0, false
+	}
+	return ModeToOS(d.GetMode()), true
+}
+
+// ModTime returns the modification time recorded in d, if any.
+func ModTime(d *pb.Data) (time.Time, bool) {
+	mt := d.GetMtime()
+	if mt == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(mt.GetSeconds(), int64(mt.GetFractionalNanoseconds())), true
+}
+
+// SetMode records the permissions of m in d.
+func SetMode(d *pb.Data, m os.FileMode) {
+	d.Mode = proto.Uint32(ModeFromOS(m))
+}
+
+// SetModTime records t as the modification time in d.
+func SetModTime(d *pb.Data, t time.Time) {
+	d.Mtime = &pb.UnixTime{
+		Seconds: proto.Int64(t.Unix()),
+	}
+	if ns := t.Nanosecond(); ns != 0 {
+		d.Mtime.FractionalNanoseconds = proto.Uint32(uint32(ns))
+	}
+}
+
+// ErrNoAttrs is returned when setting attributes on a node which can't
+// carry them.
+var ErrNoAttrs = errors.New("node can't carry unix attributes")
+
+// WithAttrs returns a copy of the unixfs node nd, recording the given mode
+// and modification time. A nil mode or time is left unchanged. Raw leaves
+// can't carry attributes, so they are wrapped in a file node, using the
+// default CID prefix.
+func WithAttrs(nd node.Node, mode *os.FileMode, mtime *time.Time) (*dag.ProtoNode, error) {
+	var out *dag.ProtoNode
+	var d *pb.Data
+
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		var err error
+		d, err = FromBytes(nd.Data())
+		if err != nil {
+			return nil, err
+		}
+
+		out = nd.Copy().(*dag.ProtoNode)
+	case *dag.RawNode:
+		size := uint64(len(nd.RawData()))
+
+		typ := pb.Data_File
+		d = &pb.Data{
+			Type:       &typ,
+			Filesize:   proto.Uint64(size),
+			Blocksizes: []uint64{size},
+		}
+
+		out = new(dag.ProtoNode)
+		err := out.AddNodeLinkClean("", nd)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrNoAttrs
+	}
+
+	if mode != nil {
+		SetMode(d, *mode)
+	}
+	if mtime != nil {
+		SetModTime(d, *mtime)
+	}
+
+	b, err := proto.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+
+	out.SetData(b)
+	return out, nil
+}
@@ -0,0 +1,87 @@
+package unixfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	dag "github.com/scroot/go-ipfs/merkledag"
+)
+
+func TestModeConversion(t *testing.T) {
+	for _, m := range []os.FileMode{0644, 0755, 0700 | os.ModeSetuid, 0775 | os.ModeSetgid, 0777 | os.ModeSticky} {
+		if out := ModeToOS(ModeFromOS(m)); out != m {
+			t.Fatalf("mode %s came back as %s", m, out)
+		}
+	}
+
+	if ModeFromOS(0755|os.ModeSetuid|os.ModeDir) != 04755 {
+		t.Fatal("wrong unix mode bits")
+	}
+}
+
+func TestAttrsRoundTrip(t *testing.T) {
+	mode := os.FileMode(0750)
+	mtime := time.Unix(1483326245, 123456789)
+
+	nd, err := WithAttrs(dag.NodeWithData(FilePBData([]byte("hello"), 5)), &mode, &mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// attributes survive re-encoding
+	fsn, err := FSNodeFromBytes(nd.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fsn.GetBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := FromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, ok := Mode(d)
+	if !ok || m != mode {
+		t.Fatalf("expected mode %s, got %s", mode, m)
+	}
+	mt, ok := ModTime(d)
+	if !ok || !mt.Equal(mtime) {
+		t.Fatalf("expected mtime %s, got %s", mtime, mt)
+	}
+	if string(d.GetData()) != "hello" || d.GetFilesize() != 5 {
+		t.Fatal("file content changed")
+	}
+}
+
+func TestAttrsOnRawNode(t *testing.T) {
+	raw := dag.NewRawNode([]byte("raw leaf"))
+	mtime := time.Unix(1483326245, 0)
+
+	nd, err := WithAttrs(raw, nil, &mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nd.Links()) != 1 || !nd.Links()[0].Cid.Equals(raw.Cid()) {
+		t.Fatal("raw node should be linked from its wrapper")
+	}
+
+	d, err := FromBytes(nd.Data())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.GetType() != TFile || d.GetFilesize() != uint64(len(raw.RawData())) {
+		t.Fatal("wrapper is not a file of the right size")
+	}
+	if _, ok := Mode(d); ok {
+		t.Fatal("no mode should have been recorded")
+	}
+	if mt, ok := ModTime(d); !ok || !mt.Equal(mtime) {
+		t.Fatalf("expected mtime %s, got %s", mtime, mt)
+	}
+}
@@ -0,0 +1,317 @@
+// Package diff compares unixfs trees file by file.
+package diff
+
+import (
+	"context"
+	"fmt"
+	gopath "path"
+	"sort"
+
+	dag "github.com/scroot/go-ipfs/merkledag"
+	ft "github.com/scroot/go-ipfs/unixfs"
+	hamt "github.com/scroot/go-ipfs/unixfs/hamt"
+	uio "github.com/scroot/go-ipfs/unixfs/io"
+	pb "github.com/scroot/go-ipfs/unixfs/pb"
+
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// ChangeType is the kind of a Change.
+type ChangeType int
+
+const (
+	Added ChangeType = iota
+	Removed
+	Modified
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	default:
+		return fmt.Sprintf("ChangeType(%d)", int(t))
+	}
+}
+
+// Change is a path added, removed or modified between two trees. Sizes are
+// the cumulative sizes of the DAGs, Before is nil for added paths and After
+// for removed ones.
+type Change struct {
+	Type       ChangeType
+	Path       string
+	Before     *cid.Cid `json:",omitempty"`
+	After      *cid.Cid `json:",omitempty"`
+	BeforeSize uint64   `json:",omitempty"`
+	AfterSize  uint64   `json:",omitempty"`
+}
+
+// Diff calls f with the changes turning the unixfs tree a into b, as it
+// finds them. Directories, sharded or not, are compared entry by entry,
+// and the subtrees which didn't change, having the same CIDs on both
+// sides, are skipped. Added and removed directories are reported as a
+// single change, without listing their content. Entries of plain
+// directories come in name order, the ones of sharded directories in the
+// order of their hashes.
+func Diff(ctx context.Context, ds dag.DAGService, a, b node.Node, f func(*Change) error) error {
+	if a.Cid().Equals(b.Cid()) {
+		return nil
+	}
+
+	as, err := a.Size()
+	if err != nil {
+		return err
+	}
+	bs, err := b.Size()
+	if err != nil {
+		return err
+	}
+
+	d := &differ{ctx: ctx, ds: ds, f: f}
+	return d.diffNodes("", a, b, as, bs)
+}
+
+type differ struct {
+	ctx context.Context
+	ds  dag.DAGService
+	f   func(*Change) error
+}
+
+// diffNodes compares the different nodes a and b found at path.
+func (d *differ) diffNodes(path string, a, b node.Node, as, bs uint64) error {
+	da, ok := dirData(a)
+	if !ok {
+		return d.modified(path, a.Cid(), b.Cid(), as, bs)
+	}
+	db, ok := dirData(b)
+	if !ok {
+		return d.modified(path, a.Cid(), b.Cid(), as, bs)
+	}
+
+	// shards built the same way put an entry at the same place, which
+	// allows skipping the unchanged parts of the trie
+	if da.GetType() == ft.THAMTShard && db.GetType() == ft.THAMTShard &&
+		da.GetFanout() == db.GetFanout() && da.GetHashType() == hamt.HashMurmur3 &&
+		db.GetHashType() == hamt.HashMurmur3 {
+		return d.diffShards(path, a.(*dag.ProtoNode), b.(*dag.ProtoNode), int(da.GetFanout()))
+	}
+
+	la, err := d.entries(a)
+	if err != nil {
+		return err
+	}
+	lb, err := d.entries(b)
+	if err != nil {
+		return err
+	}
+	return d.diffEntries(path, la, lb)
+}
+
+// diffShards compares the entries of the shards a and b, slot by slot.
+func (d *differ) diffShards(path string, a, b *dag.ProtoNode, fanout int) error {
+	padLen := len(fmt.Sprintf("%X", fanout-1))
+
+	slots := func(nd *dag.ProtoNode) (map[string]*node.Link, error) {
+		m := make(map[string]*node.Link)
+		for _, l := range nd.Links() {
+			if len(l.Name) < padLen {
+				return nil, fmt.Errorf("invalid link name '%s' in shard %s", l.Name, nd.Cid())
+			}
+			m[l.Name[:padLen]] = l
+		}
+		return m, nil
+	}
+
+	sa, err := slots(a)
+	if err != nil {
+		return err
+	}
+	sb, err := slots(b)
+	if err != nil {
+		return err
+	}
+
+	var idxs []string
+	for idx := range sa {
+		idxs = append(idxs, idx)
+	}
+	for idx := range sb {
+		if _, ok := sa[idx]; !ok {
+			idxs = append(idxs, idx)
+		}
+	}
+	sort.Strings(idxs)
+
+	for _, idx := range idxs {
+		la, lb := sa[idx], sb[idx]
+		if la != nil && lb != nil && la.Name == lb.Name && la.Cid.Equals(lb.Cid) {
+			continue
+		}
+
+		// both slots hold a sub-shard
+		if la != nil && lb != nil && len(la.Name) == padLen && len(lb.Name) == padLen {
+			na, err := d.getShard(la)
+			if err != nil {
+				return err
+			}
+			nb, err := d.getShard(lb)
+			if err != nil {
+				return err
+			}
+
+			if err := d.diffShards(path, na, nb, fanout); err != nil {
+				return err
+			}
+			continue
+		}
+
+		ea, err := d.slotEntries(la, padLen)
+		if err != nil {
+			return err
+		}
+		eb, err := d.slotEntries(lb, padLen)
+		if err != nil {
+			return err
+		}
+		if err := d.diffEntries(path, ea, eb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getShard returns the sub-shard l links to.
+func (d *differ) getShard(l *node.Link) (*dag.ProtoNode, error) {
+	nd, err := l.GetNode(d.ctx, d.ds)
+	if err != nil {
+		return nil, err
+	}
+
+	pbnd, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, dag.ErrNotProtobuf
+	}
+	return pbnd, nil
+}
+
+// slotEntries returns the directory entries found in the slot of a shard
+// linked to by l.
+func (d *differ) slotEntries(l *node.Link, padLen int) ([]*node.Link, error) {
+	switch {
+	case l == nil:
+		return nil, nil
+	case len(l.Name) > padLen:
+		return []*node.Link{{Name: l.Name[padLen:], Size: l.Size, Cid: l.Cid}}, nil
+	default:
+		nd, err := d.getShard(l)
+		if err != nil {
+			return nil, err
+		}
+		return d.entries(nd)
+	}
+}
+
+// entries returns the entries of the directory nd, sorted by name.
+func (d *differ) entries(nd node.Node) ([]*node.Link, error) {
+	dir, err := uio.NewDirectoryFromNode(d.ds, nd)
+	if err != nil {
+		return nil, err
+	}
+
+	links, err := dir.Links(d.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*node.Link, len(links))
+	copy(out, links)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// diffEntries compares the entries of two directories, sorted by name.
+func (d *differ) diffEntries(path string, la, lb []*node.Link) error {
+	for len(la) > 0 || len(lb) > 0 {
+		switch {
+		case len(lb) == 0 || (len(la) > 0 && la[0].Name < lb[0].Name):
+			err := d.f(&Change{
+				Type:       Removed,
+				Path:       gopath.Join(path, la[0].Name),
+				Before:     la[0].Cid,
+				BeforeSize: la[0].Size,
+			})
+			if err != nil {
+				return err
+			}
+			la = la[1:]
+		case len(la) == 0 || lb[0].Name < la[0].Name:
+			err := d.f(&Change{
+				Type:      Added,
+				Path:      gopath.Join(path, lb[0].Name),
+				After:     lb[0].Cid,
+				AfterSize: lb[0].Size,
+			})
+			if err != nil {
+				return err
+			}
+			lb = lb[1:]
+		default:
+			if err := d.diffLinks(gopath.Join(path, la[0].Name), la[0], lb[0]); err != nil {
+				return err
+			}
+			la, lb = la[1:], lb[1:]
+		}
+	}
+	return nil
+}
+
+// diffLinks compares the entries la and lb found at path.
+func (d *differ) diffLinks(path string, la, lb *node.Link) error {
+	if la.Cid.Equals(lb.Cid) {
+		return nil
+	}
+
+	if err := d.ctx.Err(); err != nil {
+		return err
+	}
+
+	a, err := la.GetNode(d.ctx, d.ds)
+	if err != nil {
+		return err
+	}
+	b, err := lb.GetNode(d.ctx, d.ds)
+	if err != nil {
+		return err
+	}
+	return d.diffNodes(path, a, b, la.Size, lb.Size)
+}
+
+func (d *differ) modified(path string, before, after *cid.Cid, bs, as uint64) error {
+	return d.f(&Change{
+		Type:       Modified,
+		Path:       path,
+		Before:     before,
+		After:      after,
+		BeforeSize: bs,
+		AfterSize:  as,
+	})
+}
+
+// dirData returns the unixfs data of nd if it is a directory.
+func dirData(nd node.Node) (*pb.Data, bool) {
+	pbnd, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, false
+	}
+
+	pbd, err := ft.FromBytes(pbnd.Data())
+	if err != nil {
+		return nil, false
+	}
+	return pbd, pbd.GetType() == ft.TDirectory || pbd.GetType() == ft.THAMTShard
+}
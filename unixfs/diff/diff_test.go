@@ -0,0 +1,160 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	dag "github.com/scroot/go-ipfs/merkledag"
+	mdtest "github.com/scroot/go-ipfs/merkledag/test"
+	ft "github.com/scroot/go-ipfs/unixfs"
+	hamt "github.com/scroot/go-ipfs/unixfs/hamt"
+
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
+)
+
+// countingDAG counts the nodes fetched from a DAGService.
+type countingDAG struct {
+	dag.DAGService
+	gets int
+}
+
+func (c *countingDAG) Get(ctx context.Context, k *cid.Cid) (node.Node, error) {
+	c.gets++
+	return c.DAGService.Get(ctx, k)
+}
+
+func file(t *testing.T, ds dag.DAGService, data string) node.Node {
+	nd := dag.NodeWithData(ft.FilePBData([]byte(data), uint64(len(data))))
+	if _, err := ds.Add(nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func dir(t *testing.T, ds dag.DAGService, entries map[string]node.Node) node.Node {
+	nd := ft.EmptyDirNode()
+	for name, c := range entries {
+		if err := nd.AddNodeLinkClean(name, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ds.Add(nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func shard(t *testing.T, ds dag.DAGService, entries map[string]node.Node) node.Node {
+	s, err := hamt.NewHamtShard(ds, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range entries {
+		if err := s.Set(context.Background(), name, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nd, err := s.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func diffAll(t *testing.T, ds dag.DAGService, a, b node.Node) []string {
+	var out []string
+	err := Diff(context.Background(), ds, a, b, func(c *Change) error {
+		if (c.Before == nil) != (c.Type == Added) || (c.After == nil) != (c.Type == Removed) {
+			t.Fatalf("unexpected CIDs for %s change of %s", c.Type, c.Path)
+		}
+		out = append(out, fmt.Sprintf("%s %s", c.Type, c.Path))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func checkChanges(t *testing.T, got []string, exp ...string) {
+	sort.Strings(exp)
+	if fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Fatalf("expected changes %q, got %q", exp, got)
+	}
+}
+
+func TestDiffDirectories(t *testing.T) {
+	ds := mdtest.Mock()
+
+	unchanged := dir(t, ds, map[string]node.Node{
+		"x": file(t, ds, "x"),
+		"y": file(t, ds, "y"),
+	})
+	a := dir(t, ds, map[string]node.Node{
+		"a":         file(t, ds, "a"),
+		"b":         file(t, ds, "b"),
+		"same":      file(t, ds, "same"),
+		"unchanged": unchanged,
+		"sub": dir(t, ds, map[string]node.Node{
+			"c": file(t, ds, "c"),
+		}),
+		"kind": file(t, ds, "file"),
+	})
+	b := dir(t, ds, map[string]node.Node{
+		"a":         file(t, ds, "a2"),
+		"same":      file(t, ds, "same"),
+		"unchanged": unchanged,
+		"d":         dir(t, ds, map[string]node.Node{"e": file(t, ds, "e")}),
+		"sub": dir(t, ds, map[string]node.Node{
+			"c": file(t, ds, "c2"),
+		}),
+		"kind": dir(t, ds, nil),
+	})
+
+	checkChanges(t, diffAll(t, ds, a, b),
+		"modified a", "removed b", "added d", "modified sub/c", "modified kind")
+	checkChanges(t, diffAll(t, ds, b, a),
+		"modified a", "added b", "removed d", "modified sub/c", "modified kind")
+	checkChanges(t, diffAll(t, ds, a, a))
+
+	// two files
+	fa, fb := file(t, ds, "1"), file(t, ds, "2")
+	checkChanges(t, diffAll(t, ds, fa, fb), "modified ")
+}
+
+func TestDiffShards(t *testing.T) {
+	mock := mdtest.Mock()
+
+	entries := make(map[string]node.Node)
+	for i := 0; i < 2000; i++ {
+		entries[fmt.Sprintf("file%d", i)] = file(t, mock, fmt.Sprintf("data%d", i))
+	}
+	a := shard(t, mock, entries)
+
+	entries["file7"] = file(t, mock, "changed")
+	delete(entries, "file42")
+	entries["new"] = file(t, mock, "new")
+	b := shard(t, mock, entries)
+
+	ds := &countingDAG{DAGService: mock}
+	checkChanges(t, diffAll(t, ds, a, b), "modified file7", "removed file42", "added new")
+
+	// only the parts of the tries leading to the changes are fetched
+	if ds.gets > 20 {
+		t.Fatalf("fetched %d nodes to diff the shards", ds.gets)
+	}
+
+	// sharded and plain directories can be compared
+	small := map[string]node.Node{
+		"file1": entries["file1"],
+		"file7": entries["file7"],
+	}
+	checkChanges(t, diffAll(t, ds, dir(t, mock, small), shard(t, mock, small)))
+	delete(small, "file1")
+	checkChanges(t, diffAll(t, ds, shard(t, mock, map[string]node.Node{"file1": entries["file1"]}), dir(t, mock, small)),
+		"removed file1", "added file7")
+}
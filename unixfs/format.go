@@ -137,6 +137,10 @@ type FSNode struct {
 
 	// node type of this node
 	Type pb.Data_DataType
+
+	// unix attributes, kept as is when the node is re-encoded
+	mode  *uint32
+	mtime *pb.UnixTime
 }
 
 func FSNodeFromBytes(b []byte) (*FSNode, error) {
@@ -151,6 +155,8 @@ func FSNodeFromBytes(b []byte) (*FSNode, error) {
 	n.blocksizes = pbn.Blocksizes
 	n.subtotal = pbn.GetFilesize() - uint64(len(n.Data))
 	n.Type = pbn.GetType()
+	n.mode = pbn.Mode
+	n.mtime = pbn.Mtime
 	return n, nil
 }
 
@@ -171,6 +177,8 @@ func (n *FSNode) GetBytes() ([]byte, error) {
 	pbn.Filesize = proto.Uint64(uint64(len(n.Data)) + n.subtotal)
 	pbn.Blocksizes = n.blocksizes
 	pbn.Data = n.Data
+	pbn.Mode = n.mode
+	pbn.Mtime = n.mtime
 	return proto.Marshal(pbn)
 }
 
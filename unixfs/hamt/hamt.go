@@ -229,6 +229,18 @@ func (ds *HamtShard) Set(ctx context.Context, name string, nd node.Node) error {
 	return ds.modifyValue(ctx, hv, name, lnk)
 }
 
+// SetLink sets 'name' to point to the target of lnk in the HAMT, without
+// fetching the node it points to. The link is copied, so that its name can
+// be set.
+func (ds *HamtShard) SetLink(ctx context.Context, name string, lnk *node.Link) error {
+	hv := &hashBits{b: hash([]byte(name))}
+
+	cp := *lnk
+	cp.Name = ds.linkNamePrefix(0) + name
+
+	return ds.modifyValue(ctx, hv, name, &cp)
+}
+
 // Remove deletes the named entry if it exists, this operation is idempotent.
 func (ds *HamtShard) Remove(ctx context.Context, name string) error {
 	hv := &hashBits{b: hash([]byte(name))}
@@ -13,6 +13,8 @@ import (
 	mdtest "github.com/scroot/go-ipfs/merkledag/test"
 	dagutils "github.com/scroot/go-ipfs/merkledag/utils"
 	ft "github.com/scroot/go-ipfs/unixfs"
+
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
 )
 
 func shuffle(seed int64, arr []string) {
@@ -158,6 +160,49 @@ func TestDirBuilding(t *testing.T) {
 	}
 }
 
+func TestSetLink(t *testing.T) {
+	ds := mdtest.Mock()
+	ctx := context.Background()
+
+	names, s, err := makeDir(ds, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child := ft.EmptyDirNode()
+	lnk, err := node.MakeLink(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnk.Name = "unchanged"
+
+	ls, _ := NewHamtShard(ds, 256)
+	for _, name := range names {
+		err := ls.SetLink(ctx, name, lnk)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if lnk.Name != "unchanged" {
+		t.Fatal("SetLink modified the given link")
+	}
+
+	nda, err := s.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ndb, err := ls.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !nda.Cid().Equals(ndb.Cid()) {
+		t.Fatal("shards built with Set and SetLink differ")
+	}
+}
+
 func TestShardReload(t *testing.T) {
 	ds := mdtest.Mock()
 	_, _ = NewHamtShard(ds, 256)
@@ -20,6 +20,7 @@ var ErrCantReadSymlinks = errors.New("cannot currently read symlinks")
 
 type DagReader interface {
 	ReadSeekCloser
+	io.ReaderAt
 	Size() uint64
 	CtxReadFull(context.Context, []byte) (int, error)
 	Offset() int64
@@ -2,9 +2,12 @@ package io
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"strings"
+	"sync"
 	"testing"
 
 	mdag "github.com/scroot/go-ipfs/merkledag"
@@ -239,6 +242,101 @@ func TestReaderSzie(t *testing.T) {
 	}
 }
 
+func TestReadAt(t *testing.T) {
+	dserv := testu.GetDAGServ()
+	size := int64(100000)
+	inbuf, node := testu.GetRandomNode(t, dserv, size)
+	ctx, closer := context.WithCancel(context.Background())
+	defer closer()
+
+	reader, err := NewDagReader(ctx, node, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent reads of random ranges don't interfere with each other,
+	// nor with the offset of the reader
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < 50; i++ {
+				off := rng.Int63n(size)
+				buf := make([]byte, rng.Intn(3000))
+				n, err := reader.ReadAt(buf, off)
+				exp := inbuf[off:]
+				if len(exp) > len(buf) {
+					exp = exp[:len(buf)]
+				}
+				if n != len(exp) || (n < len(buf) && err != io.EOF) || (n == len(buf) && err != nil) {
+					errs <- fmt.Errorf("read %d bytes at %d of %d: %d, %v", len(buf), off, size, n, err)
+					return
+				}
+				if !bytes.Equal(buf[:n], exp) {
+					errs <- fmt.Errorf("wrong data read at %d", off)
+					return
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if reader.Offset() != 0 {
+		t.Fatal("ReadAt moved the offset of the reader")
+	}
+
+	if n, err := reader.ReadAt(make([]byte, 1), size); n != 0 || err != io.EOF {
+		t.Fatalf("expected EOF reading at the end, got %d, %v", n, err)
+	}
+	if _, err := reader.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Fatal("expected an error reading at a negative offset")
+	}
+}
+
+func TestPrefetchWindow(t *testing.T) {
+	defer func(w int) { PrefetchWindow = w }(PrefetchWindow)
+
+	dserv := testu.GetDAGServ()
+	inbuf, node := testu.GetRandomNode(t, dserv, 50000)
+
+	for _, w := range []int{0, 1, 3, 1000} {
+		PrefetchWindow = w
+
+		reader, err := NewDagReader(context.Background(), node, dserv)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		outbuf, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testu.ArrComp(inbuf, outbuf); err != nil {
+			t.Fatalf("window %d: %s", w, err)
+		}
+
+		// seeking back requests the released children again
+		if _, err := reader.Seek(1000, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		outbuf, err = ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testu.ArrComp(inbuf[1000:], outbuf); err != nil {
+			t.Fatalf("window %d after seeking: %s", w, err)
+		}
+		reader.Close()
+	}
+}
+
 func readByte(t testing.TB, reader DagReader) byte {
 	out := make([]byte, 1)
 	c, err := reader.Read(out)
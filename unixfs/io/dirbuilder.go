@@ -14,8 +14,9 @@ import (
 )
 
 // ShardSplitThreshold specifies how large of an unsharded directory
-// the Directory code will generate. Adding entries over this value will
-// result in the node being restructured into a sharded object.
+// the Directory code will generate when UseHAMTSharding is set. Adding
+// entries over this value will result in the node being restructured into
+// a sharded object.
 var ShardSplitThreshold = 1000
 
 // UseHAMTSharding is a global flag that signifies whether or not to use the
@@ -30,6 +31,9 @@ type Directory struct {
 	dirnode *mdag.ProtoNode
 
 	shard *hamt.HamtShard
+
+	// splitThreshold overrides ShardSplitThreshold when set
+	splitThreshold *int
 }
 
 // NewDirectory returns a Directory. It needs a DAGService to add the Children
@@ -93,15 +97,25 @@ func (d *Directory) SetPrefix(prefix *cid.Prefix) {
 	}
 }
 
-// AddChild adds a (name, key)-pair to the root node.
+// AddChild adds a (name, key)-pair to the root node. When UseHAMTSharding
+// is set, a plain directory growing over ShardSplitThreshold entries is
+// turned into a sharded one.
 func (d *Directory) AddChild(ctx context.Context, name string, nd node.Node) error {
 	if d.shard == nil {
-		if !UseHAMTSharding {
+		_, err := d.dirnode.GetNodeLink(name)
+		exists := err == nil
+
+		threshold := ShardSplitThreshold
+		if d.splitThreshold != nil {
+			threshold = *d.splitThreshold
+		}
+
+		if !UseHAMTSharding || exists || len(d.dirnode.Links()) < threshold {
 			_ = d.dirnode.RemoveNodeLink(name)
 			return d.dirnode.AddNodeLinkClean(name, nd)
 		}
 
-		err := d.switchToSharding(ctx)
+		err = d.switchToSharding(ctx)
 		if err != nil {
 			return err
 		}
@@ -110,29 +124,38 @@ func (d *Directory) AddChild(ctx context.Context, name string, nd node.Node) err
 	return d.shard.Set(ctx, name, nd)
 }
 
+// switchToSharding moves the entries of the plain directory node into a
+// new shard. The children are linked as is, without being fetched.
 func (d *Directory) switchToSharding(ctx context.Context) error {
 	s, err := hamt.NewHamtShard(d.dserv, DefaultShardWidth)
 	if err != nil {
 		return err
 	}
 
-	d.shard = s
 	for _, lnk := range d.dirnode.Links() {
-		cnd, err := d.dserv.Get(ctx, lnk.Cid)
-		if err != nil {
-			return err
-		}
-
-		err = d.shard.Set(ctx, lnk.Name, cnd)
+		err = s.SetLink(ctx, lnk.Name, lnk)
 		if err != nil {
 			return err
 		}
 	}
 
+	d.shard = s
 	d.dirnode = nil
 	return nil
 }
 
+// SetShardSplitThreshold overrides ShardSplitThreshold for this directory.
+// With a threshold of 0, the directory is sharded as soon as an entry is
+// added to it.
+func (d *Directory) SetShardSplitThreshold(threshold int) {
+	d.splitThreshold = &threshold
+}
+
+// IsSharded returns whether the directory is a HAMT shard.
+func (d *Directory) IsSharded() bool {
+	return d.shard != nil
+}
+
 func (d *Directory) ForEachLink(ctx context.Context, f func(*node.Link) error) error {
 	if d.shard == nil {
 		for _, l := range d.dirnode.Links() {
@@ -176,9 +199,15 @@ func (d *Directory) Find(ctx context.Context, name string) (node.Node, error) {
 	return lnk.GetNode(ctx, d.dserv)
 }
 
+// RemoveChild removes the named entry. os.ErrNotExist is returned when there
+// is no such entry, whether the directory is sharded or not.
 func (d *Directory) RemoveChild(ctx context.Context, name string) error {
 	if d.shard == nil {
-		return d.dirnode.RemoveNodeLink(name)
+		err := d.dirnode.RemoveNodeLink(name)
+		if err == mdag.ErrNotFound {
+			return os.ErrNotExist
+		}
+		return err
 	}
 
 	return d.shard.Remove(ctx, name)
@@ -3,6 +3,7 @@ package io
 import (
 	"context"
 	"fmt"
+	"os"
 	"testing"
 
 	mdtest "github.com/scroot/go-ipfs/merkledag/test"
@@ -156,3 +157,90 @@ func TestDirBuilder(t *testing.T) {
 		t.Fatal("wrong number of links", len(links), count)
 	}
 }
+
+func TestDirectorySwitchToSharding(t *testing.T) {
+	defer func(use bool, threshold int) {
+		UseHAMTSharding = use
+		ShardSplitThreshold = threshold
+	}(UseHAMTSharding, ShardSplitThreshold)
+	UseHAMTSharding = true
+	ShardSplitThreshold = 10
+
+	ds := mdtest.Mock()
+	ctx := context.Background()
+
+	dir, err := NewDirectoryFromNode(ds, ft.EmptyDirNode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	child := ft.EmptyDirNode()
+	_, err = ds.Add(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		err := dir.AddChild(ctx, fmt.Sprintf("entry%d", i), child)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// replacing an entry doesn't grow the directory
+	err = dir.AddChild(ctx, "entry0", child)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dir.IsSharded() {
+		t.Fatal("directory shouldn't be sharded below the threshold")
+	}
+
+	err = dir.AddChild(ctx, "entry10", child)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !dir.IsSharded() {
+		t.Fatal("directory should be sharded over the threshold")
+	}
+
+	links, err := dir.Links(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(links) != 11 {
+		t.Fatal("wrong number of links", len(links))
+	}
+
+	for i := 0; i < 11; i++ {
+		_, err := dir.Find(ctx, fmt.Sprintf("entry%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = dir.RemoveChild(ctx, "entry3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dir.Find(ctx, "entry3"); err != os.ErrNotExist {
+		t.Fatal("expected os.ErrNotExist, got", err)
+	}
+
+	if err := dir.RemoveChild(ctx, "entry3"); err != os.ErrNotExist {
+		t.Fatal("expected os.ErrNotExist, got", err)
+	}
+}
+
+func TestRemoveMissingChild(t *testing.T) {
+	dir := NewDirectory(mdtest.Mock())
+
+	err := dir.RemoveChild(context.Background(), "missing")
+	if err != os.ErrNotExist {
+		t.Fatal("expected os.ErrNotExist, got", err)
+	}
+}
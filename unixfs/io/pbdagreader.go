@@ -5,14 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	mdag "github.com/scroot/go-ipfs/merkledag"
 	ft "github.com/scroot/go-ipfs/unixfs"
 	ftpb "github.com/scroot/go-ipfs/unixfs/pb"
 
+	node "gx/ipfs/QmPAKbSsgEX5B6fpmxa61jXYnoWzZr5sNafd3qgPiSH8Uv/go-ipld-format"
 	proto "gx/ipfs/QmZ4Qi3GaRbjcx28Sme5eMH7RQjGkt8wHxt2a65oLaeFEV/gogo-protobuf/proto"
+	cid "gx/ipfs/Qma4RJSuh7mMeJQYCqMbKzekn6EwBo7HEs5AQYjVRMQATB/go-cid"
 )
 
+// PrefetchWindow is the number of upcoming children of a file node that
+// readers request ahead of the one being read.
+var PrefetchWindow = 16
+
 // DagReader provides a way to easily read the data contained in a dag.
 type pbDagReader struct {
 	serv mdag.DAGService
@@ -27,8 +34,13 @@ type pbDagReader struct {
 	// will either be a bytes.Reader or a child DagReader
 	buf ReadSeekCloser
 
-	// NodeGetters for each of 'nodes' child links
-	promises []mdag.NodeGetter
+	// the CIDs of the child links of node
+	links []*cid.Cid
+
+	// NodeGetters for the child links of node requested so far, guarded by
+	// promisesLk as ReadAt may be called concurrently
+	promises   []mdag.NodeGetter
+	promisesLk sync.Mutex
 
 	// the index of the child link currently being read from
 	linkPosition int
@@ -45,32 +57,80 @@ type pbDagReader struct {
 
 var _ DagReader = (*pbDagReader)(nil)
 
+// NewPBFileReader returns a reader for the file node n. The children of n
+// are fetched through a single exchange session, PrefetchWindow of them
+// ahead of the one being read.
 func NewPBFileReader(ctx context.Context, n *mdag.ProtoNode, pb *ftpb.Data, serv mdag.DAGService) *pbDagReader {
 	fctx, cancel := context.WithCancel(ctx)
-	promises := mdag.GetDAG(fctx, serv, n)
+	links := make([]*cid.Cid, len(n.Links()))
+	for i, l := range n.Links() {
+		links[i] = l.Cid
+	}
 	return &pbDagReader{
 		node:     n,
-		serv:     serv,
+		serv:     mdag.NewSession(fctx, serv),
 		buf:      NewBufDagReader(pb.GetData()),
-		promises: promises,
+		links:    links,
+		promises: make([]mdag.NodeGetter, len(links)),
 		ctx:      fctx,
 		cancel:   cancel,
 		pbdata:   pb,
 	}
 }
 
+// child returns the promise of the child i, and requests the children
+// following it up to the end of the prefetch window.
+func (dr *pbDagReader) child(i int) mdag.NodeGetter {
+	dr.promisesLk.Lock()
+	defer dr.promisesLk.Unlock()
+
+	end := i + PrefetchWindow
+	if end <= i {
+		end = i + 1
+	}
+	if end > len(dr.links) {
+		end = len(dr.links)
+	}
+
+	// while reading sequentially, the window moves forward one child at a
+	// time and only its last promise is missing
+	for j := i; j < end; {
+		if dr.promises[j] != nil {
+			j++
+			continue
+		}
+		k := j
+		for k < end && dr.promises[k] == nil {
+			k++
+		}
+		copy(dr.promises[j:k], mdag.GetNodes(dr.ctx, dr.serv, dr.links[j:k]))
+		j = k
+	}
+	return dr.promises[i]
+}
+
+// release drops the promise of the child i, which holds a node already
+// read.
+func (dr *pbDagReader) release(i int) {
+	dr.promisesLk.Lock()
+	defer dr.promisesLk.Unlock()
+
+	dr.promises[i] = nil
+}
+
 // precalcNextBuf follows the next link in line and loads it from the
 // DAGService, setting the next buffer to read from
 func (dr *pbDagReader) precalcNextBuf(ctx context.Context) error {
 	dr.buf.Close() // Just to make sure
-	if dr.linkPosition >= len(dr.promises) {
+	if dr.linkPosition >= len(dr.links) {
 		return io.EOF
 	}
 
-	nxt, err := dr.promises[dr.linkPosition].Get(ctx)
+	nxt, err := dr.child(dr.linkPosition).Get(ctx)
 	if err != nil {
 		return err
 	}
+	dr.release(dr.linkPosition)
 	dr.linkPosition++
 
 	switch nxt := nxt.(type) {
@@ -178,6 +238,135 @@ func (dr *pbDagReader) Offset() int64 {
 	return dr.offset
 }
 
+// ReadAt reads len(b) bytes of the file starting at offset off. It neither
+// uses nor moves the offset of the reader, and may be called concurrently
+// with the other methods, but Close.
+func (dr *pbDagReader) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("Invalid offset")
+	}
+
+	size := int64(dr.Size())
+	if off >= size {
+		return 0, io.EOF
+	}
+	want := b
+	if int64(len(want)) > size-off {
+		want = want[:size-off]
+	}
+
+	n, err := dr.readAt(dr.ctx, dr.pbdata, len(dr.links), want, off, func(first, last int) []mdag.NodeGetter {
+		promises := make([]mdag.NodeGetter, 0, last-first)
+		for i := first; i < last; i++ {
+			promises = append(promises, dr.child(i))
+		}
+		return promises
+	})
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readAt fills b with the data of the file node described by pb, starting at
+// off. getChildren returns the promises of the children of the node between
+// first and last, out of nlinks.
+func (dr *pbDagReader) readAt(ctx context.Context, pb *ftpb.Data, nlinks int, b []byte, off int64, getChildren func(first, last int) []mdag.NodeGetter) (int, error) {
+	if len(pb.Blocksizes) != nlinks {
+		return 0, errors.New("file node has a different number of links and block sizes")
+	}
+
+	n := 0
+	data := pb.GetData()
+	if off < int64(len(data)) {
+		n = copy(b, data[off:])
+	}
+
+	// find the children holding the rest of the range
+	pos, end := off+int64(n), off+int64(len(b))
+	first, last := -1, -1
+	starts := make([]int64, len(pb.Blocksizes))
+	start := int64(len(data))
+	for i, bs := range pb.Blocksizes {
+		starts[i] = start
+		if start < end && start+int64(bs) > pos {
+			if first < 0 {
+				first = i
+			}
+			last = i + 1
+		}
+		start += int64(bs)
+	}
+	if first < 0 {
+		return n, nil
+	}
+
+	promises := getChildren(first, last)
+	for i := first; i < last; i++ {
+		nd, err := promises[i-first].Get(ctx)
+		if err != nil {
+			return n, err
+		}
+
+		buf := b[n:]
+		if rem := starts[i] + int64(pb.Blocksizes[i]) - pos; int64(len(buf)) > rem {
+			buf = buf[:rem]
+		}
+		m, err := dr.readNodeAt(ctx, nd, buf, pos-starts[i])
+		n += m
+		pos += int64(m)
+		if err != nil {
+			return n, err
+		}
+		if m < len(buf) {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, nil
+}
+
+// readNodeAt fills b with the data of the child nd of a file, starting at
+// off.
+func (dr *pbDagReader) readNodeAt(ctx context.Context, nd node.Node, b []byte, off int64) (int, error) {
+	switch nd := nd.(type) {
+	case *mdag.RawNode:
+		data := nd.RawData()
+		if off > int64(len(data)) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return copy(b, data[off:]), nil
+	case *mdag.ProtoNode:
+		pb := new(ftpb.Data)
+		if err := proto.Unmarshal(nd.Data(), pb); err != nil {
+			return 0, fmt.Errorf("incorrectly formatted protobuf: %s", err)
+		}
+
+		switch pb.GetType() {
+		case ftpb.Data_File, ftpb.Data_Raw:
+		case ftpb.Data_Directory:
+			// A directory should not exist within a file
+			return 0, ft.ErrInvalidDirLocation
+		case ftpb.Data_Metadata:
+			return 0, errors.New("shouldnt have had metadata object inside file")
+		case ftpb.Data_Symlink:
+			return 0, errors.New("shouldnt have had symlink inside file")
+		default:
+			return 0, ft.ErrUnrecognizedType
+		}
+
+		links := nd.Links()
+		return dr.readAt(ctx, pb, len(links), b, off, func(first, last int) []mdag.NodeGetter {
+			cids := make([]*cid.Cid, 0, last-first)
+			for _, l := range links[first:last] {
+				cids = append(cids, l.Cid)
+			}
+			return mdag.GetNodes(ctx, dr.serv, cids)
+		})
+	default:
+		return 0, fmt.Errorf("unrecognized node type")
+	}
+}
+
 // Seek implements io.Seeker, and will seek to a given offset in the file
 // interface matches standard unix seek
 // TODO: check if we can do relative seeks, to reduce the amount of dagreader